@@ -1,33 +1,62 @@
 package client
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"github.com/feng081212/fabric-sdk-go/fabric/endpoints"
 	"github.com/golang/protobuf/proto"
 	"github.com/feng081212/fabric-protos-go/common"
 	"github.com/feng081212/fabric-protos-go/orderer"
-	"github.com/feng081212/fabric-protos-go/peer"
+	"github.com/feng081212/fabric-protos-go/orderer/etcdraft"
 	"github.com/pkg/errors"
 )
 
 type OrdererClient struct {
 	Orderer *endpoints.Orderer
-	Signer  Signer
-	Signers []Signer
+	// Orderers are the orderers requests are sent to, Orderer is used when it is empty
+	Orderers []*endpoints.Orderer
+	// Strategy decides in which order Orderers are tried, a RandomStrategy is used when it is nil
+	Strategy OrdererSelectionStrategy
+	Signer   Signer
+	Signers  []Signer
 }
 
 // GenesisBlock 获取创世区块，区块高度为0
 func (p *OrdererClient) GenesisBlock(channelID string) (*common.Block, error) {
-	return p.GetBlock(channelID, newSpecificSeekPosition(0))
+	return p.GenesisBlockContext(context.Background(), channelID)
+}
+
+// GenesisBlockContext is GenesisBlock with a context and per-call options
+func (p *OrdererClient) GenesisBlockContext(ctx context.Context, channelID string, opts ...RequestOption) (*common.Block, error) {
+	ctx, cancel, c := p.prepare(ctx, opts)
+	defer cancel()
+
+	return c.GetBlockContext(ctx, channelID, NewSpecificSeekPosition(0))
 }
 
 func (p *OrdererClient) GetNewestBlock(channelID string) (*common.Block, error) {
-	return p.GetBlock(channelID, newNewestSeekPosition())
+	return p.GetNewestBlockContext(context.Background(), channelID)
+}
+
+// GetNewestBlockContext is GetNewestBlock with a context and per-call options
+func (p *OrdererClient) GetNewestBlockContext(ctx context.Context, channelID string, opts ...RequestOption) (*common.Block, error) {
+	ctx, cancel, c := p.prepare(ctx, opts)
+	defer cancel()
+
+	return c.GetBlockContext(ctx, channelID, NewNewestSeekPosition())
 }
 
 func (p *OrdererClient) GetConfigBlock(channelID string) (*common.Block, error) {
-	block, err := p.GetBlock(channelID, newNewestSeekPosition())
+	return p.GetConfigBlockContext(context.Background(), channelID)
+}
+
+// GetConfigBlockContext is GetConfigBlock with a context and per-call options
+func (p *OrdererClient) GetConfigBlockContext(ctx context.Context, channelID string, opts ...RequestOption) (*common.Block, error) {
+	ctx, cancel, c := p.prepare(ctx, opts)
+	defer cancel()
+
+	block, err := c.GetBlockContext(ctx, channelID, NewNewestSeekPosition())
 	if err != nil {
 		return nil, err
 	}
@@ -38,12 +67,19 @@ func (p *OrdererClient) GetConfigBlock(channelID string) (*common.Block, error)
 	if lc == block.Header.Number {
 		return block, nil
 	}
-	return p.GetBlock(channelID, newSpecificSeekPosition(lc))
+	return c.GetBlockContext(ctx, channelID, NewSpecificSeekPosition(lc))
 }
 
 func (p *OrdererClient) GetBlock(channelID string, position *orderer.SeekPosition) (*common.Block, error) {
+	return p.GetBlockContext(context.Background(), channelID, position)
+}
+
+// GetBlockContext is GetBlock with a context and per-call options
+func (p *OrdererClient) GetBlockContext(ctx context.Context, channelID string, position *orderer.SeekPosition, opts ...RequestOption) (*common.Block, error) {
+	ctx, cancel, c := p.prepare(ctx, opts)
+	defer cancel()
 
-	payload, err := p.CreatePayload(common.HeaderType_DELIVER_SEEK_INFO, channelID, func() ([]byte, error) {
+	payload, err := c.CreatePayload(common.HeaderType_DELIVER_SEEK_INFO, channelID, func() ([]byte, error) {
 
 		seekInfo := &orderer.SeekInfo{
 			Start:    position,
@@ -62,69 +98,64 @@ func (p *OrdererClient) GetBlock(channelID string, position *orderer.SeekPositio
 		return nil, errors.WithMessage(err, "CreatePayload failed")
 	}
 
-	return p.SendPayload(context.Background(), payload)
+	return c.SendPayload(ctx, payload)
 }
 
 func (p *OrdererClient) DeleteOrganizationalFromConsortium(consortium, mspID string) (*common.Status, error) {
-	channelID := "genesis"
+	return p.DeleteOrganizationalFromConsortiumContext(context.Background(), consortium, mspID)
+}
 
-	block, err := p.GetConfigBlock(channelID)
-	if err != nil {
-		return nil, err
-	}
+// DeleteOrganizationalFromConsortiumContext is DeleteOrganizationalFromConsortium with a context and per-call options
+func (p *OrdererClient) DeleteOrganizationalFromConsortiumContext(ctx context.Context, consortium, mspID string, opts ...RequestOption) (*common.Status, error) {
+	ctx, cancel, c := p.prepare(ctx, opts)
+	defer cancel()
 
-	return p.UpdateChannelConfig(channelID, block, func(envelope *common.ConfigEnvelope) error {
-		delete(envelope.Config.ChannelGroup.Groups["Consortiums"].Groups[consortium].Groups, mspID)
-		return nil
+	return c.EditChannelConfigContext(ctx, "genesis", func(editor *ConfigEditor) error {
+		return editor.Consortium(consortium).RemoveOrganization(mspID)
 	})
 }
 
 func (p *OrdererClient) AddOrganizationalToConsortium(consortium string, organization *Organization) (*common.Status, error) {
+	return p.AddOrganizationalToConsortiumContext(context.Background(), consortium, organization)
+}
 
-	channelID := "genesis"
-	orgGroup, err := organization.BuildConfigGroupForConsortium()
-
-	if err != nil {
-		return nil, err
-	}
-
-	block, err := p.GetConfigBlock(channelID)
-	if err != nil {
-		return nil, err
-	}
+// AddOrganizationalToConsortiumContext is AddOrganizationalToConsortium with a context and per-call options
+func (p *OrdererClient) AddOrganizationalToConsortiumContext(ctx context.Context, consortium string, organization *Organization, opts ...RequestOption) (*common.Status, error) {
+	ctx, cancel, c := p.prepare(ctx, opts)
+	defer cancel()
 
-	return p.UpdateChannelConfig(channelID, block, func(envelope *common.ConfigEnvelope) error {
-		_, b := envelope.Config.ChannelGroup.Groups[ConsortiumsGroupKey].Groups[consortium].Groups[organization.ID]
-		if b {
-			return fmt.Errorf("consortium[%s] is already exist organizational[%s]", consortium, organization.ID)
-		}
-		envelope.Config.ChannelGroup.Groups["Consortiums"].Groups[consortium].Groups[organization.ID] = orgGroup
-		return nil
+	return c.EditChannelConfigContext(ctx, "genesis", func(editor *ConfigEditor) error {
+		return editor.Consortium(consortium).AddOrganization(organization)
 	})
 }
 
 func (p *OrdererClient) UpdateOrganizationalOfConsortium(consortium, mspID string, updateFunc func(group *common.ConfigGroup) error) (*common.Status, error) {
-	channelID := "genesis"
+	return p.UpdateOrganizationalOfConsortiumContext(context.Background(), consortium, mspID, updateFunc)
+}
 
-	block, err := p.GetConfigBlock(channelID)
-	if err != nil {
-		return nil, err
-	}
+// UpdateOrganizationalOfConsortiumContext is UpdateOrganizationalOfConsortium with a context and per-call options
+func (p *OrdererClient) UpdateOrganizationalOfConsortiumContext(ctx context.Context, consortium, mspID string, updateFunc func(group *common.ConfigGroup) error, opts ...RequestOption) (*common.Status, error) {
+	ctx, cancel, c := p.prepare(ctx, opts)
+	defer cancel()
 
-	return p.UpdateChannelConfig(channelID, block, func(envelope *common.ConfigEnvelope) error {
-		v, b := envelope.Config.ChannelGroup.Groups[ConsortiumsGroupKey].Groups[consortium].Groups[mspID]
-		if !b {
-			return fmt.Errorf("consortium[%s] do not have organizational[%s]", consortium, mspID)
-		}
-		err = updateFunc(v)
+	return c.EditChannelConfigContext(ctx, "genesis", func(editor *ConfigEditor) error {
+		group, err := editor.Consortium(consortium).Organization(mspID).Group()
 		if err != nil {
 			return err
 		}
-		return nil
+		return updateFunc(group)
 	})
 }
 
 func (p *OrdererClient) CreateChannel(channelID string, channel *Channel) (*common.Status, error) {
+	return p.CreateChannelContext(context.Background(), channelID, channel)
+}
+
+// CreateChannelContext is CreateChannel with a context and per-call options
+func (p *OrdererClient) CreateChannelContext(ctx context.Context, channelID string, channel *Channel, opts ...RequestOption) (*common.Status, error) {
+	ctx, cancel, c := p.prepare(ctx, opts)
+	defer cancel()
+
 	configGroup, e := channel.BuildConfigGroup()
 	if e != nil {
 		return nil, e
@@ -152,124 +183,255 @@ func (p *OrdererClient) CreateChannel(channelID string, channel *Channel) (*comm
 		return nil, err
 	}
 
-	return p.UpdateChannel(channelID, configBytes)
+	return c.UpdateChannelContext(ctx, channelID, configBytes)
 }
 
 func (p *OrdererClient) CreateChannelWithBlock(channelID string, chConfigTx []byte) (*common.Status, error) {
-	return p.UpdateChannel(channelID, chConfigTx)
+	return p.CreateChannelWithBlockContext(context.Background(), channelID, chConfigTx)
 }
 
-func (p *OrdererClient) AddOrganizationalToChannel(channelID string, organization *Organization) (*common.Status, error) {
+// CreateChannelWithBlockContext is CreateChannelWithBlock with a context and per-call options
+func (p *OrdererClient) CreateChannelWithBlockContext(ctx context.Context, channelID string, chConfigTx []byte, opts ...RequestOption) (*common.Status, error) {
+	ctx, cancel, c := p.prepare(ctx, opts)
+	defer cancel()
 
-	orgGroup, err := organization.BuildConfigGroupForApplication()
+	return c.UpdateChannelContext(ctx, channelID, chConfigTx)
+}
 
-	if err != nil {
-		return nil, err
-	}
+func (p *OrdererClient) AddOrganizationalToChannel(channelID string, organization *Organization) (*common.Status, error) {
+	return p.AddOrganizationalToChannelContext(context.Background(), channelID, organization)
+}
 
-	block, err := p.GetConfigBlock(channelID)
-	if err != nil {
-		return nil, err
-	}
+// AddOrganizationalToChannelContext is AddOrganizationalToChannel with a context and per-call options
+func (p *OrdererClient) AddOrganizationalToChannelContext(ctx context.Context, channelID string, organization *Organization, opts ...RequestOption) (*common.Status, error) {
+	ctx, cancel, c := p.prepare(ctx, opts)
+	defer cancel()
 
-	return p.UpdateChannelConfig(channelID, block, func(envelope *common.ConfigEnvelope) error {
-		_, b := envelope.Config.ChannelGroup.Groups[ApplicationGroupKey].Groups[organization.ID]
-		if b {
-			return fmt.Errorf("channel[%s] is already exist organizational[%s]", channelID, organization.ID)
-		}
-		envelope.Config.ChannelGroup.Groups[ApplicationGroupKey].Groups[organization.ID] = orgGroup
-		return nil
+	return c.EditChannelConfigContext(ctx, channelID, func(editor *ConfigEditor) error {
+		return editor.Application().AddOrganization(organization)
 	})
 }
 
 func (p *OrdererClient) DeleteOrganizationalToChannel(channelID, mspID string) (*common.Status, error) {
+	return p.DeleteOrganizationalToChannelContext(context.Background(), channelID, mspID)
+}
 
-	block, err := p.GetConfigBlock(channelID)
-	if err != nil {
-		return nil, err
-	}
+// DeleteOrganizationalToChannelContext is DeleteOrganizationalToChannel with a context and per-call options
+func (p *OrdererClient) DeleteOrganizationalToChannelContext(ctx context.Context, channelID, mspID string, opts ...RequestOption) (*common.Status, error) {
+	ctx, cancel, c := p.prepare(ctx, opts)
+	defer cancel()
 
-	return p.UpdateChannelConfig(channelID, block, func(envelope *common.ConfigEnvelope) error {
-		_, b := envelope.Config.ChannelGroup.Groups[ApplicationGroupKey].Groups[mspID]
-		if !b {
-			return fmt.Errorf("channel[%s] do not have organizational[%s]", channelID, mspID)
-		}
-		delete(envelope.Config.ChannelGroup.Groups[ApplicationGroupKey].Groups, mspID)
-		return nil
+	return c.EditChannelConfigContext(ctx, channelID, func(editor *ConfigEditor) error {
+		return editor.Application().RemoveOrganization(mspID)
 	})
 }
 
+// SetAnchorPeer replaces the anchor peers of the organization on the channel. At least one anchor
+// peer is required, an empty list is an error and does not remove the anchor peers.
 func (p *OrdererClient) SetAnchorPeer(mspID, channelID string, anchors ...*AnchorPeer) (*common.Status, error) {
+	return p.SetAnchorPeerContext(context.Background(), mspID, channelID, anchors)
+}
+
+// SetAnchorPeerContext is SetAnchorPeer with a context and per-call options
+func (p *OrdererClient) SetAnchorPeerContext(ctx context.Context, mspID, channelID string, anchors []*AnchorPeer, opts ...RequestOption) (*common.Status, error) {
+	ctx, cancel, c := p.prepare(ctx, opts)
+	defer cancel()
+
 	if len(anchors) == 0 {
 		return nil, fmt.Errorf("set anchor peer error to channel[%s] of org[%s]: anchor is nil", channelID, mspID)
 	}
 
-	block, e := p.GetConfigBlock(channelID)
-	if e != nil {
-		return nil, errors.Wrapf(e, "pull config block of channel[%s] error", channelID)
+	return c.EditChannelConfigContext(ctx, channelID, func(editor *ConfigEditor) error {
+		return editor.Application().Organization(mspID).SetAnchorPeers(anchors...)
+	})
+}
+
+func (p *OrdererClient) SetAnchorPeerWithBlock(channelID string, chConfigTx []byte) (*common.Status, error) {
+	return p.SetAnchorPeerWithBlockContext(context.Background(), channelID, chConfigTx)
+}
+
+// SetAnchorPeerWithBlockContext is SetAnchorPeerWithBlock with a context and per-call options
+func (p *OrdererClient) SetAnchorPeerWithBlockContext(ctx context.Context, channelID string, chConfigTx []byte, opts ...RequestOption) (*common.Status, error) {
+	ctx, cancel, c := p.prepare(ctx, opts)
+	defer cancel()
+
+	return c.UpdateChannelContext(ctx, channelID, chConfigTx)
+}
+
+func (p *OrdererClient) EditChannelConfig(channelID string, editFunc func(*ConfigEditor) error) (*common.Status, error) {
+	return p.EditChannelConfigContext(context.Background(), channelID, editFunc)
+}
+
+// EditChannelConfigContext pulls the config block of the channel, edits its config with editFunc
+// and submits the resulting config update. Edits changing more than one Raft consenter are refused.
+func (p *OrdererClient) EditChannelConfigContext(ctx context.Context, channelID string, editFunc func(*ConfigEditor) error, opts ...RequestOption) (*common.Status, error) {
+	ctx, cancel, c := p.prepare(ctx, opts)
+	defer cancel()
+
+	block, err := c.GetConfigBlockContext(ctx, channelID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "pull config block of channel[%s] error", channelID)
 	}
 
-	return p.UpdateChannelConfig(channelID, block, func(configEnvelope *common.ConfigEnvelope) error {
-		v, b := configEnvelope.Config.ChannelGroup.Groups[ApplicationGroupKey].Groups[mspID]
-		if !b {
-			return fmt.Errorf("org[%s] is not in channel[%s]", mspID, channelID)
+	return c.UpdateChannelConfigContext(ctx, channelID, block, func(envelope *common.ConfigEnvelope) error {
+		original := proto.Clone(envelope.Config).(*common.Config)
+		if err := editFunc(NewConfigEditor(envelope.Config)); err != nil {
+			return err
 		}
+		return CheckConsenterChange(original, envelope.Config)
+	})
+}
 
-		var anchorPeers []*peer.AnchorPeer
-		for _, anchorPeer := range anchors {
-			anchorPeers = append(anchorPeers, &peer.AnchorPeer{
-				Host: anchorPeer.Host,
-				Port: int32(anchorPeer.Port),
-			})
-		}
-		_ = addValue(v, AdminsPolicyKey, AnchorPeersKey, &peer.AnchorPeers{AnchorPeers: anchorPeers})
-		return nil
+// AddConsenter adds an orderer node to the Raft cluster of the channel. The system channel and
+// each application channel the node serves must be updated separately.
+func (p *OrdererClient) AddConsenter(channelID string, endpoint *OrdererEndpoint) (*common.Status, error) {
+	return p.AddConsenterContext(context.Background(), channelID, endpoint)
+}
+
+// AddConsenterContext is AddConsenter with a context and per-call options
+func (p *OrdererClient) AddConsenterContext(ctx context.Context, channelID string, endpoint *OrdererEndpoint, opts ...RequestOption) (*common.Status, error) {
+	ctx, cancel, c := p.prepare(ctx, opts)
+	defer cancel()
+
+	return c.EditChannelConfigContext(ctx, channelID, func(editor *ConfigEditor) error {
+		return editor.Orderer().AddConsenter(endpoint)
 	})
 }
 
-func (p *OrdererClient) SetAnchorPeerWithBlock(channelID string, chConfigTx []byte) (*common.Status, error) {
-	return p.UpdateChannel(channelID, chConfigTx)
+// RemoveConsenter removes an orderer node from the Raft cluster of the channel. With
+// WithConsenterAdmins it is refused if the remaining nodes that are up are not a quorum of the
+// new cluster.
+func (p *OrdererClient) RemoveConsenter(channelID, host string, port uint32) (*common.Status, error) {
+	return p.RemoveConsenterContext(context.Background(), channelID, host, port)
 }
 
-func (p *OrdererClient) UpdateChannelConfig(channelID string, block *common.Block, updateFunc func(*common.ConfigEnvelope) error) (*common.Status, error) {
-	envelope := &common.Envelope{}
-	if err := proto.Unmarshal(block.Data.Data[0], envelope); err != nil {
-		return nil, err
-	}
-	payload := &common.Payload{}
-	if err := proto.Unmarshal(envelope.Payload, payload); err != nil {
-		return nil, err
+// RemoveConsenterContext is RemoveConsenter with a context and per-call options
+func (p *OrdererClient) RemoveConsenterContext(ctx context.Context, channelID, host string, port uint32, opts ...RequestOption) (*common.Status, error) {
+	ctx, cancel, c := p.prepare(ctx, opts)
+	defer cancel()
+
+	admins := newRequestOptions(opts).consenterAdmins
+	return c.EditChannelConfigContext(ctx, channelID, func(editor *ConfigEditor) error {
+		if admins != nil {
+			metadata, err := editor.Orderer().RaftMetadata()
+			if err != nil {
+				return err
+			}
+			if err = CheckConsenterRemoval(ctx, channelID, metadata, host, port, admins); err != nil {
+				return err
+			}
+		}
+		return editor.Orderer().RemoveConsenter(host, port)
+	})
+}
+
+// CheckConsenterRemoval checks that the consenters that remain after removing the consenter with
+// host and port are a quorum of the new cluster when only the consenters that are up are counted.
+// A consenter is up when its admin endpoint reports the channel as active with a consenter
+// relation. admins maps the host:port of the consenters to clients of their admin endpoints,
+// consenters without a client count as down.
+func CheckConsenterRemoval(ctx context.Context, channelID string, metadata *etcdraft.ConfigMetadata, host string, port uint32, admins map[string]*OrdererAdminClient) error {
+	var remaining []string
+	for _, consenter := range metadata.Consenters {
+		if consenter.Host != host || consenter.Port != port {
+			remaining = append(remaining, fmt.Sprintf("%s:%d", consenter.Host, consenter.Port))
+		}
 	}
-	configEnvelope := &common.ConfigEnvelope{}
-	if err := proto.Unmarshal(payload.Data, configEnvelope); err != nil {
-		return nil, err
+	if len(remaining) == len(metadata.Consenters) {
+		return errors.Errorf("consenter [%s:%d] does not exist", host, port)
 	}
-	configEnvelopeNew := &common.ConfigEnvelope{}
-	if err := proto.Unmarshal(payload.Data, configEnvelopeNew); err != nil {
-		return nil, err
+
+	up := 0
+	var down []string
+	for _, consenter := range remaining {
+		admin, ok := admins[consenter]
+		if !ok {
+			down = append(down, consenter+" (no admin endpoint)")
+			continue
+		}
+		info, err := admin.GetChannelInfoContext(ctx, channelID)
+		if err != nil {
+			down = append(down, fmt.Sprintf("%s (%s)", consenter, err))
+			continue
+		}
+		if info.Status != "active" || info.ConsensusRelation != "consenter" {
+			down = append(down, fmt.Sprintf("%s (%s %s)", consenter, info.Status, info.ConsensusRelation))
+			continue
+		}
+		up++
 	}
-	if err := updateFunc(configEnvelopeNew); err != nil {
-		return nil, err
+
+	if quorum := len(remaining)/2 + 1; up < quorum {
+		return errors.Errorf("removing consenter [%s:%d] leaves %d of %d consenters up, the new cluster needs a quorum of %d, down are %v",
+			host, port, up, len(remaining), quorum, down)
 	}
+	return nil
+}
 
-	updateConfig, err := Compute(configEnvelope.Config, configEnvelopeNew.Config)
+// UpdateConsenterTLSCerts rotates the TLS certificates of the orderer node with the host and port
+// of endpoint
+func (p *OrdererClient) UpdateConsenterTLSCerts(channelID string, endpoint *OrdererEndpoint) (*common.Status, error) {
+	return p.UpdateConsenterTLSCertsContext(context.Background(), channelID, endpoint)
+}
+
+// UpdateConsenterTLSCertsContext is UpdateConsenterTLSCerts with a context and per-call options
+func (p *OrdererClient) UpdateConsenterTLSCertsContext(ctx context.Context, channelID string, endpoint *OrdererEndpoint, opts ...RequestOption) (*common.Status, error) {
+	ctx, cancel, c := p.prepare(ctx, opts)
+	defer cancel()
+
+	return c.EditChannelConfigContext(ctx, channelID, func(editor *ConfigEditor) error {
+		return editor.Orderer().UpdateConsenterTLSCerts(endpoint)
+	})
+}
+
+func (p *OrdererClient) SetRaftOptions(channelID string, options *etcdraft.Options) (*common.Status, error) {
+	return p.SetRaftOptionsContext(context.Background(), channelID, options)
+}
+
+// SetRaftOptionsContext is SetRaftOptions with a context and per-call options
+func (p *OrdererClient) SetRaftOptionsContext(ctx context.Context, channelID string, options *etcdraft.Options, opts ...RequestOption) (*common.Status, error) {
+	ctx, cancel, c := p.prepare(ctx, opts)
+	defer cancel()
+
+	return c.EditChannelConfigContext(ctx, channelID, func(editor *ConfigEditor) error {
+		return editor.Orderer().SetRaftOptions(options)
+	})
+}
+
+func (p *OrdererClient) UpdateChannelConfig(channelID string, block *common.Block, updateFunc func(*common.ConfigEnvelope) error) (*common.Status, error) {
+	return p.UpdateChannelConfigContext(context.Background(), channelID, block, updateFunc)
+}
+
+// UpdateChannelConfigContext is UpdateChannelConfig with a context and per-call options
+func (p *OrdererClient) UpdateChannelConfigContext(ctx context.Context, channelID string, block *common.Block, updateFunc func(*common.ConfigEnvelope) error, opts ...RequestOption) (*common.Status, error) {
+	ctx, cancel, c := p.prepare(ctx, opts)
+	defer cancel()
+
+	updateConfig, err := CreateConfigUpdate(channelID, block, updateFunc)
 	if err != nil {
 		return nil, err
 	}
-	updateConfig.ChannelId = channelID
 
 	configBytes, err := proto.Marshal(updateConfig)
 	if err != nil {
 		return nil, err
 	}
 
-	return p.UpdateChannel(channelID, configBytes)
+	return c.UpdateChannelContext(ctx, channelID, configBytes)
 }
 
 func (p *OrdererClient) UpdateChannel(channelID string, updateData []byte) (*common.Status, error) {
-	payload, err := p.CreatePayload(common.HeaderType_CONFIG_UPDATE, channelID, func() ([]byte, error) {
+	return p.UpdateChannelContext(context.Background(), channelID, updateData)
+}
+
+// UpdateChannelContext is UpdateChannel with a context and per-call options
+func (p *OrdererClient) UpdateChannelContext(ctx context.Context, channelID string, updateData []byte, opts ...RequestOption) (*common.Status, error) {
+	ctx, cancel, c := p.prepare(ctx, opts)
+	defer cancel()
+
+	payload, err := c.CreatePayload(common.HeaderType_CONFIG_UPDATE, channelID, func() ([]byte, error) {
 		var configSignatures []*common.ConfigSignature
-		for _, signer := range p.Signers {
+		for _, signer := range c.Signers {
 			configSignature, e := CreateConfigSignature(signer, updateData)
 			if e != nil {
 				return nil, e
@@ -292,7 +454,7 @@ func (p *OrdererClient) UpdateChannel(channelID string, updateData []byte) (*com
 		return nil, errors.WithMessage(err, "CreatePayload failed")
 	}
 
-	return p.BroadcastPayload(context.Background(), payload)
+	return c.BroadcastPayload(ctx, payload)
 }
 
 func (p *OrdererClient) CreatePayload(headerType common.HeaderType, channelID string, dataFunc func() ([]byte, error)) (*common.Payload, error) {
@@ -307,10 +469,26 @@ func (p *OrdererClient) CreatePayload(headerType common.HeaderType, channelID st
 		return nil, errors.WithMessage(err, "hash function creation failed")
 	}
 
-	tlsClientCertsHash, err := tlsCertHash(p.Orderer.GetTlsClientCerts())
+	targets := p.orderers()
+	if len(targets) == 0 {
+		return nil, errors.New("orderer not set")
+	}
+
+	// the payload is bound to the TLS client certificate, which has to be the same for every
+	// orderer the payload may be sent to
+	tlsClientCertsHash, err := tlsCertHash(targets[0].GetTlsClientCerts())
 	if err != nil {
 		return nil, errors.WithMessage(err, "failed to get tls cert hash")
 	}
+	for _, target := range targets[1:] {
+		hash, err := tlsCertHash(target.GetTlsClientCerts())
+		if err != nil {
+			return nil, errors.WithMessage(err, "failed to get tls cert hash")
+		}
+		if !bytes.Equal(hash, tlsClientCertsHash) {
+			return nil, errors.Errorf("orderers [%s] and [%s] use different TLS client certificates", targets[0].URL(), target.URL())
+		}
+	}
 
 	data, err := dataFunc()
 	if err != nil {
@@ -345,32 +523,51 @@ func CreateConfigSignature(signer Signer, configtx []byte) (*common.ConfigSignat
 	return &configSignature, nil
 }
 
-// BroadcastPayload will send the given payload to some orderer, picking random endpoints
-// until all are exhausted
-func (p *OrdererClient) BroadcastPayload(context context.Context, payload *common.Payload) (*common.Status, error) {
+// BroadcastPayload will send the given payload to some orderer, picking endpoints in the order
+// of the Strategy until one accepts it or all are exhausted
+func (p *OrdererClient) BroadcastPayload(ctx context.Context, payload *common.Payload, opts ...RequestOption) (*common.Status, error) {
+	ctx, cancel, c := p.prepare(ctx, opts)
+	defer cancel()
+
 	// Check if orderers are defined
-	if p.Orderer == nil {
+	if len(c.orderers()) == 0 {
 		return nil, errors.New("orderer not set")
 	}
 
-	envelope, err := signPayload(p.Signer, payload)
+	envelope, err := signPayload(c.Signer, payload)
 	if err != nil {
 		return nil, err
 	}
 
-	return p.Orderer.SendBroadcast(context, envelope)
+	res, err := c.invokeOrderers(ctx, func(orderer *endpoints.Orderer) (interface{}, error) {
+		return orderer.SendBroadcast(ctx, envelope)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res.(*common.Status), nil
 }
 
-// SendPayload sends the given payload to each orderer and returns a block response
-func (p *OrdererClient) SendPayload(context context.Context, payload *common.Payload) (*common.Block, error) {
-	if p.Orderer == nil {
+// SendPayload sends the given payload to some orderer, picking endpoints in the order of the
+// Strategy, and returns a block response
+func (p *OrdererClient) SendPayload(ctx context.Context, payload *common.Payload, opts ...RequestOption) (*common.Block, error) {
+	ctx, cancel, c := p.prepare(ctx, opts)
+	defer cancel()
+
+	if len(c.orderers()) == 0 {
 		return nil, errors.New("orderer not set")
 	}
 
-	envelope, err := signPayload(p.Signer, payload)
+	envelope, err := signPayload(c.Signer, payload)
 	if err != nil {
 		return nil, err
 	}
 
-	return p.Orderer.SendDeliver(context, envelope)
+	res, err := c.invokeOrderers(ctx, func(orderer *endpoints.Orderer) (interface{}, error) {
+		return orderer.SendDeliver(ctx, envelope)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res.(*common.Block), nil
 }
@@ -1,7 +1,9 @@
 package client
 
 import (
+	"bytes"
 	"context"
+	ccpackager "github.com/feng081212/fabric-sdk-go/fabric/chaincode/ccpackager/lifecycle"
 	//logging "github.com/feng081212/fabric-sdk-go/common/logger"
 	"github.com/feng081212/fabric-sdk-go/fabric/endpoints"
 	"github.com/golang/protobuf/proto"
@@ -10,6 +12,7 @@ import (
 	"github.com/feng081212/fabric-protos-go/peer/lifecycle"
 	"github.com/pkg/errors"
 	"net/http"
+	"strconv"
 )
 
 //var logger = logging.NewLogger("fabsdk/client/peer")
@@ -20,6 +23,13 @@ type PeerClient struct {
 }
 
 func (p *PeerClient) QueryChannels() (*peer.ChannelQueryResponse, error) {
+	return p.QueryChannelsContext(context.Background())
+}
+
+// QueryChannelsContext is QueryChannels with a context and per-call options
+func (p *PeerClient) QueryChannelsContext(ctx context.Context, opts ...RequestOption) (*peer.ChannelQueryResponse, error) {
+	ctx, cancel, c := p.prepare(ctx, opts)
+	defer cancel()
 
 	request := &endpoints.ChaincodeInvokeRequest{
 		ChaincodeID: "cscc",
@@ -28,7 +38,7 @@ func (p *PeerClient) QueryChannels() (*peer.ChannelQueryResponse, error) {
 
 	result := &peer.ChannelQueryResponse{}
 
-	_, _, _, err := p.process(context.Background(), "", request, result)
+	_, _, _, err := c.process(ctx, "", request, result)
 	if err != nil {
 		return nil, err
 	}
@@ -37,9 +47,16 @@ func (p *PeerClient) QueryChannels() (*peer.ChannelQueryResponse, error) {
 }
 
 func (p *PeerClient) JoinChannel(channelID string, ordererClient *OrdererClient) error {
+	return p.JoinChannelContext(context.Background(), channelID, ordererClient)
+}
+
+// JoinChannelContext is JoinChannel with a context and per-call options
+func (p *PeerClient) JoinChannelContext(ctx context.Context, channelID string, ordererClient *OrdererClient, opts ...RequestOption) error {
+	ctx, cancel, c := p.prepare(ctx, opts)
+	defer cancel()
 
 	// 加入通道必须从创世区块开始拉取数据
-	block, err := ordererClient.GenesisBlock(channelID)
+	block, err := ordererClient.GenesisBlockContext(ctx, channelID, opts...)
 	if err != nil {
 		return errors.WithMessage(err, "missing block input parameter with the required genesis block")
 	}
@@ -55,11 +72,143 @@ func (p *PeerClient) JoinChannel(channelID string, ordererClient *OrdererClient)
 		Args:        [][]byte{genesisBlockBytes},
 	}
 
-	_, _, _, err = p.process(context.Background(), "", request, nil)
+	_, _, _, err = c.process(ctx, "", request, nil)
 	return err
 }
 
+func (p *PeerClient) GetChainInfo(channelID string) (*common.BlockchainInfo, error) {
+	return p.GetChainInfoContext(context.Background(), channelID)
+}
+
+// GetChainInfoContext is GetChainInfo with a context and per-call options
+func (p *PeerClient) GetChainInfoContext(ctx context.Context, channelID string, opts ...RequestOption) (*common.BlockchainInfo, error) {
+	ctx, cancel, c := p.prepare(ctx, opts)
+	defer cancel()
+
+	request := &endpoints.ChaincodeInvokeRequest{
+		ChaincodeID: "qscc",
+		Fcn:         "GetChainInfo",
+		Args:        [][]byte{[]byte(channelID)},
+	}
+
+	result := &common.BlockchainInfo{}
+
+	_, _, _, err := c.process(ctx, channelID, request, result)
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func (p *PeerClient) GetBlockByNumber(channelID string, blockNumber uint64) (*common.Block, error) {
+	return p.GetBlockByNumberContext(context.Background(), channelID, blockNumber)
+}
+
+// GetBlockByNumberContext is GetBlockByNumber with a context and per-call options
+func (p *PeerClient) GetBlockByNumberContext(ctx context.Context, channelID string, blockNumber uint64, opts ...RequestOption) (*common.Block, error) {
+	ctx, cancel, c := p.prepare(ctx, opts)
+	defer cancel()
+
+	request := &endpoints.ChaincodeInvokeRequest{
+		ChaincodeID: "qscc",
+		Fcn:         "GetBlockByNumber",
+		Args:        [][]byte{[]byte(channelID), []byte(strconv.FormatUint(blockNumber, 10))},
+	}
+
+	result := &common.Block{}
+
+	_, _, _, err := c.process(ctx, channelID, request, result)
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func (p *PeerClient) GetBlockByHash(channelID string, blockHash []byte) (*common.Block, error) {
+	return p.GetBlockByHashContext(context.Background(), channelID, blockHash)
+}
+
+// GetBlockByHashContext is GetBlockByHash with a context and per-call options
+func (p *PeerClient) GetBlockByHashContext(ctx context.Context, channelID string, blockHash []byte, opts ...RequestOption) (*common.Block, error) {
+	ctx, cancel, c := p.prepare(ctx, opts)
+	defer cancel()
+
+	request := &endpoints.ChaincodeInvokeRequest{
+		ChaincodeID: "qscc",
+		Fcn:         "GetBlockByHash",
+		Args:        [][]byte{[]byte(channelID), blockHash},
+	}
+
+	result := &common.Block{}
+
+	_, _, _, err := c.process(ctx, channelID, request, result)
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func (p *PeerClient) GetTransactionByID(channelID, txID string) (*peer.ProcessedTransaction, error) {
+	return p.GetTransactionByIDContext(context.Background(), channelID, txID)
+}
+
+// GetTransactionByIDContext is GetTransactionByID with a context and per-call options
+func (p *PeerClient) GetTransactionByIDContext(ctx context.Context, channelID, txID string, opts ...RequestOption) (*peer.ProcessedTransaction, error) {
+	ctx, cancel, c := p.prepare(ctx, opts)
+	defer cancel()
+
+	request := &endpoints.ChaincodeInvokeRequest{
+		ChaincodeID: "qscc",
+		Fcn:         "GetTransactionByID",
+		Args:        [][]byte{[]byte(channelID), []byte(txID)},
+	}
+
+	result := &peer.ProcessedTransaction{}
+
+	_, _, _, err := c.process(ctx, channelID, request, result)
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func (p *PeerClient) GetBlockByTxID(channelID, txID string) (*common.Block, error) {
+	return p.GetBlockByTxIDContext(context.Background(), channelID, txID)
+}
+
+// GetBlockByTxIDContext is GetBlockByTxID with a context and per-call options
+func (p *PeerClient) GetBlockByTxIDContext(ctx context.Context, channelID, txID string, opts ...RequestOption) (*common.Block, error) {
+	ctx, cancel, c := p.prepare(ctx, opts)
+	defer cancel()
+
+	request := &endpoints.ChaincodeInvokeRequest{
+		ChaincodeID: "qscc",
+		Fcn:         "GetBlockByTxID",
+		Args:        [][]byte{[]byte(channelID), []byte(txID)},
+	}
+
+	result := &common.Block{}
+
+	_, _, _, err := c.process(ctx, channelID, request, result)
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
 func (p *PeerClient) GetInstalledChainCodePackageByID(packageID string) (*lifecycle.GetInstalledChaincodePackageResult, error) {
+	return p.GetInstalledChainCodePackageByIDContext(context.Background(), packageID)
+}
+
+// GetInstalledChainCodePackageByIDContext is GetInstalledChainCodePackageByID with a context and per-call options
+func (p *PeerClient) GetInstalledChainCodePackageByIDContext(ctx context.Context, packageID string, opts ...RequestOption) (*lifecycle.GetInstalledChaincodePackageResult, error) {
+	ctx, cancel, c := p.prepare(ctx, opts)
+	defer cancel()
 
 	args := &lifecycle.GetInstalledChaincodePackageArgs{
 		PackageId: packageID,
@@ -73,7 +222,7 @@ func (p *PeerClient) GetInstalledChainCodePackageByID(packageID string) (*lifecy
 
 	result := &lifecycle.GetInstalledChaincodePackageResult{}
 
-	_, _, _, err := p.process(context.Background(), "", request, result)
+	_, _, _, err := c.process(ctx, "", request, result)
 	if err != nil {
 		return nil, err
 	}
@@ -81,7 +230,39 @@ func (p *PeerClient) GetInstalledChainCodePackageByID(packageID string) (*lifecy
 	return result, nil
 }
 
+func (p *PeerClient) VerifyInstalledChainCodePackage(pkg []byte) error {
+	return p.VerifyInstalledChainCodePackageContext(context.Background(), pkg)
+}
+
+// VerifyInstalledChainCodePackageContext checks that the package installed on the peer with the
+// package ID of pkg is byte-identical to pkg
+func (p *PeerClient) VerifyInstalledChainCodePackageContext(ctx context.Context, pkg []byte, opts ...RequestOption) error {
+	local, err := ccpackager.ParsePackage(pkg)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel, c := p.prepare(ctx, opts)
+	defer cancel()
+
+	installed, err := c.GetInstalledChainCodePackageByIDContext(ctx, local.PackageID, opts...)
+	if err != nil {
+		return errors.WithMessagef(err, "get installed package %s failed", local.PackageID)
+	}
+	if !bytes.Equal(installed.ChaincodeInstallPackage, pkg) {
+		return errors.Errorf("package %s installed on peer %s differs from the local package", local.PackageID, c.Peer.URL())
+	}
+	return nil
+}
+
 func (p *PeerClient) GetInstalledChainCodePackage() (*lifecycle.QueryInstalledChaincodesResult, error) {
+	return p.GetInstalledChainCodePackageContext(context.Background())
+}
+
+// GetInstalledChainCodePackageContext is GetInstalledChainCodePackage with a context and per-call options
+func (p *PeerClient) GetInstalledChainCodePackageContext(ctx context.Context, opts ...RequestOption) (*lifecycle.QueryInstalledChaincodesResult, error) {
+	ctx, cancel, c := p.prepare(ctx, opts)
+	defer cancel()
 
 	args := &lifecycle.QueryInstalledChaincodesArgs{}
 
@@ -93,7 +274,7 @@ func (p *PeerClient) GetInstalledChainCodePackage() (*lifecycle.QueryInstalledCh
 
 	result := &lifecycle.QueryInstalledChaincodesResult{}
 
-	_, _, _, err := p.process(context.Background(), "", request, result)
+	_, _, _, err := c.process(ctx, "", request, result)
 	if err != nil {
 		return nil, err
 	}
@@ -102,6 +283,13 @@ func (p *PeerClient) GetInstalledChainCodePackage() (*lifecycle.QueryInstalledCh
 }
 
 func (p *PeerClient) InstallChainCodePackage(pkg []byte) (*lifecycle.InstallChaincodeResult, error) {
+	return p.InstallChainCodePackageContext(context.Background(), pkg)
+}
+
+// InstallChainCodePackageContext is InstallChainCodePackage with a context and per-call options
+func (p *PeerClient) InstallChainCodePackageContext(ctx context.Context, pkg []byte, opts ...RequestOption) (*lifecycle.InstallChaincodeResult, error) {
+	ctx, cancel, c := p.prepare(ctx, opts)
+	defer cancel()
 
 	args := &lifecycle.InstallChaincodeArgs{
 		ChaincodeInstallPackage: pkg,
@@ -115,7 +303,7 @@ func (p *PeerClient) InstallChainCodePackage(pkg []byte) (*lifecycle.InstallChai
 
 	result := &lifecycle.InstallChaincodeResult{}
 
-	_, _, _, err := p.process(context.Background(), "", request, result)
+	_, _, _, err := c.process(ctx, "", request, result)
 	if err != nil {
 		return nil, err
 	}
@@ -124,6 +312,13 @@ func (p *PeerClient) InstallChainCodePackage(pkg []byte) (*lifecycle.InstallChai
 }
 
 func (p *PeerClient) ApproveChainCode(channelID string, req *ApproveChaincodeRequest, ordererClient *OrdererClient) (*common.Status, error) {
+	return p.ApproveChainCodeContext(context.Background(), channelID, req, ordererClient)
+}
+
+// ApproveChainCodeContext is ApproveChainCode with a context and per-call options
+func (p *PeerClient) ApproveChainCodeContext(ctx context.Context, channelID string, req *ApproveChaincodeRequest, ordererClient *OrdererClient, opts ...RequestOption) (*common.Status, error) {
+	ctx, cancel, c := p.prepare(ctx, opts)
+	defer cancel()
 
 	chaincodeSource := &lifecycle.ChaincodeSource{}
 
@@ -162,9 +357,8 @@ func (p *PeerClient) ApproveChainCode(channelID string, req *ApproveChaincodeReq
 		Args:        [][]byte{ProtoMarshalIgnoreError(args)},
 	}
 
-	ctx := context.Background()
 
-	response, chaincodeInvokeProposal, header, err := p.process(ctx, channelID, request, nil)
+	response, chaincodeInvokeProposal, header, err := c.process(ctx, channelID, request, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -187,10 +381,17 @@ func (p *PeerClient) ApproveChainCode(channelID string, req *ApproveChaincodeReq
 		}),
 	}
 
-	return ordererClient.BroadcastPayload(context.Background(), payload)
+	return ordererClient.BroadcastPayload(ctx, payload, opts...)
 }
 
 func (p *PeerClient) QueryApprovedChaincodeDefinition(channelID, ccName string, sequence int64) (*lifecycle.QueryApprovedChaincodeDefinitionResult, error) {
+	return p.QueryApprovedChaincodeDefinitionContext(context.Background(), channelID, ccName, sequence)
+}
+
+// QueryApprovedChaincodeDefinitionContext is QueryApprovedChaincodeDefinition with a context and per-call options
+func (p *PeerClient) QueryApprovedChaincodeDefinitionContext(ctx context.Context, channelID, ccName string, sequence int64, opts ...RequestOption) (*lifecycle.QueryApprovedChaincodeDefinitionResult, error) {
+	ctx, cancel, c := p.prepare(ctx, opts)
+	defer cancel()
 
 	args := &lifecycle.QueryApprovedChaincodeDefinitionArgs{
 		Name:     ccName,
@@ -205,7 +406,7 @@ func (p *PeerClient) QueryApprovedChaincodeDefinition(channelID, ccName string,
 
 	result := &lifecycle.QueryApprovedChaincodeDefinitionResult{}
 
-	_, _, _, err := p.process(context.Background(), channelID, request, result)
+	_, _, _, err := c.process(ctx, channelID, request, result)
 	if err != nil {
 		return nil, err
 	}
@@ -214,6 +415,13 @@ func (p *PeerClient) QueryApprovedChaincodeDefinition(channelID, ccName string,
 }
 
 func (p *PeerClient) CheckCommitReadiness(channelID string, req *CheckChaincodeCommitReadinessRequest) (*lifecycle.CheckCommitReadinessResult, error) {
+	return p.CheckCommitReadinessContext(context.Background(), channelID, req)
+}
+
+// CheckCommitReadinessContext is CheckCommitReadiness with a context and per-call options
+func (p *PeerClient) CheckCommitReadinessContext(ctx context.Context, channelID string, req *CheckChaincodeCommitReadinessRequest, opts ...RequestOption) (*lifecycle.CheckCommitReadinessResult, error) {
+	ctx, cancel, c := p.prepare(ctx, opts)
+	defer cancel()
 
 	applicationPolicy, e := CreatePolicyBytes(req.SignaturePolicy, req.ChannelConfigPolicy)
 	if e != nil {
@@ -239,7 +447,7 @@ func (p *PeerClient) CheckCommitReadiness(channelID string, req *CheckChaincodeC
 
 	result := &lifecycle.CheckCommitReadinessResult{}
 
-	_, _, _, err := p.process(context.Background(), channelID, request, result)
+	_, _, _, err := c.process(ctx, channelID, request, result)
 	if err != nil {
 		return nil, err
 	}
@@ -248,6 +456,13 @@ func (p *PeerClient) CheckCommitReadiness(channelID string, req *CheckChaincodeC
 }
 
 func (p *PeerClient) QueryCommitted(channelID, ccName string) (*lifecycle.QueryChaincodeDefinitionResult, error) {
+	return p.QueryCommittedContext(context.Background(), channelID, ccName)
+}
+
+// QueryCommittedContext is QueryCommitted with a context and per-call options
+func (p *PeerClient) QueryCommittedContext(ctx context.Context, channelID, ccName string, opts ...RequestOption) (*lifecycle.QueryChaincodeDefinitionResult, error) {
+	ctx, cancel, c := p.prepare(ctx, opts)
+	defer cancel()
 
 	args := &lifecycle.QueryChaincodeDefinitionArgs{
 		Name: ccName,
@@ -261,7 +476,7 @@ func (p *PeerClient) QueryCommitted(channelID, ccName string) (*lifecycle.QueryC
 
 	result := &lifecycle.QueryChaincodeDefinitionResult{}
 
-	_, _, _, err := p.process(context.Background(), channelID, request, result)
+	_, _, _, err := c.process(ctx, channelID, request, result)
 	if err != nil {
 		return nil, err
 	}
@@ -270,6 +485,13 @@ func (p *PeerClient) QueryCommitted(channelID, ccName string) (*lifecycle.QueryC
 }
 
 func (p *PeerClient) QueryCommittedOfChannel(channelID string) (*lifecycle.QueryChaincodeDefinitionsResult, error) {
+	return p.QueryCommittedOfChannelContext(context.Background(), channelID)
+}
+
+// QueryCommittedOfChannelContext is QueryCommittedOfChannel with a context and per-call options
+func (p *PeerClient) QueryCommittedOfChannelContext(ctx context.Context, channelID string, opts ...RequestOption) (*lifecycle.QueryChaincodeDefinitionsResult, error) {
+	ctx, cancel, c := p.prepare(ctx, opts)
+	defer cancel()
 
 	args := &lifecycle.QueryChaincodeDefinitionsArgs{}
 
@@ -281,7 +503,7 @@ func (p *PeerClient) QueryCommittedOfChannel(channelID string) (*lifecycle.Query
 
 	result := &lifecycle.QueryChaincodeDefinitionsResult{}
 
-	_, _, _, err := p.process(context.Background(), channelID, request, result)
+	_, _, _, err := c.process(ctx, channelID, request, result)
 	if err != nil {
 		return nil, err
 	}
@@ -290,14 +512,22 @@ func (p *PeerClient) QueryCommittedOfChannel(channelID string) (*lifecycle.Query
 }
 
 func (p *PeerClient) QueryChainCode(channelID string, chaincodeID string, isInit bool, args [][]byte) (*peer.Response, error) {
+	return p.QueryChainCodeContext(context.Background(), channelID, chaincodeID, isInit, args)
+}
+
+// QueryChainCodeContext is QueryChainCode with a context and per-call options
+func (p *PeerClient) QueryChainCodeContext(ctx context.Context, channelID string, chaincodeID string, isInit bool, args [][]byte, opts ...RequestOption) (*peer.Response, error) {
+	ctx, cancel, c := p.prepare(ctx, opts)
+	defer cancel()
 
 	request := &endpoints.ChaincodeInvokeRequest{
-		ChaincodeID: chaincodeID,
-		Args:        args,
-		IsInit:      isInit,
+		ChaincodeID:  chaincodeID,
+		Args:         args,
+		IsInit:       isInit,
+		TransientMap: newRequestOptions(opts).transientMap,
 	}
 
-	response, _, _, err := p.process(context.Background(), channelID, request, nil)
+	response, _, _, err := c.process(ctx, channelID, request, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,116 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/feng081212/fabric-protos-go/common"
+	"github.com/feng081212/fabric-protos-go/peer"
+	"github.com/feng081212/fabric-protos-go/peer/lifecycle"
+	ccpackager "github.com/feng081212/fabric-sdk-go/fabric/chaincode/ccpackager/lifecycle"
+)
+
+// qsccHandler answers the queries of qscc like a peer with a ledger of height 8 and the
+// transaction tx1 in block 7
+func qsccHandler(invocation *testInvocation) *peer.Response {
+	if invocation.Chaincode != "qscc" || len(invocation.Args) < 2 || string(invocation.Args[1]) != "mychannel" {
+		return &peer.Response{Status: 500, Message: "unexpected invocation"}
+	}
+	block := &common.Block{Header: &common.BlockHeader{Number: 7, DataHash: []byte("data")}}
+	switch fcn, arg := string(invocation.Args[0]), invocation.Args[len(invocation.Args)-1]; {
+	case fcn == "GetChainInfo" && len(invocation.Args) == 2:
+		return &peer.Response{Status: 200, Payload: ProtoMarshalIgnoreError(&common.BlockchainInfo{Height: 8, CurrentBlockHash: []byte("hash7")})}
+	case fcn == "GetBlockByNumber" && string(arg) == "7",
+		fcn == "GetBlockByHash" && bytes.Equal(arg, []byte("hash7")),
+		fcn == "GetBlockByTxID" && string(arg) == "tx1":
+		return &peer.Response{Status: 200, Payload: ProtoMarshalIgnoreError(block)}
+	case fcn == "GetTransactionByID" && string(arg) == "tx1":
+		return &peer.Response{Status: 200, Payload: ProtoMarshalIgnoreError(&peer.ProcessedTransaction{
+			TransactionEnvelope: &common.Envelope{Payload: []byte("tx1")},
+			ValidationCode:      int32(peer.TxValidationCode_VALID),
+		})}
+	}
+	return &peer.Response{Status: 500, Message: "not found"}
+}
+
+func TestQuerySystemChaincode(t *testing.T) {
+	network, peers := startTestNetwork(t, qsccHandler)
+	client := &PeerClient{Peer: peers.Peers[0], Signer: peers.Signer}
+
+	info, err := client.GetChainInfo("mychannel")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Height != 8 || string(info.CurrentBlockHash) != "hash7" {
+		t.Fatalf("unexpected chain info %+v", info)
+	}
+
+	block, err := client.GetBlockByNumber("mychannel", 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if block.Header.Number != 7 || string(block.Header.DataHash) != "data" {
+		t.Fatalf("unexpected block %+v", block.Header)
+	}
+	if block, err = client.GetBlockByHash("mychannel", []byte("hash7")); err != nil || block.Header.Number != 7 {
+		t.Fatalf("expected block 7 by its hash, got %v", err)
+	}
+	if block, err = client.GetBlockByTxID("mychannel", "tx1"); err != nil || block.Header.Number != 7 {
+		t.Fatalf("expected block 7 by the transaction, got %v", err)
+	}
+
+	tx, err := client.GetTransactionByID("mychannel", "tx1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(tx.TransactionEnvelope.Payload) != "tx1" || tx.ValidationCode != int32(peer.TxValidationCode_VALID) {
+		t.Fatalf("unexpected transaction %+v", tx)
+	}
+
+	if _, err = client.GetBlockByNumber("mychannel", 8); err == nil {
+		t.Fatal("expected a block beyond the height to fail")
+	}
+
+	// the channel is the first argument and the proposal is for the channel
+	expected := []string{"GetChainInfo", "GetBlockByNumber", "GetBlockByHash", "GetBlockByTxID", "GetTransactionByID", "GetBlockByNumber"}
+	if len(network.invocations) != len(expected) {
+		t.Fatalf("expected %d invocations, got %d", len(expected), len(network.invocations))
+	}
+	for i, invocation := range network.invocations {
+		if string(invocation.Args[0]) != expected[i] || invocation.ChannelID != "mychannel" {
+			t.Errorf("expected %s on mychannel, got %s on %q", expected[i], invocation.Args[0], invocation.ChannelID)
+		}
+	}
+	if arg := network.invocations[1].Args[2]; string(arg) != "7" {
+		t.Errorf("expected the block number in decimal, got %q", arg)
+	}
+}
+
+func TestVerifyInstalledChainCodePackage(t *testing.T) {
+	pkg, err := ccpackager.NewCCaaSPackage(&ccpackager.CCaaSDescriptor{Label: "cc_1", Address: "cc.example.com:9999"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := ccpackager.NewCCaaSPackage(&ccpackager.CCaaSDescriptor{Label: "cc_1", Address: "other.example.com:9999"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	installed := func(pkg []byte) *peer.Response {
+		return &peer.Response{Status: 200, Payload: ProtoMarshalIgnoreError(&lifecycle.GetInstalledChaincodePackageResult{ChaincodeInstallPackage: pkg})}
+	}
+	same := startEndorserServer(t, installed(pkg))
+	differs := startEndorserServer(t, installed(other))
+
+	client := &PeerClient{Peer: same, Signer: &testSigner{}}
+	if err = client.VerifyInstalledChainCodePackage(pkg); err != nil {
+		t.Fatalf("expected the installed package to match: %s", err)
+	}
+
+	// the error names the peer the query went to
+	err = client.VerifyInstalledChainCodePackageContext(context.Background(), pkg, WithTargets(differs))
+	if err == nil || !strings.Contains(err.Error(), differs.URL()) || strings.Contains(err.Error(), same.URL()) {
+		t.Fatalf("expected the package on %s to differ, got %v", differs.URL(), err)
+	}
+}
@@ -5,6 +5,8 @@ import (
 	"context"
 	"encoding/base64"
 	"github.com/feng081212/fabric-sdk-go/fabric/endpoints"
+	"github.com/feng081212/fabric-sdk-go/fabric/errors/multi"
+	"github.com/feng081212/fabric-sdk-go/fabric/policies"
 	"github.com/golang/protobuf/proto"
 	"github.com/feng081212/fabric-protos-go/common"
 	"github.com/feng081212/fabric-protos-go/peer"
@@ -17,21 +19,97 @@ type PeersClient struct {
 	Peers   []*endpoints.Peer
 	Orderer OrdererClient
 	Signer  Signer
+	// VerifyEndorsements enables checking the endorsement signatures before the transaction is
+	// sent to the orderer
+	VerifyEndorsements bool
+	// EndorsementPolicy, if set, is the policy the endorsers must satisfy before the transaction
+	// is sent to the orderer, it implies VerifyEndorsements
+	EndorsementPolicy *common.SignaturePolicyEnvelope
+	// MSPs are the MSPs of the channel the endorsers are validated against, they are required to
+	// verify endorsements, see GetMSPsFromConfig
+	MSPs policies.MSPs
+}
+
+// WithDiscoveredEndorsers returns a copy of the client that sends proposals only to the smallest
+// set of peers satisfying the endorsement policy of the invocation, as computed from the
+// discovery service. See DiscoveryClient.DiscoverEndorsers for the meaning of calls.
+func (p *PeersClient) WithDiscoveredEndorsers(ctx context.Context, discoveryClient *DiscoveryClient, channelID string, calls ...*peer.ChaincodeCall) (*PeersClient, error) {
+	peers, err := discoveryClient.DiscoverEndorsementPeers(ctx, channelID, calls...)
+	if err != nil {
+		return nil, errors.WithMessage(err, "discover endorsers failed")
+	}
+	c := *p
+	c.Peers = peers
+	return &c, nil
 }
 
 func (p *PeersClient) InvokeChainCode(channelID, chaincodeID string, isInit bool, args [][]byte) (*common.Status, error) {
+	return p.InvokeChainCodeContext(context.Background(), channelID, chaincodeID, isInit, args)
+}
+
+// InvokeChainCodeContext is InvokeChainCode with a context and per-call options
+func (p *PeersClient) InvokeChainCodeContext(ctx context.Context, channelID, chaincodeID string, isInit bool, args [][]byte, opts ...RequestOption) (*common.Status, error) {
+	ctx, cancel, c := p.prepare(ctx, opts)
+	defer cancel()
+
+	request := &endpoints.ChaincodeInvokeRequest{
+		ChaincodeID:  chaincodeID,
+		Args:         args,
+		IsInit:       isInit,
+		TransientMap: newRequestOptions(opts).transientMap,
+	}
+
+	_, st, err := c.process(ctx, channelID, request)
+	return st, err
+}
+
+// InvokeChainCodeAndWait invokes the chaincode and waits until the transaction is committed
+// on the committer peer. The returned result always carries the transaction ID once the
+// proposal was created; an error is returned when ctx is done before the transaction is
+// committed or when the peer marked it invalid.
+func (p *PeersClient) InvokeChainCodeAndWait(ctx context.Context, channelID, chaincodeID string, isInit bool, args [][]byte, committer *endpoints.Peer, opts ...RequestOption) (*TransactionResult, error) {
 
 	request := &endpoints.ChaincodeInvokeRequest{
-		ChaincodeID: chaincodeID,
-		Args:        args,
-		IsInit:      isInit,
+		ChaincodeID:  chaincodeID,
+		Args:         args,
+		IsInit:       isInit,
+		TransientMap: newRequestOptions(opts).transientMap,
 	}
 
-	return p.process(context.Background(), channelID, request)
+	return p.processAndWait(ctx, channelID, request, committer, opts)
 }
 
 func (p *PeersClient) CommitChainCode(channelID string, req *CommitChaincodeRequest) (*common.Status, error) {
+	return p.CommitChainCodeContext(context.Background(), channelID, req)
+}
+
+// CommitChainCodeContext is CommitChainCode with a context and per-call options
+func (p *PeersClient) CommitChainCodeContext(ctx context.Context, channelID string, req *CommitChaincodeRequest, opts ...RequestOption) (*common.Status, error) {
+	ctx, cancel, c := p.prepare(ctx, opts)
+	defer cancel()
+
+	request, err := newCommitChaincodeRequest(req)
+	if err != nil {
+		return nil, err
+	}
 
+	_, st, err := c.process(ctx, channelID, request)
+	return st, err
+}
+
+// CommitChainCodeAndWait commits the chaincode definition and waits until the transaction is
+// committed on the committer peer, see InvokeChainCodeAndWait.
+func (p *PeersClient) CommitChainCodeAndWait(ctx context.Context, channelID string, req *CommitChaincodeRequest, committer *endpoints.Peer, opts ...RequestOption) (*TransactionResult, error) {
+	request, err := newCommitChaincodeRequest(req)
+	if err != nil {
+		return nil, err
+	}
+
+	return p.processAndWait(ctx, channelID, request, committer, opts)
+}
+
+// newCommitChaincodeRequest creates the _lifecycle invocation committing the chaincode definition
+func newCommitChaincodeRequest(req *CommitChaincodeRequest) (*endpoints.ChaincodeInvokeRequest, error) {
 	applicationPolicy, e := CreatePolicyBytes(req.SignaturePolicy, req.ChannelConfigPolicy)
 	if e != nil {
 		return nil, e
@@ -54,21 +132,55 @@ func (p *PeersClient) CommitChainCode(channelID string, req *CommitChaincodeRequ
 		Args:        [][]byte{ProtoMarshalIgnoreError(args)},
 	}
 
-	return p.process(context.Background(), channelID, request)
+	return request, nil
+}
+
+func (p *PeersClient) processAndWait(ctx context.Context, channelID string, request *endpoints.ChaincodeInvokeRequest, committer *endpoints.Peer, opts []RequestOption) (*TransactionResult, error) {
+	if committer == nil {
+		return nil, errors.New("committer peer is required")
+	}
+
+	ctx, cancel, c := p.prepare(ctx, opts)
+	defer cancel()
+
+	committerClient := &PeerClient{Peer: committer, Signer: c.Signer}
+	events, errs := committerClient.DeliverFilteredBlocks(ctx, channelID, NewNewestSeekPosition(), nil)
+
+	// the stream starts at the newest block, waiting for it guarantees that the block
+	// committing the transaction is delivered
+	if _, ok := <-events; !ok {
+		return nil, errors.WithMessage(<-errs, "failed to listen for blocks on committer peer")
+	}
+
+	txID, _, err := c.process(ctx, channelID, request)
+	if err != nil {
+		if txID == "" {
+			return nil, err
+		}
+		return &TransactionResult{TxID: txID}, err
+	}
+
+	return WaitForTransaction(ctx, txID, events, errs)
 }
 
-func (p *PeersClient) process(ctx context.Context, channelID string, request *endpoints.ChaincodeInvokeRequest) (*common.Status, error) {
+func (p *PeersClient) process(ctx context.Context, channelID string, request *endpoints.ChaincodeInvokeRequest) (string, *common.Status, error) {
 
 	proposal, header, err := CreateChaincodeInvokeProposal(channelID, p.Signer, request)
 	if err != nil {
-		return nil, errors.WithMessage(err, "CreateChaincodeInvokeProposal failed")
+		return "", nil, errors.WithMessage(err, "CreateChaincodeInvokeProposal failed")
+	}
+
+	channelHeader := &common.ChannelHeader{}
+	if err = proto.Unmarshal(header.ChannelHeader, channelHeader); err != nil {
+		return "", nil, errors.Wrap(err, "unmarshal channel header failed")
 	}
+	txID := channelHeader.TxId
 
-	responses, _ := p.SendProposal(ctx, proposal)
+	responses, errs := p.SendProposal(ctx, proposal)
 
 	if responses == nil || len(responses) == 0 {
 		// this should only be empty due to a programming bug
-		return nil, errors.New("no proposal responses received")
+		return txID, nil, errors.New("no proposal responses received")
 	}
 
 	var payload []byte
@@ -93,7 +205,7 @@ func (p *PeersClient) process(ctx context.Context, channelID string, request *en
 		}
 
 		if !bytes.Equal(payload, proposalResponse.Payload) {
-			return nil, errors.Errorf("ProposalResponsePayloads do not match (base64): '%s' vs '%s'", base64.StdEncoding.EncodeToString(proposalResponse.Payload), base64.StdEncoding.EncodeToString(payload))
+			return txID, nil, errors.Errorf("ProposalResponsePayloads do not match (base64): '%s' vs '%s'", base64.StdEncoding.EncodeToString(proposalResponse.Payload), base64.StdEncoding.EncodeToString(payload))
 		}
 
 		if r.Endorsement != nil {
@@ -106,30 +218,46 @@ func (p *PeersClient) process(ctx context.Context, channelID string, request *en
 	}
 
 	if payload == nil || len(payload) == 0 {
-		return nil, errors.New("no payload")
+		// the errors of the endorsers tell why none of them endorsed the proposal
+		if err = multi.New(errs...); err != nil {
+			return txID, nil, errors.WithMessage(err, "no payload")
+		}
+		return txID, nil, errors.New("no payload")
 	}
 
 	if len(endorsements) == 0 {
-		return nil, errors.New("no endorsements")
+		return txID, nil, errors.New("no endorsements")
+	}
+
+	if p.VerifyEndorsements || p.EndorsementPolicy != nil {
+		if err = VerifyEndorsements(payload, endorsements, p.EndorsementPolicy, p.MSPs); err != nil {
+			return txID, nil, err
+		}
+	}
+
+	proposalPayload, err := proposalPayloadForTx(proposal)
+	if err != nil {
+		return txID, nil, err
 	}
 
 	tAction := &peer.TransactionAction{
 		Header: header.SignatureHeader,
 		Payload: ProtoMarshalIgnoreError(&peer.ChaincodeActionPayload{
-			ChaincodeProposalPayload: proposal.Payload,
+			ChaincodeProposalPayload: proposalPayload,
 			Action: &peer.ChaincodeEndorsedAction{
-				ProposalResponsePayload: payload, // ChaincodeProposalPayload.TransientMap 不需要已经为空，原SDK中多了一步置空的操作
+				ProposalResponsePayload: payload,
 				Endorsements:            endorsements,
 			},
 		}),
 	}
 
-	return p.Orderer.BroadcastPayload(context.Background(), &common.Payload{
+	st, err := p.Orderer.BroadcastPayload(ctx, &common.Payload{
 		Header: header,
 		Data: ProtoMarshalIgnoreError(&peer.Transaction{
 			Actions: []*peer.TransactionAction{tAction},
 		}),
 	})
+	return txID, st, err
 }
 
 func (p *PeersClient) SendProposal(ctx context.Context, proposal *peer.Proposal) ([]*endpoints.TransactionProposalResponse, []error) {
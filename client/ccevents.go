@@ -0,0 +1,316 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/feng081212/fabric-protos-go/common"
+	"github.com/feng081212/fabric-protos-go/orderer"
+	"github.com/feng081212/fabric-protos-go/peer"
+	"github.com/golang/protobuf/proto"
+	"github.com/pkg/errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+)
+
+// ChaincodeEvent is an event set by a chaincode in a valid transaction
+type ChaincodeEvent struct {
+	TxID        string
+	BlockNumber uint64
+	ChaincodeID string
+	EventName   string
+	Payload     []byte
+}
+
+// EventCheckpoint is the position from which a chaincode event subscription resumes
+type EventCheckpoint struct {
+	// BlockNumber is the number of the next block to process
+	BlockNumber uint64 `json:"blockNumber"`
+	// TxID is the last processed transaction within that block, empty if none was processed yet
+	TxID string `json:"txId,omitempty"`
+}
+
+// EventCheckpointer persists the checkpoint of a chaincode event subscription
+type EventCheckpointer interface {
+	// Load returns the stored checkpoint, or nil if there is none
+	Load() (*EventCheckpoint, error)
+	// Save stores the checkpoint
+	Save(checkpoint *EventCheckpoint) error
+}
+
+// ChaincodeEventRequest contains the parameters for subscribing to chaincode events
+type ChaincodeEventRequest struct {
+	ChannelID   string
+	ChaincodeID string
+	// EventFilter is a regular expression matched against the event name, an empty filter matches all events
+	EventFilter string
+	// Start is used when the checkpointer holds no checkpoint, the newest block is used when it is nil
+	Start *orderer.SeekPosition
+	// Checkpointer is optional, when set the subscription resumes from and updates its checkpoint
+	Checkpointer EventCheckpointer
+}
+
+// SubscribeChaincodeEvents streams the events of the chaincode that match the event filter.
+// With a checkpointer an event is checkpointed once the consumer receives the next event from the
+// events channel, the consumer is expected to be done with an event when it asks for the next one.
+// A restarted subscription therefore continues with the last event handed out, which may be
+// delivered twice. Blocks without a matching event are not checkpointed on their own.
+// The channels are closed the same way as for DeliverBlocks.
+func (p *PeerClient) SubscribeChaincodeEvents(ctx context.Context, request *ChaincodeEventRequest) (<-chan *ChaincodeEvent, <-chan error) {
+	events := make(chan *ChaincodeEvent)
+	errs := make(chan error, 1)
+
+	go func() {
+		defer close(errs)
+		defer close(events)
+		if err := p.subscribeChaincodeEvents(ctx, request, events); err != nil {
+			errs <- err
+		}
+	}()
+
+	return events, errs
+}
+
+func (p *PeerClient) subscribeChaincodeEvents(ctx context.Context, request *ChaincodeEventRequest, out chan<- *ChaincodeEvent) error {
+	if request == nil || request.ChannelID == "" || request.ChaincodeID == "" {
+		return errors.New("channel ID and chaincode ID are required")
+	}
+
+	filter, err := regexp.Compile(request.EventFilter)
+	if err != nil {
+		return errors.Wrapf(err, "invalid event filter '%s'", request.EventFilter)
+	}
+
+	start := request.Start
+	if start == nil {
+		start = NewNewestSeekPosition()
+	}
+
+	var checkpoint *EventCheckpoint
+	if request.Checkpointer != nil {
+		checkpoint, err = request.Checkpointer.Load()
+		if err != nil {
+			return errors.WithMessage(err, "load event checkpoint failed")
+		}
+		if checkpoint != nil {
+			start = NewSpecificSeekPosition(checkpoint.BlockNumber)
+		}
+	}
+
+	save := func(c *EventCheckpoint) error {
+		if request.Checkpointer == nil {
+			return nil
+		}
+		return errors.WithMessage(request.Checkpointer.Save(c), "save event checkpoint failed")
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	blocks, errs := p.DeliverBlocks(ctx, request.ChannelID, start, nil)
+
+	// handled is the checkpoint to save once the consumer is done with the last event handed out
+	var handled *EventCheckpoint
+
+	for block := range blocks {
+		ccEvents, err := GetChaincodeEventsFromBlock(block.Block)
+		if err != nil {
+			return err
+		}
+
+		// skip the transactions of the checkpoint block that were already processed
+		skip := checkpoint != nil && checkpoint.TxID != "" && checkpoint.BlockNumber == block.BlockNumber
+
+		for _, ccEvent := range ccEvents {
+			if skip {
+				skip = ccEvent.TxID != checkpoint.TxID
+				continue
+			}
+			if ccEvent.ChaincodeID != request.ChaincodeID || !filter.MatchString(ccEvent.EventName) {
+				continue
+			}
+
+			select {
+			case out <- ccEvent:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+
+			// the consumer received this event, so it is done with the previous one
+			if handled != nil {
+				if err = save(handled); err != nil {
+					return err
+				}
+			}
+			handled = &EventCheckpoint{BlockNumber: block.BlockNumber, TxID: ccEvent.TxID}
+		}
+
+		if handled != nil {
+			handled = &EventCheckpoint{BlockNumber: block.BlockNumber + 1}
+		}
+		checkpoint = nil
+	}
+
+	return <-errs
+}
+
+// GetChaincodeEventsFromBlock returns the chaincode events of the valid endorser transactions in
+// the block, in the order of the transactions
+func GetChaincodeEventsFromBlock(block *common.Block) ([]*ChaincodeEvent, error) {
+	if block == nil || block.Data == nil {
+		return nil, errors.New("block data is required")
+	}
+
+	var flags []byte
+	if block.Metadata != nil && len(block.Metadata.Metadata) > int(common.BlockMetadataIndex_TRANSACTIONS_FILTER) {
+		flags = block.Metadata.Metadata[common.BlockMetadataIndex_TRANSACTIONS_FILTER]
+	}
+
+	var events []*ChaincodeEvent
+
+	for i, data := range block.Data.Data {
+		if i < len(flags) && peer.TxValidationCode(flags[i]) != peer.TxValidationCode_VALID {
+			continue
+		}
+
+		envelope := &common.Envelope{}
+		if err := proto.Unmarshal(data, envelope); err != nil {
+			return nil, errors.Wrapf(err, "unmarshal envelope %d of block %d failed", i, block.Header.GetNumber())
+		}
+		payload := &common.Payload{}
+		if err := proto.Unmarshal(envelope.Payload, payload); err != nil {
+			return nil, errors.Wrapf(err, "unmarshal payload %d of block %d failed", i, block.Header.GetNumber())
+		}
+		channelHeader := &common.ChannelHeader{}
+		if err := proto.Unmarshal(payload.GetHeader().GetChannelHeader(), channelHeader); err != nil {
+			return nil, errors.Wrapf(err, "unmarshal channel header %d of block %d failed", i, block.Header.GetNumber())
+		}
+		if common.HeaderType(channelHeader.Type) != common.HeaderType_ENDORSER_TRANSACTION {
+			continue
+		}
+
+		tx := &peer.Transaction{}
+		if err := proto.Unmarshal(payload.Data, tx); err != nil {
+			return nil, errors.Wrapf(err, "unmarshal transaction [%s] failed", channelHeader.TxId)
+		}
+
+		for _, action := range tx.Actions {
+			ccEvent, err := getChaincodeEventFromAction(action)
+			if err != nil {
+				return nil, errors.WithMessagef(err, "transaction [%s]", channelHeader.TxId)
+			}
+			if ccEvent == nil {
+				continue
+			}
+			events = append(events, &ChaincodeEvent{
+				TxID:        channelHeader.TxId,
+				BlockNumber: block.Header.GetNumber(),
+				ChaincodeID: ccEvent.ChaincodeId,
+				EventName:   ccEvent.EventName,
+				Payload:     ccEvent.Payload,
+			})
+		}
+	}
+
+	return events, nil
+}
+
+func getChaincodeEventFromAction(action *peer.TransactionAction) (*peer.ChaincodeEvent, error) {
+	actionPayload := &peer.ChaincodeActionPayload{}
+	if err := proto.Unmarshal(action.Payload, actionPayload); err != nil {
+		return nil, errors.Wrap(err, "unmarshal chaincode action payload failed")
+	}
+	if actionPayload.Action == nil {
+		return nil, nil
+	}
+
+	responsePayload := &peer.ProposalResponsePayload{}
+	if err := proto.Unmarshal(actionPayload.Action.ProposalResponsePayload, responsePayload); err != nil {
+		return nil, errors.Wrap(err, "unmarshal proposal response payload failed")
+	}
+
+	chaincodeAction := &peer.ChaincodeAction{}
+	if err := proto.Unmarshal(responsePayload.Extension, chaincodeAction); err != nil {
+		return nil, errors.Wrap(err, "unmarshal chaincode action failed")
+	}
+	if len(chaincodeAction.Events) == 0 {
+		return nil, nil
+	}
+
+	ccEvent := &peer.ChaincodeEvent{}
+	if err := proto.Unmarshal(chaincodeAction.Events, ccEvent); err != nil {
+		return nil, errors.Wrap(err, "unmarshal chaincode event failed")
+	}
+	return ccEvent, nil
+}
+
+// MemoryCheckpointer keeps the checkpoint in memory, it does not survive a restart of the process
+type MemoryCheckpointer struct {
+	mutex      sync.Mutex
+	checkpoint *EventCheckpoint
+}
+
+func (m *MemoryCheckpointer) Load() (*EventCheckpoint, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.checkpoint == nil {
+		return nil, nil
+	}
+	c := *m.checkpoint
+	return &c, nil
+}
+
+func (m *MemoryCheckpointer) Save(checkpoint *EventCheckpoint) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	c := *checkpoint
+	m.checkpoint = &c
+	return nil
+}
+
+// FileCheckpointer stores the checkpoint as JSON in a file
+type FileCheckpointer struct {
+	Path string
+}
+
+func NewFileCheckpointer(path string) *FileCheckpointer {
+	return &FileCheckpointer{Path: path}
+}
+
+func (f *FileCheckpointer) Load() (*EventCheckpoint, error) {
+	bs, err := ioutil.ReadFile(f.Path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "read checkpoint file [%s] failed", f.Path)
+	}
+	checkpoint := &EventCheckpoint{}
+	if err = json.Unmarshal(bs, checkpoint); err != nil {
+		return nil, errors.Wrapf(err, "unmarshal checkpoint file [%s] failed", f.Path)
+	}
+	return checkpoint, nil
+}
+
+func (f *FileCheckpointer) Save(checkpoint *EventCheckpoint) error {
+	bs, err := json.Marshal(checkpoint)
+	if err != nil {
+		return errors.Wrap(err, "marshal checkpoint failed")
+	}
+	// write to a temporary file first so that a crash never leaves a truncated checkpoint
+	tmp, err := ioutil.TempFile(filepath.Dir(f.Path), filepath.Base(f.Path)+".tmp")
+	if err != nil {
+		return errors.Wrapf(err, "create checkpoint file [%s] failed", f.Path)
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+	if _, err = tmp.Write(bs); err != nil {
+		_ = tmp.Close()
+		return errors.Wrapf(err, "write checkpoint file [%s] failed", f.Path)
+	}
+	if err = tmp.Close(); err != nil {
+		return errors.Wrapf(err, "write checkpoint file [%s] failed", f.Path)
+	}
+	return errors.Wrapf(os.Rename(tmp.Name(), f.Path), "write checkpoint file [%s] failed", f.Path)
+}
@@ -0,0 +1,265 @@
+package client
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/feng081212/fabric-protos-go/common"
+	ab "github.com/feng081212/fabric-protos-go/orderer"
+	"github.com/feng081212/fabric-protos-go/peer"
+	"github.com/feng081212/fabric-sdk-go/fabric/endpoints"
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	grpcstatus "google.golang.org/grpc/status"
+)
+
+// testEventTx is a transaction of a test block, its event is set when name is not empty
+type testEventTx struct {
+	txID      string
+	chaincode string
+	name      string
+	invalid   bool
+}
+
+func testEventBlock(number uint64, txs ...testEventTx) *common.Block {
+	block := &common.Block{
+		Header:   &common.BlockHeader{Number: number},
+		Data:     &common.BlockData{},
+		Metadata: &common.BlockMetadata{Metadata: make([][]byte, len(common.BlockMetadataIndex_name))},
+	}
+	flags := make([]byte, len(txs))
+	for i, tx := range txs {
+		if tx.invalid {
+			flags[i] = byte(peer.TxValidationCode_MVCC_READ_CONFLICT)
+		}
+		action := &peer.ChaincodeAction{Response: &peer.Response{Status: 200}}
+		if tx.name != "" {
+			action.Events = ProtoMarshalIgnoreError(&peer.ChaincodeEvent{ChaincodeId: tx.chaincode, TxId: tx.txID, EventName: tx.name, Payload: []byte(tx.txID)})
+		}
+		transaction := &peer.Transaction{Actions: []*peer.TransactionAction{{
+			Payload: ProtoMarshalIgnoreError(&peer.ChaincodeActionPayload{Action: &peer.ChaincodeEndorsedAction{
+				ProposalResponsePayload: ProtoMarshalIgnoreError(&peer.ProposalResponsePayload{Extension: ProtoMarshalIgnoreError(action)}),
+			}}),
+		}}}
+		payload := &common.Payload{
+			Header: &common.Header{ChannelHeader: ProtoMarshalIgnoreError(&common.ChannelHeader{
+				Type: int32(common.HeaderType_ENDORSER_TRANSACTION), ChannelId: "mychannel", TxId: tx.txID,
+			})},
+			Data: ProtoMarshalIgnoreError(transaction),
+		}
+		block.Data.Data = append(block.Data.Data, ProtoMarshalIgnoreError(&common.Envelope{Payload: ProtoMarshalIgnoreError(payload)}))
+	}
+	block.Metadata.Metadata[common.BlockMetadataIndex_TRANSACTIONS_FILTER] = flags
+	return block
+}
+
+// ledgerDeliverServer delivers the blocks of the ledger from the requested start and then keeps
+// the stream open, like a peer waiting for new blocks
+type ledgerDeliverServer struct {
+	blocks []*common.Block
+	starts chan uint64
+}
+
+func (s *ledgerDeliverServer) Deliver(stream peer.Deliver_DeliverServer) error {
+	envelope, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+	payload := &common.Payload{}
+	if err = proto.Unmarshal(envelope.Payload, payload); err != nil {
+		return err
+	}
+	seekInfo := &ab.SeekInfo{}
+	if err = proto.Unmarshal(payload.Data, seekInfo); err != nil {
+		return err
+	}
+	start := uint64(len(s.blocks) - 1)
+	if specified := seekInfo.Start.GetSpecified(); specified != nil {
+		start = specified.Number
+	}
+	s.starts <- start
+
+	for _, block := range s.blocks[start:] {
+		if err = stream.Send(&peer.DeliverResponse{Type: &peer.DeliverResponse_Block{Block: block}}); err != nil {
+			return err
+		}
+	}
+	<-stream.Context().Done()
+	return nil
+}
+
+func (s *ledgerDeliverServer) DeliverFiltered(peer.Deliver_DeliverFilteredServer) error {
+	return grpcstatus.Error(codes.Unimplemented, "use Deliver")
+}
+
+func (s *ledgerDeliverServer) DeliverWithPrivateData(peer.Deliver_DeliverWithPrivateDataServer) error {
+	return grpcstatus.Error(codes.Unimplemented, "use Deliver")
+}
+
+func startLedgerDeliverServer(t *testing.T, blocks ...*common.Block) (*PeerClient, *ledgerDeliverServer) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	deliverServer := &ledgerDeliverServer{blocks: blocks, starts: make(chan uint64, 16)}
+	server := grpc.NewServer()
+	peer.RegisterDeliverServer(server, deliverServer)
+	go func() { _ = server.Serve(listener) }()
+	t.Cleanup(server.Stop)
+	return &PeerClient{Peer: endpoints.EmptyPeer().SetUrl("grpc://" + listener.Addr().String()), Signer: &testSigner{}}, deliverServer
+}
+
+// receiveEvents takes count events from the subscription, then stops it and waits for it to end
+func receiveEvents(t *testing.T, client *PeerClient, request *ChaincodeEventRequest, count int) []string {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events, errs := client.SubscribeChaincodeEvents(ctx, request)
+
+	var txIDs []string
+	for event := range events {
+		txIDs = append(txIDs, event.TxID)
+		if len(txIDs) == count {
+			cancel()
+		}
+	}
+	if err := <-errs; err != context.Canceled {
+		t.Fatalf("expected the subscription to end with the context, got %v", err)
+	}
+	return txIDs
+}
+
+func TestSubscribeChaincodeEventsResume(t *testing.T) {
+	client, server := startLedgerDeliverServer(t,
+		testEventBlock(0),
+		testEventBlock(1,
+			testEventTx{txID: "tx1", chaincode: "basic", name: "created"},
+			testEventTx{txID: "tx2", chaincode: "other", name: "created"},
+			testEventTx{txID: "tx3", chaincode: "basic", name: "transferred"},
+		),
+		testEventBlock(2,
+			testEventTx{txID: "tx4", chaincode: "basic", name: "created", invalid: true},
+			testEventTx{txID: "tx5", chaincode: "basic"},
+			testEventTx{txID: "tx6", chaincode: "basic", name: "deleted"},
+		),
+		testEventBlock(3, testEventTx{txID: "tx7", chaincode: "basic", name: "created"}),
+	)
+
+	dir, err := ioutil.TempDir("", "ccevents")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+	checkpointer := NewFileCheckpointer(filepath.Join(dir, "checkpoint.json"))
+	request := &ChaincodeEventRequest{
+		ChannelID:    "mychannel",
+		ChaincodeID:  "basic",
+		Start:        NewSpecificSeekPosition(1),
+		Checkpointer: checkpointer,
+	}
+
+	// the consumer stops while handling tx3, so only tx1 is known to be handled
+	if txIDs := receiveEvents(t, client, request, 2); !reflect.DeepEqual(txIDs, []string{"tx1", "tx3"}) {
+		t.Fatalf("expected the events of basic in block 1, got %v", txIDs)
+	}
+	checkpoint, err := checkpointer.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(checkpoint, &EventCheckpoint{BlockNumber: 1, TxID: "tx1"}) {
+		t.Fatalf("expected the checkpoint of tx1, got %+v", checkpoint)
+	}
+
+	// the restarted subscription starts at the checkpoint block and redelivers tx3 once, invalid
+	// transactions and transactions without an event are left out
+	if txIDs := receiveEvents(t, client, request, 3); !reflect.DeepEqual(txIDs, []string{"tx3", "tx6", "tx7"}) {
+		t.Fatalf("expected tx3 again and the events after it, got %v", txIDs)
+	}
+	if start := <-server.starts; start != 1 {
+		t.Fatalf("expected the first subscription to start at block 1, got %d", start)
+	}
+	if start := <-server.starts; start != 1 {
+		t.Fatalf("expected the restarted subscription to start at the checkpoint block, got %d", start)
+	}
+
+	// after a block the checkpoint moves to the start of the next block
+	if checkpoint, err = checkpointer.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(checkpoint, &EventCheckpoint{BlockNumber: 3}) {
+		t.Fatalf("expected the checkpoint of block 3, got %+v", checkpoint)
+	}
+	if txIDs := receiveEvents(t, client, request, 1); !reflect.DeepEqual(txIDs, []string{"tx7"}) {
+		t.Fatalf("expected tx7 again, got %v", txIDs)
+	}
+	if start := <-server.starts; start != 3 {
+		t.Fatalf("expected the subscription to start at block 3, got %d", start)
+	}
+}
+
+func TestSubscribeChaincodeEventsFilter(t *testing.T) {
+	client, _ := startLedgerDeliverServer(t,
+		testEventBlock(0,
+			testEventTx{txID: "tx1", chaincode: "basic", name: "created"},
+			testEventTx{txID: "tx2", chaincode: "basic", name: "deleted"},
+			testEventTx{txID: "tx3", chaincode: "basic", name: "recreated"},
+		),
+	)
+
+	request := &ChaincodeEventRequest{ChannelID: "mychannel", ChaincodeID: "basic", EventFilter: "^created$|^deleted$"}
+	if txIDs := receiveEvents(t, client, request, 2); !reflect.DeepEqual(txIDs, []string{"tx1", "tx2"}) {
+		t.Fatalf("expected the events matching the filter, got %v", txIDs)
+	}
+
+	_, errs := client.SubscribeChaincodeEvents(context.Background(), &ChaincodeEventRequest{ChannelID: "mychannel", ChaincodeID: "basic", EventFilter: "("})
+	if err := <-errs; err == nil {
+		t.Fatal("expected an invalid filter to be refused")
+	}
+}
+
+func TestFileCheckpointer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "checkpoint")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+	checkpointer := NewFileCheckpointer(filepath.Join(dir, "checkpoint.json"))
+
+	checkpoint, err := checkpointer.Load()
+	if err != nil || checkpoint != nil {
+		t.Fatalf("expected no checkpoint before the first save, got %+v %v", checkpoint, err)
+	}
+
+	for _, expected := range []*EventCheckpoint{{BlockNumber: 7, TxID: "tx1"}, {BlockNumber: 8}} {
+		if err = checkpointer.Save(expected); err != nil {
+			t.Fatal(err)
+		}
+		if checkpoint, err = checkpointer.Load(); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(checkpoint, expected) {
+			t.Fatalf("expected %+v, got %+v", expected, checkpoint)
+		}
+	}
+
+	// the temporary files are renamed or removed
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 || files[0].Name() != "checkpoint.json" {
+		t.Fatalf("expected only the checkpoint file, got %d files", len(files))
+	}
+
+	if err = ioutil.WriteFile(checkpointer.Path, []byte("{"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = checkpointer.Load(); err == nil {
+		t.Fatal("expected a corrupt checkpoint file to be refused")
+	}
+}
@@ -0,0 +1,109 @@
+package client
+
+import (
+	"encoding/json"
+	"github.com/feng081212/fabric-protos-go/peer"
+	"github.com/feng081212/fabric-sdk-go/fabric/policies"
+	"github.com/pkg/errors"
+	"io/ioutil"
+)
+
+// CollectionDefinition is a private data collection as written in the collections config file
+// given to the peer CLI with --collections-config
+type CollectionDefinition struct {
+	Name              string                 `json:"name"`
+	Policy            string                 `json:"policy"`
+	RequiredPeerCount *int32                 `json:"requiredPeerCount"`
+	MaxPeerCount      *int32                 `json:"maxPeerCount"`
+	BlockToLive       uint64                 `json:"blockToLive"`
+	MemberOnlyRead    bool                   `json:"memberOnlyRead"`
+	MemberOnlyWrite   bool                   `json:"memberOnlyWrite"`
+	EndorsementPolicy *CollectionEndorsement `json:"endorsementPolicy,omitempty"`
+}
+
+// CollectionEndorsement is the endorsement policy of a collection, at most one of the policies
+// may be set
+type CollectionEndorsement struct {
+	SignaturePolicy     string `json:"signaturePolicy,omitempty"`
+	ChannelConfigPolicy string `json:"channelConfigPolicy,omitempty"`
+}
+
+// ToCollectionConfig converts the definition to the collection config of a chaincode definition
+func (d *CollectionDefinition) ToCollectionConfig() (*peer.CollectionConfig, error) {
+	if d.Name == "" {
+		return nil, errors.New("collection name is required")
+	}
+	if d.RequiredPeerCount == nil {
+		return nil, errors.Errorf("collection [%s] requiredPeerCount is required", d.Name)
+	}
+	if d.MaxPeerCount == nil {
+		return nil, errors.Errorf("collection [%s] maxPeerCount is required", d.Name)
+	}
+
+	memberOrgsPolicy, err := policies.FromString(d.Policy)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "invalid policy [%s] of collection [%s]", d.Policy, d.Name)
+	}
+
+	var endorsementPolicy *peer.ApplicationPolicy
+	if d.EndorsementPolicy != nil {
+		endorsementPolicy, err = CreatePolicyBytes(d.EndorsementPolicy.SignaturePolicy, d.EndorsementPolicy.ChannelConfigPolicy)
+		if err != nil {
+			return nil, errors.WithMessagef(err, "invalid endorsement policy of collection [%s]", d.Name)
+		}
+	}
+
+	return &peer.CollectionConfig{
+		Payload: &peer.CollectionConfig_StaticCollectionConfig{
+			StaticCollectionConfig: &peer.StaticCollectionConfig{
+				Name: d.Name,
+				MemberOrgsPolicy: &peer.CollectionPolicyConfig{
+					Payload: &peer.CollectionPolicyConfig_SignaturePolicy{
+						SignaturePolicy: memberOrgsPolicy,
+					},
+				},
+				RequiredPeerCount: *d.RequiredPeerCount,
+				MaximumPeerCount:  *d.MaxPeerCount,
+				BlockToLive:       d.BlockToLive,
+				MemberOnlyRead:    d.MemberOnlyRead,
+				MemberOnlyWrite:   d.MemberOnlyWrite,
+				EndorsementPolicy: endorsementPolicy,
+			},
+		},
+	}, nil
+}
+
+// GetCollectionConfigFromJSON converts a collections config file of the peer CLI, a JSON array of
+// collection definitions, to the CollectionConfig of a chaincode definition request
+func GetCollectionConfigFromJSON(bs []byte) ([]*peer.CollectionConfig, error) {
+	var definitions []*CollectionDefinition
+	if err := json.Unmarshal(bs, &definitions); err != nil {
+		return nil, errors.Wrap(err, "unmarshal collections config failed")
+	}
+
+	result := make([]*peer.CollectionConfig, 0, len(definitions))
+	names := make(map[string]bool)
+	for _, d := range definitions {
+		if names[d.Name] {
+			return nil, errors.Errorf("collection [%s] is defined more than once", d.Name)
+		}
+		names[d.Name] = true
+
+		config, err := d.ToCollectionConfig()
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, config)
+	}
+	return result, nil
+}
+
+// GetCollectionConfigFromFile reads a collections config file of the peer CLI, see
+// GetCollectionConfigFromJSON
+func GetCollectionConfigFromFile(path string) ([]*peer.CollectionConfig, error) {
+	bs, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "read collections config [%s] failed", path)
+	}
+	return GetCollectionConfigFromJSON(bs)
+}
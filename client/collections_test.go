@@ -0,0 +1,79 @@
+package client
+
+import (
+	"testing"
+
+	"github.com/feng081212/fabric-protos-go/peer"
+)
+
+const testCollections = `[
+	{
+		"name": "collectionMarbles",
+		"policy": "OR('Org1MSP.member', 'Org2MSP.member')",
+		"requiredPeerCount": 0,
+		"maxPeerCount": 3,
+		"blockToLive": 1000000,
+		"memberOnlyRead": true
+	},
+	{
+		"name": "collectionMarblePrivateDetails",
+		"policy": "OR('Org1MSP.member')",
+		"requiredPeerCount": 1,
+		"maxPeerCount": 1,
+		"memberOnlyRead": true,
+		"memberOnlyWrite": true,
+		"endorsementPolicy": {
+			"signaturePolicy": "OR('Org1MSP.member')"
+		}
+	}
+]`
+
+func TestGetCollectionConfigFromJSON(t *testing.T) {
+	configs, err := GetCollectionConfigFromJSON([]byte(testCollections))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(configs) != 2 {
+		t.Fatalf("expected 2 collections, got %d", len(configs))
+	}
+
+	marbles := configs[0].GetStaticCollectionConfig()
+	if marbles.Name != "collectionMarbles" || marbles.RequiredPeerCount != 0 || marbles.MaximumPeerCount != 3 ||
+		marbles.BlockToLive != 1000000 || !marbles.MemberOnlyRead || marbles.MemberOnlyWrite {
+		t.Fatalf("unexpected collection %+v", marbles)
+	}
+	if marbles.EndorsementPolicy != nil {
+		t.Fatal("expected no endorsement policy without endorsementPolicy")
+	}
+	if identities := marbles.MemberOrgsPolicy.GetSignaturePolicy().GetIdentities(); len(identities) != 2 {
+		t.Fatalf("expected the member orgs policy of both orgs, got %d identities", len(identities))
+	}
+
+	details := configs[1].GetStaticCollectionConfig()
+	if details.Name != "collectionMarblePrivateDetails" || details.RequiredPeerCount != 1 || !details.MemberOnlyWrite {
+		t.Fatalf("unexpected collection %+v", details)
+	}
+	if _, ok := details.EndorsementPolicy.GetType().(*peer.ApplicationPolicy_SignaturePolicy); !ok {
+		t.Fatalf("expected the signature policy of the collection, got %v", details.EndorsementPolicy)
+	}
+}
+
+func TestGetCollectionConfigFromJSONInvalid(t *testing.T) {
+	for name, collections := range map[string]string{
+		"missing requiredPeerCount": `[{"name": "c", "policy": "OR('Org1MSP.member')", "maxPeerCount": 1}]`,
+		"missing maxPeerCount":      `[{"name": "c", "policy": "OR('Org1MSP.member')", "requiredPeerCount": 1}]`,
+		"missing name":              `[{"policy": "OR('Org1MSP.member')", "requiredPeerCount": 1, "maxPeerCount": 1}]`,
+		"invalid policy":            `[{"name": "c", "policy": "Org1MSP", "requiredPeerCount": 1, "maxPeerCount": 1}]`,
+		"duplicate names": `[
+			{"name": "c", "policy": "OR('Org1MSP.member')", "requiredPeerCount": 1, "maxPeerCount": 1},
+			{"name": "c", "policy": "OR('Org2MSP.member')", "requiredPeerCount": 1, "maxPeerCount": 1}
+		]`,
+		"two endorsement policies": `[{"name": "c", "policy": "OR('Org1MSP.member')", "requiredPeerCount": 1, "maxPeerCount": 1,
+			"endorsementPolicy": {"signaturePolicy": "OR('Org1MSP.member')", "channelConfigPolicy": "/Channel/Application/Endorsement"}}]`,
+		"not an array": `{"name": "c"}`,
+	} {
+		if _, err := GetCollectionConfigFromJSON([]byte(collections)); err == nil {
+			t.Errorf("expected an error for %s", name)
+		}
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"github.com/feng081212/fabric-protos-go/orderer"
 	"github.com/feng081212/fabric-protos-go/peer"
 	"github.com/feng081212/fabric-sdk-go/fabric/bccsp/hasher"
+	"github.com/feng081212/fabric-sdk-go/fabric/blockparser"
 	"github.com/feng081212/fabric-sdk-go/fabric/endpoints"
 	"github.com/feng081212/fabric-sdk-go/fabric/policies"
 	"github.com/golang/protobuf/proto"
@@ -72,6 +73,20 @@ func CreateChaincodeInvokeProposal(channelID string, signer Signer, request *end
 	}, header, nil
 }
 
+// proposalPayloadForTx returns the proposal payload without the transient map, which must not be
+// written to the ledger
+func proposalPayloadForTx(proposal *peer.Proposal) ([]byte, error) {
+	payload := &peer.ChaincodeProposalPayload{}
+	if err := proto.Unmarshal(proposal.Payload, payload); err != nil {
+		return nil, errors.Wrap(err, "unmarshal chaincode proposal payload failed")
+	}
+	if len(payload.TransientMap) == 0 {
+		return proposal.Payload, nil
+	}
+	payload.TransientMap = nil
+	return proto.Marshal(payload)
+}
+
 func CreatePayload(headerType common.HeaderType, channelID string, h hash.Hash, creator, data []byte, chHandler func(*common.ChannelHeader)) *common.Payload {
 
 	header, _ := CreateHeader(headerType, channelID, h, creator, chHandler)
@@ -167,7 +182,8 @@ func computeHash(msg []byte) ([]byte, error) {
 	return h, err
 }
 
-func newSpecificSeekPosition(index uint64) *orderer.SeekPosition {
+// NewSpecificSeekPosition returns a seek position pointing at the block with the given number
+func NewSpecificSeekPosition(index uint64) *orderer.SeekPosition {
 	return &orderer.SeekPosition{
 		Type: &orderer.SeekPosition_Specified{
 			Specified: &orderer.SeekSpecified{
@@ -177,7 +193,8 @@ func newSpecificSeekPosition(index uint64) *orderer.SeekPosition {
 	}
 }
 
-func newNewestSeekPosition() *orderer.SeekPosition {
+// NewNewestSeekPosition returns a seek position pointing at the newest block
+func NewNewestSeekPosition() *orderer.SeekPosition {
 	return &orderer.SeekPosition{
 		Type: &orderer.SeekPosition_Newest{
 			Newest: &orderer.SeekNewest{},
@@ -185,33 +202,42 @@ func newNewestSeekPosition() *orderer.SeekPosition {
 	}
 }
 
+// NewOldestSeekPosition returns a seek position pointing at the oldest block
+func NewOldestSeekPosition() *orderer.SeekPosition {
+	return &orderer.SeekPosition{
+		Type: &orderer.SeekPosition_Oldest{
+			Oldest: &orderer.SeekOldest{},
+		},
+	}
+}
+
 // GetLastConfigIndexFromBlock retrieves the index of the last config block as
 // encoded in the block metadata
 func GetLastConfigIndexFromBlock(block *common.Block) (uint64, error) {
-	m, err := GetMetadataFromBlock(block, common.BlockMetadataIndex_SIGNATURES)
-	if err != nil {
-		return 0, errors.WithMessage(err, "failed to retrieve metadata")
+	return blockparser.LastConfigIndex(block)
+}
+
+// GetConfigFromBlock retrieves the channel config from a config block
+func GetConfigFromBlock(block *common.Block) (*common.Config, error) {
+	if block == nil || block.Data == nil || len(block.Data.Data) == 0 {
+		return nil, errors.New("block has no data")
 	}
-	// TODO FAB-15864 Remove this fallback when we can stop supporting upgrade from pre-1.4.1 orderer
-	if len(m.Value) == 0 {
-		m, err := GetMetadataFromBlock(block, common.BlockMetadataIndex_LAST_CONFIG)
-		if err != nil {
-			return 0, errors.WithMessage(err, "failed to retrieve metadata")
-		}
-		lc := &common.LastConfig{}
-		err = proto.Unmarshal(m.Value, lc)
-		if err != nil {
-			return 0, errors.Wrap(err, "error unmarshalling LastConfig")
-		}
-		return lc.Index, nil
+	envelope := &common.Envelope{}
+	if err := proto.Unmarshal(block.Data.Data[0], envelope); err != nil {
+		return nil, errors.Wrap(err, "error unmarshalling envelope")
 	}
-
-	obm := &common.OrdererBlockMetadata{}
-	err = proto.Unmarshal(m.Value, obm)
-	if err != nil {
-		return 0, errors.Wrap(err, "failed to unmarshal orderer block metadata")
+	payload := &common.Payload{}
+	if err := proto.Unmarshal(envelope.Payload, payload); err != nil {
+		return nil, errors.Wrap(err, "error unmarshalling payload")
+	}
+	configEnvelope := &common.ConfigEnvelope{}
+	if err := proto.Unmarshal(payload.Data, configEnvelope); err != nil {
+		return nil, errors.Wrap(err, "error unmarshalling config envelope")
+	}
+	if configEnvelope.Config == nil || configEnvelope.Config.ChannelGroup == nil {
+		return nil, errors.New("block is not a config block")
 	}
-	return obm.LastConfig.Index, nil
+	return configEnvelope.Config, nil
 }
 
 // GetMetadataFromBlock retrieves metadata at the specified index.
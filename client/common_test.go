@@ -0,0 +1,52 @@
+package client
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/feng081212/fabric-protos-go/peer"
+	"github.com/golang/protobuf/proto"
+)
+
+func TestProposalPayloadForTx(t *testing.T) {
+	input := ProtoMarshalIgnoreError(&peer.ChaincodeInvocationSpec{ChaincodeSpec: &peer.ChaincodeSpec{
+		ChaincodeId: &peer.ChaincodeID{Name: "basic"},
+		Input:       &peer.ChaincodeInput{Args: [][]byte{[]byte("CreateAsset"), []byte("asset1")}},
+	}})
+
+	// the transient map is left out of the transaction
+	proposal := &peer.Proposal{Payload: ProtoMarshalIgnoreError(&peer.ChaincodeProposalPayload{
+		Input:        input,
+		TransientMap: map[string][]byte{"asset_properties": []byte("secret")},
+	})}
+	payloadBytes, err := proposalPayloadForTx(proposal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload := &peer.ChaincodeProposalPayload{}
+	if err = proto.Unmarshal(payloadBytes, payload); err != nil {
+		t.Fatal(err)
+	}
+	if len(payload.TransientMap) != 0 {
+		t.Fatal("expected the transient map to be removed")
+	}
+	if !bytes.Equal(payload.Input, input) {
+		t.Fatal("expected the input to be unchanged")
+	}
+	if bytes.Contains(payloadBytes, []byte("secret")) {
+		t.Fatal("expected no transient data in the transaction")
+	}
+
+	// without a transient map the payload is used as it is
+	proposal = &peer.Proposal{Payload: ProtoMarshalIgnoreError(&peer.ChaincodeProposalPayload{Input: input})}
+	if payloadBytes, err = proposalPayloadForTx(proposal); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(payloadBytes, proposal.Payload) {
+		t.Fatal("expected the payload without transient map to be unchanged")
+	}
+
+	if _, err = proposalPayloadForTx(&peer.Proposal{Payload: []byte("not a payload")}); err == nil {
+		t.Fatal("expected an invalid payload to be refused")
+	}
+}
@@ -0,0 +1,346 @@
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/feng081212/fabric-protos-go/common"
+	"github.com/feng081212/fabric-sdk-go/fabric/configtxlator"
+	"github.com/golang/protobuf/proto"
+	"sort"
+	"strings"
+)
+
+type ConfigChangeType string
+
+const (
+	ConfigElementAdded    ConfigChangeType = "added"
+	ConfigElementRemoved  ConfigChangeType = "removed"
+	ConfigElementModified ConfigChangeType = "modified"
+)
+
+type ConfigElementKind string
+
+const (
+	ConfigGroupElement  ConfigElementKind = "group"
+	ConfigValueElement  ConfigElementKind = "value"
+	ConfigPolicyElement ConfigElementKind = "policy"
+)
+
+// ConfigChange is the change of a group, value or policy of the channel config
+type ConfigChange struct {
+	// Path is the path of the element, for example /Channel/Application/Org1MSP/AnchorPeers
+	Path   string
+	Kind   ConfigElementKind
+	Change ConfigChangeType
+	// OldVersion is not set for added elements, NewVersion is not set for removed elements
+	OldVersion uint64
+	NewVersion uint64
+	// ModPolicy is the absolute path of the policy that must be satisfied by the signatures of the
+	// update: the mod_policy of a modified element, or of the parent group when an element is
+	// added or removed
+	ModPolicy string
+	// Old and New are the JSON of values and policies, for modified groups only the mod_policy
+	// is shown
+	Old string
+	New string
+}
+
+// ConfigDiff is the list of changes between two channel configs, ordered by path
+type ConfigDiff struct {
+	Changes []*ConfigChange
+}
+
+// DiffConfigs returns the changes of updated compared to original, with the versions the config
+// update computed by Compute carries
+func DiffConfigs(original, updated *common.Config) (*ConfigDiff, error) {
+	if proto.Equal(original.ChannelGroup, updated.ChannelGroup) {
+		return &ConfigDiff{}, nil
+	}
+	configUpdate, err := Compute(original, updated)
+	if err != nil {
+		return nil, err
+	}
+	return DiffConfigUpdate(original, configUpdate)
+}
+
+// DiffConfigUpdate returns the changes the config update makes to original
+func DiffConfigUpdate(original *common.Config, configUpdate *common.ConfigUpdate) (*ConfigDiff, error) {
+	if original.ChannelGroup == nil {
+		return nil, fmt.Errorf("no channel group included for original config")
+	}
+	if configUpdate.WriteSet == nil {
+		return nil, fmt.Errorf("config update has no write set")
+	}
+
+	updated := applyConfigGroupUpdate(original.ChannelGroup, configUpdate.WriteSet)
+
+	diff := &ConfigDiff{}
+	if err := diff.groups([]string{ChannelGroupKey}, original.ChannelGroup, updated, ""); err != nil {
+		return nil, err
+	}
+	sort.SliceStable(diff.Changes, func(i, j int) bool {
+		return diff.Changes[i].Path < diff.Changes[j].Path
+	})
+	return diff, nil
+}
+
+// String returns the report of the changes, one change per line followed by the old and new
+// JSON of values and policies
+func (d *ConfigDiff) String() string {
+	if len(d.Changes) == 0 {
+		return "no changes\n"
+	}
+
+	var b strings.Builder
+	for _, c := range d.Changes {
+		var version string
+		switch c.Change {
+		case ConfigElementAdded:
+			version = fmt.Sprintf("version %d", c.NewVersion)
+		case ConfigElementRemoved:
+			version = fmt.Sprintf("version %d", c.OldVersion)
+		default:
+			version = fmt.Sprintf("version %d -> %d", c.OldVersion, c.NewVersion)
+		}
+		fmt.Fprintf(&b, "%-8s %-6s %s (%s, mod_policy %s)\n", c.Change, c.Kind, c.Path, version, c.ModPolicy)
+		if c.Old != "" {
+			fmt.Fprintf(&b, "\t- %s\n", c.Old)
+		}
+		if c.New != "" {
+			fmt.Fprintf(&b, "\t+ %s\n", c.New)
+		}
+	}
+	return b.String()
+}
+
+// applyConfigGroupUpdate applies the write set to the group like the orderer does: the members of
+// a group whose version changed are the ones of the write set, members that did not change
+// version keep their current content
+func applyConfigGroupUpdate(original, write *common.ConfigGroup) *common.ConfigGroup {
+	if write == nil {
+		return original
+	}
+	if original != nil && original.Version == write.Version {
+		result := proto.Clone(original).(*common.ConfigGroup)
+		for name, group := range write.Groups {
+			if result.Groups == nil {
+				result.Groups = make(map[string]*common.ConfigGroup)
+			}
+			result.Groups[name] = applyConfigGroupUpdate(original.Groups[name], group)
+		}
+		for name, value := range write.Values {
+			if existing, ok := original.Values[name]; !ok || existing.Version != value.Version {
+				if result.Values == nil {
+					result.Values = make(map[string]*common.ConfigValue)
+				}
+				result.Values[name] = value
+			}
+		}
+		for name, policy := range write.Policies {
+			if existing, ok := original.Policies[name]; !ok || existing.Version != policy.Version {
+				if result.Policies == nil {
+					result.Policies = make(map[string]*common.ConfigPolicy)
+				}
+				result.Policies[name] = policy
+			}
+		}
+		return result
+	}
+
+	result := &common.ConfigGroup{
+		Version:   write.Version,
+		ModPolicy: write.ModPolicy,
+		Groups:    make(map[string]*common.ConfigGroup),
+		Values:    make(map[string]*common.ConfigValue),
+		Policies:  make(map[string]*common.ConfigPolicy),
+	}
+	var originalGroups map[string]*common.ConfigGroup
+	var originalValues map[string]*common.ConfigValue
+	var originalPolicies map[string]*common.ConfigPolicy
+	if original != nil {
+		originalGroups, originalValues, originalPolicies = original.Groups, original.Values, original.Policies
+	}
+	for name, group := range write.Groups {
+		result.Groups[name] = applyConfigGroupUpdate(originalGroups[name], group)
+	}
+	for name, value := range write.Values {
+		if existing, ok := originalValues[name]; ok && existing.Version == value.Version {
+			value = existing
+		}
+		result.Values[name] = value
+	}
+	for name, policy := range write.Policies {
+		if existing, ok := originalPolicies[name]; ok && existing.Version == policy.Version {
+			policy = existing
+		}
+		result.Policies[name] = policy
+	}
+	return result
+}
+
+func (d *ConfigDiff) groups(path []string, original, updated *common.ConfigGroup, parentModPolicy string) error {
+	groupPath := "/" + strings.Join(path, "/")
+
+	switch {
+	case original == nil:
+		d.Changes = append(d.Changes, &ConfigChange{Path: groupPath, Kind: ConfigGroupElement, Change: ConfigElementAdded,
+			NewVersion: updated.Version, ModPolicy: parentModPolicy, New: "mod_policy " + updated.ModPolicy})
+	case updated == nil:
+		d.Changes = append(d.Changes, &ConfigChange{Path: groupPath, Kind: ConfigGroupElement, Change: ConfigElementRemoved,
+			OldVersion: original.Version, ModPolicy: parentModPolicy, Old: "mod_policy " + original.ModPolicy})
+		return nil
+	case original.Version != updated.Version || original.ModPolicy != updated.ModPolicy:
+		change := &ConfigChange{Path: groupPath, Kind: ConfigGroupElement, Change: ConfigElementModified,
+			OldVersion: original.Version, NewVersion: updated.Version, ModPolicy: absoluteModPolicy(path, original.ModPolicy)}
+		if original.ModPolicy != updated.ModPolicy {
+			change.Old, change.New = "mod_policy "+original.ModPolicy, "mod_policy "+updated.ModPolicy
+		}
+		d.Changes = append(d.Changes, change)
+	}
+
+	// members of added groups are authorized by the parent of the group, members of existing
+	// groups by the group itself
+	var originalGroups map[string]*common.ConfigGroup
+	var originalValues map[string]*common.ConfigValue
+	var originalPolicies map[string]*common.ConfigPolicy
+	membersModPolicy := parentModPolicy
+	if original != nil {
+		originalGroups, originalValues, originalPolicies = original.Groups, original.Values, original.Policies
+		membersModPolicy = absoluteModPolicy(path, original.ModPolicy)
+	}
+
+	for _, name := range unionKeys(originalGroups, updated.Groups) {
+		if err := d.groups(append(append([]string(nil), path...), name), originalGroups[name], updated.Groups[name], membersModPolicy); err != nil {
+			return err
+		}
+	}
+
+	for _, name := range unionKeys(originalValues, updated.Values) {
+		o, err := describeConfigValue(name, originalValues[name])
+		if err != nil {
+			return err
+		}
+		u, err := describeConfigValue(name, updated.Values[name])
+		if err != nil {
+			return err
+		}
+		if change := diffElement(path, name, ConfigValueElement, o, u, membersModPolicy); change != nil {
+			d.Changes = append(d.Changes, change)
+		}
+	}
+
+	for _, name := range unionKeys(originalPolicies, updated.Policies) {
+		o, err := describeConfigPolicy(originalPolicies[name])
+		if err != nil {
+			return err
+		}
+		u, err := describeConfigPolicy(updated.Policies[name])
+		if err != nil {
+			return err
+		}
+		if change := diffElement(path, name, ConfigPolicyElement, o, u, membersModPolicy); change != nil {
+			d.Changes = append(d.Changes, change)
+		}
+	}
+
+	return nil
+}
+
+// configElementContent is the version, mod_policy and JSON of a value or policy
+type configElementContent struct {
+	version   uint64
+	modPolicy string
+	json      string
+}
+
+func describeConfigValue(name string, value *common.ConfigValue) (*configElementContent, error) {
+	if value == nil {
+		return nil, nil
+	}
+	bs, err := configtxlator.ConfigValueToJSON(name, value.Value)
+	if err != nil {
+		return nil, err
+	}
+	return &configElementContent{version: value.Version, modPolicy: value.ModPolicy, json: compactJSON(bs)}, nil
+}
+
+func describeConfigPolicy(policy *common.ConfigPolicy) (*configElementContent, error) {
+	if policy == nil {
+		return nil, nil
+	}
+	content := &configElementContent{version: policy.Version, modPolicy: policy.ModPolicy}
+	if policy.Policy != nil {
+		bs, err := configtxlator.MarshalJSON(policy.Policy)
+		if err != nil {
+			return nil, err
+		}
+		content.json = compactJSON(bs)
+	}
+	return content, nil
+}
+
+func diffElement(path []string, name string, kind ConfigElementKind, original, updated *configElementContent, membersModPolicy string) *ConfigChange {
+	elementPath := "/" + strings.Join(append(append([]string(nil), path...), name), "/")
+
+	switch {
+	case original == nil:
+		return &ConfigChange{Path: elementPath, Kind: kind, Change: ConfigElementAdded, NewVersion: updated.version,
+			ModPolicy: membersModPolicy, New: updated.json + " (mod_policy " + updated.modPolicy + ")"}
+	case updated == nil:
+		return &ConfigChange{Path: elementPath, Kind: kind, Change: ConfigElementRemoved, OldVersion: original.version,
+			ModPolicy: membersModPolicy, Old: original.json + " (mod_policy " + original.modPolicy + ")"}
+	case *original == *updated:
+		return nil
+	}
+
+	change := &ConfigChange{Path: elementPath, Kind: kind, Change: ConfigElementModified, OldVersion: original.version,
+		NewVersion: updated.version, ModPolicy: absoluteModPolicy(path, original.modPolicy), Old: original.json, New: updated.json}
+	if original.modPolicy != updated.modPolicy {
+		change.Old += " (mod_policy " + original.modPolicy + ")"
+		change.New += " (mod_policy " + updated.modPolicy + ")"
+	}
+	return change
+}
+
+// absoluteModPolicy resolves a mod_policy relative to the group at path
+func absoluteModPolicy(path []string, modPolicy string) string {
+	if modPolicy == "" || strings.HasPrefix(modPolicy, "/") {
+		return modPolicy
+	}
+	return "/" + strings.Join(append(append([]string(nil), path...), modPolicy), "/")
+}
+
+func compactJSON(bs []byte) string {
+	var b bytes.Buffer
+	if err := json.Compact(&b, bs); err != nil {
+		return string(bs)
+	}
+	return b.String()
+}
+
+func unionKeys(maps ...interface{}) []string {
+	keys := make(map[string]bool)
+	for _, m := range maps {
+		switch m := m.(type) {
+		case map[string]*common.ConfigGroup:
+			for k := range m {
+				keys[k] = true
+			}
+		case map[string]*common.ConfigValue:
+			for k := range m {
+				keys[k] = true
+			}
+		case map[string]*common.ConfigPolicy:
+			for k := range m {
+				keys[k] = true
+			}
+		}
+	}
+	result := make([]string, 0, len(keys))
+	for k := range keys {
+		result = append(result, k)
+	}
+	sort.Strings(result)
+	return result
+}
@@ -0,0 +1,146 @@
+package client
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/feng081212/fabric-protos-go/common"
+	"github.com/feng081212/fabric-protos-go/peer"
+	"github.com/golang/protobuf/proto"
+)
+
+func testDiffOrg(t *testing.T, mspID string) *common.ConfigGroup {
+	group := NewConfigGroup(AdminsPolicyKey)
+	for _, name := range []string{AdminsPolicyKey, ReadersPolicyKey} {
+		policy, err := GetSignaturePolicy("OR('" + mspID + ".admin')")
+		if err != nil {
+			t.Fatal(err)
+		}
+		addPolicy(group, AdminsPolicyKey, name, policy)
+	}
+	_ = addValue(group, AdminsPolicyKey, AnchorPeersKey, &peer.AnchorPeers{AnchorPeers: []*peer.AnchorPeer{{Host: "peer0." + mspID, Port: 7051}}})
+	return group
+}
+
+func testDiffConfig(t *testing.T) *common.Config {
+	application := NewConfigGroup(AdminsPolicyKey)
+	application.Policies[AdminsPolicyKey] = implicitMetaAdmins(common.ImplicitMetaPolicy_MAJORITY)
+	_ = addValue(application, AdminsPolicyKey, CapabilitiesKey, CapabilitiesConfigValue([]string{"V2_0"}))
+	application.Groups["Org1"] = testDiffOrg(t, "Org1")
+	application.Groups["Org3"] = testDiffOrg(t, "Org3")
+
+	channel := NewConfigGroup(AdminsPolicyKey)
+	channel.Groups[ApplicationGroupKey] = application
+	return &common.Config{ChannelGroup: channel}
+}
+
+func TestDiffConfigs(t *testing.T) {
+	original := testDiffConfig(t)
+	updated := proto.Clone(original).(*common.Config)
+	application := updated.ChannelGroup.Groups[ApplicationGroupKey]
+
+	delete(application.Values, CapabilitiesKey)
+	delete(application.Groups, "Org3")
+	application.Groups["Org2"] = NewConfigGroup(AdminsPolicyKey)
+	policy, _ := GetSignaturePolicy("OR('Org2.admin')")
+	addPolicy(application.Groups["Org2"], AdminsPolicyKey, AdminsPolicyKey, policy)
+
+	org1 := application.Groups["Org1"]
+	_ = addValue(org1, AdminsPolicyKey, AnchorPeersKey, &peer.AnchorPeers{AnchorPeers: []*peer.AnchorPeer{{Host: "peer1.Org1", Port: 7051}}})
+	org1.Policies[ReadersPolicyKey].ModPolicy = "/Channel/Application/Admins"
+	addPolicy(org1, AdminsPolicyKey, WritersPolicyKey, policy)
+
+	diff, err := DiffConfigs(original, updated)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []ConfigChange{
+		{Path: "/Channel/Application", Kind: ConfigGroupElement, Change: ConfigElementModified, NewVersion: 1, ModPolicy: "/Channel/Application/Admins"},
+		{Path: "/Channel/Application/Capabilities", Kind: ConfigValueElement, Change: ConfigElementRemoved, ModPolicy: "/Channel/Application/Admins"},
+		{Path: "/Channel/Application/Org1", Kind: ConfigGroupElement, Change: ConfigElementModified, NewVersion: 1, ModPolicy: "/Channel/Application/Org1/Admins"},
+		{Path: "/Channel/Application/Org1/AnchorPeers", Kind: ConfigValueElement, Change: ConfigElementModified, NewVersion: 1, ModPolicy: "/Channel/Application/Org1/Admins"},
+		{Path: "/Channel/Application/Org1/Readers", Kind: ConfigPolicyElement, Change: ConfigElementModified, NewVersion: 1, ModPolicy: "/Channel/Application/Org1/Admins"},
+		{Path: "/Channel/Application/Org1/Writers", Kind: ConfigPolicyElement, Change: ConfigElementAdded, ModPolicy: "/Channel/Application/Org1/Admins"},
+		// the members of an added group are authorized by the parent of the group
+		{Path: "/Channel/Application/Org2", Kind: ConfigGroupElement, Change: ConfigElementAdded, ModPolicy: "/Channel/Application/Admins"},
+		{Path: "/Channel/Application/Org2/Admins", Kind: ConfigPolicyElement, Change: ConfigElementAdded, ModPolicy: "/Channel/Application/Admins"},
+		{Path: "/Channel/Application/Org3", Kind: ConfigGroupElement, Change: ConfigElementRemoved, ModPolicy: "/Channel/Application/Admins"},
+	}
+
+	if len(diff.Changes) != len(expected) {
+		t.Fatalf("expected %d changes, got:\n%s", len(expected), diff)
+	}
+	for i, e := range expected {
+		c := diff.Changes[i]
+		if c.Path != e.Path || c.Kind != e.Kind || c.Change != e.Change || c.OldVersion != e.OldVersion ||
+			c.NewVersion != e.NewVersion || c.ModPolicy != e.ModPolicy {
+			t.Errorf("change %d: expected %+v, got %+v", i, e, *c)
+		}
+	}
+
+	anchorPeers := diff.Changes[3]
+	if !strings.Contains(anchorPeers.Old, "peer0.Org1") || !strings.Contains(anchorPeers.New, "peer1.Org1") {
+		t.Errorf("expected the JSON of the anchor peers, got %s and %s", anchorPeers.Old, anchorPeers.New)
+	}
+	readers := diff.Changes[4]
+	if !strings.Contains(readers.Old, "(mod_policy Admins)") || !strings.Contains(readers.New, "(mod_policy /Channel/Application/Admins)") {
+		t.Errorf("expected the mod_policy change of the readers policy, got %s and %s", readers.Old, readers.New)
+	}
+	if report := diff.String(); !strings.Contains(report, "removed  group  /Channel/Application/Org3") {
+		t.Errorf("unexpected report:\n%s", report)
+	}
+}
+
+func TestDiffConfigsUnchanged(t *testing.T) {
+	original := testDiffConfig(t)
+	diff, err := DiffConfigs(original, proto.Clone(original).(*common.Config))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diff.Changes) != 0 || diff.String() != "no changes\n" {
+		t.Fatalf("expected no changes, got:\n%s", diff)
+	}
+}
+
+func TestDiffConfigUpdate(t *testing.T) {
+	original := testDiffConfig(t)
+	org1 := original.ChannelGroup.Groups[ApplicationGroupKey].Groups["Org1"]
+
+	// the write set repeats the unchanged readers policy with its current version, only the
+	// anchor peers with a new version are modified
+	writeOrg1 := &common.ConfigGroup{
+		Version:   org1.Version,
+		ModPolicy: org1.ModPolicy,
+		Values: map[string]*common.ConfigValue{AnchorPeersKey: {
+			Version:   org1.Values[AnchorPeersKey].Version + 1,
+			ModPolicy: "/Channel/Application/Admins",
+			Value:     ProtoMarshalIgnoreError(&peer.AnchorPeers{}),
+		}},
+		Policies: map[string]*common.ConfigPolicy{ReadersPolicyKey: org1.Policies[ReadersPolicyKey]},
+	}
+	update := &common.ConfigUpdate{
+		ChannelId: "mychannel",
+		WriteSet: &common.ConfigGroup{Groups: map[string]*common.ConfigGroup{
+			ApplicationGroupKey: {Groups: map[string]*common.ConfigGroup{"Org1": writeOrg1}},
+		}},
+	}
+
+	diff, err := DiffConfigUpdate(original, update)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diff.Changes) != 1 {
+		t.Fatalf("expected 1 change, got:\n%s", diff)
+	}
+	change := diff.Changes[0]
+	// the mod_policy of the current value authorizes the change, not the one of the write set
+	if change.Path != "/Channel/Application/Org1/AnchorPeers" || change.Change != ConfigElementModified ||
+		change.ModPolicy != "/Channel/Application/Org1/Admins" || change.NewVersion != 1 {
+		t.Fatalf("unexpected change %+v", *change)
+	}
+
+	if _, err = DiffConfigUpdate(original, &common.ConfigUpdate{}); err == nil {
+		t.Fatal("expected a config update without write set to fail")
+	}
+}
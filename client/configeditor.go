@@ -0,0 +1,531 @@
+package client
+
+import (
+	"fmt"
+	"github.com/feng081212/fabric-protos-go/common"
+	"github.com/feng081212/fabric-protos-go/orderer"
+	"github.com/feng081212/fabric-protos-go/orderer/etcdraft"
+	"github.com/feng081212/fabric-protos-go/peer"
+	"github.com/feng081212/fabric-sdk-go/fabric/policies"
+	"github.com/golang/protobuf/proto"
+	"github.com/pkg/errors"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ConfigEditor edits a channel config through typed accessors. The accessors of groups never
+// fail, a missing group is reported by the setters called on it.
+type ConfigEditor struct {
+	config *common.Config
+}
+
+func NewConfigEditor(config *common.Config) *ConfigEditor {
+	return &ConfigEditor{config: config}
+}
+
+// Config returns the edited config
+func (e *ConfigEditor) Config() *common.Config {
+	return e.config
+}
+
+func (e *ConfigEditor) channel() *GroupEditor {
+	if e.config == nil || e.config.ChannelGroup == nil {
+		return &GroupEditor{path: "/" + ChannelGroupKey, err: errors.New("config has no channel group")}
+	}
+	return &GroupEditor{group: e.config.ChannelGroup, path: "/" + ChannelGroupKey}
+}
+
+func (e *ConfigEditor) Application() *ApplicationEditor {
+	return &ApplicationEditor{GroupEditor: e.channel().subGroup(ApplicationGroupKey)}
+}
+
+func (e *ConfigEditor) Orderer() *OrdererEditor {
+	return &OrdererEditor{GroupEditor: e.channel().subGroup(OrdererGroupKey)}
+}
+
+// Consortium edits a consortium of the system channel
+func (e *ConfigEditor) Consortium(name string) *ConsortiumEditor {
+	return &ConsortiumEditor{GroupEditor: e.channel().subGroup(ConsortiumsGroupKey).subGroup(name)}
+}
+
+// SetCapabilities sets the channel capabilities
+func (e *ConfigEditor) SetCapabilities(capabilities ...string) error {
+	return e.channel().SetCapabilities(capabilities...)
+}
+
+// SetPolicy sets the policy at path, which is either absolute, like /Channel/Application/Admins,
+// or relative to /Channel, like Application/Org1MSP/Endorsement. A rule like "MAJORITY Admins"
+// is an implicit meta policy, other rules are signature policies like "OR('Org1MSP.admin')".
+func (e *ConfigEditor) SetPolicy(path, rule string) error {
+	path = strings.TrimPrefix(path, "/"+ChannelGroupKey+"/")
+	elements := strings.Split(strings.Trim(path, "/"), "/")
+	group := e.channel()
+	for _, name := range elements[:len(elements)-1] {
+		group = group.subGroup(name)
+	}
+	return group.SetPolicy(elements[len(elements)-1], rule)
+}
+
+// GroupEditor edits the values and policies of a config group
+type GroupEditor struct {
+	group *common.ConfigGroup
+	path  string
+	err   error
+}
+
+// Group returns the edited config group, or the error if the group does not exist
+func (g *GroupEditor) Group() (*common.ConfigGroup, error) {
+	return g.group, g.err
+}
+
+func (g *GroupEditor) subGroup(name string) *GroupEditor {
+	path := g.path + "/" + name
+	if g.err != nil {
+		return &GroupEditor{path: path, err: g.err}
+	}
+	group, ok := g.group.Groups[name]
+	if !ok {
+		return &GroupEditor{path: path, err: errors.Errorf("config group [%s] does not exist", path)}
+	}
+	return &GroupEditor{group: group, path: path}
+}
+
+// SetCapabilities sets the capabilities of the group
+func (g *GroupEditor) SetCapabilities(capabilities ...string) error {
+	if len(capabilities) == 0 {
+		return errors.New("at least one capability is required")
+	}
+	for _, capability := range capabilities {
+		if capability == "" {
+			return errors.New("capability name is required")
+		}
+	}
+	return g.setValue(CapabilitiesKey, CapabilitiesConfigValue(capabilities))
+}
+
+// SetPolicy sets the policy of the group with the given name, see ConfigEditor.SetPolicy for the
+// rule syntax
+func (g *GroupEditor) SetPolicy(name, rule string) error {
+	if g.err != nil {
+		return g.err
+	}
+	if name == "" {
+		return errors.New("policy name is required")
+	}
+
+	policy, err := parsePolicyRule(rule)
+	if err != nil {
+		return errors.WithMessagef(err, "policy [%s/%s]", g.path, name)
+	}
+
+	if existing, ok := g.group.Policies[name]; ok {
+		existing.Policy = policy
+		return nil
+	}
+	if g.group.Policies == nil {
+		g.group.Policies = make(map[string]*common.ConfigPolicy)
+	}
+	addPolicy(g.group, AdminsPolicyKey, name, policy)
+	return nil
+}
+
+// RemovePolicy removes the policy of the group with the given name
+func (g *GroupEditor) RemovePolicy(name string) error {
+	if g.err != nil {
+		return g.err
+	}
+	if _, ok := g.group.Policies[name]; !ok {
+		return errors.Errorf("policy [%s/%s] does not exist", g.path, name)
+	}
+	delete(g.group.Policies, name)
+	return nil
+}
+
+// setValue replaces the value, keeping its mod_policy, or adds it with the Admins mod_policy
+func (g *GroupEditor) setValue(key string, value proto.Message) error {
+	if g.err != nil {
+		return g.err
+	}
+	bs, err := proto.Marshal(value)
+	if err != nil {
+		return errors.Wrapf(err, "marshal value [%s/%s] failed", g.path, key)
+	}
+	if existing, ok := g.group.Values[key]; ok {
+		existing.Value = bs
+		return nil
+	}
+	if g.group.Values == nil {
+		g.group.Values = make(map[string]*common.ConfigValue)
+	}
+	g.group.Values[key] = &common.ConfigValue{Value: bs, ModPolicy: AdminsPolicyKey}
+	return nil
+}
+
+// getValue unmarshals the value, found is false if the group has no such value
+func (g *GroupEditor) getValue(key string, value proto.Message) (found bool, err error) {
+	if g.err != nil {
+		return false, g.err
+	}
+	existing, ok := g.group.Values[key]
+	if !ok {
+		return false, nil
+	}
+	if err = proto.Unmarshal(existing.Value, value); err != nil {
+		return true, errors.Wrapf(err, "unmarshal value [%s/%s] failed", g.path, key)
+	}
+	return true, nil
+}
+
+func (g *GroupEditor) addGroup(name string, group *common.ConfigGroup) error {
+	if g.err != nil {
+		return g.err
+	}
+	if _, ok := g.group.Groups[name]; ok {
+		return errors.Errorf("config group [%s/%s] already exists", g.path, name)
+	}
+	if g.group.Groups == nil {
+		g.group.Groups = make(map[string]*common.ConfigGroup)
+	}
+	g.group.Groups[name] = group
+	return nil
+}
+
+func (g *GroupEditor) removeGroup(name string) error {
+	if g.err != nil {
+		return g.err
+	}
+	if _, ok := g.group.Groups[name]; !ok {
+		return errors.Errorf("config group [%s/%s] does not exist", g.path, name)
+	}
+	delete(g.group.Groups, name)
+	return nil
+}
+
+// ApplicationEditor edits the Application group of a channel config
+type ApplicationEditor struct {
+	*GroupEditor
+}
+
+func (a *ApplicationEditor) Organization(mspID string) *OrganizationEditor {
+	return &OrganizationEditor{GroupEditor: a.subGroup(mspID)}
+}
+
+func (a *ApplicationEditor) AddOrganization(organization *Organization) error {
+	if organization == nil {
+		return errors.New("organization is required")
+	}
+	group, err := organization.BuildConfigGroupForApplication()
+	if err != nil {
+		return err
+	}
+	return a.addGroup(organization.ID, group)
+}
+
+func (a *ApplicationEditor) RemoveOrganization(mspID string) error {
+	return a.removeGroup(mspID)
+}
+
+// SetACL sets the policy checked for the API resource, policyRef is either absolute or relative
+// to /Channel/Application
+func (a *ApplicationEditor) SetACL(resource, policyRef string) error {
+	if resource == "" {
+		return errors.New("ACL resource is required")
+	}
+	if policyRef == "" {
+		return errors.Errorf("policy of ACL resource [%s] is required", resource)
+	}
+
+	acls := &peer.ACLs{}
+	if _, err := a.getValue(ACLsKey, acls); err != nil {
+		return err
+	}
+	if acls.Acls == nil {
+		acls.Acls = make(map[string]*peer.APIResource)
+	}
+	acls.Acls[resource] = &peer.APIResource{PolicyRef: policyRef}
+	return a.setValue(ACLsKey, acls)
+}
+
+// OrganizationEditor edits the group of an organization
+type OrganizationEditor struct {
+	*GroupEditor
+}
+
+// SetAnchorPeers replaces the anchor peers of an application organization, an empty list is an
+// error
+func (o *OrganizationEditor) SetAnchorPeers(anchors ...*AnchorPeer) error {
+	if len(anchors) == 0 {
+		return errors.New("at least one anchor peer is required")
+	}
+
+	anchorPeers := &peer.AnchorPeers{}
+	for _, anchor := range anchors {
+		if anchor == nil || anchor.Host == "" {
+			return errors.New("anchor peer host is required")
+		}
+		if anchor.Port <= 0 || anchor.Port > 65535 {
+			return errors.Errorf("invalid port %d of anchor peer [%s]", anchor.Port, anchor.Host)
+		}
+		anchorPeers.AnchorPeers = append(anchorPeers.AnchorPeers, &peer.AnchorPeer{Host: anchor.Host, Port: int32(anchor.Port)})
+	}
+	return o.setValue(AnchorPeersKey, anchorPeers)
+}
+
+// ConsortiumEditor edits a consortium of the system channel
+type ConsortiumEditor struct {
+	*GroupEditor
+}
+
+func (c *ConsortiumEditor) Organization(mspID string) *OrganizationEditor {
+	return &OrganizationEditor{GroupEditor: c.subGroup(mspID)}
+}
+
+func (c *ConsortiumEditor) AddOrganization(organization *Organization) error {
+	if organization == nil {
+		return errors.New("organization is required")
+	}
+	group, err := organization.BuildConfigGroupForConsortium()
+	if err != nil {
+		return err
+	}
+	return c.addGroup(organization.ID, group)
+}
+
+func (c *ConsortiumEditor) RemoveOrganization(mspID string) error {
+	return c.removeGroup(mspID)
+}
+
+// OrdererEditor edits the Orderer group of a channel config
+type OrdererEditor struct {
+	*GroupEditor
+}
+
+func (o *OrdererEditor) Organization(mspID string) *OrganizationEditor {
+	return &OrganizationEditor{GroupEditor: o.subGroup(mspID)}
+}
+
+func (o *OrdererEditor) SetBatchSize(batchSize *orderer.BatchSize) error {
+	if batchSize == nil {
+		return errors.New("batch size is required")
+	}
+	if batchSize.MaxMessageCount == 0 {
+		return errors.New("batch size MaxMessageCount must be greater than 0")
+	}
+	if batchSize.AbsoluteMaxBytes == 0 {
+		return errors.New("batch size AbsoluteMaxBytes must be greater than 0")
+	}
+	if batchSize.PreferredMaxBytes == 0 || batchSize.PreferredMaxBytes > batchSize.AbsoluteMaxBytes {
+		return errors.New("batch size PreferredMaxBytes must be greater than 0 and not greater than AbsoluteMaxBytes")
+	}
+	return o.setValue(BatchSizeKey, batchSize)
+}
+
+func (o *OrdererEditor) SetBatchTimeout(timeout time.Duration) error {
+	if timeout <= 0 {
+		return errors.New("batch timeout must be greater than 0")
+	}
+	return o.setValue(BatchTimeoutKey, &orderer.BatchTimeout{Timeout: timeout.String()})
+}
+
+// AddConsenter adds a consenter to the Raft cluster of the channel
+func (o *OrdererEditor) AddConsenter(endpoint *OrdererEndpoint) error {
+	if endpoint == nil || endpoint.Host == "" || endpoint.Port == 0 {
+		return errors.New("consenter host and port are required")
+	}
+	consenter, err := endpoint.GetRaftConsenter()
+	if err != nil {
+		return errors.WithMessagef(err, "invalid TLS certificates of consenter [%s:%d]", endpoint.Host, endpoint.Port)
+	}
+
+	return o.updateRaftMetadata(func(metadata *etcdraft.ConfigMetadata) error {
+		for _, existing := range metadata.Consenters {
+			if existing.Host == consenter.Host && existing.Port == consenter.Port {
+				return errors.Errorf("consenter [%s:%d] already exists", consenter.Host, consenter.Port)
+			}
+		}
+		metadata.Consenters = append(metadata.Consenters, consenter)
+		return nil
+	})
+}
+
+// RemoveConsenter removes a consenter from the Raft cluster of the channel, the last consenter
+// cannot be removed. Whether the remaining consenters keep a quorum depends on which of them are
+// up, which the config does not tell, see CheckConsenterRemoval.
+func (o *OrdererEditor) RemoveConsenter(host string, port uint32) error {
+	return o.updateRaftMetadata(func(metadata *etcdraft.ConfigMetadata) error {
+		for i, existing := range metadata.Consenters {
+			if existing.Host != host || existing.Port != port {
+				continue
+			}
+			if len(metadata.Consenters) == 1 {
+				return errors.Errorf("consenter [%s:%d] is the last consenter of the channel", host, port)
+			}
+			metadata.Consenters = append(metadata.Consenters[:i], metadata.Consenters[i+1:]...)
+			return nil
+		}
+		return errors.Errorf("consenter [%s:%d] does not exist", host, port)
+	})
+}
+
+// UpdateConsenterTLSCerts replaces the TLS certificates of the consenter with the host and port
+// of endpoint
+func (o *OrdererEditor) UpdateConsenterTLSCerts(endpoint *OrdererEndpoint) error {
+	if endpoint == nil || endpoint.Host == "" || endpoint.Port == 0 {
+		return errors.New("consenter host and port are required")
+	}
+	consenter, err := endpoint.GetRaftConsenter()
+	if err != nil {
+		return errors.WithMessagef(err, "invalid TLS certificates of consenter [%s:%d]", endpoint.Host, endpoint.Port)
+	}
+
+	return o.updateRaftMetadata(func(metadata *etcdraft.ConfigMetadata) error {
+		for i, existing := range metadata.Consenters {
+			if existing.Host == consenter.Host && existing.Port == consenter.Port {
+				if proto.Equal(existing, consenter) {
+					return errors.Errorf("consenter [%s:%d] already has these TLS certificates", consenter.Host, consenter.Port)
+				}
+				metadata.Consenters[i] = consenter
+				return nil
+			}
+		}
+		return errors.Errorf("consenter [%s:%d] does not exist", consenter.Host, consenter.Port)
+	})
+}
+
+// SetRaftOptions replaces the options of the Raft cluster of the channel
+func (o *OrdererEditor) SetRaftOptions(options *etcdraft.Options) error {
+	if err := ValidateRaftOptions(options); err != nil {
+		return err
+	}
+	return o.updateRaftMetadata(func(metadata *etcdraft.ConfigMetadata) error {
+		metadata.Options = options
+		return nil
+	})
+}
+
+// RaftMetadata returns the Raft metadata of the ConsensusType value
+func (o *OrdererEditor) RaftMetadata() (*etcdraft.ConfigMetadata, error) {
+	var result *etcdraft.ConfigMetadata
+	err := o.updateRaftMetadata(func(metadata *etcdraft.ConfigMetadata) error {
+		result = metadata
+		return nil
+	})
+	return result, err
+}
+
+// updateRaftMetadata calls update with the Raft metadata of the ConsensusType value and writes
+// back the result
+func (o *OrdererEditor) updateRaftMetadata(update func(metadata *etcdraft.ConfigMetadata) error) error {
+	consensusType := &orderer.ConsensusType{}
+	found, err := o.getValue(ConsensusTypeKey, consensusType)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return errors.Errorf("config group [%s] has no %s value", o.path, ConsensusTypeKey)
+	}
+	if consensusType.Type != ConsensusTypeEtcdRaft {
+		return errors.Errorf("consensus type is [%s], not %s", consensusType.Type, ConsensusTypeEtcdRaft)
+	}
+
+	metadata := &etcdraft.ConfigMetadata{}
+	if err = proto.Unmarshal(consensusType.Metadata, metadata); err != nil {
+		return errors.Wrap(err, "unmarshal raft metadata failed")
+	}
+	if err = update(metadata); err != nil {
+		return err
+	}
+	if consensusType.Metadata, err = proto.Marshal(metadata); err != nil {
+		return errors.Wrap(err, "marshal raft metadata failed")
+	}
+	return o.setValue(ConsensusTypeKey, consensusType)
+}
+
+func ValidateRaftOptions(options *etcdraft.Options) error {
+	if options == nil {
+		return errors.New("raft options are required")
+	}
+	tickInterval, err := time.ParseDuration(options.TickInterval)
+	if err != nil {
+		return errors.Wrapf(err, "invalid raft TickInterval [%s]", options.TickInterval)
+	}
+	if tickInterval <= 0 {
+		return errors.New("raft TickInterval must be greater than 0")
+	}
+	if options.HeartbeatTick == 0 {
+		return errors.New("raft HeartbeatTick must be greater than 0")
+	}
+	if options.ElectionTick <= options.HeartbeatTick {
+		return errors.Errorf("raft ElectionTick %d must be greater than HeartbeatTick %d", options.ElectionTick, options.HeartbeatTick)
+	}
+	if options.MaxInflightBlocks == 0 {
+		return errors.New("raft MaxInflightBlocks must be greater than 0")
+	}
+	return nil
+}
+
+// CheckConsenterChange refuses an updated config whose Raft cluster differs from the original in
+// more than one consenter, counting added, removed and rotated consenters. Channels that are not
+// ordered by Raft are not checked.
+func CheckConsenterChange(original, updated *common.Config) error {
+	originalOrderer := NewConfigEditor(original).Orderer()
+	if originalOrderer.err != nil {
+		// no orderer group, so no consenters
+		return nil
+	}
+	consensusType := &orderer.ConsensusType{}
+	found, err := originalOrderer.getValue(ConsensusTypeKey, consensusType)
+	if err != nil {
+		return err
+	}
+	if !found || consensusType.Type != ConsensusTypeEtcdRaft {
+		return nil
+	}
+
+	originalMetadata, err := originalOrderer.RaftMetadata()
+	if err != nil {
+		return err
+	}
+	updatedMetadata, err := NewConfigEditor(updated).Orderer().RaftMetadata()
+	if err != nil {
+		return err
+	}
+
+	key := func(c *etcdraft.Consenter) string {
+		return fmt.Sprintf("%s:%d", c.Host, c.Port)
+	}
+	consenters := make(map[string]*etcdraft.Consenter)
+	for _, c := range originalMetadata.Consenters {
+		consenters[key(c)] = c
+	}
+
+	var changed []string
+	for _, c := range updatedMetadata.Consenters {
+		existing, ok := consenters[key(c)]
+		if !ok || !proto.Equal(existing, c) {
+			changed = append(changed, key(c))
+		}
+		delete(consenters, key(c))
+	}
+	for k := range consenters {
+		changed = append(changed, k)
+	}
+	if len(changed) > 1 {
+		sort.Strings(changed)
+		return errors.Errorf("only one consenter can be changed at a time, changed consenters are %v", changed)
+	}
+	return nil
+}
+
+// parsePolicyRule parses an implicit meta rule like "MAJORITY Admins", or else a signature
+// policy rule
+func parsePolicyRule(rule string) (*common.Policy, error) {
+	if rule == "" {
+		return nil, errors.New("policy rule is required")
+	}
+	if implicitMeta, err := policies.ImplicitMetaFromString(rule); err == nil {
+		return NewImplicitMetaPolicy(implicitMeta)
+	}
+	return GetSignaturePolicy(rule)
+}
@@ -0,0 +1,305 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/feng081212/fabric-protos-go/common"
+	"github.com/feng081212/fabric-protos-go/orderer"
+	"github.com/feng081212/fabric-protos-go/orderer/etcdraft"
+	"github.com/feng081212/fabric-protos-go/peer"
+	"github.com/golang/protobuf/proto"
+)
+
+func testEditorConfig() *common.Config {
+	org1 := NewConfigGroup(AdminsPolicyKey)
+	_ = addValue(org1, "/Channel/Application/Admins", AnchorPeersKey, &peer.AnchorPeers{AnchorPeers: []*peer.AnchorPeer{{Host: "peer0.org1.example.com", Port: 7051}}})
+	org2 := NewConfigGroup(AdminsPolicyKey)
+
+	application := NewConfigGroup(AdminsPolicyKey)
+	application.Groups["Org1MSP"] = org1
+	application.Groups["Org2MSP"] = org2
+
+	ordererGroup := NewConfigGroup(AdminsPolicyKey)
+	_ = addValue(ordererGroup, AdminsPolicyKey, BatchSizeKey, &orderer.BatchSize{MaxMessageCount: 500, AbsoluteMaxBytes: 10 << 20, PreferredMaxBytes: 2 << 20})
+
+	channel := NewConfigGroup(AdminsPolicyKey)
+	channel.Groups[ApplicationGroupKey] = application
+	channel.Groups[OrdererGroupKey] = ordererGroup
+	return &common.Config{ChannelGroup: channel}
+}
+
+func TestSetAnchorPeers(t *testing.T) {
+	config := testEditorConfig()
+	editor := NewConfigEditor(config)
+
+	err := editor.Application().Organization("Org1MSP").SetAnchorPeers(&AnchorPeer{Host: "peer1.org1.example.com", Port: 8051}, &AnchorPeer{Host: "peer2.org1.example.com", Port: 9051})
+	if err != nil {
+		t.Fatal(err)
+	}
+	value := config.ChannelGroup.Groups[ApplicationGroupKey].Groups["Org1MSP"].Values[AnchorPeersKey]
+	anchorPeers := &peer.AnchorPeers{}
+	if err = proto.Unmarshal(value.Value, anchorPeers); err != nil {
+		t.Fatal(err)
+	}
+	if len(anchorPeers.AnchorPeers) != 2 || anchorPeers.AnchorPeers[0].Host != "peer1.org1.example.com" || anchorPeers.AnchorPeers[1].Port != 9051 {
+		t.Fatalf("expected the anchor peers to be replaced, got %v", anchorPeers.AnchorPeers)
+	}
+	if value.ModPolicy != "/Channel/Application/Admins" {
+		t.Fatalf("expected the mod_policy of the value to be kept, got %s", value.ModPolicy)
+	}
+
+	// an organization without anchor peers gets the value with the Admins mod_policy
+	if err = editor.Application().Organization("Org2MSP").SetAnchorPeers(&AnchorPeer{Host: "peer0.org2.example.com", Port: 7051}); err != nil {
+		t.Fatal(err)
+	}
+	if value = config.ChannelGroup.Groups[ApplicationGroupKey].Groups["Org2MSP"].Values[AnchorPeersKey]; value == nil || value.ModPolicy != AdminsPolicyKey {
+		t.Fatalf("expected the anchor peers to be added with the Admins mod_policy, got %v", value)
+	}
+
+	invalid := []struct {
+		name    string
+		mspID   string
+		anchors []*AnchorPeer
+	}{
+		{"empty list", "Org1MSP", nil},
+		{"nil anchor peer", "Org1MSP", []*AnchorPeer{nil}},
+		{"missing host", "Org1MSP", []*AnchorPeer{{Port: 7051}}},
+		{"invalid port", "Org1MSP", []*AnchorPeer{{Host: "peer0.org1.example.com", Port: 70000}}},
+		{"unknown organization", "Org3MSP", []*AnchorPeer{{Host: "peer0.org3.example.com", Port: 7051}}},
+	}
+	for _, test := range invalid {
+		t.Run(test.name, func(t *testing.T) {
+			before := proto.Clone(config)
+			if err := editor.Application().Organization(test.mspID).SetAnchorPeers(test.anchors...); err == nil {
+				t.Fatal("expected an error")
+			}
+			if !proto.Equal(before, config) {
+				t.Fatal("expected the config to be left unchanged")
+			}
+		})
+	}
+}
+
+func TestSetBatchSize(t *testing.T) {
+	config := testEditorConfig()
+	editor := NewConfigEditor(config)
+
+	if err := editor.Orderer().SetBatchSize(&orderer.BatchSize{MaxMessageCount: 100, AbsoluteMaxBytes: 1 << 20, PreferredMaxBytes: 1 << 20}); err != nil {
+		t.Fatal(err)
+	}
+	batchSize := &orderer.BatchSize{}
+	if err := proto.Unmarshal(config.ChannelGroup.Groups[OrdererGroupKey].Values[BatchSizeKey].Value, batchSize); err != nil {
+		t.Fatal(err)
+	}
+	if batchSize.MaxMessageCount != 100 || batchSize.AbsoluteMaxBytes != 1<<20 || batchSize.PreferredMaxBytes != 1<<20 {
+		t.Fatalf("expected the batch size to be replaced, got %v", batchSize)
+	}
+
+	invalid := []struct {
+		name      string
+		batchSize *orderer.BatchSize
+	}{
+		{"nil", nil},
+		{"no messages", &orderer.BatchSize{AbsoluteMaxBytes: 1 << 20, PreferredMaxBytes: 1 << 20}},
+		{"no absolute max bytes", &orderer.BatchSize{MaxMessageCount: 100, PreferredMaxBytes: 1 << 20}},
+		{"no preferred max bytes", &orderer.BatchSize{MaxMessageCount: 100, AbsoluteMaxBytes: 1 << 20}},
+		{"preferred above absolute", &orderer.BatchSize{MaxMessageCount: 100, AbsoluteMaxBytes: 1 << 20, PreferredMaxBytes: 2 << 20}},
+	}
+	for _, test := range invalid {
+		t.Run(test.name, func(t *testing.T) {
+			if err := editor.Orderer().SetBatchSize(test.batchSize); err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+
+	if err := NewConfigEditor(&common.Config{ChannelGroup: NewConfigGroup(AdminsPolicyKey)}).Orderer().SetBatchSize(batchSize); err == nil {
+		t.Fatal("expected a config without orderer group to fail")
+	}
+}
+
+func testRaftConfig(consenters int) *common.Config {
+	metadata := &etcdraft.ConfigMetadata{Options: DefaultRaftOptions()}
+	for i := 0; i < consenters; i++ {
+		metadata.Consenters = append(metadata.Consenters, &etcdraft.Consenter{Host: fmt.Sprintf("orderer%d.example.com", i), Port: 7050})
+	}
+	config := testEditorConfig()
+	_ = addValue(config.ChannelGroup.Groups[OrdererGroupKey], AdminsPolicyKey, ConsensusTypeKey, &orderer.ConsensusType{
+		Type:     ConsensusTypeEtcdRaft,
+		Metadata: ProtoMarshalIgnoreError(metadata),
+	})
+	return config
+}
+
+func TestRemoveConsenter(t *testing.T) {
+	tests := []struct {
+		consenters int
+		removable  bool
+	}{
+		{1, false},
+		{2, true},
+		{3, true},
+	}
+
+	for _, test := range tests {
+		t.Run(fmt.Sprintf("%d consenters", test.consenters), func(t *testing.T) {
+			editor := NewConfigEditor(testRaftConfig(test.consenters))
+			err := editor.Orderer().RemoveConsenter("orderer0.example.com", 7050)
+			if test.removable && err != nil {
+				t.Fatalf("expected the consenter to be removed: %s", err)
+			}
+			if !test.removable && err == nil {
+				t.Fatal("expected the removal to be refused")
+			}
+
+			metadata, err := editor.Orderer().RaftMetadata()
+			if err != nil {
+				t.Fatal(err)
+			}
+			expected := test.consenters
+			if test.removable {
+				expected--
+			}
+			if len(metadata.Consenters) != expected {
+				t.Fatalf("expected %d consenters, got %d", expected, len(metadata.Consenters))
+			}
+			for _, c := range metadata.Consenters {
+				if test.removable && c.Host == "orderer0.example.com" {
+					t.Fatal("expected orderer0.example.com to be removed")
+				}
+			}
+		})
+	}
+
+	editor := NewConfigEditor(testRaftConfig(3))
+	if err := editor.Orderer().RemoveConsenter("orderer0.example.com", 8050); err == nil {
+		t.Fatal("expected the removal of an unknown consenter to fail")
+	}
+	if err := NewConfigEditor(testEditorConfig()).Orderer().RemoveConsenter("orderer0.example.com", 7050); err == nil {
+		t.Fatal("expected the removal from a channel without consensus type to fail")
+	}
+}
+
+func TestCheckConsenterRemoval(t *testing.T) {
+	metadata, err := NewConfigEditor(testRaftConfig(4)).Orderer().RaftMetadata()
+	if err != nil {
+		t.Fatal(err)
+	}
+	admin := func(status, relation string) *OrdererAdminClient {
+		server := httptest.NewServer(&channelParticipationServer{channels: map[string]*ChannelInfo{
+			"mychannel": {Name: "mychannel", Status: status, ConsensusRelation: relation},
+		}})
+		t.Cleanup(server.Close)
+		return &OrdererAdminClient{URL: server.URL}
+	}
+	up := admin("active", "consenter")
+	other := httptest.NewServer(&channelParticipationServer{channels: map[string]*ChannelInfo{}})
+	t.Cleanup(other.Close)
+
+	// after removing orderer0 a quorum of 2 of the 3 remaining consenters has to be up
+	tests := []struct {
+		name   string
+		admins map[string]*OrdererAdminClient
+		valid  bool
+	}{
+		{"all up", map[string]*OrdererAdminClient{"orderer1.example.com:7050": up, "orderer2.example.com:7050": up, "orderer3.example.com:7050": up}, true},
+		{"one without admin endpoint", map[string]*OrdererAdminClient{"orderer1.example.com:7050": up, "orderer2.example.com:7050": up}, true},
+		{"one onboarding", map[string]*OrdererAdminClient{
+			"orderer1.example.com:7050": up,
+			"orderer2.example.com:7050": admin("onboarding", "consenter"),
+			"orderer3.example.com:7050": admin("active", "follower"),
+		}, false},
+		{"removed consenter does not count", map[string]*OrdererAdminClient{"orderer0.example.com:7050": up, "orderer1.example.com:7050": up}, false},
+		{"channel missing", map[string]*OrdererAdminClient{"orderer1.example.com:7050": up, "orderer2.example.com:7050": {URL: other.URL}}, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := CheckConsenterRemoval(context.Background(), "mychannel", metadata, "orderer0.example.com", 7050, test.admins)
+			if test.valid && err != nil {
+				t.Fatalf("expected the removal to be allowed: %s", err)
+			}
+			if !test.valid && err == nil {
+				t.Fatal("expected the removal to be refused")
+			}
+		})
+	}
+
+	if err = CheckConsenterRemoval(context.Background(), "mychannel", metadata, "orderer9.example.com", 7050, nil); err == nil {
+		t.Fatal("expected the removal of an unknown consenter to fail")
+	}
+}
+
+func TestCheckConsenterChange(t *testing.T) {
+	original := testRaftConfig(3)
+	updated := proto.Clone(original).(*common.Config)
+	if err := NewConfigEditor(updated).Orderer().RemoveConsenter("orderer0.example.com", 7050); err != nil {
+		t.Fatal(err)
+	}
+	if err := CheckConsenterChange(original, updated); err != nil {
+		t.Fatalf("expected a single change to be allowed: %s", err)
+	}
+	if err := NewConfigEditor(updated).Orderer().RemoveConsenter("orderer1.example.com", 7050); err != nil {
+		t.Fatal(err)
+	}
+	if err := CheckConsenterChange(original, updated); err == nil || !strings.Contains(err.Error(), "only one consenter") {
+		t.Fatalf("expected two changes to be refused, got %v", err)
+	}
+
+	solo := testEditorConfig()
+	_ = addValue(solo.ChannelGroup.Groups[OrdererGroupKey], AdminsPolicyKey, ConsensusTypeKey, &orderer.ConsensusType{Type: "solo"})
+	if err := CheckConsenterChange(solo, solo); err != nil {
+		t.Fatalf("expected a channel that is not ordered by Raft not to be checked: %s", err)
+	}
+
+	corrupt := testEditorConfig()
+	_ = addValue(corrupt.ChannelGroup.Groups[OrdererGroupKey], AdminsPolicyKey, ConsensusTypeKey, &orderer.ConsensusType{
+		Type:     ConsensusTypeEtcdRaft,
+		Metadata: []byte("not raft metadata"),
+	})
+	if err := CheckConsenterChange(corrupt, updated); err == nil {
+		t.Fatal("expected invalid Raft metadata to be an error")
+	}
+}
+
+func TestValidateRaftOptions(t *testing.T) {
+	if err := ValidateRaftOptions(DefaultRaftOptions()); err != nil {
+		t.Fatalf("expected the default options to be valid: %s", err)
+	}
+
+	tests := []struct {
+		name   string
+		modify func(options *etcdraft.Options)
+	}{
+		{"invalid tick interval", func(o *etcdraft.Options) { o.TickInterval = "500" }},
+		{"zero tick interval", func(o *etcdraft.Options) { o.TickInterval = "0s" }},
+		{"zero heartbeat tick", func(o *etcdraft.Options) { o.HeartbeatTick = 0 }},
+		{"election tick equal to heartbeat tick", func(o *etcdraft.Options) { o.ElectionTick = o.HeartbeatTick }},
+		{"zero max inflight blocks", func(o *etcdraft.Options) { o.MaxInflightBlocks = 0 }},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			options := DefaultRaftOptions()
+			test.modify(options)
+			if err := ValidateRaftOptions(options); err == nil {
+				t.Fatal("expected the options to be invalid")
+			}
+		})
+	}
+	if err := ValidateRaftOptions(nil); err == nil {
+		t.Fatal("expected nil options to be invalid")
+	}
+
+	// invalid options are not written to the config
+	config := testRaftConfig(3)
+	before := proto.Clone(config)
+	if err := NewConfigEditor(config).Orderer().SetRaftOptions(&etcdraft.Options{TickInterval: "500ms"}); err == nil {
+		t.Fatal("expected the invalid options to be refused")
+	}
+	if !proto.Equal(before, config) {
+		t.Fatal("expected the config to be left unchanged")
+	}
+}
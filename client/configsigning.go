@@ -0,0 +1,389 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"github.com/feng081212/fabric-protos-go/common"
+	"github.com/feng081212/fabric-protos-go/msp"
+	"github.com/feng081212/fabric-sdk-go/fabric/policies"
+	"github.com/golang/protobuf/proto"
+	"github.com/pkg/errors"
+	"io/ioutil"
+	"strings"
+)
+
+// CreateConfigUpdate computes the config update that changes the config of the config block as
+// done by updateFunc
+func CreateConfigUpdate(channelID string, block *common.Block, updateFunc func(*common.ConfigEnvelope) error) (*common.ConfigUpdate, error) {
+	envelope := &common.Envelope{}
+	if err := proto.Unmarshal(block.Data.Data[0], envelope); err != nil {
+		return nil, err
+	}
+	payload := &common.Payload{}
+	if err := proto.Unmarshal(envelope.Payload, payload); err != nil {
+		return nil, err
+	}
+	configEnvelope := &common.ConfigEnvelope{}
+	if err := proto.Unmarshal(payload.Data, configEnvelope); err != nil {
+		return nil, err
+	}
+	configEnvelopeNew := &common.ConfigEnvelope{}
+	if err := proto.Unmarshal(payload.Data, configEnvelopeNew); err != nil {
+		return nil, err
+	}
+	if err := updateFunc(configEnvelopeNew); err != nil {
+		return nil, err
+	}
+
+	updateConfig, err := Compute(configEnvelope.Config, configEnvelopeNew.Config)
+	if err != nil {
+		return nil, err
+	}
+	updateConfig.ChannelId = channelID
+	return updateConfig, nil
+}
+
+// CreateConfigUpdateEnvelope returns the unsigned config update envelope of the change done by
+// updateFunc. The envelope is written to a file with WriteConfigUpdateEnvelopeFile and handed to
+// the admins of the organizations, who sign it with CreateConfigSignature.
+func CreateConfigUpdateEnvelope(channelID string, block *common.Block, updateFunc func(*common.ConfigEnvelope) error) (*common.ConfigUpdateEnvelope, error) {
+	configUpdate, err := CreateConfigUpdate(channelID, block, updateFunc)
+	if err != nil {
+		return nil, err
+	}
+	configUpdateBytes, err := proto.Marshal(configUpdate)
+	if err != nil {
+		return nil, errors.Wrap(err, "marshal config update failed")
+	}
+	return &common.ConfigUpdateEnvelope{ConfigUpdate: configUpdateBytes}, nil
+}
+
+func WriteConfigUpdateEnvelopeFile(path string, envelope *common.ConfigUpdateEnvelope) error {
+	return writeProtoFile(path, envelope)
+}
+
+func ReadConfigUpdateEnvelopeFile(path string) (*common.ConfigUpdateEnvelope, error) {
+	envelope := &common.ConfigUpdateEnvelope{}
+	if err := readProtoFile(path, envelope); err != nil {
+		return nil, err
+	}
+	return envelope, nil
+}
+
+func WriteConfigSignatureFile(path string, signature *common.ConfigSignature) error {
+	return writeProtoFile(path, signature)
+}
+
+func ReadConfigSignatureFile(path string) (*common.ConfigSignature, error) {
+	signature := &common.ConfigSignature{}
+	if err := readProtoFile(path, signature); err != nil {
+		return nil, err
+	}
+	return signature, nil
+}
+
+// MergeConfigSignatures verifies the signatures over the config update and adds them to the
+// envelope. A signature of an identity that already signed the envelope replaces its signature.
+func MergeConfigSignatures(envelope *common.ConfigUpdateEnvelope, signatures ...*common.ConfigSignature) error {
+	for _, signature := range signatures {
+		_, creator, err := verifyConfigSignature(envelope.ConfigUpdate, signature)
+		if err != nil {
+			return err
+		}
+
+		replaced := false
+		for i, existing := range envelope.Signatures {
+			if existingCreator, err := configSignatureCreator(existing); err == nil && string(existingCreator) == string(creator) {
+				envelope.Signatures[i] = signature
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			envelope.Signatures = append(envelope.Signatures, signature)
+		}
+	}
+	return nil
+}
+
+// CheckConfigUpdateSignatures checks that the envelope updates channelID and that its signatures
+// satisfy the mod_policy of every element the update modifies, resolved against config, the
+// current config of the channel. Signers are validated against the MSPs of the config, which also
+// resolve their roles from the admin certificates and NodeOUs, see policies.MSP. As in Fabric,
+// signers that are not valid for any MSP of the channel are ignored.
+func CheckConfigUpdateSignatures(channelID string, config *common.Config, envelope *common.ConfigUpdateEnvelope) error {
+	configUpdate := &common.ConfigUpdate{}
+	if err := proto.Unmarshal(envelope.ConfigUpdate, configUpdate); err != nil {
+		return errors.Wrap(err, "unmarshal config update failed")
+	}
+	if configUpdate.ChannelId != channelID {
+		return errors.Errorf("config update is for channel [%s], not [%s]", configUpdate.ChannelId, channelID)
+	}
+	if configUpdate.WriteSet == nil {
+		return errors.New("config update has no write set")
+	}
+
+	msps, err := GetMSPsFromConfig(config)
+	if err != nil {
+		return err
+	}
+
+	var identities []*policies.Identity
+	for _, signature := range envelope.Signatures {
+		identity, _, err := verifyConfigSignature(envelope.ConfigUpdate, signature)
+		if err != nil {
+			return err
+		}
+		if msps.Validate(identity) != nil {
+			continue
+		}
+		identities = append(identities, identity)
+	}
+
+	current := make(map[string]*configElement)
+	flattenConfigGroup(current, []string{ChannelGroupKey}, config.ChannelGroup)
+	readSet := make(map[string]*configElement)
+	if configUpdate.ReadSet != nil {
+		flattenConfigGroup(readSet, []string{ChannelGroupKey}, configUpdate.ReadSet)
+	}
+	writeSet := make(map[string]*configElement)
+	flattenConfigGroup(writeSet, []string{ChannelGroupKey}, configUpdate.WriteSet)
+
+	for key, element := range writeSet {
+		if read, ok := readSet[key]; ok && read.version == element.version {
+			continue
+		}
+
+		existing, ok := current[key]
+		if !ok {
+			if element.version != 0 {
+				return errors.Errorf("new element %s must have version 0, got %d", key, element.version)
+			}
+			continue
+		}
+		if element.version != existing.version+1 {
+			return errors.Errorf("element %s must have version %d, got %d", key, existing.version+1, element.version)
+		}
+
+		if err = checkModPolicy(config.ChannelGroup, existing, identities, msps); err != nil {
+			return errors.WithMessagef(err, "mod_policy [%s] of %s", existing.modPolicy, key)
+		}
+	}
+	return nil
+}
+
+// SubmitConfigUpdateEnvelope checks the signatures of the envelope against the current config of
+// the channel and sends the config update to the orderer. The check is skipped with
+// WithoutSignatureCheck, for instance when a policy cannot be evaluated by the client.
+func (p *OrdererClient) SubmitConfigUpdateEnvelope(ctx context.Context, channelID string, envelope *common.ConfigUpdateEnvelope, opts ...RequestOption) (*common.Status, error) {
+	ctx, cancel, c := p.prepare(ctx, opts)
+	defer cancel()
+
+	if !newRequestOptions(opts).skipSignatureCheck {
+		block, err := c.GetConfigBlockContext(ctx, channelID)
+		if err != nil {
+			return nil, errors.WithMessagef(err, "get config block of channel [%s] failed", channelID)
+		}
+		config, err := GetConfigFromBlock(block)
+		if err != nil {
+			return nil, err
+		}
+		if err = CheckConfigUpdateSignatures(channelID, config, envelope); err != nil {
+			return nil, errors.WithMessage(err, "config update is not sufficiently signed")
+		}
+	}
+
+	payload, err := c.CreatePayload(common.HeaderType_CONFIG_UPDATE, channelID, func() ([]byte, error) {
+		return proto.Marshal(envelope)
+	})
+	if err != nil {
+		return nil, errors.WithMessage(err, "CreatePayload failed")
+	}
+
+	return c.BroadcastPayload(ctx, payload)
+}
+
+func configSignatureCreator(signature *common.ConfigSignature) ([]byte, error) {
+	header := &common.SignatureHeader{}
+	if err := proto.Unmarshal(signature.SignatureHeader, header); err != nil {
+		return nil, errors.Wrap(err, "unmarshal signature header failed")
+	}
+	return header.Creator, nil
+}
+
+func verifyConfigSignature(configUpdate []byte, signature *common.ConfigSignature) (*policies.Identity, []byte, error) {
+	creator, err := configSignatureCreator(signature)
+	if err != nil {
+		return nil, nil, err
+	}
+	identity, err := policies.DeserializeIdentity(creator)
+	if err != nil {
+		return nil, nil, errors.WithMessage(err, "invalid config signature creator")
+	}
+	if err = identity.Verify(ConcatenateBytes(signature.SignatureHeader, configUpdate), signature.Signature); err != nil {
+		return nil, nil, errors.WithMessagef(err, "invalid config signature of [%s] %s", identity.MSPID, identity.Certificate.Subject.CommonName)
+	}
+	return identity, creator, nil
+}
+
+type configElement struct {
+	// policyPath is the group the mod_policy is relative to
+	policyPath []string
+	version    uint64
+	modPolicy  string
+}
+
+func flattenConfigGroup(result map[string]*configElement, path []string, group *common.ConfigGroup) {
+	groupPath := append([]string(nil), path...)
+	result["[Group]  /"+strings.Join(groupPath, "/")] = &configElement{policyPath: groupPath, version: group.Version, modPolicy: group.ModPolicy}
+
+	for name, value := range group.Values {
+		result["[Value]  /"+strings.Join(append(groupPath, name), "/")] = &configElement{policyPath: groupPath, version: value.Version, modPolicy: value.ModPolicy}
+	}
+	for name, policy := range group.Policies {
+		result["[Policy] /"+strings.Join(append(groupPath, name), "/")] = &configElement{policyPath: groupPath, version: policy.Version, modPolicy: policy.ModPolicy}
+	}
+	for name, subGroup := range group.Groups {
+		flattenConfigGroup(result, append(groupPath, name), subGroup)
+	}
+}
+
+func checkModPolicy(root *common.ConfigGroup, element *configElement, identities []*policies.Identity, msps policies.MSPs) error {
+	if element.modPolicy == "" {
+		return errors.New("empty mod_policy rejects every update")
+	}
+
+	var path []string
+	if strings.HasPrefix(element.modPolicy, "/") {
+		path = strings.Split(element.modPolicy[1:], "/")
+		if len(path) < 2 || path[0] != ChannelGroupKey {
+			return errors.New("absolute mod_policy must start with /" + ChannelGroupKey)
+		}
+		path = path[1:]
+	} else {
+		path = append(append([]string(nil), element.policyPath[1:]...), strings.Split(element.modPolicy, "/")...)
+	}
+
+	group := root
+	for _, name := range path[:len(path)-1] {
+		if group = group.Groups[name]; group == nil {
+			return errors.Errorf("group [%s] of policy does not exist", name)
+		}
+	}
+	return evaluateConfigPolicy(group, path[len(path)-1], identities, msps)
+}
+
+func evaluateConfigPolicy(group *common.ConfigGroup, name string, identities []*policies.Identity, msps policies.MSPs) error {
+	configPolicy, ok := group.Policies[name]
+	if !ok || configPolicy.Policy == nil {
+		return errors.Errorf("policy [%s] does not exist", name)
+	}
+
+	switch common.Policy_PolicyType(configPolicy.Policy.Type) {
+	case common.Policy_SIGNATURE:
+		envelope := &common.SignaturePolicyEnvelope{}
+		if err := proto.Unmarshal(configPolicy.Policy.Value, envelope); err != nil {
+			return errors.Wrapf(err, "unmarshal signature policy [%s] failed", name)
+		}
+		return policies.EvaluateSignaturePolicy(envelope, identities, msps)
+
+	case common.Policy_IMPLICIT_META:
+		implicitMeta := &common.ImplicitMetaPolicy{}
+		if err := proto.Unmarshal(configPolicy.Policy.Value, implicitMeta); err != nil {
+			return errors.Wrapf(err, "unmarshal implicit meta policy [%s] failed", name)
+		}
+
+		var threshold int
+		switch implicitMeta.Rule {
+		case common.ImplicitMetaPolicy_ANY:
+			threshold = 1
+		case common.ImplicitMetaPolicy_ALL:
+			threshold = len(group.Groups)
+		case common.ImplicitMetaPolicy_MAJORITY:
+			threshold = len(group.Groups)/2 + 1
+		}
+		// like the orderer, a group without sub-groups satisfies any rule
+		if len(group.Groups) == 0 {
+			threshold = 0
+		}
+
+		satisfied := 0
+		var failures []string
+		for subName, subGroup := range group.Groups {
+			if err := evaluateConfigPolicy(subGroup, implicitMeta.SubPolicy, identities, msps); err != nil {
+				failures = append(failures, fmt.Sprintf("%s: %s", subName, err))
+				continue
+			}
+			satisfied++
+		}
+		if satisfied < threshold {
+			return errors.Errorf("implicit meta policy %s %s requires %d sub-policies, %d satisfied (%s)",
+				implicitMeta.Rule, implicitMeta.SubPolicy, threshold, satisfied, strings.Join(failures, "; "))
+		}
+		return nil
+
+	default:
+		return errors.Errorf("unsupported policy type %d of policy [%s]", configPolicy.Policy.Type, name)
+	}
+}
+
+// GetMSPsFromConfig returns the MSPs of the organizations of the channel config, the identities
+// of endorsements and config signatures are validated against them
+func GetMSPsFromConfig(config *common.Config) (policies.MSPs, error) {
+	if config == nil || config.ChannelGroup == nil {
+		return nil, errors.New("channel config is required")
+	}
+	result := make(policies.MSPs)
+	if err := collectConfigMSPs(result, config.ChannelGroup); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func collectConfigMSPs(result policies.MSPs, group *common.ConfigGroup) error {
+	if value, ok := group.Values[MSPKey]; ok {
+		mspConfig := &msp.MSPConfig{}
+		if err := proto.Unmarshal(value.Value, mspConfig); err != nil {
+			return errors.Wrap(err, "unmarshal msp config failed")
+		}
+		fabricMSPConfig := &msp.FabricMSPConfig{}
+		if err := proto.Unmarshal(mspConfig.Config, fabricMSPConfig); err != nil {
+			return errors.Wrap(err, "unmarshal fabric msp config failed")
+		}
+
+		mspDef, err := policies.NewMSP(fabricMSPConfig)
+		if err != nil {
+			return err
+		}
+		result[mspDef.ID] = mspDef
+	}
+
+	for _, subGroup := range group.Groups {
+		if err := collectConfigMSPs(result, subGroup); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeProtoFile(path string, msg proto.Message) error {
+	bs, err := proto.Marshal(msg)
+	if err != nil {
+		return errors.Wrapf(err, "marshal %T failed", msg)
+	}
+	if err = ioutil.WriteFile(path, bs, 0644); err != nil {
+		return errors.Wrapf(err, "write [%s] failed", path)
+	}
+	return nil
+}
+
+func readProtoFile(path string, msg proto.Message) error {
+	bs, err := ioutil.ReadFile(path)
+	if err != nil {
+		return errors.Wrapf(err, "read [%s] failed", path)
+	}
+	if err = proto.Unmarshal(bs, msg); err != nil {
+		return errors.Wrapf(err, "unmarshal [%s] failed", path)
+	}
+	return nil
+}
@@ -0,0 +1,237 @@
+package client
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"hash"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/feng081212/fabric-protos-go/common"
+	"github.com/feng081212/fabric-protos-go/msp"
+	"github.com/feng081212/fabric-sdk-go/fabric/bccsp"
+	"github.com/feng081212/fabric-sdk-go/fabric/policies"
+	"github.com/golang/protobuf/proto"
+)
+
+// ecdsaSigner signs with the key of a certificate issued by a testCA
+type ecdsaSigner struct {
+	mspID   string
+	certPEM []byte
+	key     *ecdsa.PrivateKey
+}
+
+func (s *ecdsaSigner) Sign(msg []byte) ([]byte, error) {
+	digest := sha256.Sum256(msg)
+	r, sig, err := ecdsa.Sign(rand.Reader, s.key, digest[:])
+	if err != nil {
+		return nil, err
+	}
+	if sig, err = bccsp.ToLowS(&s.key.PublicKey, sig); err != nil {
+		return nil, err
+	}
+	return bccsp.MarshalECDSASignature(r, sig)
+}
+func (s *ecdsaSigner) Serialize() ([]byte, error) {
+	return proto.Marshal(&msp.SerializedIdentity{Mspid: s.mspID, IdBytes: s.certPEM})
+}
+func (s *ecdsaSigner) Hash(msg []byte) ([]byte, error) { h := sha256.Sum256(msg); return h[:], nil }
+func (s *ecdsaSigner) GetHash() (hash.Hash, error)     { return sha256.New(), nil }
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func newTestCA(t *testing.T, name string) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return &testCA{cert: cert, key: key}
+}
+
+func (ca *testCA) pem() []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.cert.Raw})
+}
+
+func (ca *testCA) signer(t *testing.T, mspID, commonName string, ous ...string) *ecdsaSigner {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serial, _ := rand.Int(rand.Reader, big.NewInt(1<<62))
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: commonName, OrganizationalUnit: ous},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &ecdsaSigner{mspID: mspID, certPEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), key: key}
+}
+
+func testOrgGroup(t *testing.T, config *msp.FabricMSPConfig) *common.ConfigGroup {
+	policy, err := policies.FromString("OR('" + config.Name + ".admin')")
+	if err != nil {
+		t.Fatal(err)
+	}
+	group := &common.ConfigGroup{
+		Values:    map[string]*common.ConfigValue{},
+		Policies:  map[string]*common.ConfigPolicy{},
+		Groups:    map[string]*common.ConfigGroup{},
+		ModPolicy: AdminsPolicyKey,
+	}
+	_ = addValue(group, AdminsPolicyKey, MSPKey, &msp.MSPConfig{Config: ProtoMarshalIgnoreError(config)})
+	group.Policies[AdminsPolicyKey] = &common.ConfigPolicy{
+		ModPolicy: AdminsPolicyKey,
+		Policy:    &common.Policy{Type: int32(common.Policy_SIGNATURE), Value: ProtoMarshalIgnoreError(policy)},
+	}
+	return group
+}
+
+func implicitMetaAdmins(rule common.ImplicitMetaPolicy_Rule) *common.ConfigPolicy {
+	return &common.ConfigPolicy{
+		ModPolicy: AdminsPolicyKey,
+		Policy: &common.Policy{
+			Type:  int32(common.Policy_IMPLICIT_META),
+			Value: ProtoMarshalIgnoreError(&common.ImplicitMetaPolicy{SubPolicy: AdminsPolicyKey, Rule: rule}),
+		},
+	}
+}
+
+// configUpdateOf returns the envelope of an update that bumps the version of the group at path
+func configUpdateOf(path ...string) *common.ConfigUpdateEnvelope {
+	readSet := &common.ConfigGroup{Groups: map[string]*common.ConfigGroup{}}
+	writeSet := &common.ConfigGroup{Groups: map[string]*common.ConfigGroup{}}
+	read, write := readSet, writeSet
+	for i, name := range path {
+		next := &common.ConfigGroup{Groups: map[string]*common.ConfigGroup{}}
+		write.Groups[name] = next
+		write = next
+		if i < len(path)-1 {
+			read.Groups[name] = &common.ConfigGroup{Groups: map[string]*common.ConfigGroup{}}
+			read = read.Groups[name]
+		}
+	}
+	write.Version = 1
+	write.ModPolicy = AdminsPolicyKey
+
+	update := &common.ConfigUpdate{ChannelId: "mychannel", ReadSet: readSet, WriteSet: writeSet}
+	return &common.ConfigUpdateEnvelope{ConfigUpdate: ProtoMarshalIgnoreError(update)}
+}
+
+func TestCheckConfigUpdateSignatures(t *testing.T) {
+	ca1 := newTestCA(t, "ca.org1.example.com")
+	ca2 := newTestCA(t, "ca.org2.example.com")
+
+	// Org1 lists its admin certificate, Org2 tells admins apart with NodeOUs
+	org1Admin := ca1.signer(t, "Org1MSP", "Admin@org1.example.com")
+	org1User := ca1.signer(t, "Org1MSP", "User1@org1.example.com")
+	org2Admin := ca2.signer(t, "Org2MSP", "Admin@org2.example.com", "admin")
+	org2Client := ca2.signer(t, "Org2MSP", "User1@org2.example.com", "client")
+	// claims to be an Org1 identity but is issued by the CA of Org2
+	outsider := ca2.signer(t, "Org1MSP", "Admin@org1.example.com", "admin")
+	// claims to be an Org2 admin but is issued by the CA of Org1
+	impostor := ca1.signer(t, "Org2MSP", "Admin@org2.example.com", "admin")
+
+	application := &common.ConfigGroup{
+		Groups: map[string]*common.ConfigGroup{
+			"Org1": testOrgGroup(t, &msp.FabricMSPConfig{Name: "Org1MSP", RootCerts: [][]byte{ca1.pem()}, Admins: [][]byte{org1Admin.certPEM}}),
+			"Org2": testOrgGroup(t, &msp.FabricMSPConfig{Name: "Org2MSP", RootCerts: [][]byte{ca2.pem()}, FabricNodeOus: &msp.FabricNodeOUs{
+				Enable:             true,
+				ClientOuIdentifier: &msp.FabricOUIdentifier{OrganizationalUnitIdentifier: "client"},
+				PeerOuIdentifier:   &msp.FabricOUIdentifier{OrganizationalUnitIdentifier: "peer"},
+				AdminOuIdentifier:  &msp.FabricOUIdentifier{OrganizationalUnitIdentifier: "admin"},
+			}}),
+		},
+		Policies:  map[string]*common.ConfigPolicy{AdminsPolicyKey: implicitMetaAdmins(common.ImplicitMetaPolicy_MAJORITY)},
+		ModPolicy: AdminsPolicyKey,
+	}
+	// a group without organizations, its implicit meta policies are satisfied by anyone
+	empty := &common.ConfigGroup{
+		Policies:  map[string]*common.ConfigPolicy{AdminsPolicyKey: implicitMetaAdmins(common.ImplicitMetaPolicy_ANY)},
+		ModPolicy: AdminsPolicyKey,
+	}
+	config := &common.Config{ChannelGroup: &common.ConfigGroup{
+		Groups: map[string]*common.ConfigGroup{ApplicationGroupKey: application, "Empty": empty},
+	}}
+
+	tests := []struct {
+		name    string
+		update  *common.ConfigUpdateEnvelope
+		signers []Signer
+		valid   bool
+	}{
+		{"admin certificate", configUpdateOf(ApplicationGroupKey, "Org1"), []Signer{org1Admin}, true},
+		{"member is not admin", configUpdateOf(ApplicationGroupKey, "Org1"), []Signer{org1User}, false},
+		{"admin node OU", configUpdateOf(ApplicationGroupKey, "Org2"), []Signer{org2Admin}, true},
+		{"client node OU is not admin", configUpdateOf(ApplicationGroupKey, "Org2"), []Signer{org2Client}, false},
+		{"admin of another org", configUpdateOf(ApplicationGroupKey, "Org1"), []Signer{org2Admin}, false},
+		{"certificate of another CA", configUpdateOf(ApplicationGroupKey, "Org1"), []Signer{outsider}, false},
+		{"majority of admins", configUpdateOf(ApplicationGroupKey), []Signer{org1Admin, org2Admin}, true},
+		{"majority not reached", configUpdateOf(ApplicationGroupKey), []Signer{org1Admin, org2Client}, false},
+		{"implicit meta without sub-groups", configUpdateOf("Empty"), []Signer{org2Client}, true},
+		{"no signatures", configUpdateOf(ApplicationGroupKey, "Org1"), nil, false},
+		{"stray signer is ignored", configUpdateOf(ApplicationGroupKey, "Org1"), []Signer{outsider, org1Admin}, true},
+		{"stray signer does not count", configUpdateOf(ApplicationGroupKey), []Signer{org1Admin, impostor}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			envelope := proto.Clone(test.update).(*common.ConfigUpdateEnvelope)
+			for _, signer := range test.signers {
+				signature, err := CreateConfigSignature(signer, envelope.ConfigUpdate)
+				if err != nil {
+					t.Fatal(err)
+				}
+				envelope.Signatures = append(envelope.Signatures, signature)
+			}
+
+			err := CheckConfigUpdateSignatures("mychannel", config, envelope)
+			if test.valid && err != nil {
+				t.Fatalf("expected the update to be sufficiently signed: %s", err)
+			}
+			if !test.valid && err == nil {
+				t.Fatal("expected the update not to be sufficiently signed")
+			}
+		})
+	}
+
+	t.Run("other channel", func(t *testing.T) {
+		envelope := configUpdateOf(ApplicationGroupKey, "Org1")
+		signature, err := CreateConfigSignature(org1Admin, envelope.ConfigUpdate)
+		if err != nil {
+			t.Fatal(err)
+		}
+		envelope.Signatures = append(envelope.Signatures, signature)
+		if err = CheckConfigUpdateSignatures("otherchannel", config, envelope); err == nil {
+			t.Fatal("expected an update of another channel to be refused")
+		}
+	})
+
+}
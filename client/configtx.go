@@ -0,0 +1,500 @@
+package client
+
+import (
+	"github.com/feng081212/fabric-protos-go/orderer"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Configtx is a configtx.yaml as used by configtxgen. Relative paths in it, like MSPDir and the TLS
+// certificates of the consenters, are relative to the directory of the file.
+type Configtx struct {
+	// Profiles are the profiles of the file by name
+	Profiles map[string]*ConfigtxProfile
+	// Defaults are the top-level Application, Orderer and Channel sections, which the profiles
+	// usually merge with YAML anchors. Its Name is empty.
+	Defaults *ConfigtxProfile
+	// Capabilities are the enabled capabilities of the top-level Capabilities section by section,
+	// for example Channel, Orderer and Application
+	Capabilities  map[string][]string
+	organizations []*configtxOrganizationYAML
+}
+
+// ConfigtxProfile is a profile of a configtx.yaml. Depending on its sections it defines the genesis
+// block of a system channel (Orderer and Consortiums), a channel created through a system channel
+// (Consortium and Application) or an application channel of orderers without a system channel
+// (Orderer and Application).
+type ConfigtxProfile struct {
+	Name string
+	conf *configtxProfileYAML
+	dir  string
+}
+
+// LoadConfigtx reads a configtx.yaml, YAML anchors and merge keys are resolved
+func LoadConfigtx(path string) (*Configtx, error) {
+	bs, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "read configtx file [%s] failed", path)
+	}
+	dir, err := filepath.Abs(filepath.Dir(path))
+	if err != nil {
+		return nil, errors.Wrapf(err, "resolve directory of configtx file [%s] failed", path)
+	}
+	return ParseConfigtx(bs, dir)
+}
+
+// ParseConfigtx parses the content of a configtx.yaml, relative paths are resolved against dir
+func ParseConfigtx(data []byte, dir string) (*Configtx, error) {
+	conf := &configtxYAML{}
+	if err := yaml.Unmarshal(data, conf); err != nil {
+		return nil, errors.Wrap(err, "parse configtx failed")
+	}
+
+	defaults := &configtxProfileYAML{Application: conf.Application, Orderer: conf.Orderer}
+	if conf.Channel != nil {
+		defaults.Capabilities = conf.Channel.Capabilities
+		defaults.Policies = conf.Channel.Policies
+	}
+	configtx := &Configtx{
+		Profiles:      make(map[string]*ConfigtxProfile),
+		Defaults:      &ConfigtxProfile{conf: defaults, dir: dir},
+		Capabilities:  make(map[string][]string),
+		organizations: conf.Organizations,
+	}
+	for section, capabilities := range conf.Capabilities {
+		configtx.Capabilities[section] = capabilities.enabled()
+	}
+	for name, profile := range conf.Profiles {
+		if profile == nil {
+			return nil, errors.Errorf("profile [%s] is empty", name)
+		}
+		configtx.Profiles[name] = &ConfigtxProfile{Name: name, conf: profile, dir: dir}
+	}
+	return configtx, nil
+}
+
+func (p *Configtx) Profile(name string) (*ConfigtxProfile, error) {
+	profile, ok := p.Profiles[name]
+	if !ok {
+		names := make([]string, 0, len(p.Profiles))
+		for n := range p.Profiles {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return nil, errors.Errorf("profile [%s] does not exist, profiles are %v", name, names)
+	}
+	return profile, nil
+}
+
+// Organization returns the organization with the given Name of the top-level Organizations
+// section, as configtxgen -printOrg does
+func (p *Configtx) Organization(name string) (*Organization, error) {
+	var names []string
+	for _, conf := range p.organizations {
+		if conf == nil {
+			continue
+		}
+		if conf.Name == name {
+			return p.Defaults.organization(conf)
+		}
+		names = append(names, conf.Name)
+	}
+	return nil, errors.Errorf("organization [%s] does not exist, organizations are %v", name, names)
+}
+
+// Organizations returns the organizations of the top-level Organizations section
+func (p *Configtx) Organizations() ([]*Organization, error) {
+	return p.Defaults.organizations(p.organizations)
+}
+
+// label names the profile in errors
+func (p *ConfigtxProfile) label() string {
+	if p.Name == "" {
+		return "top-level sections"
+	}
+	return "profile [" + p.Name + "]"
+}
+
+// ApplicationChannel returns the application channel of the profile, for orderers without a
+// system channel. The profile needs an Orderer and an Application section.
+func (p *ConfigtxProfile) ApplicationChannel(channelID string) (*ApplicationChannel, error) {
+	ordererEndpoints, err := p.OrdererEndpoints()
+	if err != nil {
+		return nil, err
+	}
+	application, err := p.Application()
+	if err != nil {
+		return nil, err
+	}
+
+	channel := DefaultApplicationChannel(channelID, ordererEndpoints, application)
+	channel.Capabilities = p.conf.Capabilities.enabled()
+	if channel.Policies, err = p.conf.Policies.policies(); err != nil {
+		return nil, errors.WithMessage(err, p.label())
+	}
+	return channel, nil
+}
+
+// Channel returns the channel of the profile, created through the system channel. The profile
+// needs a Consortium and an Application section.
+func (p *ConfigtxProfile) Channel(channelID string) (*Channel, error) {
+	if p.conf.Consortium == "" {
+		return nil, errors.Errorf("%s has no Consortium", p.label())
+	}
+	application, err := p.Application()
+	if err != nil {
+		return nil, err
+	}
+
+	channel := DefaultChannel(p.conf.Consortium, channelID)
+	channel.Application = application
+	channel.Capabilities = p.conf.Capabilities.enabled()
+	if channel.Policies, err = p.conf.Policies.policies(); err != nil {
+		return nil, errors.WithMessage(err, p.label())
+	}
+	return channel, nil
+}
+
+// Consortium returns the consortium with the given name of the system channel profile. The profile
+// needs an Orderer and a Consortiums section.
+func (p *ConfigtxProfile) Consortium(name string) (*Consortium, error) {
+	consortium, ok := p.conf.Consortiums[name]
+	if !ok {
+		return nil, errors.Errorf("%s has no consortium [%s]", p.label(), name)
+	}
+	ordererEndpoints, err := p.OrdererEndpoints()
+	if err != nil {
+		return nil, err
+	}
+
+	result := DefaultConsortium(name)
+	result.OrdererEndpoints = ordererEndpoints
+	result.Capabilities = p.conf.Capabilities.enabled()
+	if result.Policies, err = p.conf.Policies.policies(); err != nil {
+		return nil, errors.WithMessage(err, p.label())
+	}
+	if consortium != nil {
+		if result.Organizations, err = p.organizations(consortium.Organizations); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// OrdererEndpoints returns the Orderer section of the profile, only the etcdraft orderer type is
+// supported
+func (p *ConfigtxProfile) OrdererEndpoints() (*OrdererEndpoints, error) {
+	conf := p.conf.Orderer
+	if conf == nil {
+		return nil, errors.Errorf("%s has no Orderer section", p.label())
+	}
+	if conf.OrdererType != ConsensusTypeEtcdRaft {
+		return nil, errors.Errorf("orderer type [%s] of %s is not supported, use %s", conf.OrdererType, p.label(), ConsensusTypeEtcdRaft)
+	}
+
+	result := DefaultOrdererEndpoints()
+	result.Capabilities = conf.Capabilities.enabled()
+	var err error
+	if result.Policies, err = conf.Policies.policies(); err != nil {
+		return nil, errors.WithMessagef(err, "orderer of %s", p.label())
+	}
+	if result.Organizations, err = p.organizations(conf.Organizations); err != nil {
+		return nil, err
+	}
+
+	if conf.BatchTimeout != "" {
+		if _, err = time.ParseDuration(conf.BatchTimeout); err != nil {
+			return nil, errors.Wrapf(err, "invalid BatchTimeout [%s] of %s", conf.BatchTimeout, p.label())
+		}
+		result.BatchTimeout = &orderer.BatchTimeout{Timeout: conf.BatchTimeout}
+	}
+	// the fields that are not set keep their defaults, as with configtxgen
+	if conf.BatchSize != nil {
+		batchSize := result.BatchSize
+		if conf.BatchSize.MaxMessageCount != 0 {
+			batchSize.MaxMessageCount = conf.BatchSize.MaxMessageCount
+		}
+		if conf.BatchSize.AbsoluteMaxBytes != "" {
+			if batchSize.AbsoluteMaxBytes, err = parseByteSize(conf.BatchSize.AbsoluteMaxBytes); err != nil {
+				return nil, errors.WithMessagef(err, "AbsoluteMaxBytes of %s", p.label())
+			}
+		}
+		if conf.BatchSize.PreferredMaxBytes != "" {
+			if batchSize.PreferredMaxBytes, err = parseByteSize(conf.BatchSize.PreferredMaxBytes); err != nil {
+				return nil, errors.WithMessagef(err, "PreferredMaxBytes of %s", p.label())
+			}
+		}
+	}
+	result.ChannelRestrictions = &orderer.ChannelRestrictions{MaxCount: conf.MaxChannels}
+	result.Addresses = conf.Addresses
+
+	if conf.EtcdRaft == nil {
+		return nil, errors.Errorf("orderer of %s has no EtcdRaft section", p.label())
+	}
+	if options := conf.EtcdRaft.Options; options != nil {
+		raftOptions := result.RaftOptions
+		if options.TickInterval != "" {
+			raftOptions.TickInterval = options.TickInterval
+		}
+		if options.ElectionTick != 0 {
+			raftOptions.ElectionTick = options.ElectionTick
+		}
+		if options.HeartbeatTick != 0 {
+			raftOptions.HeartbeatTick = options.HeartbeatTick
+		}
+		if options.MaxInflightBlocks != 0 {
+			raftOptions.MaxInflightBlocks = options.MaxInflightBlocks
+		}
+		if options.SnapshotIntervalSize != "" {
+			if raftOptions.SnapshotIntervalSize, err = parseByteSize(options.SnapshotIntervalSize); err != nil {
+				return nil, errors.WithMessagef(err, "SnapshotIntervalSize of %s", p.label())
+			}
+		}
+	}
+	for _, consenter := range conf.EtcdRaft.Consenters {
+		endpoint := &OrdererEndpoint{Host: consenter.Host, Port: consenter.Port}
+		if endpoint.ClientTlsCert, err = p.readFile(consenter.ClientTLSCert); err != nil {
+			return nil, errors.WithMessagef(err, "client TLS certificate of consenter [%s:%d]", consenter.Host, consenter.Port)
+		}
+		if endpoint.ServerTlsCert, err = p.readFile(consenter.ServerTLSCert); err != nil {
+			return nil, errors.WithMessagef(err, "server TLS certificate of consenter [%s:%d]", consenter.Host, consenter.Port)
+		}
+		result.AddOrderer(endpoint)
+	}
+
+	return result, nil
+}
+
+// Application returns the Application section of the profile
+func (p *ConfigtxProfile) Application() (*Application, error) {
+	conf := p.conf.Application
+	if conf == nil {
+		return nil, errors.Errorf("%s has no Application section", p.label())
+	}
+
+	result := DefaultApplication()
+	result.Capabilities = conf.Capabilities.enabled()
+	result.ACLs = conf.ACLs
+	var err error
+	if result.Policies, err = conf.Policies.policies(); err != nil {
+		return nil, errors.WithMessagef(err, "application of %s", p.label())
+	}
+	if result.Organizations, err = p.organizations(conf.Organizations); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (p *ConfigtxProfile) organizations(confs []*configtxOrganizationYAML) ([]*Organization, error) {
+	var result []*Organization
+	for _, conf := range confs {
+		if conf == nil {
+			continue
+		}
+		organization, err := p.organization(conf)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, organization)
+	}
+	return result, nil
+}
+
+func (p *ConfigtxProfile) organization(conf *configtxOrganizationYAML) (*Organization, error) {
+	if conf.ID == "" {
+		return nil, errors.Errorf("organization [%s] has no ID", conf.Name)
+	}
+	if conf.MSPType != "" && conf.MSPType != "bccsp" {
+		return nil, errors.Errorf("MSPType [%s] of organization [%s] is not supported", conf.MSPType, conf.Name)
+	}
+	if conf.MSPDir == "" {
+		return nil, errors.Errorf("organization [%s] has no MSPDir", conf.Name)
+	}
+
+	mspConfig, err := LoadMspConfig(conf.ID, p.path(conf.MSPDir))
+	if err != nil {
+		return nil, err
+	}
+
+	organization := &Organization{
+		Name:             conf.Name,
+		ID:               conf.ID,
+		MspConfig:        mspConfig,
+		MSPType:          conf.MSPType,
+		OrdererEndpoints: conf.OrdererEndpoints,
+	}
+	if organization.Name == "" {
+		organization.Name = conf.ID
+	}
+	if organization.Policies, err = conf.Policies.policies(); err != nil {
+		return nil, errors.WithMessagef(err, "organization [%s]", conf.Name)
+	}
+	for _, anchor := range conf.AnchorPeers {
+		organization.AnchorPeers = append(organization.AnchorPeers, &AnchorPeer{Host: anchor.Host, Port: anchor.Port})
+	}
+	return organization, nil
+}
+
+func (p *ConfigtxProfile) path(path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(p.dir, path)
+}
+
+func (p *ConfigtxProfile) readFile(path string) (string, error) {
+	if path == "" {
+		return "", errors.New("file path is required")
+	}
+	bs, err := ioutil.ReadFile(p.path(path))
+	if err != nil {
+		return "", errors.Wrapf(err, "read file [%s] failed", path)
+	}
+	return string(bs), nil
+}
+
+type configtxYAML struct {
+	Organizations []*configtxOrganizationYAML         `yaml:"Organizations"`
+	Capabilities  map[string]configtxCapabilitiesYAML `yaml:"Capabilities"`
+	Application   *configtxApplicationYAML            `yaml:"Application"`
+	Orderer       *configtxOrdererYAML                `yaml:"Orderer"`
+	Channel       *struct {
+		Capabilities configtxCapabilitiesYAML `yaml:"Capabilities"`
+		Policies     configtxPoliciesYAML     `yaml:"Policies"`
+	} `yaml:"Channel"`
+	Profiles map[string]*configtxProfileYAML `yaml:"Profiles"`
+}
+
+type configtxProfileYAML struct {
+	Consortium   string                             `yaml:"Consortium"`
+	Application  *configtxApplicationYAML           `yaml:"Application"`
+	Orderer      *configtxOrdererYAML               `yaml:"Orderer"`
+	Consortiums  map[string]*configtxConsortiumYAML `yaml:"Consortiums"`
+	Capabilities configtxCapabilitiesYAML           `yaml:"Capabilities"`
+	Policies     configtxPoliciesYAML               `yaml:"Policies"`
+}
+
+type configtxConsortiumYAML struct {
+	Organizations []*configtxOrganizationYAML `yaml:"Organizations"`
+}
+
+type configtxOrganizationYAML struct {
+	Name             string               `yaml:"Name"`
+	ID               string               `yaml:"ID"`
+	MSPDir           string               `yaml:"MSPDir"`
+	MSPType          string               `yaml:"MSPType"`
+	Policies         configtxPoliciesYAML `yaml:"Policies"`
+	OrdererEndpoints []string             `yaml:"OrdererEndpoints"`
+	AnchorPeers      []struct {
+		Host string `yaml:"Host"`
+		Port int    `yaml:"Port"`
+	} `yaml:"AnchorPeers"`
+}
+
+type configtxApplicationYAML struct {
+	Organizations []*configtxOrganizationYAML `yaml:"Organizations"`
+	Capabilities  configtxCapabilitiesYAML    `yaml:"Capabilities"`
+	Policies      configtxPoliciesYAML        `yaml:"Policies"`
+	ACLs          map[string]string           `yaml:"ACLs"`
+}
+
+type configtxOrdererYAML struct {
+	OrdererType  string   `yaml:"OrdererType"`
+	Addresses    []string `yaml:"Addresses"`
+	BatchTimeout string   `yaml:"BatchTimeout"`
+	BatchSize    *struct {
+		MaxMessageCount   uint32 `yaml:"MaxMessageCount"`
+		AbsoluteMaxBytes  string `yaml:"AbsoluteMaxBytes"`
+		PreferredMaxBytes string `yaml:"PreferredMaxBytes"`
+	} `yaml:"BatchSize"`
+	MaxChannels uint64 `yaml:"MaxChannels"`
+	EtcdRaft    *struct {
+		Consenters []struct {
+			Host          string `yaml:"Host"`
+			Port          uint32 `yaml:"Port"`
+			ClientTLSCert string `yaml:"ClientTLSCert"`
+			ServerTLSCert string `yaml:"ServerTLSCert"`
+		} `yaml:"Consenters"`
+		Options *struct {
+			TickInterval         string `yaml:"TickInterval"`
+			ElectionTick         uint32 `yaml:"ElectionTick"`
+			HeartbeatTick        uint32 `yaml:"HeartbeatTick"`
+			MaxInflightBlocks    uint32 `yaml:"MaxInflightBlocks"`
+			SnapshotIntervalSize string `yaml:"SnapshotIntervalSize"`
+		} `yaml:"Options"`
+	} `yaml:"EtcdRaft"`
+	Organizations []*configtxOrganizationYAML `yaml:"Organizations"`
+	Capabilities  configtxCapabilitiesYAML    `yaml:"Capabilities"`
+	Policies      configtxPoliciesYAML        `yaml:"Policies"`
+}
+
+// configtxCapabilitiesYAML are the capabilities of a section, only the ones set to true are enabled
+type configtxCapabilitiesYAML map[string]bool
+
+func (c configtxCapabilitiesYAML) enabled() []string {
+	var result []string
+	for name, enabled := range c {
+		if enabled {
+			result = append(result, name)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+type configtxPoliciesYAML map[string]*struct {
+	Type string `yaml:"Type"`
+	Rule string `yaml:"Rule"`
+}
+
+func (c configtxPoliciesYAML) policies() (map[string]*Policy, error) {
+	result := make(map[string]*Policy)
+	for name, policy := range c {
+		if policy == nil {
+			return nil, errors.Errorf("policy [%s] is empty", name)
+		}
+		if policy.Type != ImplicitMetaPolicyType && policy.Type != SignaturePolicyType {
+			return nil, errors.Errorf("policy [%s] has unknown type [%s]", name, policy.Type)
+		}
+		result[name] = &Policy{Type: policy.Type, Rule: policy.Rule}
+	}
+	return result, nil
+}
+
+var byteSizePattern = regexp.MustCompile(`^([0-9]+)\s*([kKmMgG])?[bB]?$`)
+
+// parseByteSize parses sizes like configtxgen does: a number of bytes with an optional unit of
+// KB, MB or GB, for example "99 MB". An empty size is 0.
+func parseByteSize(size string) (uint32, error) {
+	size = strings.TrimSpace(size)
+	if size == "" {
+		return 0, nil
+	}
+	matches := byteSizePattern.FindStringSubmatch(size)
+	if matches == nil {
+		return 0, errors.Errorf("invalid size [%s]", size)
+	}
+	value, err := strconv.ParseUint(matches[1], 10, 32)
+	if err != nil {
+		return 0, errors.Wrapf(err, "invalid size [%s]", size)
+	}
+	switch strings.ToUpper(matches[2]) {
+	case "K":
+		value <<= 10
+	case "M":
+		value <<= 20
+	case "G":
+		value <<= 30
+	}
+	if value > 0xFFFFFFFF {
+		return 0, errors.Errorf("size [%s] is larger than 4 GB", size)
+	}
+	return uint32(value), nil
+}
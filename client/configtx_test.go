@@ -0,0 +1,251 @@
+package client
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/feng081212/fabric-protos-go/common"
+	"github.com/golang/protobuf/proto"
+)
+
+const testNodeOUsConfig = `NodeOUs:
+  Enable: true
+  ClientOUIdentifier:
+    Certificate: cacerts/ca.pem
+    OrganizationalUnitIdentifier: client
+  PeerOUIdentifier:
+    Certificate: cacerts/ca.pem
+    OrganizationalUnitIdentifier: peer
+  AdminOUIdentifier:
+    Certificate: cacerts/ca.pem
+    OrganizationalUnitIdentifier: admin
+  OrdererOUIdentifier:
+    Certificate: cacerts/ca.pem
+    OrganizationalUnitIdentifier: orderer
+`
+
+func writeTestFile(t *testing.T, path string, data []byte) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// writeTestMSP writes an MSP directory with NodeOUs rooted at ca, like cryptogen does. The
+// directories also hold a file that is not PEM encoded, which must be skipped.
+func writeTestMSP(t *testing.T, dir string, ca *testCA) {
+	for _, name := range []string{"cacerts", "tlscacerts"} {
+		writeTestFile(t, filepath.Join(dir, name, "ca.pem"), ca.pem())
+		writeTestFile(t, filepath.Join(dir, name, ".DS_Store"), []byte{0, 0, 0, 1, 'B', 'u', 'd', '1'})
+	}
+	writeTestFile(t, filepath.Join(dir, "config.yaml"), []byte(testNodeOUsConfig))
+}
+
+// testConfigtx loads testdata/configtx.yaml from a temporary directory that holds the MSP
+// directories and TLS certificates it refers to
+func testConfigtx(t *testing.T) *Configtx {
+	dir, err := ioutil.TempDir("", "configtx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+
+	data, err := ioutil.ReadFile(filepath.Join("testdata", "configtx.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeTestFile(t, filepath.Join(dir, "configtx.yaml"), data)
+
+	writeTestMSP(t, filepath.Join(dir, "crypto", "orderer", "msp"), newTestCA(t, "ca.example.com"))
+	writeTestMSP(t, filepath.Join(dir, "crypto", "org1", "msp"), newTestCA(t, "ca.org1.example.com"))
+	writeTestMSP(t, filepath.Join(dir, "crypto", "org2", "msp"), newTestCA(t, "ca.org2.example.com"))
+	tlsCA := newTestCA(t, "tlsca.example.com")
+	for _, name := range []string{"orderer0", "orderer1"} {
+		cert := tlsCA.signer(t, "OrdererMSP", name+".example.com").certPEM
+		writeTestFile(t, filepath.Join(dir, "crypto", "orderer", "tls", name+".crt"), cert)
+	}
+
+	configtx, err := LoadConfigtx(filepath.Join(dir, "configtx.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return configtx
+}
+
+func TestConfigtxApplicationChannel(t *testing.T) {
+	configtx := testConfigtx(t)
+	if _, err := configtx.Profile("SampleSingleMSPChannel"); err == nil {
+		t.Fatal("expected an unknown profile to be refused")
+	}
+	profile, err := configtx.Profile("TwoOrgsApplicationGenesis")
+	if err != nil {
+		t.Fatal(err)
+	}
+	channel, err := profile.ApplicationChannel("mychannel")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the profile overrides the BatchTimeout of the merged orderer defaults and keeps the rest
+	if timeout := channel.Orderer.BatchTimeout.Timeout; timeout != "1s" {
+		t.Fatalf("expected the BatchTimeout of the profile, got %s", timeout)
+	}
+	if size := channel.Orderer.BatchSize; size.MaxMessageCount != 10 || size.AbsoluteMaxBytes != 99<<20 || size.PreferredMaxBytes != 512<<10 {
+		t.Fatalf("expected the BatchSize of the orderer defaults, got %v", size)
+	}
+	if len(channel.Orderer.Orderers) != 2 || channel.Orderer.Orderers[1].ClientTlsCert == "" {
+		t.Fatalf("expected two consenters with TLS certificates, got %v", channel.Orderer.Orderers)
+	}
+	if len(channel.Capabilities) != 1 || len(channel.Orderer.Capabilities) != 1 || len(channel.Application.Capabilities) != 1 {
+		t.Fatal("expected the capabilities of the anchors")
+	}
+	if len(channel.Policies) != 3 || channel.Application.ACLs["qscc/GetBlockByNumber"] != "/Channel/Application/Readers" {
+		t.Fatal("expected the policies and ACLs of the merged defaults")
+	}
+
+	if len(channel.Application.Organizations) != 2 {
+		t.Fatalf("expected two application organizations, got %d", len(channel.Application.Organizations))
+	}
+	org2 := channel.Application.Organizations[1]
+	if org2.ID != "Org2MSP" || len(org2.AnchorPeers) != 1 || org2.AnchorPeers[0].Port != 9051 {
+		t.Fatalf("expected Org2MSP with its anchor peer, got %s %v", org2.ID, org2.AnchorPeers)
+	}
+	if len(org2.MspConfig.Cacerts) != 1 || len(org2.MspConfig.TlsCACerts) != 1 {
+		t.Fatal("expected the files that are not PEM encoded to be skipped")
+	}
+	if nodeOUs := org2.MspConfig.NodeOUs; nodeOUs == nil || !nodeOUs.Enable || nodeOUs.AdminOUIdentifier != "admin" {
+		t.Fatalf("expected the NodeOUs of config.yaml, got %v", nodeOUs)
+	}
+
+	block, err := channel.GenesisBlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	config, err := GetConfigFromBlock(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = ValidateChannelConfig(config); err != nil {
+		t.Fatalf("expected the config of the genesis block to be valid: %s", err)
+	}
+	addresses := &common.OrdererAddresses{}
+	if err = proto.Unmarshal(config.ChannelGroup.Values[OrdererAddressesKey].GetValue(), addresses); err != nil {
+		t.Fatal(err)
+	}
+	if len(addresses.Addresses) != 1 || addresses.Addresses[0] != "orderer0.example.com:7050" {
+		t.Fatalf("expected the Addresses of the orderer, got %v", addresses.Addresses)
+	}
+}
+
+func TestConfigtxConsortium(t *testing.T) {
+	configtx := testConfigtx(t)
+
+	profile, err := configtx.Profile("TwoOrgsOrdererGenesis")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = profile.Consortium("OtherConsortium"); err == nil {
+		t.Fatal("expected an unknown consortium to be refused")
+	}
+	consortium, err := profile.Consortium("SampleConsortium")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(consortium.Organizations) != 2 || consortium.OrdererEndpoints.BatchTimeout.Timeout != "2s" {
+		t.Fatal("expected the organizations of the consortium and the orderer defaults")
+	}
+	if _, err = consortium.GenesisBlock(); err != nil {
+		t.Fatal(err)
+	}
+
+	profile, err = configtx.Profile("TwoOrgsChannel")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = profile.ApplicationChannel("mychannel"); err == nil {
+		t.Fatal("expected a profile without an Orderer section to be refused")
+	}
+	channel, err := profile.Channel("mychannel")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if channel.ConsortiumName != "SampleConsortium" || len(channel.Application.Organizations) != 2 {
+		t.Fatal("expected the consortium and organizations of the profile")
+	}
+}
+
+func TestConfigtxTopLevelSections(t *testing.T) {
+	configtx := testConfigtx(t)
+
+	org1, err := configtx.Organization("Org1MSP")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if org1.ID != "Org1MSP" || len(org1.AnchorPeers) != 1 || len(org1.Policies) != 4 || org1.MspConfig == nil {
+		t.Fatalf("unexpected organization %s %v", org1.ID, org1.AnchorPeers)
+	}
+	ordererOrg, err := configtx.Organization("OrdererOrg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ordererOrg.ID != "OrdererMSP" || len(ordererOrg.OrdererEndpoints) != 2 {
+		t.Fatalf("expected the orderer organization with its endpoints, got %s %v", ordererOrg.ID, ordererOrg.OrdererEndpoints)
+	}
+	if _, err = configtx.Organization("Org3MSP"); err == nil {
+		t.Fatal("expected an unknown organization to be refused")
+	}
+	if organizations, err := configtx.Organizations(); err != nil || len(organizations) != 3 {
+		t.Fatalf("expected the 3 organizations, got %d %v", len(organizations), err)
+	}
+
+	if capabilities := configtx.Capabilities["Application"]; len(capabilities) != 1 || capabilities[0] != "V2_0" {
+		t.Fatalf("expected the application capabilities, got %v", capabilities)
+	}
+
+	application, err := configtx.Defaults.Application()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(application.Organizations) != 0 || len(application.Policies) != 5 || len(application.ACLs) != 2 {
+		t.Fatal("expected the top-level Application section")
+	}
+
+	ordererEndpoints, err := configtx.Defaults.OrdererEndpoints()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ordererEndpoints.BatchTimeout.Timeout != "2s" || len(ordererEndpoints.Orderers) != 2 || ordererEndpoints.BatchSize.MaxMessageCount != 10 {
+		t.Fatal("expected the top-level Orderer section")
+	}
+	// the options of the file override the defaults, the others keep their defaults
+	options, defaults := ordererEndpoints.RaftOptions, DefaultRaftOptions()
+	if options.TickInterval != "250ms" || options.SnapshotIntervalSize != 8<<20 ||
+		options.ElectionTick != defaults.ElectionTick || options.HeartbeatTick != defaults.HeartbeatTick || options.MaxInflightBlocks != defaults.MaxInflightBlocks {
+		t.Fatalf("expected the Raft options of the file merged with the defaults, got %v", options)
+	}
+
+	profile, err := configtx.Profile("PartialOrderer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ordererEndpoints, err = profile.OrdererEndpoints(); err != nil {
+		t.Fatal(err)
+	}
+	defaultEndpoints := DefaultOrdererEndpoints()
+	if size := ordererEndpoints.BatchSize; size.MaxMessageCount != 20 ||
+		size.AbsoluteMaxBytes != defaultEndpoints.BatchSize.AbsoluteMaxBytes || size.PreferredMaxBytes != defaultEndpoints.BatchSize.PreferredMaxBytes {
+		t.Fatalf("expected the MaxMessageCount of the profile and the default sizes, got %v", size)
+	}
+	if !proto.Equal(ordererEndpoints.RaftOptions, defaults) || !proto.Equal(ordererEndpoints.BatchTimeout, defaultEndpoints.BatchTimeout) {
+		t.Fatal("expected the default Raft options and BatchTimeout")
+	}
+
+	if _, err = configtx.Defaults.Channel("mychannel"); err == nil || !strings.Contains(err.Error(), "top-level sections") {
+		t.Fatalf("expected the top-level sections to have no Consortium, got %v", err)
+	}
+}
@@ -0,0 +1,346 @@
+package client
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"github.com/feng081212/fabric-protos-go/common"
+	"github.com/feng081212/fabric-protos-go/msp"
+	"github.com/feng081212/fabric-protos-go/orderer"
+	"github.com/feng081212/fabric-protos-go/orderer/etcdraft"
+	"github.com/feng081212/fabric-protos-go/peer"
+	"github.com/feng081212/fabric-sdk-go/fabric/bccsp/hasher"
+	"github.com/golang/protobuf/proto"
+	"github.com/pkg/errors"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// the capabilities the orderer and peers of Fabric 2.x know, a channel requiring others is refused
+var (
+	channelCapabilities     = capabilitySet("V1_1", "V1_3", "V1_4_2", "V1_4_3", "V2_0")
+	ordererCapabilities     = capabilitySet("V1_1", "V1_4_2", "V2_0")
+	applicationCapabilities = capabilitySet("V1_1", "V1_2", "V1_3", "V1_4_2", "V2_0", "V2_5")
+)
+
+func capabilitySet(names ...string) map[string]bool {
+	set := make(map[string]bool, len(names))
+	for _, name := range names {
+		set[name] = true
+	}
+	return set
+}
+
+var channelIDPattern = regexp.MustCompile(`^[a-z][a-z0-9.-]*$`)
+
+// ValidateChannelID checks the channel ID like the orderer does: lower case letters, digits, dots
+// and dashes, starting with a letter and shorter than 250 characters
+func ValidateChannelID(channelID string) error {
+	if channelID == "" {
+		return errors.New("channel ID is required")
+	}
+	if len(channelID) > 249 {
+		return errors.Errorf("channel ID [%s] is longer than 249 characters", channelID)
+	}
+	if !channelIDPattern.MatchString(channelID) {
+		return errors.Errorf("channel ID [%s] contains illegal characters, allowed are [a-z][a-z0-9.-]*", channelID)
+	}
+	return nil
+}
+
+// ValidateChannelConfig checks the config of an application channel of orderers without a system
+// channel against the rules the orderer applies when it creates the channel from the genesis block
+func ValidateChannelConfig(config *common.Config) error {
+	editor := NewConfigEditor(config)
+	channel := editor.channel()
+	if channel.err != nil {
+		return channel.err
+	}
+
+	if _, ok := channel.group.Groups[ConsortiumsGroupKey]; ok {
+		return errors.New("an application channel must not contain a Consortiums group")
+	}
+	if err := validateChannelValues(channel); err != nil {
+		return err
+	}
+	if err := requirePolicies(channel, ReadersPolicyKey, WritersPolicyKey, AdminsPolicyKey); err != nil {
+		return err
+	}
+	if err := validateCapabilities(channel, channelCapabilities); err != nil {
+		return err
+	}
+	if err := validateOrdererGroup(editor.Orderer()); err != nil {
+		return err
+	}
+	if err := validateApplicationGroup(editor.Application(), channel.group); err != nil {
+		return err
+	}
+	if err := validateConfigMSPs(channel.group); err != nil {
+		return err
+	}
+	return validateImplicitMetaPolicies(channel.path, channel.group)
+}
+
+func validateChannelValues(channel *GroupEditor) error {
+	hashingAlgorithm := &common.HashingAlgorithm{}
+	if found, err := channel.getValue(HashingAlgorithmKey, hashingAlgorithm); err != nil {
+		return err
+	} else if !found {
+		return errors.Errorf("channel config has no %s value", HashingAlgorithmKey)
+	}
+	if hashingAlgorithm.Name != string(hasher.SHA256) && hashingAlgorithm.Name != string(hasher.SHA3_256) {
+		return errors.Errorf("unknown hashing algorithm [%s]", hashingAlgorithm.Name)
+	}
+
+	hashingStructure := &common.BlockDataHashingStructure{}
+	if found, err := channel.getValue(BlockDataHashingStructureKey, hashingStructure); err != nil {
+		return err
+	} else if !found {
+		return errors.Errorf("channel config has no %s value", BlockDataHashingStructureKey)
+	}
+	if hashingStructure.Width != math.MaxUint32 {
+		return errors.Errorf("block data hashing structure width must be %d, not %d", uint32(math.MaxUint32), hashingStructure.Width)
+	}
+	return nil
+}
+
+func validateOrdererGroup(ordererGroup *OrdererEditor) error {
+	if ordererGroup.err != nil {
+		return ordererGroup.err
+	}
+	if len(ordererGroup.group.Groups) == 0 {
+		return errors.New("orderer group has no organizations")
+	}
+	if err := requirePolicies(ordererGroup.GroupEditor, ReadersPolicyKey, WritersPolicyKey, AdminsPolicyKey, BlockValidationPolicyKey); err != nil {
+		return err
+	}
+	if err := validateCapabilities(ordererGroup.GroupEditor, ordererCapabilities); err != nil {
+		return err
+	}
+
+	batchSize := &orderer.BatchSize{}
+	if found, err := ordererGroup.getValue(BatchSizeKey, batchSize); err != nil {
+		return err
+	} else if !found {
+		return errors.Errorf("orderer group has no %s value", BatchSizeKey)
+	}
+	if batchSize.MaxMessageCount == 0 || batchSize.AbsoluteMaxBytes == 0 || batchSize.PreferredMaxBytes == 0 ||
+		batchSize.PreferredMaxBytes > batchSize.AbsoluteMaxBytes {
+		return errors.Errorf("invalid batch size %v", batchSize)
+	}
+
+	batchTimeout := &orderer.BatchTimeout{}
+	if found, err := ordererGroup.getValue(BatchTimeoutKey, batchTimeout); err != nil {
+		return err
+	} else if !found {
+		return errors.Errorf("orderer group has no %s value", BatchTimeoutKey)
+	}
+	if timeout, err := time.ParseDuration(batchTimeout.Timeout); err != nil || timeout <= 0 {
+		return errors.Errorf("invalid batch timeout [%s]", batchTimeout.Timeout)
+	}
+
+	consensusType := &orderer.ConsensusType{}
+	if found, err := ordererGroup.getValue(ConsensusTypeKey, consensusType); err != nil {
+		return err
+	} else if !found {
+		return errors.Errorf("orderer group has no %s value", ConsensusTypeKey)
+	}
+	if consensusType.Type != ConsensusTypeEtcdRaft {
+		return errors.Errorf("consensus type [%s] is not supported without a system channel, use %s", consensusType.Type, ConsensusTypeEtcdRaft)
+	}
+	if consensusType.State != orderer.ConsensusType_STATE_NORMAL {
+		return errors.Errorf("consensus state must be %s", orderer.ConsensusType_STATE_NORMAL)
+	}
+
+	metadata := &etcdraft.ConfigMetadata{}
+	if err := proto.Unmarshal(consensusType.Metadata, metadata); err != nil {
+		return errors.Wrap(err, "unmarshal raft metadata failed")
+	}
+	return validateRaftMetadata(metadata)
+}
+
+func validateRaftMetadata(metadata *etcdraft.ConfigMetadata) error {
+	if len(metadata.Consenters) == 0 {
+		return errors.New("raft cluster has no consenters")
+	}
+	if err := ValidateRaftOptions(metadata.Options); err != nil {
+		return err
+	}
+
+	endpoints := make(map[string]bool)
+	for _, consenter := range metadata.Consenters {
+		endpoint := fmt.Sprintf("%s:%d", consenter.Host, consenter.Port)
+		if consenter.Host == "" || consenter.Port == 0 {
+			return errors.Errorf("consenter [%s] has no host or port", endpoint)
+		}
+		if endpoints[endpoint] {
+			return errors.Errorf("consenter [%s] is defined twice", endpoint)
+		}
+		endpoints[endpoint] = true
+
+		if err := validatePEMCertificate(consenter.ClientTlsCert); err != nil {
+			return errors.WithMessagef(err, "client TLS certificate of consenter [%s]", endpoint)
+		}
+		if err := validatePEMCertificate(consenter.ServerTlsCert); err != nil {
+			return errors.WithMessagef(err, "server TLS certificate of consenter [%s]", endpoint)
+		}
+	}
+	return nil
+}
+
+func validateApplicationGroup(application *ApplicationEditor, channelGroup *common.ConfigGroup) error {
+	if application.err != nil {
+		return application.err
+	}
+	if len(application.group.Groups) == 0 {
+		return errors.New("application group has no organizations")
+	}
+	if err := requirePolicies(application.GroupEditor, ReadersPolicyKey, WritersPolicyKey, AdminsPolicyKey); err != nil {
+		return err
+	}
+	if err := validateCapabilities(application.GroupEditor, applicationCapabilities); err != nil {
+		return err
+	}
+
+	acls := &peer.ACLs{}
+	if _, err := application.getValue(ACLsKey, acls); err != nil {
+		return err
+	}
+	for resource, acl := range acls.Acls {
+		policyRef := acl.GetPolicyRef()
+		if !strings.HasPrefix(policyRef, "/") {
+			policyRef = application.path + "/" + policyRef
+		}
+		if !configPolicyExists(channelGroup, policyRef) {
+			return errors.Errorf("policy [%s] of ACL resource [%s] does not exist", policyRef, resource)
+		}
+	}
+	return nil
+}
+
+func requirePolicies(group *GroupEditor, names ...string) error {
+	for _, name := range names {
+		if _, ok := group.group.Policies[name]; !ok {
+			return errors.Errorf("config group [%s] has no %s policy", group.path, name)
+		}
+	}
+	return nil
+}
+
+func validateCapabilities(group *GroupEditor, known map[string]bool) error {
+	capabilities := &common.Capabilities{}
+	if _, err := group.getValue(CapabilitiesKey, capabilities); err != nil {
+		return err
+	}
+	for name := range capabilities.Capabilities {
+		if !known[name] {
+			supported := make([]string, 0, len(known))
+			for k := range known {
+				supported = append(supported, k)
+			}
+			sort.Strings(supported)
+			return errors.Errorf("capability [%s] of config group [%s] is not supported, supported are %v", name, group.path, supported)
+		}
+	}
+	return nil
+}
+
+// validateConfigMSPs checks that every organization has an MSP, and that organizations sharing
+// an MSP ID, like one organization in the orderer and application group, define the same MSP
+func validateConfigMSPs(channelGroup *common.ConfigGroup) error {
+	msps := make(map[string]*msp.FabricMSPConfig)
+	for _, key := range []string{OrdererGroupKey, ApplicationGroupKey} {
+		for orgName, org := range channelGroup.Groups[key].GetGroups() {
+			value, ok := org.Values[MSPKey]
+			if !ok {
+				return errors.Errorf("organization [%s] of the %s group has no MSP", orgName, key)
+			}
+			mspConfig := &msp.MSPConfig{}
+			if err := proto.Unmarshal(value.Value, mspConfig); err != nil {
+				return errors.Wrapf(err, "unmarshal msp config of organization [%s] failed", orgName)
+			}
+			fabricMSPConfig := &msp.FabricMSPConfig{}
+			if err := proto.Unmarshal(mspConfig.Config, fabricMSPConfig); err != nil {
+				return errors.Wrapf(err, "unmarshal fabric msp config of organization [%s] failed", orgName)
+			}
+			if fabricMSPConfig.Name == "" {
+				return errors.Errorf("msp of organization [%s] has no name", orgName)
+			}
+			if len(fabricMSPConfig.RootCerts) == 0 {
+				return errors.Errorf("msp [%s] has no root certificates", fabricMSPConfig.Name)
+			}
+			for _, cert := range fabricMSPConfig.RootCerts {
+				if err := validatePEMCertificate(cert); err != nil {
+					return errors.WithMessagef(err, "root certificate of msp [%s]", fabricMSPConfig.Name)
+				}
+			}
+
+			if existing, ok := msps[fabricMSPConfig.Name]; ok && !proto.Equal(existing, fabricMSPConfig) {
+				return errors.Errorf("msp [%s] is defined twice with different configs", fabricMSPConfig.Name)
+			}
+			msps[fabricMSPConfig.Name] = fabricMSPConfig
+		}
+	}
+	return nil
+}
+
+// validateImplicitMetaPolicies checks that the sub policy of every implicit meta policy is defined
+// by at least one child group, otherwise the policy can never be satisfied
+func validateImplicitMetaPolicies(path string, group *common.ConfigGroup) error {
+	for name, configPolicy := range group.Policies {
+		if configPolicy.Policy == nil || configPolicy.Policy.Type != int32(common.Policy_IMPLICIT_META) {
+			continue
+		}
+		implicitMeta := &common.ImplicitMetaPolicy{}
+		if err := proto.Unmarshal(configPolicy.Policy.Value, implicitMeta); err != nil {
+			return errors.Wrapf(err, "unmarshal implicit meta policy [%s/%s] failed", path, name)
+		}
+		defined := false
+		for _, child := range group.Groups {
+			if _, ok := child.Policies[implicitMeta.SubPolicy]; ok {
+				defined = true
+				break
+			}
+		}
+		if !defined {
+			return errors.Errorf("policy [%s/%s] refers to sub policy %s, which no child group of [%s] defines", path, name, implicitMeta.SubPolicy, path)
+		}
+	}
+
+	for name, child := range group.Groups {
+		if err := validateImplicitMetaPolicies(path+"/"+name, child); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// configPolicyExists checks if the absolute policy path, like /Channel/Application/Readers, exists
+func configPolicyExists(channelGroup *common.ConfigGroup, path string) bool {
+	elements := strings.Split(strings.TrimPrefix(path, "/"), "/")
+	if len(elements) < 2 || elements[0] != ChannelGroupKey {
+		return false
+	}
+	group := channelGroup
+	for _, name := range elements[1 : len(elements)-1] {
+		if group = group.Groups[name]; group == nil {
+			return false
+		}
+	}
+	_, ok := group.Policies[elements[len(elements)-1]]
+	return ok
+}
+
+func validatePEMCertificate(bs []byte) error {
+	block, _ := pem.Decode(bs)
+	if block == nil {
+		return errors.New("certificate is not PEM encoded")
+	}
+	if _, err := x509.ParseCertificate(block.Bytes); err != nil {
+		return errors.Wrap(err, "parse certificate failed")
+	}
+	return nil
+}
@@ -0,0 +1,524 @@
+package client
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"github.com/feng081212/fabric-sdk-go/fabric/endpoints"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc/keepalive"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// ConnectionProfile is a Fabric connection profile, the network config in YAML or JSON used by the
+// Fabric SDKs. Relative paths in it are relative to the directory of the profile.
+type ConnectionProfile struct {
+	Name                   string                                  `yaml:"name"`
+	Version                string                                  `yaml:"version"`
+	Client                 *ProfileClient                          `yaml:"client"`
+	Channels               map[string]*ProfileChannel              `yaml:"channels"`
+	Organizations          map[string]*ProfileOrganization         `yaml:"organizations"`
+	Orderers               map[string]*ProfileNode                 `yaml:"orderers"`
+	Peers                  map[string]*ProfileNode                 `yaml:"peers"`
+	CertificateAuthorities map[string]*ProfileCertificateAuthority `yaml:"certificateAuthorities"`
+
+	dir string
+}
+
+type ProfileClient struct {
+	// Organization is the organization of the client, its user signs the requests
+	Organization string `yaml:"organization"`
+	TlsCerts     *struct {
+		// Client is the TLS client certificate for mutual TLS with peers and orderers
+		Client *struct {
+			Key  *ProfileMaterial `yaml:"key"`
+			Cert *ProfileMaterial `yaml:"cert"`
+		} `yaml:"client"`
+	} `yaml:"tlsCerts"`
+}
+
+type ProfileChannel struct {
+	Orderers []string                       `yaml:"orderers"`
+	Peers    map[string]*ProfileChannelPeer `yaml:"peers"`
+}
+
+// ProfileChannelPeer are the roles of a peer in a channel, roles that are not set are true
+type ProfileChannelPeer struct {
+	EndorsingPeer  *bool `yaml:"endorsingPeer"`
+	ChaincodeQuery *bool `yaml:"chaincodeQuery"`
+	LedgerQuery    *bool `yaml:"ledgerQuery"`
+	EventSource    *bool `yaml:"eventSource"`
+}
+
+type ProfileOrganization struct {
+	MspID                  string           `yaml:"mspid"`
+	Peers                  []string         `yaml:"peers"`
+	CertificateAuthorities []string         `yaml:"certificateAuthorities"`
+	AdminPrivateKey        *ProfileMaterial `yaml:"adminPrivateKey"`
+	SignedCert             *ProfileMaterial `yaml:"signedCert"`
+}
+
+// ProfileNode is a peer or an orderer. The supported gRPC options are ssl-target-name-override
+// (or hostnameOverride), keep-alive-time, keep-alive-timeout, keep-alive-permit, fail-fast,
+// allow-insecure and request-timeout. Durations are strings like "120s" or numbers of seconds.
+type ProfileNode struct {
+	URL         string                 `yaml:"url"`
+	GrpcOptions map[string]interface{} `yaml:"grpcOptions"`
+	TlsCACerts  *ProfileMaterial       `yaml:"tlsCACerts"`
+}
+
+type ProfileCertificateAuthority struct {
+	URL         string                 `yaml:"url"`
+	CAName      string                 `yaml:"caName"`
+	HttpOptions map[string]interface{} `yaml:"httpOptions"`
+	TlsCACerts  *ProfileMaterial       `yaml:"tlsCACerts"`
+}
+
+// ProfileMaterial is PEM material given either inline or as the path of a file. Pem is a single
+// string or a list of strings.
+type ProfileMaterial struct {
+	Path string      `yaml:"path"`
+	Pem  interface{} `yaml:"pem"`
+}
+
+var envPattern = regexp.MustCompile(`\$\{(\w+)\}`)
+
+// LoadConnectionProfile reads a connection profile in YAML or JSON. References to environment
+// variables like ${FABRIC_CFG_PATH} in string values are replaced by their value.
+func LoadConnectionProfile(path string) (*ConnectionProfile, error) {
+	bs, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "read connection profile [%s] failed", path)
+	}
+	dir, err := filepath.Abs(filepath.Dir(path))
+	if err != nil {
+		return nil, errors.Wrapf(err, "resolve directory of connection profile [%s] failed", path)
+	}
+	return ParseConnectionProfile(bs, dir)
+}
+
+// ParseConnectionProfile parses a connection profile in YAML or JSON, relative paths are resolved
+// against dir
+func ParseConnectionProfile(data []byte, dir string) (*ConnectionProfile, error) {
+	profile := &ConnectionProfile{}
+	if err := yaml.Unmarshal(data, profile); err != nil {
+		return nil, errors.Wrap(err, "parse connection profile failed")
+	}
+	expandEnv(reflect.ValueOf(profile))
+	profile.dir = dir
+	return profile, nil
+}
+
+// expandEnv replaces the references to environment variables in the string values of v, after
+// parsing so that values like PEM blocks cannot change the structure of the profile. Map keys are
+// left as they are.
+func expandEnv(v reflect.Value) {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if !v.IsNil() {
+			expandEnv(v.Elem())
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if v.Field(i).CanSet() {
+				expandEnv(v.Field(i))
+			}
+		}
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			expandEnv(v.Index(i))
+		}
+	case reflect.Map:
+		// map values cannot be set in place
+		for _, key := range v.MapKeys() {
+			value := reflect.New(v.Type().Elem()).Elem()
+			value.Set(v.MapIndex(key))
+			expandEnv(value)
+			v.SetMapIndex(key, value)
+		}
+	case reflect.Interface:
+		if !v.IsNil() {
+			value := reflect.New(v.Elem().Type()).Elem()
+			value.Set(v.Elem())
+			expandEnv(value)
+			v.Set(value)
+		}
+	case reflect.String:
+		v.SetString(envPattern.ReplaceAllStringFunc(v.String(), func(ref string) string {
+			return os.Getenv(envPattern.FindStringSubmatch(ref)[1])
+		}))
+	}
+}
+
+// Peer returns the peer with the given name, its MSP ID is the one of the organization listing it
+func (p *ConnectionProfile) Peer(name string) (*endpoints.Peer, error) {
+	node, ok := p.Peers[name]
+	if !ok || node == nil {
+		return nil, errors.Errorf("peer [%s] is not defined in connection profile", name)
+	}
+	if node.URL == "" {
+		return nil, errors.Errorf("peer [%s] has no url", name)
+	}
+
+	result := endpoints.EmptyPeer().SetUrl(node.URL).SetMspID(p.peerMspID(name))
+	tlsCaCerts, err := p.certificates(node.TlsCACerts)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "tlsCACerts of peer [%s]", name)
+	}
+	if tlsCaCerts != nil {
+		result.AppendTlsCaCertsFromPEM(tlsCaCerts)
+	}
+	tlsClientCerts, err := p.tlsClientCerts()
+	if err != nil {
+		return nil, err
+	}
+	result.SetTlsClientCerts(tlsClientCerts)
+
+	options, err := parseGrpcOptions(node.GrpcOptions)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "grpcOptions of peer [%s]", name)
+	}
+	result.SetServerName(options.serverName).SetKeepaliveParams(options.keepalive).SetFailFast(options.failFast).SetInSecure(options.allowInsecure)
+	if options.timeout > 0 {
+		result.SetTimeout(options.timeout)
+	}
+	return result, nil
+}
+
+// Orderer returns the orderer with the given name
+func (p *ConnectionProfile) Orderer(name string) (*endpoints.Orderer, error) {
+	node, ok := p.Orderers[name]
+	if !ok || node == nil {
+		return nil, errors.Errorf("orderer [%s] is not defined in connection profile", name)
+	}
+	if node.URL == "" {
+		return nil, errors.Errorf("orderer [%s] has no url", name)
+	}
+
+	result := endpoints.EmptyOrderer().SetUrl(node.URL)
+	tlsCaCerts, err := p.certificates(node.TlsCACerts)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "tlsCACerts of orderer [%s]", name)
+	}
+	if tlsCaCerts != nil {
+		result.AppendTlsCaCertsFromPEM(tlsCaCerts)
+	}
+	tlsClientCerts, err := p.tlsClientCerts()
+	if err != nil {
+		return nil, err
+	}
+	result.SetTlsClientCerts(tlsClientCerts)
+
+	options, err := parseGrpcOptions(node.GrpcOptions)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "grpcOptions of orderer [%s]", name)
+	}
+	result.SetServerName(options.serverName).SetKeepaliveParams(options.keepalive).SetFailFast(options.failFast).SetAllowInsecure(options.allowInsecure)
+	if options.timeout > 0 {
+		result.SetTimeout(options.timeout)
+	}
+	return result, nil
+}
+
+// ChannelPeers returns the peers of the channel, sorted by name. With endorsingOnly the peers
+// whose endorsingPeer role is false are left out.
+func (p *ConnectionProfile) ChannelPeers(channelID string, endorsingOnly bool) ([]*endpoints.Peer, error) {
+	channel, err := p.channel(channelID)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(channel.Peers))
+	for name, roles := range channel.Peers {
+		if endorsingOnly && roles != nil && roles.EndorsingPeer != nil && !*roles.EndorsingPeer {
+			continue
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return p.peers(names)
+}
+
+// OrganizationPeers returns the peers of the organization
+func (p *ConnectionProfile) OrganizationPeers(organization string) ([]*endpoints.Peer, error) {
+	org, ok := p.Organizations[organization]
+	if !ok || org == nil {
+		return nil, errors.Errorf("organization [%s] is not defined in connection profile", organization)
+	}
+	return p.peers(org.Peers)
+}
+
+// ChannelOrderers returns the orderers of the channel, or all orderers sorted by name if the
+// channel lists none
+func (p *ConnectionProfile) ChannelOrderers(channelID string) ([]*endpoints.Orderer, error) {
+	channel, err := p.channel(channelID)
+	if err != nil {
+		return nil, err
+	}
+
+	names := channel.Orderers
+	if len(names) == 0 {
+		for name := range p.Orderers {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+	}
+
+	var result []*endpoints.Orderer
+	for _, name := range names {
+		o, err := p.Orderer(name)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, o)
+	}
+	if len(result) == 0 {
+		return nil, errors.Errorf("channel [%s] has no orderers", channelID)
+	}
+	return result, nil
+}
+
+// User returns the admin user of the organization, from its adminPrivateKey and signedCert.
+// An empty organization is the organization of the client section.
+func (p *ConnectionProfile) User(organization string) (*User, error) {
+	if organization == "" && p.Client != nil {
+		organization = p.Client.Organization
+	}
+	org, ok := p.Organizations[organization]
+	if !ok || org == nil {
+		return nil, errors.Errorf("organization [%s] is not defined in connection profile", organization)
+	}
+	if org.AdminPrivateKey == nil || org.SignedCert == nil {
+		return nil, errors.Errorf("organization [%s] has no adminPrivateKey or signedCert", organization)
+	}
+
+	key, err := p.material(org.AdminPrivateKey)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "adminPrivateKey of organization [%s]", organization)
+	}
+	cert, err := p.material(org.SignedCert)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "signedCert of organization [%s]", organization)
+	}
+	return GetUser("Admin@"+organization, org.MspID, cert, key)
+}
+
+// PeerClient returns a client of the peer with the given name
+func (p *ConnectionProfile) PeerClient(name string, signer Signer) (*PeerClient, error) {
+	peer, err := p.Peer(name)
+	if err != nil {
+		return nil, err
+	}
+	return &PeerClient{Peer: peer, Signer: signer}, nil
+}
+
+// OrdererClient returns a client of the orderers of the channel
+func (p *ConnectionProfile) OrdererClient(channelID string, signer Signer) (*OrdererClient, error) {
+	orderers, err := p.ChannelOrderers(channelID)
+	if err != nil {
+		return nil, err
+	}
+	return &OrdererClient{Orderer: orderers[0], Orderers: orderers, Signer: signer}, nil
+}
+
+// PeersClient returns a client of the endorsing peers and the orderers of the channel
+func (p *ConnectionProfile) PeersClient(channelID string, signer Signer) (*PeersClient, error) {
+	peers, err := p.ChannelPeers(channelID, true)
+	if err != nil {
+		return nil, err
+	}
+	if len(peers) == 0 {
+		return nil, errors.Errorf("channel [%s] has no endorsing peers", channelID)
+	}
+	ordererClient, err := p.OrdererClient(channelID, signer)
+	if err != nil {
+		return nil, err
+	}
+	return &PeersClient{Peers: peers, Orderer: *ordererClient, Signer: signer}, nil
+}
+
+func (p *ConnectionProfile) channel(channelID string) (*ProfileChannel, error) {
+	channel, ok := p.Channels[channelID]
+	if !ok {
+		return nil, errors.Errorf("channel [%s] is not defined in connection profile", channelID)
+	}
+	if channel == nil {
+		channel = &ProfileChannel{}
+	}
+	return channel, nil
+}
+
+func (p *ConnectionProfile) peers(names []string) ([]*endpoints.Peer, error) {
+	var result []*endpoints.Peer
+	for _, name := range names {
+		peer, err := p.Peer(name)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, peer)
+	}
+	return result, nil
+}
+
+func (p *ConnectionProfile) peerMspID(name string) string {
+	for _, org := range p.Organizations {
+		if org == nil {
+			continue
+		}
+		for _, peer := range org.Peers {
+			if peer == name {
+				return org.MspID
+			}
+		}
+	}
+	return ""
+}
+
+func (p *ConnectionProfile) tlsClientCerts() ([]tls.Certificate, error) {
+	if p.Client == nil || p.Client.TlsCerts == nil || p.Client.TlsCerts.Client == nil {
+		return nil, nil
+	}
+	client := p.Client.TlsCerts.Client
+	if client.Key == nil || client.Cert == nil {
+		return nil, errors.New("client TLS certificate needs both key and cert")
+	}
+	key, err := p.material(client.Key)
+	if err != nil {
+		return nil, errors.WithMessage(err, "client TLS key")
+	}
+	cert, err := p.material(client.Cert)
+	if err != nil {
+		return nil, errors.WithMessage(err, "client TLS cert")
+	}
+	tlsCert, err := tls.X509KeyPair([]byte(cert), []byte(key))
+	if err != nil {
+		return nil, errors.Wrap(err, "load client TLS certificate failed")
+	}
+	return []tls.Certificate{tlsCert}, nil
+}
+
+// certificates returns the PEM encoded certificates of the material, nil if there are none
+func (p *ConnectionProfile) certificates(material *ProfileMaterial) ([]byte, error) {
+	if material == nil {
+		return nil, nil
+	}
+	pems, err := p.material(material)
+	if err != nil {
+		return nil, err
+	}
+	if !x509.NewCertPool().AppendCertsFromPEM([]byte(pems)) {
+		return nil, errors.New("no valid PEM certificate")
+	}
+	return []byte(pems), nil
+}
+
+// material returns the inline PEM, or the content of the file of the path
+func (p *ConnectionProfile) material(material *ProfileMaterial) (string, error) {
+	switch pem := material.Pem.(type) {
+	case string:
+		if pem != "" {
+			return pem, nil
+		}
+	case []interface{}:
+		var result string
+		for _, item := range pem {
+			s, ok := item.(string)
+			if !ok {
+				return "", errors.Errorf("pem list contains a %T", item)
+			}
+			result += s + "\n"
+		}
+		if result != "" {
+			return result, nil
+		}
+	case nil:
+	default:
+		return "", errors.Errorf("pem is a %T, not a string or a list of strings", pem)
+	}
+
+	if material.Path == "" {
+		return "", errors.New("neither pem nor path is set")
+	}
+	path := material.Path
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(p.dir, path)
+	}
+	bs, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", errors.Wrapf(err, "read file [%s] failed", material.Path)
+	}
+	return string(bs), nil
+}
+
+type grpcOptions struct {
+	serverName    string
+	keepalive     *keepalive.ClientParameters
+	failFast      bool
+	allowInsecure bool
+	timeout       time.Duration
+}
+
+func parseGrpcOptions(options map[string]interface{}) (*grpcOptions, error) {
+	result := &grpcOptions{keepalive: endpoints.GetDefaultKeepaliveParams()}
+	var err error
+	for name, value := range options {
+		switch name {
+		case "ssl-target-name-override", "hostnameOverride":
+			result.serverName = fmt.Sprint(value)
+		case "keep-alive-time":
+			result.keepalive.Time, err = optionDuration(value)
+		case "keep-alive-timeout":
+			result.keepalive.Timeout, err = optionDuration(value)
+		case "keep-alive-permit":
+			result.keepalive.PermitWithoutStream, err = optionBool(value)
+		case "fail-fast":
+			result.failFast, err = optionBool(value)
+		case "allow-insecure":
+			result.allowInsecure, err = optionBool(value)
+		case "request-timeout":
+			result.timeout, err = optionDuration(value)
+		}
+		if err != nil {
+			return nil, errors.WithMessagef(err, "option [%s]", name)
+		}
+	}
+	return result, nil
+}
+
+func optionDuration(value interface{}) (time.Duration, error) {
+	switch v := value.(type) {
+	case int:
+		return time.Duration(v) * time.Second, nil
+	case float64:
+		return time.Duration(v * float64(time.Second)), nil
+	case string:
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return 0, errors.Wrapf(err, "invalid duration [%s]", v)
+		}
+		return d, nil
+	}
+	return 0, errors.Errorf("invalid duration [%v]", value)
+}
+
+func optionBool(value interface{}) (bool, error) {
+	switch v := value.(type) {
+	case bool:
+		return v, nil
+	case string:
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return false, errors.Wrapf(err, "invalid boolean [%s]", v)
+		}
+		return b, nil
+	}
+	return false, errors.Errorf("invalid boolean [%v]", value)
+}
@@ -0,0 +1,322 @@
+package client
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testConnectionProfile = `
+name: test-network
+version: 1.0.0
+client:
+  organization: Org1
+  tlsCerts:
+    client:
+      key:
+        path: ${CP_TEST_CRYPTO}/client.key
+      cert:
+        path: ${CP_TEST_CRYPTO}/client.crt
+channels:
+  mychannel:
+    orderers:
+      - orderer.example.com
+    peers:
+      peer0.org1.example.com:
+        endorsingPeer: true
+      peer0.org2.example.com:
+        endorsingPeer: true
+      peer1.org2.example.com:
+        endorsingPeer: false
+        ledgerQuery: true
+  otherchannel:
+organizations:
+  Org1:
+    mspid: Org1MSP
+    peers:
+      - peer0.org1.example.com
+    adminPrivateKey:
+      path: ${CP_TEST_CRYPTO}/admin.key
+    signedCert:
+      pem: |
+%s
+  Org2:
+    mspid: Org2MSP
+    peers:
+      - peer0.org2.example.com
+      - peer1.org2.example.com
+orderers:
+  orderer.example.com:
+    url: grpcs://${CP_TEST_ORDERER_HOST}:7050
+    grpcOptions:
+      ssl-target-name-override: orderer.example.com
+      keep-alive-time: 10s
+      request-timeout: 30
+    tlsCACerts:
+      pem: |
+%s
+peers:
+  peer0.org1.example.com:
+    url: grpcs://localhost:7051
+    grpcOptions:
+      hostnameOverride: peer0.org1.example.com
+      keep-alive-permit: "true"
+      request-timeout: 1.5
+    tlsCACerts:
+      path: crypto/tlsca.pem
+  peer0.org2.example.com:
+    url: grpcs://localhost:9051
+    tlsCACerts:
+      pem:
+%s
+  peer1.org2.example.com:
+    url: grpcs://localhost:10051${CP_TEST_UNSET}
+`
+
+// indent indents every line of text by the given number of spaces, to embed PEM in YAML
+func indent(text string, spaces int) string {
+	prefix := strings.Repeat(" ", spaces)
+	return prefix + strings.ReplaceAll(strings.TrimSpace(text), "\n", "\n"+prefix)
+}
+
+func writeTestKey(t *testing.T, path string, signer *ecdsaSigner) {
+	der, err := x509.MarshalPKCS8PrivateKey(signer.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeTestFile(t, path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+}
+
+// testProfile writes the crypto material of testConnectionProfile to a temporary directory and
+// parses the profile with that directory
+func testProfile(t *testing.T) *ConnectionProfile {
+	dir, err := ioutil.TempDir("", "connectionprofile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+
+	tlsCA := newTestCA(t, "tlsca.example.com")
+	writeTestFile(t, filepath.Join(dir, "crypto", "tlsca.pem"), tlsCA.pem())
+	client := tlsCA.signer(t, "Org1MSP", "client.org1.example.com")
+	writeTestFile(t, filepath.Join(dir, "crypto", "client.crt"), client.certPEM)
+	writeTestKey(t, filepath.Join(dir, "crypto", "client.key"), client)
+	admin := newTestCA(t, "ca.org1.example.com").signer(t, "Org1MSP", "Admin@org1.example.com", "admin")
+	writeTestKey(t, filepath.Join(dir, "crypto", "admin.key"), admin)
+
+	// the pem of peer0.org2.example.com is a list of certificates
+	pemList := indent("- |\n"+indent(string(tlsCA.pem()), 2)+"\n- |\n"+indent(string(newTestCA(t, "tlsca.org2.example.com").pem()), 2), 8)
+	data := []byte(fmt.Sprintf(testConnectionProfile, indent(string(admin.certPEM), 8), indent(string(tlsCA.pem()), 8), pemList))
+
+	t.Setenv("CP_TEST_CRYPTO", filepath.Join(dir, "crypto"))
+	t.Setenv("CP_TEST_ORDERER_HOST", "orderer.example.com")
+	profile, err := ParseConnectionProfile(data, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return profile
+}
+
+func TestConnectionProfile(t *testing.T) {
+	profile := testProfile(t)
+
+	orderer, err := profile.Orderer("orderer.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if url := orderer.GetGrpcUrl(); url != "orderer.example.com:7050" {
+		t.Fatalf("expected the environment variable to be substituted, got %s", url)
+	}
+	if orderer.GetTimeout() != 30*time.Second {
+		t.Fatalf("expected a request timeout of 30s, got %s", orderer.GetTimeout())
+	}
+
+	peer, err := profile.Peer("peer0.org1.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if peer.MSPID() != "Org1MSP" || peer.GetTimeout() != 1500*time.Millisecond {
+		t.Fatalf("expected Org1MSP and a request timeout of 1.5s, got %s %s", peer.MSPID(), peer.GetTimeout())
+	}
+	if len(peer.GetTlsClientCerts()) != 1 {
+		t.Fatal("expected the client TLS certificate of the client section")
+	}
+
+	// an unset environment variable is replaced by nothing
+	peer, err = profile.Peer("peer1.org2.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if peer.URL() != "grpcs://localhost:10051" || peer.GetTimeout() != 60*time.Second {
+		t.Fatalf("expected the url without the unset variable and the default timeout, got %s %s", peer.URL(), peer.GetTimeout())
+	}
+
+	peers, err := profile.ChannelPeers("mychannel", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(peers) != 2 || peers[0].URL() != "grpcs://localhost:7051" || peers[1].MSPID() != "Org2MSP" {
+		t.Fatalf("expected the two endorsing peers sorted by name, got %v", peers)
+	}
+	if peers, err = profile.ChannelPeers("mychannel", false); err != nil || len(peers) != 3 {
+		t.Fatalf("expected all three peers of the channel, got %d %v", len(peers), err)
+	}
+	if peers, err = profile.OrganizationPeers("Org2"); err != nil || len(peers) != 2 {
+		t.Fatalf("expected the two peers of Org2, got %d %v", len(peers), err)
+	}
+
+	// a channel without orderers uses all orderers
+	if orderers, err := profile.ChannelOrderers("otherchannel"); err != nil || len(orderers) != 1 {
+		t.Fatalf("expected the orderers of the profile, got %d %v", len(orderers), err)
+	}
+	if _, err = profile.ChannelOrderers("unknown"); err == nil {
+		t.Fatal("expected an unknown channel to be refused")
+	}
+
+	user, err := profile.User("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.MspID != "Org1MSP" {
+		t.Fatalf("expected the admin of the client organization, got %s", user.MspID)
+	}
+
+	peersClient, err := profile.PeersClient("mychannel", user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(peersClient.Peers) != 2 || peersClient.Orderer.Orderer == nil {
+		t.Fatal("expected the endorsing peers and the orderer of the channel")
+	}
+}
+
+func TestConnectionProfileEnvInValues(t *testing.T) {
+	tlsCA := newTestCA(t, "tlsca.example.com")
+	// substituted before parsing, the lines of the PEM and the comment sign would break the YAML
+	t.Setenv("CP_TEST_PEM", string(tlsCA.pem()))
+	t.Setenv("CP_TEST_URL", "grpcs://localhost:7051")
+	t.Setenv("CP_TEST_NAME", "peer0.org1.example.com #1")
+
+	profile, err := ParseConnectionProfile([]byte(`
+peers:
+  ${CP_TEST_NAME}:
+    url: ${CP_TEST_URL}
+    grpcOptions:
+      ssl-target-name-override: ${CP_TEST_NAME}
+    tlsCACerts:
+      pem:
+        - ${CP_TEST_PEM}
+`), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	node, ok := profile.Peers["${CP_TEST_NAME}"]
+	if !ok {
+		t.Fatal("expected the keys of the profile to be left as they are")
+	}
+	if node.URL != "grpcs://localhost:7051" || node.GrpcOptions["ssl-target-name-override"] != "peer0.org1.example.com #1" {
+		t.Fatalf("expected the variables in the values to be substituted, got %s %v", node.URL, node.GrpcOptions)
+	}
+	certificates, err := profile.certificates(node.TlsCACerts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.TrimSpace(string(certificates)) != strings.TrimSpace(string(tlsCA.pem())) {
+		t.Fatal("expected the PEM of the environment variable")
+	}
+}
+
+func TestConnectionProfileTlsCACerts(t *testing.T) {
+	profile := testProfile(t)
+
+	fromPath, err := profile.certificates(profile.Peers["peer0.org1.example.com"].TlsCACerts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fromPem, err := profile.certificates(profile.Orderers["orderer.example.com"].TlsCACerts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.TrimSpace(string(fromPath)) != strings.TrimSpace(string(fromPem)) {
+		t.Fatal("expected the same certificate from the path and from the inline pem")
+	}
+	fromList, err := profile.certificates(profile.Peers["peer0.org2.example.com"].TlsCACerts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if blocks := strings.Count(string(fromList), "BEGIN CERTIFICATE"); blocks != 2 {
+		t.Fatalf("expected the two certificates of the pem list, got %d", blocks)
+	}
+
+	tests := []struct {
+		name     string
+		material *ProfileMaterial
+		errMsg   string
+	}{
+		{"missing file", &ProfileMaterial{Path: "crypto/missing.pem"}, "read file [crypto/missing.pem] failed"},
+		{"not a certificate", &ProfileMaterial{Pem: "not a certificate"}, "no valid PEM certificate"},
+		{"neither pem nor path", &ProfileMaterial{}, "neither pem nor path is set"},
+		{"pem of another type", &ProfileMaterial{Pem: 42}, "not a string or a list of strings"},
+		{"pem list of another type", &ProfileMaterial{Pem: []interface{}{42}}, "pem list contains a int"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := profile.certificates(test.material)
+			if err == nil || !strings.Contains(err.Error(), test.errMsg) {
+				t.Fatalf("expected an error containing [%s], got %v", test.errMsg, err)
+			}
+		})
+	}
+}
+
+func TestParseGrpcOptions(t *testing.T) {
+	options, err := parseGrpcOptions(map[string]interface{}{
+		"ssl-target-name-override": "peer0.org1.example.com",
+		"keep-alive-time":          "10s",
+		"keep-alive-timeout":       20,
+		"keep-alive-permit":        "true",
+		"fail-fast":                false,
+		"allow-insecure":           true,
+		"request-timeout":          2.5,
+		"grpc.max_send_message":    1024,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if options.serverName != "peer0.org1.example.com" {
+		t.Fatalf("expected the server name override, got %s", options.serverName)
+	}
+	if options.keepalive.Time != 10*time.Second || options.keepalive.Timeout != 20*time.Second || !options.keepalive.PermitWithoutStream {
+		t.Fatalf("expected the keep-alive options, got %+v", options.keepalive)
+	}
+	if options.failFast || !options.allowInsecure || options.timeout != 2500*time.Millisecond {
+		t.Fatalf("expected fail-fast false, allow-insecure true and a timeout of 2.5s, got %+v", options)
+	}
+
+	options, err = parseGrpcOptions(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if options.keepalive.Timeout != 120*time.Second || options.timeout != 0 {
+		t.Fatalf("expected the default keep-alive and no timeout, got %+v %s", options.keepalive, options.timeout)
+	}
+
+	invalid := []map[string]interface{}{
+		{"keep-alive-time": "ten seconds"},
+		{"request-timeout": true},
+		{"fail-fast": "sometimes"},
+		{"allow-insecure": 1},
+	}
+	for _, option := range invalid {
+		if _, err = parseGrpcOptions(option); err == nil {
+			t.Fatalf("expected %v to be refused", option)
+		}
+	}
+}
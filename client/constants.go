@@ -52,6 +52,9 @@ const (
 
 	ConsensusTypeEtcdRaft = "etcdraft"
 
+	// ChannelGroupKey is the name of the root group of the channel config
+	ChannelGroupKey = "Channel"
+
 	// OrdererGroupKey is the group name for the orderer config.
 	OrdererGroupKey = "Orderer"
 
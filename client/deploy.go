@@ -0,0 +1,409 @@
+package client
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/feng081212/fabric-protos-go/common"
+	"github.com/feng081212/fabric-protos-go/msp"
+	"github.com/feng081212/fabric-protos-go/peer/lifecycle"
+	ccpackager "github.com/feng081212/fabric-sdk-go/fabric/chaincode/ccpackager/lifecycle"
+	"github.com/feng081212/fabric-sdk-go/fabric/endpoints"
+	"github.com/feng081212/fabric-sdk-go/fabric/errors/multi"
+	"github.com/feng081212/fabric-sdk-go/fabric/errors/status"
+	"github.com/golang/protobuf/proto"
+	"github.com/pkg/errors"
+)
+
+// DeploymentStep is a step of a chaincode deployment
+type DeploymentStep string
+
+const (
+	DeploymentStepInstall DeploymentStep = "install"
+	DeploymentStepApprove DeploymentStep = "approve"
+	DeploymentStepCommit  DeploymentStep = "commit"
+	DeploymentStepInit    DeploymentStep = "init"
+)
+
+const defaultDeploymentPollInterval = 2 * time.Second
+
+// alreadyInitializedPattern matches the message of the peer refusing to init a chaincode twice
+var alreadyInitializedPattern = regexp.MustCompile(`chaincode '[^']+' is already initialized`)
+
+// DeploymentOrganization is an organization taking part in a chaincode deployment. The package is
+// installed on all Peers, the first peer is also used for the approval and the queries. Signer must
+// be an admin of the organization.
+type DeploymentOrganization struct {
+	// MspID is taken from the Signer when it is empty
+	MspID  string
+	Peers  []*endpoints.Peer
+	Signer Signer
+}
+
+// DeploymentProgress reports the outcome of a step for an organization. Skipped is set when the
+// step was already done by an earlier run, Peer is only set for the install step.
+type DeploymentProgress struct {
+	MspID   string
+	Peer    string
+	Step    DeploymentStep
+	Skipped bool
+	Err     error
+}
+
+// DeploymentResult is the result of a chaincode deployment, the transaction IDs are empty when
+// the step was skipped
+type DeploymentResult struct {
+	PackageID  string
+	CommitTxID string
+	InitTxID   string
+}
+
+// ChaincodeDeployment installs a chaincode package on the peers of the organizations, approves the
+// definition for each organization, commits it once all of them approved it and finally calls the
+// init function when the definition requires it. Every step already done is skipped, so running a
+// deployment again after a partial failure resumes it.
+type ChaincodeDeployment struct {
+	ChannelID string
+	// Package is a chaincode package as built by lifecycle.NewCCPackage
+	Package       []byte
+	Definition    *CommitChaincodeRequest
+	Organizations []*DeploymentOrganization
+	// Orderer receives the approvals and the commit, its Signer is replaced with the Signer of the
+	// organization sending the transaction
+	Orderer *OrdererClient
+	// InitArgs are the arguments of the init invocation, only used when Definition.InitRequired
+	InitArgs [][]byte
+	// PollInterval is the interval between two commit readiness checks, 2s by default
+	PollInterval time.Duration
+	// Progress, if set, is called after each step of each organization
+	Progress func(progress *DeploymentProgress)
+}
+
+func (p *ChaincodeDeployment) Deploy() (*DeploymentResult, error) {
+	return p.DeployContext(context.Background())
+}
+
+// DeployContext is Deploy with a context, ctx bounds the whole deployment including the wait for
+// the approvals
+func (p *ChaincodeDeployment) DeployContext(ctx context.Context) (*DeploymentResult, error) {
+	if e := p.validate(); e != nil {
+		return nil, e
+	}
+
+	pkg, e := ccpackager.ParsePackage(p.Package)
+	if e != nil {
+		return nil, e
+	}
+	result := &DeploymentResult{PackageID: pkg.PackageID}
+
+	mspIDs := make([]string, len(p.Organizations))
+	for i, org := range p.Organizations {
+		if mspIDs[i], e = org.mspID(); e != nil {
+			return nil, e
+		}
+	}
+
+	for i, org := range p.Organizations {
+		for _, endpoint := range org.Peers {
+			if e = p.install(ctx, mspIDs[i], org, endpoint, result.PackageID); e != nil {
+				return nil, e
+			}
+		}
+	}
+
+	committed, e := p.committed(ctx)
+	if e != nil {
+		return nil, e
+	}
+
+	if !committed {
+		for i, org := range p.Organizations {
+			if e = p.approve(ctx, mspIDs[i], org, result.PackageID); e != nil {
+				return nil, e
+			}
+		}
+		if e = p.waitForApprovals(ctx, mspIDs); e != nil {
+			return nil, e
+		}
+		if result.CommitTxID, e = p.commit(ctx, mspIDs[0]); e != nil {
+			return nil, e
+		}
+	} else {
+		for _, mspID := range mspIDs {
+			p.report(&DeploymentProgress{MspID: mspID, Step: DeploymentStepApprove, Skipped: true})
+		}
+		p.report(&DeploymentProgress{MspID: mspIDs[0], Step: DeploymentStepCommit, Skipped: true})
+	}
+
+	if p.Definition.InitRequired {
+		if result.InitTxID, e = p.init(ctx, mspIDs[0], committed); e != nil {
+			return nil, e
+		}
+	}
+
+	return result, nil
+}
+
+func (p *ChaincodeDeployment) validate() error {
+	if p.ChannelID == "" {
+		return errors.New("channel ID is required")
+	}
+	if len(p.Package) == 0 {
+		return errors.New("chaincode package is required")
+	}
+	if p.Definition == nil || p.Definition.Name == "" {
+		return errors.New("chaincode definition with a name is required")
+	}
+	if p.Orderer == nil {
+		return errors.New("orderer client is required")
+	}
+	if len(p.Organizations) == 0 {
+		return errors.New("at least one organization is required")
+	}
+	for i, org := range p.Organizations {
+		if org.Signer == nil {
+			return errors.Errorf("signer of organization %d is required", i)
+		}
+		if len(org.Peers) == 0 {
+			return errors.Errorf("organization %d has no peers", i)
+		}
+	}
+	return nil
+}
+
+func (p *ChaincodeDeployment) report(progress *DeploymentProgress) {
+	if p.Progress != nil {
+		p.Progress(progress)
+	}
+}
+
+// fail reports the failed step and returns its error
+func (p *ChaincodeDeployment) fail(progress *DeploymentProgress, err error) error {
+	progress.Err = err
+	p.report(progress)
+	return err
+}
+
+func (p *ChaincodeDeployment) install(ctx context.Context, mspID string, org *DeploymentOrganization, endpoint *endpoints.Peer, packageID string) error {
+	progress := &DeploymentProgress{MspID: mspID, Peer: endpoint.URL(), Step: DeploymentStepInstall}
+	peerClient := &PeerClient{Peer: endpoint, Signer: org.Signer}
+
+	installed, e := peerClient.GetInstalledChainCodePackageContext(ctx)
+	if e != nil {
+		return p.fail(progress, errors.WithMessagef(e, "query installed chaincodes of peer %s failed", progress.Peer))
+	}
+	for _, cc := range installed.InstalledChaincodes {
+		if cc.PackageId == packageID {
+			progress.Skipped = true
+			p.report(progress)
+			return nil
+		}
+	}
+
+	res, e := peerClient.InstallChainCodePackageContext(ctx, p.Package)
+	if e != nil {
+		return p.fail(progress, errors.WithMessagef(e, "install chaincode package on peer %s failed", progress.Peer))
+	}
+	if res.PackageId != packageID {
+		return p.fail(progress, errors.Errorf("peer %s installed package %s instead of %s", progress.Peer, res.PackageId, packageID))
+	}
+	p.report(progress)
+	return nil
+}
+
+// committed tells whether the sequence of the definition is already committed on the channel
+func (p *ChaincodeDeployment) committed(ctx context.Context) (bool, error) {
+	org := p.Organizations[0]
+	peerClient := &PeerClient{Peer: org.Peers[0], Signer: org.Signer}
+
+	res, e := peerClient.QueryCommittedOfChannelContext(ctx, p.ChannelID)
+	if e != nil {
+		return false, errors.WithMessagef(e, "query committed chaincodes of channel %s failed", p.ChannelID)
+	}
+	for _, definition := range res.ChaincodeDefinitions {
+		if definition.Name != p.Definition.Name {
+			continue
+		}
+		switch {
+		case definition.Sequence < p.Definition.Sequence:
+			return false, nil
+		case definition.Sequence > p.Definition.Sequence:
+			return false, errors.Errorf("chaincode %s is already committed with sequence %d, higher than %d", p.Definition.Name, definition.Sequence, p.Definition.Sequence)
+		case definition.Version != p.Definition.Version:
+			return false, errors.Errorf("sequence %d of chaincode %s is already committed with version %s instead of %s", definition.Sequence, p.Definition.Name, definition.Version, p.Definition.Version)
+		}
+		return true, nil
+	}
+	return false, nil
+}
+
+func (p *ChaincodeDeployment) readiness(ctx context.Context, org *DeploymentOrganization) (*lifecycle.CheckCommitReadinessResult, error) {
+	peerClient := &PeerClient{Peer: org.Peers[0], Signer: org.Signer}
+	res, e := peerClient.CheckCommitReadinessContext(ctx, p.ChannelID, &CheckChaincodeCommitReadinessRequest{
+		Name:                p.Definition.Name,
+		Version:             p.Definition.Version,
+		Sequence:            p.Definition.Sequence,
+		EndorsementPlugin:   p.Definition.EndorsementPlugin,
+		ValidationPlugin:    p.Definition.ValidationPlugin,
+		SignaturePolicy:     p.Definition.SignaturePolicy,
+		ChannelConfigPolicy: p.Definition.ChannelConfigPolicy,
+		CollectionConfig:    p.Definition.CollectionConfig,
+		InitRequired:        p.Definition.InitRequired,
+	})
+	if e != nil {
+		return nil, errors.WithMessagef(e, "check commit readiness of chaincode %s failed", p.Definition.Name)
+	}
+	return res, nil
+}
+
+// approve approves the definition for the organization unless it already approved the same
+// definition for the same package
+func (p *ChaincodeDeployment) approve(ctx context.Context, mspID string, org *DeploymentOrganization, packageID string) error {
+	progress := &DeploymentProgress{MspID: mspID, Step: DeploymentStepApprove}
+	peerClient := &PeerClient{Peer: org.Peers[0], Signer: org.Signer}
+
+	readiness, e := p.readiness(ctx, org)
+	if e != nil {
+		return p.fail(progress, e)
+	}
+	// the readiness ignores the package, an approval of another package must be replaced
+	if readiness.Approvals[mspID] {
+		approved, e := peerClient.QueryApprovedChaincodeDefinitionContext(ctx, p.ChannelID, p.Definition.Name, p.Definition.Sequence)
+		if e != nil {
+			return p.fail(progress, errors.WithMessagef(e, "query approved definition of chaincode %s failed", p.Definition.Name))
+		}
+		if local := approved.GetSource().GetLocalPackage(); local != nil && local.PackageId == packageID {
+			progress.Skipped = true
+			p.report(progress)
+			return nil
+		}
+	}
+
+	ordererClient := *p.Orderer
+	ordererClient.Signer = org.Signer
+	st, e := peerClient.ApproveChainCodeContext(ctx, p.ChannelID, &ApproveChaincodeRequest{
+		Name:                p.Definition.Name,
+		Version:             p.Definition.Version,
+		PackageID:           packageID,
+		Sequence:            p.Definition.Sequence,
+		EndorsementPlugin:   p.Definition.EndorsementPlugin,
+		ValidationPlugin:    p.Definition.ValidationPlugin,
+		SignaturePolicy:     p.Definition.SignaturePolicy,
+		ChannelConfigPolicy: p.Definition.ChannelConfigPolicy,
+		CollectionConfig:    p.Definition.CollectionConfig,
+		InitRequired:        p.Definition.InitRequired,
+	}, &ordererClient)
+	if e != nil {
+		return p.fail(progress, errors.WithMessagef(e, "approve chaincode %s for %s failed", p.Definition.Name, mspID))
+	}
+	if st != nil && *st != common.Status_SUCCESS {
+		return p.fail(progress, errors.Errorf("approve chaincode %s for %s failed with status %s", p.Definition.Name, mspID, st.String()))
+	}
+	p.report(progress)
+	return nil
+}
+
+// waitForApprovals polls the commit readiness until the approvals of all the organizations are
+// committed on the channel
+func (p *ChaincodeDeployment) waitForApprovals(ctx context.Context, mspIDs []string) error {
+	interval := p.PollInterval
+	if interval <= 0 {
+		interval = defaultDeploymentPollInterval
+	}
+
+	for {
+		readiness, e := p.readiness(ctx, p.Organizations[0])
+		if e != nil {
+			return e
+		}
+		var missing []string
+		for _, mspID := range mspIDs {
+			if !readiness.Approvals[mspID] {
+				missing = append(missing, mspID)
+			}
+		}
+		if len(missing) == 0 {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return errors.Wrapf(ctx.Err(), "waiting for the approvals of %s", strings.Join(missing, ", "))
+		case <-time.After(interval):
+		}
+	}
+}
+
+// lifecycleEndorsers returns a client endorsing with the first peer of each organization and
+// sending the transactions as the first organization
+func lifecycleEndorsers(organizations []*DeploymentOrganization, orderer *OrdererClient) *PeersClient {
+	org := organizations[0]
+	peersClient := &PeersClient{Orderer: *orderer, Signer: org.Signer}
+	peersClient.Orderer.Signer = org.Signer
+	for _, o := range organizations {
+		peersClient.Peers = append(peersClient.Peers, o.Peers[0])
+	}
+	return peersClient
+}
+
+func (p *ChaincodeDeployment) commit(ctx context.Context, mspID string) (string, error) {
+	progress := &DeploymentProgress{MspID: mspID, Step: DeploymentStepCommit}
+
+	res, e := lifecycleEndorsers(p.Organizations, p.Orderer).CommitChainCodeAndWait(ctx, p.ChannelID, p.Definition, p.Organizations[0].Peers[0])
+	if e != nil {
+		return "", p.fail(progress, errors.WithMessagef(e, "commit chaincode %s failed", p.Definition.Name))
+	}
+	p.report(progress)
+	return res.TxID, nil
+}
+
+// init calls the init function of the chaincode. When the definition was committed by an earlier
+// run the chaincode may already be initialized, the peer refusing a second init is not an error.
+func (p *ChaincodeDeployment) init(ctx context.Context, mspID string, committed bool) (string, error) {
+	progress := &DeploymentProgress{MspID: mspID, Step: DeploymentStepInit}
+
+	res, e := lifecycleEndorsers(p.Organizations, p.Orderer).InvokeChainCodeAndWait(ctx, p.ChannelID, p.Definition.Name, true, p.InitArgs, p.Organizations[0].Peers[0])
+	if e != nil {
+		if committed && alreadyInitialized(e) {
+			progress.Skipped = true
+			p.report(progress)
+			return "", nil
+		}
+		return "", p.fail(progress, errors.WithMessagef(e, "init chaincode %s failed", p.Definition.Name))
+	}
+	p.report(progress)
+	return res.TxID, nil
+}
+
+// alreadyInitialized tells if the endorsers refused the init because the chaincode is already
+// initialized
+func alreadyInitialized(err error) bool {
+	errs, ok := errors.Cause(err).(multi.Errors)
+	if !ok {
+		errs = multi.Errors{err}
+	}
+	for _, e := range errs {
+		s, ok := status.FromError(e)
+		if !ok || s.Group != status.ChaincodeStatus || !alreadyInitializedPattern.MatchString(s.Message) {
+			return false
+		}
+	}
+	return len(errs) > 0
+}
+
+func (p *DeploymentOrganization) mspID() (string, error) {
+	if p.MspID != "" {
+		return p.MspID, nil
+	}
+	serialized, e := p.Signer.Serialize()
+	if e != nil {
+		return "", errors.WithMessage(e, "serialize signer failed")
+	}
+	identity := &msp.SerializedIdentity{}
+	if e = proto.Unmarshal(serialized, identity); e != nil {
+		return "", errors.Wrap(e, "unmarshal signer identity failed")
+	}
+	return identity.Mspid, nil
+}
@@ -0,0 +1,317 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/feng081212/fabric-protos-go/peer"
+	"github.com/feng081212/fabric-protos-go/peer/lifecycle"
+	ccpackager "github.com/feng081212/fabric-sdk-go/fabric/chaincode/ccpackager/lifecycle"
+	"github.com/feng081212/fabric-sdk-go/fabric/endpoints"
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/grpc"
+)
+
+// endorserServer answers every proposal with the response
+type endorserServer struct {
+	response *peer.Response
+}
+
+func (s *endorserServer) ProcessProposal(context.Context, *peer.SignedProposal) (*peer.ProposalResponse, error) {
+	return &peer.ProposalResponse{Response: s.response}, nil
+}
+
+func startEndorserServer(t *testing.T, response *peer.Response) *endpoints.Peer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := grpc.NewServer()
+	peer.RegisterEndorserServer(server, &endorserServer{response: response})
+	go func() { _ = server.Serve(listener) }()
+	t.Cleanup(server.Stop)
+	return endpoints.EmptyPeer().SetUrl("grpc://" + listener.Addr().String())
+}
+
+// testApproval is the package approved by an organization, the commit readiness reports it once
+// it was checked delay times, like an approval waiting for its block
+type testApproval struct {
+	packageID string
+	checks    int
+}
+
+// testLifecycle is the _lifecycle state of mychannel shared by the peers of the test networks
+type testLifecycle struct {
+	mu        sync.Mutex
+	delay     int
+	approvals map[string]*testApproval
+	committed *lifecycle.QueryChaincodeDefinitionsResult_ChaincodeDefinition
+	// initTxID is the transaction initializing the chaincode, the endorsers of another init refuse it
+	initTxID        string
+	readinessChecks int
+}
+
+func lifecycleResponse(result proto.Message) *peer.Response {
+	return &peer.Response{Status: 200, Payload: ProtoMarshalIgnoreError(result)}
+}
+
+// peer returns the handler of a peer of the organization with the packages already installed
+func (l *testLifecycle) peer(mspID string, installed ...string) func(invocation *testInvocation) *peer.Response {
+	return func(invocation *testInvocation) *peer.Response {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+
+		if invocation.Chaincode != "_lifecycle" {
+			if l.initTxID != "" && l.initTxID != invocation.TxID {
+				return &peer.Response{Status: 500, Message: fmt.Sprintf("chaincode '%s' is already initialized but called as init", invocation.Chaincode)}
+			}
+			l.initTxID = invocation.TxID
+			return okResponse(invocation)
+		}
+
+		var arg []byte
+		if len(invocation.Args) > 1 {
+			arg = invocation.Args[1]
+		}
+		switch string(invocation.Args[0]) {
+		case "QueryInstalledChaincodes":
+			result := &lifecycle.QueryInstalledChaincodesResult{}
+			for _, packageID := range installed {
+				result.InstalledChaincodes = append(result.InstalledChaincodes, &lifecycle.QueryInstalledChaincodesResult_InstalledChaincode{PackageId: packageID})
+			}
+			return lifecycleResponse(result)
+		case "InstallChaincode":
+			args := &lifecycle.InstallChaincodeArgs{}
+			if err := proto.Unmarshal(arg, args); err != nil {
+				return &peer.Response{Status: 500, Message: err.Error()}
+			}
+			pkg, err := ccpackager.ParsePackage(args.ChaincodeInstallPackage)
+			if err != nil {
+				return &peer.Response{Status: 500, Message: err.Error()}
+			}
+			installed = append(installed, pkg.PackageID)
+			return lifecycleResponse(&lifecycle.InstallChaincodeResult{PackageId: pkg.PackageID, Label: pkg.Metadata.Label})
+		case "QueryChaincodeDefinitions":
+			result := &lifecycle.QueryChaincodeDefinitionsResult{}
+			if l.committed != nil {
+				result.ChaincodeDefinitions = append(result.ChaincodeDefinitions, l.committed)
+			}
+			return lifecycleResponse(result)
+		case "CheckCommitReadiness":
+			l.readinessChecks++
+			result := &lifecycle.CheckCommitReadinessResult{Approvals: map[string]bool{}}
+			for approver, approval := range l.approvals {
+				result.Approvals[approver] = approval.checks >= l.delay
+				approval.checks++
+			}
+			return lifecycleResponse(result)
+		case "QueryApprovedChaincodeDefinition":
+			approval, ok := l.approvals[mspID]
+			if !ok {
+				return &peer.Response{Status: 500, Message: "could not fetch approved chaincode definition"}
+			}
+			return lifecycleResponse(&lifecycle.QueryApprovedChaincodeDefinitionResult{
+				Version: "1",
+				Source: &lifecycle.ChaincodeSource{Type: &lifecycle.ChaincodeSource_LocalPackage{
+					LocalPackage: &lifecycle.ChaincodeSource_Local{PackageId: approval.packageID},
+				}},
+			})
+		case "ApproveChaincodeDefinitionForMyOrg":
+			args := &lifecycle.ApproveChaincodeDefinitionForMyOrgArgs{}
+			if err := proto.Unmarshal(arg, args); err != nil {
+				return &peer.Response{Status: 500, Message: err.Error()}
+			}
+			l.approvals[mspID] = &testApproval{packageID: args.GetSource().GetLocalPackage().GetPackageId()}
+			return lifecycleResponse(&lifecycle.ApproveChaincodeDefinitionForMyOrgResult{})
+		case "CommitChaincodeDefinition":
+			args := &lifecycle.CommitChaincodeDefinitionArgs{}
+			if err := proto.Unmarshal(arg, args); err != nil {
+				return &peer.Response{Status: 500, Message: err.Error()}
+			}
+			l.committed = &lifecycle.QueryChaincodeDefinitionsResult_ChaincodeDefinition{
+				Name: args.Name, Sequence: args.Sequence, Version: args.Version, InitRequired: args.InitRequired,
+			}
+			return lifecycleResponse(&lifecycle.CommitChaincodeDefinitionResult{})
+		}
+		return &peer.Response{Status: 500, Message: "unexpected invocation"}
+	}
+}
+
+func TestAlreadyInitialized(t *testing.T) {
+	initialized := &peer.Response{Status: 500, Message: "error in simulation: chaincode 'cc' is already initialized but called as init"}
+	failed := &peer.Response{Status: 500, Message: "error in simulation: transaction returned with failure: bad args"}
+
+	tests := []struct {
+		name        string
+		responses   []*peer.Response
+		initialized bool
+	}{
+		{"one endorser", []*peer.Response{initialized}, true},
+		{"all endorsers", []*peer.Response{initialized, initialized}, true},
+		{"init failed", []*peer.Response{failed}, false},
+		{"one endorser failed", []*peer.Response{initialized, failed}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			client := &PeersClient{Signer: &testSigner{}}
+			for _, response := range test.responses {
+				client.Peers = append(client.Peers, startEndorserServer(t, response))
+			}
+
+			_, _, err := client.process(context.Background(), "mychannel", &endpoints.ChaincodeInvokeRequest{
+				ChaincodeID: "cc", IsInit: true, Args: [][]byte{[]byte("init")},
+			})
+			if err == nil {
+				t.Fatal("expected the proposal to fail")
+			}
+			if alreadyInitialized(err) != test.initialized {
+				t.Fatalf("expected alreadyInitialized to be %v for %s", test.initialized, err)
+			}
+		})
+	}
+}
+
+func TestDeployContext(t *testing.T) {
+	pkg, err := ccpackager.NewCCaaSPackage(&ccpackager.CCaaSDescriptor{Label: "cc_1", Address: "cc.example.com:9999"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := ccpackager.ParsePackage(pkg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	packageID := parsed.PackageID
+
+	tests := []struct {
+		name string
+		// installed tells whether the package is already on peer0 and peer1 of Org1MSP and on
+		// peer0 of Org2MSP
+		installed [3]bool
+		// approvals are the packages already approved by the organizations
+		approvals   map[string]string
+		committed   bool
+		initialized bool
+		// delay is the number of commit readiness checks an approval stays hidden
+		delay           int
+		readinessChecks int
+		progress        []string
+		commit, init    bool
+	}{
+		{
+			name:            "fresh",
+			delay:           2,
+			readinessChecks: 5,
+			progress: []string{
+				"Org1MSP install", "Org1MSP install", "Org2MSP install",
+				"Org1MSP approve", "Org2MSP approve", "Org1MSP commit", "Org1MSP init",
+			},
+			commit: true,
+			init:   true,
+		},
+		{
+			name:            "resumed",
+			installed:       [3]bool{true, false, true},
+			approvals:       map[string]string{"Org1MSP": packageID, "Org2MSP": "cc_0:other"},
+			readinessChecks: 3,
+			progress: []string{
+				"Org1MSP install skipped", "Org1MSP install", "Org2MSP install skipped",
+				"Org1MSP approve skipped", "Org2MSP approve", "Org1MSP commit", "Org1MSP init",
+			},
+			commit: true,
+			init:   true,
+		},
+		{
+			name:        "committed",
+			installed:   [3]bool{true, true, true},
+			committed:   true,
+			initialized: true,
+			progress: []string{
+				"Org1MSP install skipped", "Org1MSP install skipped", "Org2MSP install skipped",
+				"Org1MSP approve skipped", "Org2MSP approve skipped", "Org1MSP commit skipped", "Org1MSP init skipped",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			state := &testLifecycle{delay: test.delay, approvals: map[string]*testApproval{}}
+			for mspID, approved := range test.approvals {
+				state.approvals[mspID] = &testApproval{packageID: approved}
+			}
+			if test.committed {
+				state.committed = &lifecycle.QueryChaincodeDefinitionsResult_ChaincodeDefinition{Name: "cc", Sequence: 1, Version: "1", InitRequired: true}
+			}
+			if test.initialized {
+				state.initTxID = "earlier"
+			}
+
+			var clients []*PeersClient
+			for i, mspID := range []string{"Org1MSP", "Org1MSP", "Org2MSP"} {
+				var installed []string
+				if test.installed[i] {
+					installed = append(installed, packageID)
+				}
+				_, client := startTestNetwork(t, state.peer(mspID, installed...))
+				clients = append(clients, client)
+			}
+			organizations := []*DeploymentOrganization{
+				{MspID: "Org1MSP", Peers: []*endpoints.Peer{clients[0].Peers[0], clients[1].Peers[0]}, Signer: &testSigner{}},
+				{MspID: "Org2MSP", Peers: []*endpoints.Peer{clients[2].Peers[0]}, Signer: &testSigner{}},
+			}
+
+			var progress []string
+			deployment := &ChaincodeDeployment{
+				ChannelID:     "mychannel",
+				Package:       pkg,
+				Definition:    &CommitChaincodeRequest{Name: "cc", Version: "1", Sequence: 1, InitRequired: true},
+				Organizations: organizations,
+				// the approvals and the commit are ordered by the network of the committer
+				Orderer:      &clients[0].Orderer,
+				PollInterval: 10 * time.Millisecond,
+				Progress: func(p *DeploymentProgress) {
+					if p.Err != nil {
+						t.Errorf("step %s of %s failed: %s", p.Step, p.MspID, p.Err)
+					}
+					step := fmt.Sprintf("%s %s", p.MspID, p.Step)
+					if p.Skipped {
+						step += " skipped"
+					}
+					progress = append(progress, step)
+				},
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			result, err := deployment.DeployContext(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(progress, test.progress) {
+				t.Fatalf("expected the steps %v, got %v", test.progress, progress)
+			}
+			if result.PackageID != packageID || (result.CommitTxID != "") != test.commit || (result.InitTxID != "") != test.init {
+				t.Fatalf("unexpected result %+v", result)
+			}
+			if state.readinessChecks != test.readinessChecks {
+				t.Errorf("expected %d commit readiness checks, got %d", test.readinessChecks, state.readinessChecks)
+			}
+			if !test.committed {
+				for _, mspID := range []string{"Org1MSP", "Org2MSP"} {
+					if approval := state.approvals[mspID]; approval == nil || approval.packageID != packageID {
+						t.Errorf("expected %s to approve %s, got %+v", mspID, packageID, approval)
+					}
+				}
+			}
+			if state.committed == nil || state.committed.Sequence != 1 {
+				t.Errorf("expected sequence 1 to be committed, got %+v", state.committed)
+			}
+		})
+	}
+}
@@ -0,0 +1,343 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"github.com/feng081212/fabric-protos-go/discovery"
+	"github.com/feng081212/fabric-protos-go/gossip"
+	"github.com/feng081212/fabric-protos-go/msp"
+	"github.com/feng081212/fabric-protos-go/peer"
+	"github.com/feng081212/fabric-sdk-go/fabric/endpoints"
+	"github.com/feng081212/fabric-sdk-go/fabric/errors/status"
+	"github.com/golang/protobuf/proto"
+	"github.com/pkg/errors"
+	"sort"
+)
+
+// DiscoveryClient queries the discovery service of a peer
+type DiscoveryClient struct {
+	Peer   *endpoints.Peer
+	Signer Signer
+}
+
+// DiscoveredPeer is a peer returned by the discovery service
+type DiscoveredPeer struct {
+	MSPID    string
+	Endpoint string
+	// LedgerHeight and Chaincodes are only known for channel peers
+	LedgerHeight uint64
+	Chaincodes   []*gossip.Chaincode
+	// Identity is the serialized msp identity of the peer
+	Identity []byte
+}
+
+// EndorsementPlan describes which peers can endorse for a chaincode invocation. The endorsement
+// policy is satisfied by any of the layouts, a layout requires the given number of distinct
+// peers from each of its groups.
+type EndorsementPlan struct {
+	Chaincode string
+	Groups    map[string][]*DiscoveredPeer
+	Layouts   []map[string]uint32
+}
+
+// NewChaincodeCall describes the invocation of a chaincode, together with the private data
+// collections it reads from or writes to
+func NewChaincodeCall(chaincodeID string, collections ...string) *peer.ChaincodeCall {
+	return &peer.ChaincodeCall{Name: chaincodeID, CollectionNames: collections}
+}
+
+// DiscoverPeers returns the peers that joined the channel
+func (p *DiscoveryClient) DiscoverPeers(ctx context.Context, channelID string) ([]*DiscoveredPeer, error) {
+	result, err := p.query(ctx, &discovery.Query{
+		Channel: channelID,
+		Query:   &discovery.Query_PeerQuery{PeerQuery: &discovery.PeerMembershipQuery{}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if result.GetMembers() == nil {
+		return nil, errors.New("discovery response has no peer membership result")
+	}
+	return toDiscoveredPeers(result.GetMembers().PeersByOrg)
+}
+
+// DiscoverLocalPeers returns the peers known to the peer, regardless of the channels they joined
+func (p *DiscoveryClient) DiscoverLocalPeers(ctx context.Context) ([]*DiscoveredPeer, error) {
+	result, err := p.query(ctx, &discovery.Query{
+		Query: &discovery.Query_LocalPeers{LocalPeers: &discovery.LocalPeerQuery{}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if result.GetMembers() == nil {
+		return nil, errors.New("discovery response has no peer membership result")
+	}
+	return toDiscoveredPeers(result.GetMembers().PeersByOrg)
+}
+
+// DiscoverConfig returns the msp configs and orderer endpoints of the channel
+func (p *DiscoveryClient) DiscoverConfig(ctx context.Context, channelID string) (*discovery.ConfigResult, error) {
+	result, err := p.query(ctx, &discovery.Query{
+		Channel: channelID,
+		Query:   &discovery.Query_ConfigQuery{ConfigQuery: &discovery.ConfigQuery{}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if result.GetConfigResult() == nil {
+		return nil, errors.New("discovery response has no config result")
+	}
+	return result.GetConfigResult(), nil
+}
+
+// DiscoverEndorsers returns the endorsement plan for an invocation of the first chaincode. The
+// following calls are the chaincodes it invokes in turn, the plan satisfies the endorsement
+// policies of all chaincodes and collections.
+func (p *DiscoveryClient) DiscoverEndorsers(ctx context.Context, channelID string, calls ...*peer.ChaincodeCall) (*EndorsementPlan, error) {
+	if len(calls) == 0 {
+		return nil, errors.New("at least one chaincode call is required")
+	}
+
+	result, err := p.query(ctx, &discovery.Query{
+		Channel: channelID,
+		Query: &discovery.Query_CcQuery{CcQuery: &discovery.ChaincodeQuery{
+			Interests: []*peer.ChaincodeInterest{{Chaincodes: calls}},
+		}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if result.GetCcQueryRes() == nil || len(result.GetCcQueryRes().Content) == 0 {
+		return nil, errors.New("discovery response has no endorsement descriptor")
+	}
+
+	descriptor := result.GetCcQueryRes().Content[0]
+	plan := &EndorsementPlan{
+		Chaincode: descriptor.Chaincode,
+		Groups:    make(map[string][]*DiscoveredPeer),
+	}
+	for group, peers := range descriptor.EndorsersByGroups {
+		for _, dp := range peers.GetPeers() {
+			discovered, err := toDiscoveredPeer(dp)
+			if err != nil {
+				return nil, errors.WithMessagef(err, "invalid peer in group [%s]", group)
+			}
+			plan.Groups[group] = append(plan.Groups[group], discovered)
+		}
+	}
+	for _, layout := range descriptor.Layouts {
+		plan.Layouts = append(plan.Layouts, layout.QuantitiesByGroup)
+	}
+
+	return plan, nil
+}
+
+// DiscoverEndorsementPeers discovers the endorsement plan of the invocation and returns the
+// smallest set of peers satisfying it, ready to be used as PeersClient.Peers
+func (p *DiscoveryClient) DiscoverEndorsementPeers(ctx context.Context, channelID string, calls ...*peer.ChaincodeCall) ([]*endpoints.Peer, error) {
+	plan, err := p.DiscoverEndorsers(ctx, channelID, calls...)
+	if err != nil {
+		return nil, err
+	}
+
+	selected, err := plan.MinimalEndorsers()
+	if err != nil {
+		return nil, err
+	}
+
+	config, err := p.DiscoverConfig(ctx, channelID)
+	if err != nil {
+		return nil, err
+	}
+
+	return p.toEndpoints(selected, config), nil
+}
+
+// MinimalEndorsers returns the smallest set of peers that satisfies one of the layouts. Within
+// a group the peers with the highest ledger height are preferred.
+func (e *EndorsementPlan) MinimalEndorsers() ([]*DiscoveredPeer, error) {
+	var best []*DiscoveredPeer
+
+	for _, layout := range e.Layouts {
+		selected, ok := e.selectLayout(layout)
+		if !ok {
+			continue
+		}
+		if best == nil || len(selected) < len(best) {
+			best = selected
+		}
+	}
+
+	if best == nil {
+		return nil, status.New(status.DiscoveryServerStatus, status.NoPeersFound.ToInt32(),
+			fmt.Sprintf("no layout of the endorsement plan for chaincode [%s] can be satisfied", e.Chaincode))
+	}
+	return best, nil
+}
+
+// selectLayout picks distinct peers for the layout. A peer can be a member of several groups, so
+// the peers are assigned to the required places of the groups as a bipartite matching: a place
+// that cannot get a free peer takes one from another place that can be served by someone else.
+func (e *EndorsementPlan) selectLayout(layout map[string]uint32) ([]*DiscoveredPeer, bool) {
+	groups := make([]string, 0, len(layout))
+	for group := range layout {
+		groups = append(groups, group)
+	}
+	sort.Strings(groups)
+
+	// one place for every required peer, each with the candidates of its group
+	var places [][]*DiscoveredPeer
+	for _, group := range groups {
+		candidates := append([]*DiscoveredPeer(nil), e.Groups[group]...)
+		sort.SliceStable(candidates, func(i, j int) bool {
+			if candidates[i].LedgerHeight != candidates[j].LedgerHeight {
+				return candidates[i].LedgerHeight > candidates[j].LedgerHeight
+			}
+			return candidates[i].Endpoint < candidates[j].Endpoint
+		})
+		for i := uint32(0); i < layout[group]; i++ {
+			places = append(places, candidates)
+		}
+	}
+
+	selected := make([]*DiscoveredPeer, len(places))
+	placeOf := make(map[string]int)
+
+	var assign func(place int, visited map[string]bool) bool
+	assign = func(place int, visited map[string]bool) bool {
+		for _, candidate := range places[place] {
+			if visited[candidate.Endpoint] {
+				continue
+			}
+			visited[candidate.Endpoint] = true
+			other, used := placeOf[candidate.Endpoint]
+			if !used || assign(other, visited) {
+				placeOf[candidate.Endpoint] = place
+				selected[place] = candidate
+				return true
+			}
+		}
+		return false
+	}
+
+	for place := range places {
+		if !assign(place, make(map[string]bool)) {
+			return nil, false
+		}
+	}
+
+	return selected, true
+}
+
+func (p *DiscoveryClient) toEndpoints(peers []*DiscoveredPeer, config *discovery.ConfigResult) []*endpoints.Peer {
+	targets := make([]*endpoints.Peer, 0, len(peers))
+	for _, dp := range peers {
+		var tlsRootCerts [][]byte
+		if mspConfig, ok := config.GetMsps()[dp.MSPID]; ok {
+			tlsRootCerts = append(append(tlsRootCerts, mspConfig.TlsRootCerts...), mspConfig.TlsIntermediateCerts...)
+		}
+		targets = append(targets, p.Peer.DiscoveredPeer(dp.Endpoint, dp.MSPID, tlsRootCerts))
+	}
+	return targets
+}
+
+func (p *DiscoveryClient) query(ctx context.Context, query *discovery.Query) (*discovery.QueryResult, error) {
+	if p.Peer == nil {
+		return nil, errors.New("targets is required")
+	}
+
+	creator, err := p.Signer.Serialize()
+	if err != nil {
+		return nil, errors.WithMessage(err, "identity from context failed")
+	}
+
+	var tlsClientCertsHash []byte
+	if len(p.Peer.GetTlsClientCerts()) > 0 {
+		tlsClientCertsHash, err = tlsCertHash(p.Peer.GetTlsClientCerts())
+		if err != nil {
+			return nil, errors.WithMessage(err, "failed to get tls cert hash")
+		}
+	}
+
+	payload, err := proto.Marshal(&discovery.Request{
+		Authentication: &discovery.AuthInfo{
+			ClientIdentity:    creator,
+			ClientTlsCertHash: tlsClientCertsHash,
+		},
+		Queries: []*discovery.Query{query},
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "marshal discovery request failed")
+	}
+
+	signature, err := p.Signer.Sign(payload)
+	if err != nil {
+		return nil, errors.WithMessage(err, "signing of discovery request failed")
+	}
+
+	response, err := p.Peer.Discover(ctx, &discovery.SignedRequest{Payload: payload, Signature: signature})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(response.Results) == 0 {
+		return nil, status.New(status.DiscoveryServerStatus, status.Unknown.ToInt32(), "discovery response has no results")
+	}
+	result := response.Results[0]
+	if result.GetError() != nil {
+		return nil, status.New(status.DiscoveryServerStatus, status.Unknown.ToInt32(), result.GetError().Content)
+	}
+	return result, nil
+}
+
+func toDiscoveredPeers(peersByOrg map[string]*discovery.Peers) ([]*DiscoveredPeer, error) {
+	orgs := make([]string, 0, len(peersByOrg))
+	for org := range peersByOrg {
+		orgs = append(orgs, org)
+	}
+	sort.Strings(orgs)
+
+	var result []*DiscoveredPeer
+	for _, org := range orgs {
+		for _, dp := range peersByOrg[org].GetPeers() {
+			discovered, err := toDiscoveredPeer(dp)
+			if err != nil {
+				return nil, errors.WithMessagef(err, "invalid peer of [%s]", org)
+			}
+			result = append(result, discovered)
+		}
+	}
+	return result, nil
+}
+
+func toDiscoveredPeer(dp *discovery.Peer) (*DiscoveredPeer, error) {
+	identity := &msp.SerializedIdentity{}
+	if err := proto.Unmarshal(dp.Identity, identity); err != nil {
+		return nil, errors.Wrap(err, "unmarshal peer identity failed")
+	}
+
+	result := &DiscoveredPeer{MSPID: identity.Mspid, Identity: dp.Identity}
+
+	if dp.MembershipInfo != nil {
+		msg := &gossip.GossipMessage{}
+		if err := proto.Unmarshal(dp.MembershipInfo.Payload, msg); err != nil {
+			return nil, errors.Wrap(err, "unmarshal membership info failed")
+		}
+		result.Endpoint = msg.GetAliveMsg().GetMembership().GetEndpoint()
+	}
+	if result.Endpoint == "" {
+		return nil, errors.Errorf("peer of [%s] has no endpoint", identity.Mspid)
+	}
+
+	if dp.StateInfo != nil {
+		msg := &gossip.GossipMessage{}
+		if err := proto.Unmarshal(dp.StateInfo.Payload, msg); err != nil {
+			return nil, errors.Wrap(err, "unmarshal state info failed")
+		}
+		properties := msg.GetStateInfo().GetProperties()
+		result.LedgerHeight = properties.GetLedgerHeight()
+		result.Chaincodes = properties.GetChaincodes()
+	}
+
+	return result, nil
+}
@@ -0,0 +1,183 @@
+package client
+
+import (
+	"context"
+	"crypto/sha256"
+	"hash"
+	"net"
+	"testing"
+
+	"github.com/feng081212/fabric-protos-go/discovery"
+	"github.com/feng081212/fabric-protos-go/gossip"
+	"github.com/feng081212/fabric-protos-go/msp"
+	"github.com/feng081212/fabric-protos-go/peer"
+	"github.com/feng081212/fabric-sdk-go/fabric/endpoints"
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/grpc"
+)
+
+type testSigner struct{}
+
+func (s *testSigner) Sign(msg []byte) ([]byte, error) { return []byte("signature"), nil }
+func (s *testSigner) Serialize() ([]byte, error) {
+	return proto.Marshal(&msp.SerializedIdentity{Mspid: "ClientMSP", IdBytes: []byte("client")})
+}
+func (s *testSigner) Hash(msg []byte) ([]byte, error) { h := sha256.Sum256(msg); return h[:], nil }
+func (s *testSigner) GetHash() (hash.Hash, error)     { return sha256.New(), nil }
+
+// discoveryServer answers every query with the results of the handler
+type discoveryServer struct {
+	handler func(query *discovery.Query) *discovery.QueryResult
+}
+
+func (s *discoveryServer) Discover(ctx context.Context, request *discovery.SignedRequest) (*discovery.Response, error) {
+	req := &discovery.Request{}
+	if err := proto.Unmarshal(request.Payload, req); err != nil {
+		return nil, err
+	}
+	response := &discovery.Response{}
+	for _, query := range req.Queries {
+		response.Results = append(response.Results, s.handler(query))
+	}
+	return response, nil
+}
+
+func startDiscoveryServer(t *testing.T, handler func(query *discovery.Query) *discovery.QueryResult) *DiscoveryClient {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := grpc.NewServer()
+	discovery.RegisterDiscoveryServer(server, &discoveryServer{handler: handler})
+	go func() { _ = server.Serve(listener) }()
+	t.Cleanup(server.Stop)
+
+	return &DiscoveryClient{
+		Peer:   endpoints.EmptyPeer().SetUrl("grpc://" + listener.Addr().String()),
+		Signer: &testSigner{},
+	}
+}
+
+func testDiscoveryPeer(mspID, endpoint string, ledgerHeight uint64) *discovery.Peer {
+	identity, _ := proto.Marshal(&msp.SerializedIdentity{Mspid: mspID, IdBytes: []byte(endpoint)})
+	alive, _ := proto.Marshal(&gossip.GossipMessage{Content: &gossip.GossipMessage_AliveMsg{AliveMsg: &gossip.AliveMessage{
+		Membership: &gossip.Member{Endpoint: endpoint},
+	}}})
+	state, _ := proto.Marshal(&gossip.GossipMessage{Content: &gossip.GossipMessage_StateInfo{StateInfo: &gossip.StateInfo{
+		Properties: &gossip.Properties{LedgerHeight: ledgerHeight},
+	}}})
+	return &discovery.Peer{
+		Identity:       identity,
+		MembershipInfo: &gossip.Envelope{Payload: alive},
+		StateInfo:      &gossip.Envelope{Payload: state},
+	}
+}
+
+func TestDiscoverEndorsementPeers(t *testing.T) {
+	var interests []*peer.ChaincodeInterest
+
+	client := startDiscoveryServer(t, func(query *discovery.Query) *discovery.QueryResult {
+		switch q := query.Query.(type) {
+		case *discovery.Query_CcQuery:
+			interests = q.CcQuery.Interests
+			return &discovery.QueryResult{Result: &discovery.QueryResult_CcQueryRes{CcQueryRes: &discovery.ChaincodeQueryResult{
+				Content: []*discovery.EndorsementDescriptor{{
+					Chaincode: "basic",
+					EndorsersByGroups: map[string]*discovery.Peers{
+						"G0": {Peers: []*discovery.Peer{
+							testDiscoveryPeer("Org1MSP", "peer0.org1:7051", 10),
+							testDiscoveryPeer("Org1MSP", "peer1.org1:7051", 12),
+						}},
+						"G1": {Peers: []*discovery.Peer{
+							testDiscoveryPeer("Org2MSP", "peer0.org2:9051", 12),
+						}},
+						"G2": {Peers: []*discovery.Peer{
+							testDiscoveryPeer("Org3MSP", "peer0.org3:11051", 12),
+						}},
+					},
+					Layouts: []*discovery.Layout{
+						{QuantitiesByGroup: map[string]uint32{"G0": 1, "G1": 1, "G2": 1}},
+						{QuantitiesByGroup: map[string]uint32{"G0": 1, "G1": 1}},
+						// cannot be satisfied, G1 has a single peer
+						{QuantitiesByGroup: map[string]uint32{"G1": 2}},
+					},
+				}},
+			}}}
+		case *discovery.Query_ConfigQuery:
+			return &discovery.QueryResult{Result: &discovery.QueryResult_ConfigResult{ConfigResult: &discovery.ConfigResult{
+				Msps: map[string]*msp.FabricMSPConfig{"Org1MSP": {Name: "Org1MSP"}},
+			}}}
+		default:
+			return &discovery.QueryResult{Result: &discovery.QueryResult_Error{Error: &discovery.Error{Content: "unexpected query"}}}
+		}
+	})
+
+	peers, err := client.DiscoverEndorsementPeers(context.Background(), "mychannel",
+		NewChaincodeCall("basic", "collectionA"), NewChaincodeCall("token"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(interests) != 1 || len(interests[0].Chaincodes) != 2 || interests[0].Chaincodes[0].CollectionNames[0] != "collectionA" {
+		t.Fatalf("unexpected chaincode interest: %v", interests)
+	}
+
+	if len(peers) != 2 {
+		t.Fatalf("expected 2 endorsers, got %d", len(peers))
+	}
+	if peers[0].URL() != "grpc://peer1.org1:7051" || peers[0].MSPID() != "Org1MSP" {
+		t.Fatalf("expected the Org1 peer with the highest ledger height, got %s of %s", peers[0].URL(), peers[0].MSPID())
+	}
+	if peers[1].URL() != "grpc://peer0.org2:9051" || peers[1].MSPID() != "Org2MSP" {
+		t.Fatalf("expected the Org2 peer, got %s of %s", peers[1].URL(), peers[1].MSPID())
+	}
+}
+
+func TestDiscoverPeersError(t *testing.T) {
+	client := startDiscoveryServer(t, func(query *discovery.Query) *discovery.QueryResult {
+		return &discovery.QueryResult{Result: &discovery.QueryResult_Error{Error: &discovery.Error{Content: "access denied"}}}
+	})
+
+	if _, err := client.DiscoverPeers(context.Background(), "mychannel"); err == nil {
+		t.Fatal("expected the error of the discovery service")
+	}
+}
+
+func TestMinimalEndorsersUnsatisfiable(t *testing.T) {
+	plan := &EndorsementPlan{
+		Chaincode: "basic",
+		Groups:    map[string][]*DiscoveredPeer{"G0": {{MSPID: "Org1MSP", Endpoint: "peer0.org1:7051"}}},
+		Layouts:   []map[string]uint32{{"G0": 2}},
+	}
+	if _, err := plan.MinimalEndorsers(); err == nil {
+		t.Fatal("expected an error for a plan without a satisfiable layout")
+	}
+}
+
+func TestMinimalEndorsersOverlappingGroups(t *testing.T) {
+	// A is a member of both groups, it has to endorse for G1 so that B can endorse for G0
+	plan := &EndorsementPlan{
+		Chaincode: "basic",
+		Groups: map[string][]*DiscoveredPeer{
+			"G0": {{MSPID: "Org1MSP", Endpoint: "A", LedgerHeight: 12}, {MSPID: "Org1MSP", Endpoint: "B", LedgerHeight: 10}},
+			"G1": {{MSPID: "Org1MSP", Endpoint: "A", LedgerHeight: 12}},
+		},
+		Layouts: []map[string]uint32{{"G0": 1, "G1": 1}},
+	}
+	peers, err := plan.MinimalEndorsers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(peers) != 2 || peers[0].Endpoint != "B" || peers[1].Endpoint != "A" {
+		t.Fatalf("expected B for G0 and A for G1, got %d peers", len(peers))
+	}
+
+	// two places of G0 and one of G1 cannot be served by two peers
+	plan.Layouts = []map[string]uint32{{"G0": 2, "G1": 1}, {"G0": 2}}
+	if peers, err = plan.MinimalEndorsers(); err != nil {
+		t.Fatal(err)
+	}
+	if len(peers) != 2 || peers[0].Endpoint == peers[1].Endpoint {
+		t.Fatalf("expected A and B for the layout of G0 alone, got %d peers", len(peers))
+	}
+}
@@ -0,0 +1,72 @@
+package client
+
+import (
+	"fmt"
+	"github.com/feng081212/fabric-protos-go/common"
+	"github.com/feng081212/fabric-protos-go/peer"
+	"github.com/feng081212/fabric-sdk-go/fabric/errors/status"
+	"github.com/feng081212/fabric-sdk-go/fabric/policies"
+	"github.com/golang/protobuf/proto"
+	"github.com/pkg/errors"
+)
+
+// VerifyEndorsements checks the signature of every endorsement over the proposal response payload,
+// that every endorser is a valid identity of its MSP in msps and, if policy is not nil, that the
+// endorsers satisfy the policy. See GetMSPsFromConfig for the MSPs of a channel.
+func VerifyEndorsements(payload []byte, endorsements []*peer.Endorsement, policy *common.SignaturePolicyEnvelope, msps policies.MSPs) error {
+	if msps == nil {
+		return errors.New("the msps of the channel are required to verify endorsements")
+	}
+
+	identities := make([]*policies.Identity, 0, len(endorsements))
+
+	for _, endorsement := range endorsements {
+		identity, err := policies.DeserializeIdentity(endorsement.Endorser)
+		if err != nil {
+			return status.New(status.EndorserClientStatus, status.SignatureVerificationFailed.ToInt32(),
+				fmt.Sprintf("invalid endorser identity: %s", err))
+		}
+
+		if err = msps.Validate(identity); err != nil {
+			return status.New(status.EndorserClientStatus, status.SignatureVerificationFailed.ToInt32(),
+				fmt.Sprintf("invalid endorser identity: %s", err))
+		}
+
+		msg := append(append([]byte(nil), payload...), endorsement.Endorser...)
+		if err = identity.Verify(msg, endorsement.Signature); err != nil {
+			return status.New(status.EndorserClientStatus, status.SignatureVerificationFailed.ToInt32(),
+				fmt.Sprintf("invalid endorsement of [%s] %s: %s", identity.MSPID, identity.Certificate.Subject.CommonName, err))
+		}
+
+		identities = append(identities, identity)
+	}
+
+	if policy == nil {
+		return nil
+	}
+
+	if err := policies.EvaluateSignaturePolicy(policy, identities, msps); err != nil {
+		return status.New(status.EndorserClientStatus, status.MissingEndorsement.ToInt32(),
+			fmt.Sprintf("endorsements do not satisfy the endorsement policy: %s", err))
+	}
+	return nil
+}
+
+// GetSignaturePolicyFromValidationParameter returns the signature policy of the validation
+// parameter of a chaincode definition. Channel config policy references cannot be evaluated by
+// the client, for these an error is returned.
+func GetSignaturePolicyFromValidationParameter(validationParameter []byte) (*common.SignaturePolicyEnvelope, error) {
+	applicationPolicy := &peer.ApplicationPolicy{}
+	if err := proto.Unmarshal(validationParameter, applicationPolicy); err != nil {
+		return nil, errors.Wrap(err, "unmarshal application policy failed")
+	}
+
+	switch policy := applicationPolicy.Type.(type) {
+	case *peer.ApplicationPolicy_SignaturePolicy:
+		return policy.SignaturePolicy, nil
+	case *peer.ApplicationPolicy_ChannelConfigPolicyReference:
+		return nil, errors.Errorf("channel config policy reference [%s] cannot be evaluated by the client", policy.ChannelConfigPolicyReference)
+	default:
+		return nil, errors.New("validation parameter has no policy")
+	}
+}
@@ -0,0 +1,123 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"github.com/feng081212/fabric-protos-go/common"
+	"github.com/feng081212/fabric-protos-go/orderer"
+	"github.com/feng081212/fabric-protos-go/peer"
+	"github.com/feng081212/fabric-sdk-go/fabric/endpoints"
+	"github.com/feng081212/fabric-sdk-go/fabric/errors/status"
+	"github.com/golang/protobuf/proto"
+	"github.com/pkg/errors"
+)
+
+// TransactionResult is the outcome of a transaction as seen by a committing peer
+type TransactionResult struct {
+	TxID           string
+	BlockNumber    uint64
+	ValidationCode peer.TxValidationCode
+}
+
+// DeliverBlocks streams the full blocks of the channel from the peer, starting at start and
+// ending at stop. A nil start means the newest block, a nil stop means the stream stays open
+// until ctx is done. See endpoints.Peer.DeliverBlocks for how the channels are closed.
+func (p *PeerClient) DeliverBlocks(ctx context.Context, channelID string, start, stop *orderer.SeekPosition) (<-chan *endpoints.BlockEvent, <-chan error) {
+	return p.deliver(ctx, endpoints.DeliverBlock, channelID, start, stop)
+}
+
+// DeliverFilteredBlocks streams the filtered blocks of the channel from the peer
+func (p *PeerClient) DeliverFilteredBlocks(ctx context.Context, channelID string, start, stop *orderer.SeekPosition) (<-chan *endpoints.BlockEvent, <-chan error) {
+	return p.deliver(ctx, endpoints.DeliverFilteredBlock, channelID, start, stop)
+}
+
+// DeliverBlocksWithPrivateData streams the full blocks of the channel from the peer together
+// with the private data the signer is entitled to
+func (p *PeerClient) DeliverBlocksWithPrivateData(ctx context.Context, channelID string, start, stop *orderer.SeekPosition) (<-chan *endpoints.BlockEvent, <-chan error) {
+	return p.deliver(ctx, endpoints.DeliverBlockAndPrivateData, channelID, start, stop)
+}
+
+func (p *PeerClient) deliver(ctx context.Context, deliverType endpoints.DeliverType, channelID string, start, stop *orderer.SeekPosition) (<-chan *endpoints.BlockEvent, <-chan error) {
+	if p.Peer == nil {
+		events := make(chan *endpoints.BlockEvent)
+		errs := make(chan error, 1)
+		errs <- errors.New("targets is required")
+		close(events)
+		close(errs)
+		return events, errs
+	}
+
+	return p.Peer.DeliverBlocks(ctx, &endpoints.DeliverRequest{
+		Type:     deliverType,
+		Start:    start,
+		Stop:     stop,
+		Envelope: p.seekEnvelope(channelID),
+	})
+}
+
+// seekEnvelope creates signed DELIVER_SEEK_INFO envelopes for the channel
+func (p *PeerClient) seekEnvelope(channelID string) endpoints.SeekEnvelopeFunc {
+	return func(seekInfo *orderer.SeekInfo) (*endpoints.SignedEnvelope, error) {
+		creator, err := p.Signer.Serialize()
+		if err != nil {
+			return nil, errors.WithMessage(err, "identity from context failed")
+		}
+
+		h, err := p.Signer.GetHash()
+		if err != nil {
+			return nil, errors.WithMessage(err, "hash function creation failed")
+		}
+
+		tlsClientCertsHash, err := tlsCertHash(p.Peer.GetTlsClientCerts())
+		if err != nil {
+			return nil, errors.WithMessage(err, "failed to get tls cert hash")
+		}
+
+		seekInfoBytes, err := proto.Marshal(seekInfo)
+		if err != nil {
+			return nil, errors.Wrap(err, "marshal seek info failed")
+		}
+
+		payload := CreatePayload(common.HeaderType_DELIVER_SEEK_INFO, channelID, h, creator, seekInfoBytes, func(header *common.ChannelHeader) {
+			header.TlsCertHash = tlsClientCertsHash
+		})
+
+		return signPayload(p.Signer, payload)
+	}
+}
+
+// WaitForTransaction reads filtered block events until the transaction with the given ID shows
+// up. A transaction that the peer marked invalid is returned together with an EventServerStatus
+// error carrying the validation code.
+func WaitForTransaction(ctx context.Context, txID string, events <-chan *endpoints.BlockEvent, errs <-chan error) (*TransactionResult, error) {
+	result := &TransactionResult{TxID: txID}
+
+	for {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				err := <-errs
+				if err == nil {
+					err = errors.New("block event stream closed")
+				}
+				return result, errors.WithMessagef(err, "waiting for transaction [%s] failed", txID)
+			}
+			for _, tx := range event.FilteredBlock.GetFilteredTransactions() {
+				if tx.Txid != txID {
+					continue
+				}
+				result.BlockNumber = event.BlockNumber
+				result.ValidationCode = tx.TxValidationCode
+				if tx.TxValidationCode != peer.TxValidationCode_VALID {
+					return result, status.New(status.EventServerStatus, int32(tx.TxValidationCode), fmt.Sprintf("transaction [%s] was invalidated in block [%d]", txID, event.BlockNumber))
+				}
+				return result, nil
+			}
+		case <-ctx.Done():
+			if ctx.Err() == context.DeadlineExceeded {
+				return result, status.New(status.ClientStatus, status.Timeout.ToInt32(), fmt.Sprintf("timed out waiting for transaction [%s]", txID))
+			}
+			return result, ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,242 @@
+package client
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/feng081212/fabric-protos-go/common"
+	ab "github.com/feng081212/fabric-protos-go/orderer"
+	"github.com/feng081212/fabric-protos-go/peer"
+	"github.com/feng081212/fabric-sdk-go/fabric/endpoints"
+	"github.com/feng081212/fabric-sdk-go/fabric/errors/status"
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	grpcstatus "google.golang.org/grpc/status"
+)
+
+// testInvocation is a proposal as seen by an endorser
+type testInvocation struct {
+	ChannelID string
+	TxID      string
+	Chaincode string
+	// Args are the arguments of the invocation, the function name first
+	Args [][]byte
+	// Transient is the transient map of the proposal
+	Transient map[string][]byte
+}
+
+func decodeInvocation(signed *peer.SignedProposal) (*testInvocation, error) {
+	proposal := &peer.Proposal{}
+	if err := proto.Unmarshal(signed.ProposalBytes, proposal); err != nil {
+		return nil, err
+	}
+	header := &common.Header{}
+	if err := proto.Unmarshal(proposal.Header, header); err != nil {
+		return nil, err
+	}
+	channelHeader := &common.ChannelHeader{}
+	if err := proto.Unmarshal(header.ChannelHeader, channelHeader); err != nil {
+		return nil, err
+	}
+	payload := &peer.ChaincodeProposalPayload{}
+	if err := proto.Unmarshal(proposal.Payload, payload); err != nil {
+		return nil, err
+	}
+	spec := &peer.ChaincodeInvocationSpec{}
+	if err := proto.Unmarshal(payload.Input, spec); err != nil {
+		return nil, err
+	}
+	return &testInvocation{
+		ChannelID: channelHeader.ChannelId,
+		TxID:      channelHeader.TxId,
+		Chaincode: spec.GetChaincodeSpec().GetChaincodeId().GetName(),
+		Args:      spec.GetChaincodeSpec().GetInput().GetArgs(),
+		Transient: payload.TransientMap,
+	}, nil
+}
+
+// testNetwork is a peer and an orderer in one. The peer endorses proposals with the handler and
+// delivers filtered blocks, the orderer cuts a block for every broadcast transaction and commits
+// it with the validation code.
+type testNetwork struct {
+	handler func(invocation *testInvocation) *peer.Response
+
+	mu         sync.Mutex
+	validation peer.TxValidationCode
+	// order is false to drop the broadcast transactions
+	order       bool
+	height      uint64
+	invocations []*testInvocation
+	broadcasts  int
+	subscribers []chan *peer.FilteredBlock
+}
+
+func (n *testNetwork) ProcessProposal(ctx context.Context, signed *peer.SignedProposal) (*peer.ProposalResponse, error) {
+	invocation, err := decodeInvocation(signed)
+	if err != nil {
+		return nil, err
+	}
+	n.mu.Lock()
+	n.invocations = append(n.invocations, invocation)
+	n.mu.Unlock()
+
+	response := n.handler(invocation)
+	proposalResponse := &peer.ProposalResponse{Response: response}
+	if response.Status < 400 {
+		proposalResponse.Payload = ProtoMarshalIgnoreError(&peer.ProposalResponsePayload{
+			ProposalHash: []byte(invocation.TxID),
+			Extension:    ProtoMarshalIgnoreError(&peer.ChaincodeAction{Response: response}),
+		})
+		proposalResponse.Endorsement = &peer.Endorsement{Endorser: []byte("peer0"), Signature: []byte("signature")}
+	}
+	return proposalResponse, nil
+}
+
+func (n *testNetwork) Broadcast(stream ab.AtomicBroadcast_BroadcastServer) error {
+	envelope, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+	payload := &common.Payload{}
+	if err = proto.Unmarshal(envelope.Payload, payload); err != nil {
+		return err
+	}
+	channelHeader := &common.ChannelHeader{}
+	if err = proto.Unmarshal(payload.Header.ChannelHeader, channelHeader); err != nil {
+		return err
+	}
+
+	n.mu.Lock()
+	n.broadcasts++
+	if n.order {
+		n.height++
+		block := &peer.FilteredBlock{ChannelId: channelHeader.ChannelId, Number: n.height, FilteredTransactions: []*peer.FilteredTransaction{
+			{Txid: "other", TxValidationCode: peer.TxValidationCode_VALID},
+			{Txid: channelHeader.TxId, TxValidationCode: n.validation},
+		}}
+		for _, subscriber := range n.subscribers {
+			subscriber <- block
+		}
+	}
+	n.mu.Unlock()
+
+	return stream.Send(&ab.BroadcastResponse{Status: common.Status_SUCCESS})
+}
+
+func (n *testNetwork) Deliver(ab.AtomicBroadcast_DeliverServer) error {
+	return grpcstatus.Error(codes.Unimplemented, "not an orderer deliver service")
+}
+
+func (n *testNetwork) DeliverFiltered(stream peer.Deliver_DeliverFilteredServer) error {
+	if _, err := stream.Recv(); err != nil {
+		return err
+	}
+
+	blocks := make(chan *peer.FilteredBlock, 16)
+	n.mu.Lock()
+	// the stream starts at the newest block
+	blocks <- &peer.FilteredBlock{ChannelId: "mychannel", Number: n.height}
+	n.subscribers = append(n.subscribers, blocks)
+	n.mu.Unlock()
+
+	for {
+		select {
+		case block := <-blocks:
+			if err := stream.Send(&peer.DeliverResponse{Type: &peer.DeliverResponse_FilteredBlock{FilteredBlock: block}}); err != nil {
+				return err
+			}
+		case <-stream.Context().Done():
+			return nil
+		}
+	}
+}
+
+type testPeerDeliverServer struct {
+	*testNetwork
+}
+
+func (s testPeerDeliverServer) Deliver(peer.Deliver_DeliverServer) error {
+	return grpcstatus.Error(codes.Unimplemented, "use DeliverFiltered")
+}
+
+func (s testPeerDeliverServer) DeliverWithPrivateData(peer.Deliver_DeliverWithPrivateDataServer) error {
+	return grpcstatus.Error(codes.Unimplemented, "use DeliverFiltered")
+}
+
+// startTestNetwork serves the network on a local port and returns a client of it
+func startTestNetwork(t *testing.T, handler func(invocation *testInvocation) *peer.Response) (*testNetwork, *PeersClient) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	network := &testNetwork{handler: handler, order: true}
+	server := grpc.NewServer()
+	peer.RegisterEndorserServer(server, network)
+	peer.RegisterDeliverServer(server, testPeerDeliverServer{network})
+	ab.RegisterAtomicBroadcastServer(server, network)
+	go func() { _ = server.Serve(listener) }()
+	t.Cleanup(server.Stop)
+
+	url := "grpc://" + listener.Addr().String()
+	return network, &PeersClient{
+		Peers:   []*endpoints.Peer{endpoints.EmptyPeer().SetUrl(url).SetMspID("Org1MSP")},
+		Orderer: OrdererClient{Orderer: endpoints.EmptyOrderer().SetUrl(url), Signer: &testSigner{}},
+		Signer:  &testSigner{},
+	}
+}
+
+func okResponse(*testInvocation) *peer.Response {
+	return &peer.Response{Status: 200, Payload: []byte("ok")}
+}
+
+func TestInvokeChainCodeAndWait(t *testing.T) {
+	network, client := startTestNetwork(t, okResponse)
+	committer := client.Peers[0]
+
+	result, err := client.InvokeChainCodeAndWait(context.Background(), "mychannel", "basic", false, [][]byte{[]byte("CreateAsset"), []byte("asset1")}, committer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.TxID == "" || result.BlockNumber != 1 || result.ValidationCode != peer.TxValidationCode_VALID {
+		t.Fatalf("expected the transaction to be committed valid in block 1, got %+v", result)
+	}
+	if invocation := network.invocations[0]; invocation.TxID != result.TxID || invocation.Chaincode != "basic" || string(invocation.Args[0]) != "CreateAsset" {
+		t.Fatalf("expected the invocation of basic, got %+v", invocation)
+	}
+
+	network.mu.Lock()
+	network.validation = peer.TxValidationCode_MVCC_READ_CONFLICT
+	network.mu.Unlock()
+	result, err = client.InvokeChainCodeAndWait(context.Background(), "mychannel", "basic", false, [][]byte{[]byte("CreateAsset"), []byte("asset1")}, committer)
+	s, ok := status.FromError(err)
+	if !ok || s.Group != status.EventServerStatus || s.Code != int32(peer.TxValidationCode_MVCC_READ_CONFLICT) {
+		t.Fatalf("expected the validation code in an EventServerStatus error, got %v", err)
+	}
+	if result == nil || result.BlockNumber != 2 || result.ValidationCode != peer.TxValidationCode_MVCC_READ_CONFLICT {
+		t.Fatalf("expected the result of the invalid transaction, got %+v", result)
+	}
+}
+
+func TestInvokeChainCodeAndWaitTimeout(t *testing.T) {
+	network, client := startTestNetwork(t, okResponse)
+	network.order = false
+
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	result, err := client.InvokeChainCodeAndWait(ctx, "mychannel", "basic", false, [][]byte{[]byte("CreateAsset")}, client.Peers[0])
+	s, ok := status.FromError(err)
+	if !ok || s.Group != status.ClientStatus || s.Code != status.Timeout.ToInt32() {
+		t.Fatalf("expected a client timeout, got %v", err)
+	}
+	if result == nil || result.TxID == "" || network.broadcasts != 1 {
+		t.Fatalf("expected the ID of the broadcast transaction, got %+v", result)
+	}
+
+	if _, err = client.InvokeChainCodeAndWait(context.Background(), "mychannel", "basic", false, nil, nil); err == nil {
+		t.Fatal("expected a committer to be required")
+	}
+}
@@ -0,0 +1,135 @@
+package client
+
+import (
+	"context"
+	"github.com/feng081212/fabric-sdk-go/fabric/endpoints"
+	retry2 "github.com/feng081212/fabric-sdk-go/fabric/errors/retry"
+	"time"
+)
+
+// RequestOption changes how a single request is made
+type RequestOption func(opts *requestOptions)
+
+type requestOptions struct {
+	timeout  time.Duration
+	retry    *retry2.Opts
+	peers    []*endpoints.Peer
+	orderers []*endpoints.Orderer
+	// transientMap is only used by chaincode invocations and queries
+	transientMap map[string][]byte
+	// skipSignatureCheck is only used by SubmitConfigUpdateEnvelope
+	skipSignatureCheck bool
+	// consenterAdmins is only used by RemoveConsenter
+	consenterAdmins map[string]*OrdererAdminClient
+}
+
+// WithTimeout limits the duration of the whole request, including retries and failover
+func WithTimeout(timeout time.Duration) RequestOption {
+	return func(opts *requestOptions) {
+		opts.timeout = timeout
+	}
+}
+
+// WithRetry overrides the retry options of the peers and orderers for the request
+func WithRetry(retryOpts retry2.Opts) RequestOption {
+	return func(opts *requestOptions) {
+		opts.retry = &retryOpts
+	}
+}
+
+// WithTargets sends the request to the given peers instead of the ones of the client.
+// PeerClient only uses the first peer.
+func WithTargets(peers ...*endpoints.Peer) RequestOption {
+	return func(opts *requestOptions) {
+		opts.peers = peers
+	}
+}
+
+// WithOrderers sends the request to the given orderers instead of the ones of the client
+func WithOrderers(orderers ...*endpoints.Orderer) RequestOption {
+	return func(opts *requestOptions) {
+		opts.orderers = orderers
+	}
+}
+
+// WithTransientMap passes private data to the chaincode. The transient map is sent to the
+// endorsers only, it is not part of the transaction sent to the orderer.
+func WithTransientMap(transientMap map[string][]byte) RequestOption {
+	return func(opts *requestOptions) {
+		opts.transientMap = transientMap
+	}
+}
+
+// WithoutSignatureCheck sends a config update envelope without checking its signatures against
+// the mod_policy of the modified elements first, the orderer still checks them
+func WithoutSignatureCheck() RequestOption {
+	return func(opts *requestOptions) {
+		opts.skipSignatureCheck = true
+	}
+}
+
+// WithConsenterAdmins makes RemoveConsenter check with CheckConsenterRemoval that the remaining
+// consenters are up. admins maps the host:port of the consenters to clients of their admin endpoints.
+func WithConsenterAdmins(admins map[string]*OrdererAdminClient) RequestOption {
+	return func(opts *requestOptions) {
+		opts.consenterAdmins = admins
+	}
+}
+
+func newRequestOptions(opts []RequestOption) *requestOptions {
+	o := &requestOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// context derives the context of the request from the parent context of the caller
+func (o *requestOptions) context(parent context.Context) (context.Context, context.CancelFunc) {
+	if parent == nil {
+		parent = context.Background()
+	}
+	if o.retry != nil {
+		parent = endpoints.WithRetryOpts(parent, *o.retry)
+	}
+	if o.timeout > 0 {
+		return context.WithTimeout(parent, o.timeout)
+	}
+	return context.WithCancel(parent)
+}
+
+// prepare applies the options to a copy of the client
+func (p *PeerClient) prepare(ctx context.Context, opts []RequestOption) (context.Context, context.CancelFunc, *PeerClient) {
+	o := newRequestOptions(opts)
+	c := *p
+	if len(o.peers) > 0 {
+		c.Peer = o.peers[0]
+	}
+	ctx, cancel := o.context(ctx)
+	return ctx, cancel, &c
+}
+
+// prepare applies the options to a copy of the client
+func (p *PeersClient) prepare(ctx context.Context, opts []RequestOption) (context.Context, context.CancelFunc, *PeersClient) {
+	o := newRequestOptions(opts)
+	c := *p
+	if len(o.peers) > 0 {
+		c.Peers = o.peers
+	}
+	if len(o.orderers) > 0 {
+		c.Orderer.Orderers = o.orderers
+	}
+	ctx, cancel := o.context(ctx)
+	return ctx, cancel, &c
+}
+
+// prepare applies the options to a copy of the client
+func (p *OrdererClient) prepare(ctx context.Context, opts []RequestOption) (context.Context, context.CancelFunc, *OrdererClient) {
+	o := newRequestOptions(opts)
+	c := *p
+	if len(o.orderers) > 0 {
+		c.Orderers = o.orderers
+	}
+	ctx, cancel := o.context(ctx)
+	return ctx, cancel, &c
+}
@@ -0,0 +1,484 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"github.com/feng081212/fabric-protos-go/common"
+	"github.com/feng081212/fabric-protos-go/msp"
+	"github.com/feng081212/fabric-sdk-go/fabric/endpoints"
+	"github.com/feng081212/fabric-sdk-go/fabric/errors/multi"
+	"github.com/feng081212/fabric-sdk-go/fabric/errors/status"
+	"github.com/golang/protobuf/proto"
+	"github.com/pkg/errors"
+	grpcCodes "google.golang.org/grpc/codes"
+	"math/rand"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// OrdererFailoverCodes are the error codes, grouped by source of error, on which a
+// broadcast or deliver request is sent to the next orderer
+var OrdererFailoverCodes = map[status.Group][]status.Code{
+	status.OrdererClientStatus: {
+		status.ConnectionFailed,
+	},
+	status.OrdererServerStatus: {
+		status.Code(common.Status_SERVICE_UNAVAILABLE),
+	},
+	status.GRPCTransportStatus: {
+		status.Code(grpcCodes.Unavailable),
+		status.Code(grpcCodes.DeadlineExceeded),
+	},
+}
+
+// OrdererSelectionStrategy decides in which order the orderers of an OrdererClient are tried
+type OrdererSelectionStrategy interface {
+	// Order returns the orderers in the order in which they are tried
+	Order(orderers []*endpoints.Orderer) []*endpoints.Orderer
+	// Report is called with the outcome of every request sent to an orderer
+	Report(orderer *endpoints.Orderer, err error)
+}
+
+// RandomStrategy tries the orderers in random order, it is used when no strategy is set
+type RandomStrategy struct{}
+
+func NewRandomStrategy() *RandomStrategy {
+	return &RandomStrategy{}
+}
+
+func (s *RandomStrategy) Order(orderers []*endpoints.Orderer) []*endpoints.Orderer {
+	result := append([]*endpoints.Orderer(nil), orderers...)
+	rand.Shuffle(len(result), func(i, j int) {
+		result[i], result[j] = result[j], result[i]
+	})
+	return result
+}
+
+func (s *RandomStrategy) Report(*endpoints.Orderer, error) {}
+
+// RoundRobinStrategy starts every request with the orderer after the one the previous request
+// started with
+type RoundRobinStrategy struct {
+	next uint32
+}
+
+func NewRoundRobinStrategy() *RoundRobinStrategy {
+	return &RoundRobinStrategy{}
+}
+
+func (s *RoundRobinStrategy) Order(orderers []*endpoints.Orderer) []*endpoints.Orderer {
+	if len(orderers) == 0 {
+		return nil
+	}
+	start := int((atomic.AddUint32(&s.next, 1) - 1) % uint32(len(orderers)))
+	return append(append([]*endpoints.Orderer(nil), orderers[start:]...), orderers[:start]...)
+}
+
+func (s *RoundRobinStrategy) Report(*endpoints.Orderer, error) {}
+
+// StickyStrategy keeps sending requests to the orderer that accepted the last one, the other
+// orderers are tried in the configured order. The client cannot ask an orderer who leads the Raft
+// cluster, but followers that cannot reach a leader fail with SERVICE_UNAVAILABLE, so the preferred
+// orderer tends to settle on one that is able to order. It can also be set with SetPreferred.
+type StickyStrategy struct {
+	mutex     sync.RWMutex
+	preferred string
+}
+
+func NewStickyStrategy() *StickyStrategy {
+	return &StickyStrategy{}
+}
+
+// SetPreferred sets the URL of the orderer that is tried first
+func (s *StickyStrategy) SetPreferred(url string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.preferred = url
+}
+
+// Preferred returns the URL of the orderer that is tried first, empty if there is none
+func (s *StickyStrategy) Preferred() string {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.preferred
+}
+
+func (s *StickyStrategy) Order(orderers []*endpoints.Orderer) []*endpoints.Orderer {
+	preferred := s.Preferred()
+	result := append([]*endpoints.Orderer(nil), orderers...)
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].URL() == preferred && result[j].URL() != preferred
+	})
+	return result
+}
+
+func (s *StickyStrategy) Report(orderer *endpoints.Orderer, err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if err == nil {
+		s.preferred = orderer.URL()
+	} else if s.preferred == orderer.URL() && isOrdererFailover(err) {
+		s.preferred = ""
+	}
+}
+
+// LeaderFinder finds the orderer that leads the Raft cluster of a channel
+type LeaderFinder interface {
+	// Leader returns the URL of the leader, as returned by endpoints.Orderer.URL
+	Leader(ctx context.Context) (string, error)
+}
+
+// LeaderFirstStrategy tries the Raft leader of the channel first, the other orderers are tried in
+// the configured order. Followers forward transactions to the leader, so sending to the leader
+// saves a hop. The leader is looked up with Finder when it is not known, and again after the
+// leader failed over. A failed lookup is retried after LookupInterval, the configured order is
+// used in the meantime.
+type LeaderFirstStrategy struct {
+	Finder LeaderFinder
+	// LookupTimeout limits a lookup of the leader, 3 seconds when it is zero
+	LookupTimeout time.Duration
+	// LookupInterval is the time between failed lookups, 10 seconds when it is zero
+	LookupInterval time.Duration
+
+	mutex      sync.Mutex
+	leader     string
+	lastLookup time.Time
+}
+
+func NewLeaderFirstStrategy(finder LeaderFinder) *LeaderFirstStrategy {
+	return &LeaderFirstStrategy{Finder: finder}
+}
+
+// Refresh looks up the leader
+func (s *LeaderFirstStrategy) Refresh(ctx context.Context) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.lookup(ctx)
+}
+
+func (s *LeaderFirstStrategy) lookup(ctx context.Context) error {
+	s.lastLookup = time.Now()
+	leader, err := s.Finder.Leader(ctx)
+	if err != nil {
+		s.leader = ""
+		return errors.WithMessage(err, "find the Raft leader failed")
+	}
+	s.leader = leader
+	return nil
+}
+
+// Leader returns the URL of the leader, it is looked up when it is not known
+func (s *LeaderFirstStrategy) Leader() string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	interval := s.LookupInterval
+	if interval == 0 {
+		interval = 10 * time.Second
+	}
+	if s.leader == "" && s.Finder != nil && time.Since(s.lastLookup) >= interval {
+		timeout := s.LookupTimeout
+		if timeout == 0 {
+			timeout = 3 * time.Second
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		_ = s.lookup(ctx)
+	}
+	return s.leader
+}
+
+func (s *LeaderFirstStrategy) Order(orderers []*endpoints.Orderer) []*endpoints.Orderer {
+	leader := s.Leader()
+	result := append([]*endpoints.Orderer(nil), orderers...)
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].URL() == leader && result[j].URL() != leader
+	})
+	return result
+}
+
+func (s *LeaderFirstStrategy) Report(orderer *endpoints.Orderer, err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if err != nil && s.leader == orderer.URL() && isOrdererFailover(err) {
+		// the leader is looked up again at the next request
+		s.leader = ""
+		s.lastLookup = time.Time{}
+	}
+}
+
+// raftLeaderMetric is the gauge of the etcdraft consensus that is 1 on the leader of a channel
+const raftLeaderMetric = "consensus_etcdraft_is_leader"
+
+// MetricsLeaderFinder finds the Raft leader of a channel from the consensus_etcdraft_is_leader
+// gauge, which the orderers expose at /metrics of their operations endpoint when they use the
+// prometheus metrics provider
+type MetricsLeaderFinder struct {
+	ChannelID string
+	// OperationsURLs maps the URL of every orderer to its operations endpoint, for example
+	// grpcs://orderer0.example.com:7050 to https://orderer0.example.com:9443
+	OperationsURLs map[string]string
+	// HTTPClient sends the requests, it holds the TLS configuration. http.DefaultClient is used
+	// when it is nil.
+	HTTPClient *http.Client
+}
+
+func (f *MetricsLeaderFinder) Leader(ctx context.Context) (string, error) {
+	orderers := make([]string, 0, len(f.OperationsURLs))
+	for orderer := range f.OperationsURLs {
+		orderers = append(orderers, orderer)
+	}
+	sort.Strings(orderers)
+
+	var errs multi.Errors
+	for _, orderer := range orderers {
+		leader, err := f.isLeader(ctx, f.OperationsURLs[orderer])
+		if err != nil {
+			errs = append(errs, errors.WithMessagef(err, "orderer [%s]", orderer))
+			continue
+		}
+		if leader {
+			return orderer, nil
+		}
+	}
+	if err := errs.ToError(); err != nil {
+		return "", err
+	}
+	return "", errors.Errorf("no orderer leads channel [%s]", f.ChannelID)
+}
+
+func (f *MetricsLeaderFinder) isLeader(ctx context.Context, operationsURL string) (bool, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(operationsURL, "/")+"/metrics", nil)
+	if err != nil {
+		return false, errors.Wrap(err, "create metrics request failed")
+	}
+	client := f.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return false, errors.Wrap(err, "get metrics failed")
+	}
+	defer func() { _ = response.Body.Close() }()
+	if response.StatusCode != http.StatusOK {
+		return false, errors.Errorf("get metrics failed with status %s", response.Status)
+	}
+
+	label := fmt.Sprintf(`channel="%s"`, f.ChannelID)
+	scanner := bufio.NewScanner(response.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, raftLeaderMetric+"{") || !strings.Contains(line, label) {
+			continue
+		}
+		value, err := strconv.ParseFloat(line[strings.LastIndex(line, " ")+1:], 64)
+		if err != nil {
+			return false, errors.Wrapf(err, "parse %s failed", raftLeaderMetric)
+		}
+		return value == 1, nil
+	}
+	if err = scanner.Err(); err != nil {
+		return false, errors.Wrap(err, "read metrics failed")
+	}
+	return false, errors.Errorf("no %s metric for channel [%s]", raftLeaderMetric, f.ChannelID)
+}
+
+// ConfigOrdererAddress is an orderer endpoint from the channel config
+type ConfigOrdererAddress struct {
+	// MSPID is the orderer organization, empty for the global OrdererAddresses of the channel
+	MSPID   string
+	Address string
+	// TlsRootCerts are the PEM encoded TLS root and intermediate certificates of the organization,
+	// for the global OrdererAddresses these are the certificates of all orderer organizations
+	TlsRootCerts [][]byte
+}
+
+// GetOrdererAddressesFromConfig returns the orderer endpoints of the channel config. The Endpoints
+// values of the orderer organizations take precedence, the global OrdererAddresses value of the
+// channel is only used when no organization defines its endpoints.
+func GetOrdererAddressesFromConfig(config *common.Config) ([]*ConfigOrdererAddress, error) {
+	if config == nil || config.ChannelGroup == nil {
+		return nil, errors.New("channel config is required")
+	}
+
+	var result []*ConfigOrdererAddress
+	var allTlsRootCerts [][]byte
+
+	if ordererGroup, ok := config.ChannelGroup.Groups[OrdererGroupKey]; ok {
+		orgs := make([]string, 0, len(ordererGroup.Groups))
+		for org := range ordererGroup.Groups {
+			orgs = append(orgs, org)
+		}
+		sort.Strings(orgs)
+
+		for _, org := range orgs {
+			orgGroup := ordererGroup.Groups[org]
+
+			mspID := org
+			var tlsRootCerts [][]byte
+			if value, ok := orgGroup.Values[MSPKey]; ok {
+				mspConfig := &msp.MSPConfig{}
+				if err := proto.Unmarshal(value.Value, mspConfig); err != nil {
+					return nil, errors.Wrapf(err, "unmarshal msp config of orderer org [%s] failed", org)
+				}
+				fabricMSPConfig := &msp.FabricMSPConfig{}
+				if err := proto.Unmarshal(mspConfig.Config, fabricMSPConfig); err != nil {
+					return nil, errors.Wrapf(err, "unmarshal fabric msp config of orderer org [%s] failed", org)
+				}
+				mspID = fabricMSPConfig.Name
+				tlsRootCerts = append(append(tlsRootCerts, fabricMSPConfig.TlsRootCerts...), fabricMSPConfig.TlsIntermediateCerts...)
+				allTlsRootCerts = append(allTlsRootCerts, tlsRootCerts...)
+			}
+
+			value, ok := orgGroup.Values[EndpointsKey]
+			if !ok {
+				continue
+			}
+			addresses := &common.OrdererAddresses{}
+			if err := proto.Unmarshal(value.Value, addresses); err != nil {
+				return nil, errors.Wrapf(err, "unmarshal endpoints of orderer org [%s] failed", org)
+			}
+			for _, address := range addresses.Addresses {
+				result = append(result, &ConfigOrdererAddress{MSPID: mspID, Address: address, TlsRootCerts: tlsRootCerts})
+			}
+		}
+	}
+
+	if len(result) > 0 {
+		return result, nil
+	}
+
+	if value, ok := config.ChannelGroup.Values[OrdererAddressesKey]; ok {
+		addresses := &common.OrdererAddresses{}
+		if err := proto.Unmarshal(value.Value, addresses); err != nil {
+			return nil, errors.Wrap(err, "unmarshal orderer addresses failed")
+		}
+		for _, address := range addresses.Addresses {
+			result = append(result, &ConfigOrdererAddress{Address: address, TlsRootCerts: allTlsRootCerts})
+		}
+	}
+
+	return result, nil
+}
+
+// RefreshOrderers replaces Orderers with the orderer endpoints of the channel config. The new
+// orderers inherit the TLS client certificates, timeouts and retry options of the first orderer
+// of the client. RefreshOrderers must not be called concurrently with other requests.
+func (p *OrdererClient) RefreshOrderers(channelID string) error {
+	return p.RefreshOrderersContext(context.Background(), channelID)
+}
+
+// RefreshOrderersContext is RefreshOrderers with a context and per-call options
+func (p *OrdererClient) RefreshOrderersContext(ctx context.Context, channelID string, opts ...RequestOption) error {
+	ctx, cancel, c := p.prepare(ctx, opts)
+	defer cancel()
+
+	targets := c.orderers()
+	if len(targets) == 0 {
+		return errors.New("orderer not set")
+	}
+
+	block, err := c.GetConfigBlockContext(ctx, channelID)
+	if err != nil {
+		return errors.WithMessagef(err, "get config block of channel [%s] failed", channelID)
+	}
+
+	config, err := GetConfigFromBlock(block)
+	if err != nil {
+		return err
+	}
+
+	addresses, err := GetOrdererAddressesFromConfig(config)
+	if err != nil {
+		return err
+	}
+	if len(addresses) == 0 {
+		return errors.Errorf("channel [%s] has no orderer addresses", channelID)
+	}
+
+	orderers := make([]*endpoints.Orderer, 0, len(addresses))
+	for _, address := range addresses {
+		orderers = append(orderers, targets[0].ConfiguredOrderer(address.Address, address.TlsRootCerts))
+	}
+
+	p.Orderers = orderers
+	return nil
+}
+
+// orderers returns Orderers, or Orderer when no orderer set is configured
+func (p *OrdererClient) orderers() []*endpoints.Orderer {
+	if len(p.Orderers) > 0 {
+		return p.Orderers
+	}
+	if p.Orderer != nil {
+		return []*endpoints.Orderer{p.Orderer}
+	}
+	return nil
+}
+
+func (p *OrdererClient) strategy() OrdererSelectionStrategy {
+	if p.Strategy != nil {
+		return p.Strategy
+	}
+	return &RandomStrategy{}
+}
+
+// invokeOrderers calls invoke with the orderers in the order of the strategy until one succeeds
+// or fails with an error that is not in OrdererFailoverCodes
+func (p *OrdererClient) invokeOrderers(ctx context.Context, invoke func(orderer *endpoints.Orderer) (interface{}, error)) (interface{}, error) {
+	targets := p.orderers()
+	if len(targets) == 0 {
+		return nil, errors.New("orderer not set")
+	}
+
+	strategy := p.strategy()
+	var errs multi.Errors
+
+	for _, orderer := range strategy.Order(targets) {
+		res, err := invoke(orderer)
+		strategy.Report(orderer, err)
+		if err == nil {
+			return res, nil
+		}
+		errs = append(errs, errors.WithMessagef(err, "orderer [%s]", orderer.URL()))
+		if !isOrdererFailover(err) || ctx.Err() != nil {
+			break
+		}
+	}
+
+	return nil, errs.ToError()
+}
+
+func isOrdererFailover(err error) bool {
+	cause := errors.Cause(err)
+
+	if m, ok := cause.(multi.Errors); ok {
+		for _, e := range m {
+			if isOrdererFailover(e) {
+				return true
+			}
+		}
+		return false
+	}
+
+	s, ok := status.FromError(cause)
+	if !ok {
+		if s = status.NewFromGRPCError(cause); s == nil {
+			return false
+		}
+	}
+
+	for _, code := range OrdererFailoverCodes[s.Group] {
+		if status.Code(s.Code) == code {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,165 @@
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/feng081212/fabric-protos-go/common"
+	ab "github.com/feng081212/fabric-protos-go/orderer"
+	"github.com/feng081212/fabric-sdk-go/fabric/endpoints"
+	"github.com/feng081212/fabric-sdk-go/fabric/errors/status"
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/grpc"
+)
+
+// deliverServer answers every deliver request with the block
+type deliverServer struct {
+	block *common.Block
+}
+
+func (s *deliverServer) Broadcast(ab.AtomicBroadcast_BroadcastServer) error {
+	return nil
+}
+
+func (s *deliverServer) Deliver(stream ab.AtomicBroadcast_DeliverServer) error {
+	if _, err := stream.Recv(); err != nil {
+		return err
+	}
+	if err := stream.Send(&ab.DeliverResponse{Type: &ab.DeliverResponse_Block{Block: s.block}}); err != nil {
+		return err
+	}
+	return stream.Send(&ab.DeliverResponse{Type: &ab.DeliverResponse_Status{Status: common.Status_SUCCESS}})
+}
+
+func startDeliverServer(t *testing.T, block *common.Block) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := grpc.NewServer()
+	ab.RegisterAtomicBroadcastServer(server, &deliverServer{block: block})
+	go func() { _ = server.Serve(listener) }()
+	t.Cleanup(server.Stop)
+	return listener.Addr().String()
+}
+
+func TestRefreshOrderers(t *testing.T) {
+	channelGroup := &common.ConfigGroup{Groups: map[string]*common.ConfigGroup{}, Values: map[string]*common.ConfigValue{}}
+	_ = addValue(channelGroup, AdminsPolicyKey, OrdererAddressesKey, &common.OrdererAddresses{
+		Addresses: []string{"orderer0.example.com:7050", "orderer1.example.com:7050"},
+	})
+	block, err := CreateGenesisBlock("mychannel", channelGroup)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	address := startDeliverServer(t, block)
+	client := &OrdererClient{
+		Orderer: endpoints.EmptyOrderer().SetUrl("grpc://" + address),
+		Signer:  &testSigner{},
+	}
+
+	if err = client.RefreshOrderers("mychannel"); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(client.Orderers) != 2 {
+		t.Fatalf("expected 2 orderers, got %d", len(client.Orderers))
+	}
+	for i, expected := range []string{"grpc://orderer0.example.com:7050", "grpc://orderer1.example.com:7050"} {
+		if url := client.Orderers[i].URL(); url != expected {
+			t.Errorf("expected orderer %d to be %s, got %s", i, expected, url)
+		}
+	}
+}
+
+// startMetricsServer serves the operations endpoint of an orderer that leads mychannel or not
+func startMetricsServer(t *testing.T, leader *int) string {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/metrics" {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = fmt.Fprintf(w, "# TYPE consensus_etcdraft_is_leader gauge\n")
+		_, _ = fmt.Fprintf(w, "consensus_etcdraft_is_leader{channel=\"otherchannel\"} 1\n")
+		_, _ = fmt.Fprintf(w, "consensus_etcdraft_is_leader{channel=\"mychannel\"} %d\n", *leader)
+	}))
+	t.Cleanup(server.Close)
+	return server.URL
+}
+
+func TestLeaderFirstStrategy(t *testing.T) {
+	orderers := []*endpoints.Orderer{
+		endpoints.EmptyOrderer().SetUrl("grpc://orderer0:7050"),
+		endpoints.EmptyOrderer().SetUrl("grpc://orderer1:7050"),
+		endpoints.EmptyOrderer().SetUrl("grpc://orderer2:7050"),
+	}
+	leaders := []int{0, 1, 0}
+	finder := &MetricsLeaderFinder{ChannelID: "mychannel", OperationsURLs: map[string]string{}}
+	for i, orderer := range orderers {
+		finder.OperationsURLs[orderer.URL()] = startMetricsServer(t, &leaders[i])
+	}
+	strategy := NewLeaderFirstStrategy(finder)
+
+	if order := strategy.Order(orderers); order[0] != orderers[1] || order[1] != orderers[0] || order[2] != orderers[2] {
+		t.Fatalf("expected the leader orderer1 first, got %s", order[0].URL())
+	}
+
+	// a new leader is looked up after the leader failed over, not after other errors
+	leaders[1], leaders[2] = 0, 1
+	strategy.Report(orderers[1], status.New(status.OrdererServerStatus, int32(common.Status_BAD_REQUEST), "bad request"))
+	if leader := strategy.Leader(); leader != "grpc://orderer1:7050" {
+		t.Fatalf("expected orderer1 to stay the leader, got %s", leader)
+	}
+	strategy.Report(orderers[1], status.New(status.OrdererServerStatus, int32(common.Status_SERVICE_UNAVAILABLE), "no leader"))
+	if order := strategy.Order(orderers); order[0] != orderers[2] {
+		t.Fatalf("expected the new leader orderer2 first, got %s", order[0].URL())
+	}
+
+	// without a leader the configured order is used
+	leaders[2] = 0
+	if err := strategy.Refresh(context.Background()); err == nil {
+		t.Fatal("expected an error when no orderer leads the channel")
+	}
+	if order := strategy.Order(orderers); order[0] != orderers[0] || order[2] != orderers[2] {
+		t.Fatalf("expected the configured order, got %s first", order[0].URL())
+	}
+}
+
+func TestCreatePayloadTlsClientCerts(t *testing.T) {
+	cert := func(der string) []tls.Certificate {
+		return []tls.Certificate{{Certificate: [][]byte{[]byte(der)}}}
+	}
+	client := &OrdererClient{
+		Orderers: []*endpoints.Orderer{
+			endpoints.EmptyOrderer().SetUrl("grpc://orderer0:7050").SetTlsClientCerts(cert("client")),
+			endpoints.EmptyOrderer().SetUrl("grpc://orderer1:7050").SetTlsClientCerts(cert("client")),
+		},
+		Signer: &testSigner{},
+	}
+	data := func() ([]byte, error) { return nil, nil }
+
+	payload, err := client.CreatePayload(common.HeaderType_DELIVER_SEEK_INFO, "mychannel", data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	channelHeader := &common.ChannelHeader{}
+	if err = proto.Unmarshal(payload.Header.ChannelHeader, channelHeader); err != nil {
+		t.Fatal(err)
+	}
+	expected, _ := tlsCertHash(cert("client"))
+	if string(channelHeader.TlsCertHash) != string(expected) {
+		t.Fatal("expected the hash of the TLS client certificate in the channel header")
+	}
+
+	// the payload would be refused by an orderer with another client certificate
+	client.Orderers[1].SetTlsClientCerts(cert("other"))
+	if _, err = client.CreatePayload(common.HeaderType_DELIVER_SEEK_INFO, "mychannel", data); err == nil {
+		t.Fatal("expected orderers with different TLS client certificates to be refused")
+	}
+}
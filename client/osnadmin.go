@@ -0,0 +1,222 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"github.com/feng081212/fabric-protos-go/common"
+	"github.com/feng081212/fabric-sdk-go/fabric/errors/status"
+	"github.com/golang/protobuf/proto"
+	"github.com/pkg/errors"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// channelParticipationPath is the path of the Channel Participation API of the orderer admin endpoint
+const channelParticipationPath = "/participation/v1/channels"
+
+// OrdererAdminClient manages the channels of an orderer through the Channel Participation API of
+// its admin endpoint, as osnadmin does. It is used with orderers that run without a system channel.
+type OrdererAdminClient struct {
+	// URL is the address of the admin endpoint, for example https://orderer0.example.com:9443
+	URL string
+	// HTTPClient sends the requests, it holds the mutual TLS configuration
+	HTTPClient *http.Client
+}
+
+// ChannelInfoShort is a channel in the channel list of an orderer
+type ChannelInfoShort struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
+}
+
+// ChannelList is the list of the channels an orderer is a member of
+type ChannelList struct {
+	// SystemChannel is nil when the orderer runs without a system channel
+	SystemChannel *ChannelInfoShort   `json:"systemChannel"`
+	Channels      []*ChannelInfoShort `json:"channels"`
+}
+
+// ChannelInfo is the status of a channel on an orderer
+type ChannelInfo struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
+	// ConsensusRelation is consenter, follower, config-tracker or other
+	ConsensusRelation string `json:"consensusRelation"`
+	// Status is active, onboarding, inactive or failed
+	Status string `json:"status"`
+	Height uint64 `json:"height"`
+}
+
+// NewOrdererAdminClient creates a client of the admin endpoint at url. The server certificate is
+// verified with caCertificate and serverName, clientCertificate and clientKey are the PEM encoded
+// TLS client certificate and key the admin endpoint requires.
+func NewOrdererAdminClient(url, serverName, caCertificate, clientCertificate, clientKey string) (*OrdererAdminClient, error) {
+	rootCAs := x509.NewCertPool()
+	if !rootCAs.AppendCertsFromPEM([]byte(caCertificate)) {
+		return nil, errors.New("no valid TLS CA certificate of the orderer admin endpoint")
+	}
+	clientCert, err := tls.X509KeyPair([]byte(clientCertificate), []byte(clientKey))
+	if err != nil {
+		return nil, errors.Wrap(err, "load TLS client certificate failed")
+	}
+
+	return &OrdererAdminClient{
+		URL: url,
+		HTTPClient: &http.Client{
+			Transport: &http.Transport{
+				TLSClientConfig: &tls.Config{
+					RootCAs:      rootCAs,
+					Certificates: []tls.Certificate{clientCert},
+					ServerName:   serverName,
+				},
+			},
+		},
+	}, nil
+}
+
+func (p *OrdererAdminClient) JoinChannel(block *common.Block) (*ChannelInfo, error) {
+	return p.JoinChannelContext(context.Background(), block)
+}
+
+// JoinChannelContext joins the orderer to the channel of the config block, which is the genesis
+// block for a new channel, for example the one of Channel.GenesisBlock
+func (p *OrdererAdminClient) JoinChannelContext(ctx context.Context, block *common.Block, opts ...RequestOption) (*ChannelInfo, error) {
+	ctx, cancel := newRequestOptions(opts).context(ctx)
+	defer cancel()
+
+	if block == nil {
+		return nil, errors.New("config block is required")
+	}
+	blockBytes, err := proto.Marshal(block)
+	if err != nil {
+		return nil, errors.Wrap(err, "marshal config block failed")
+	}
+
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	part, err := writer.CreateFormFile("config-block", "config.block")
+	if err != nil {
+		return nil, errors.Wrap(err, "create multipart form failed")
+	}
+	if _, err = part.Write(blockBytes); err != nil {
+		return nil, errors.Wrap(err, "write config block failed")
+	}
+	if err = writer.Close(); err != nil {
+		return nil, errors.Wrap(err, "close multipart form failed")
+	}
+
+	info := &ChannelInfo{}
+	if err = p.do(ctx, http.MethodPost, channelParticipationPath, writer.FormDataContentType(), body, http.StatusCreated, info); err != nil {
+		return nil, errors.WithMessage(err, "join channel failed")
+	}
+	return info, nil
+}
+
+func (p *OrdererAdminClient) RemoveChannel(channelID string) error {
+	return p.RemoveChannelContext(context.Background(), channelID)
+}
+
+// RemoveChannelContext removes the orderer from the channel and deletes the ledger of the channel
+func (p *OrdererAdminClient) RemoveChannelContext(ctx context.Context, channelID string, opts ...RequestOption) error {
+	ctx, cancel := newRequestOptions(opts).context(ctx)
+	defer cancel()
+
+	if channelID == "" {
+		return errors.New("channel ID is required")
+	}
+	if err := p.do(ctx, http.MethodDelete, channelParticipationPath+"/"+url.PathEscape(channelID), "", nil, http.StatusNoContent, nil); err != nil {
+		return errors.WithMessagef(err, "remove channel [%s] failed", channelID)
+	}
+	return nil
+}
+
+func (p *OrdererAdminClient) ListChannels() (*ChannelList, error) {
+	return p.ListChannelsContext(context.Background())
+}
+
+// ListChannelsContext lists the channels the orderer is a member of
+func (p *OrdererAdminClient) ListChannelsContext(ctx context.Context, opts ...RequestOption) (*ChannelList, error) {
+	ctx, cancel := newRequestOptions(opts).context(ctx)
+	defer cancel()
+
+	list := &ChannelList{}
+	if err := p.do(ctx, http.MethodGet, channelParticipationPath, "", nil, http.StatusOK, list); err != nil {
+		return nil, errors.WithMessage(err, "list channels failed")
+	}
+	return list, nil
+}
+
+func (p *OrdererAdminClient) GetChannelInfo(channelID string) (*ChannelInfo, error) {
+	return p.GetChannelInfoContext(context.Background(), channelID)
+}
+
+// GetChannelInfoContext returns the status of the channel on the orderer
+func (p *OrdererAdminClient) GetChannelInfoContext(ctx context.Context, channelID string, opts ...RequestOption) (*ChannelInfo, error) {
+	ctx, cancel := newRequestOptions(opts).context(ctx)
+	defer cancel()
+
+	if channelID == "" {
+		return nil, errors.New("channel ID is required")
+	}
+	info := &ChannelInfo{}
+	if err := p.do(ctx, http.MethodGet, channelParticipationPath+"/"+url.PathEscape(channelID), "", nil, http.StatusOK, info); err != nil {
+		return nil, errors.WithMessagef(err, "get channel [%s] failed", channelID)
+	}
+	return info, nil
+}
+
+// do sends the request and decodes the response into result if it is not nil. Responses with
+// another status than expected are returned as HTTPTransportStatus errors with the HTTP status
+// code and the error message of the orderer.
+func (p *OrdererAdminClient) do(ctx context.Context, method, path, contentType string, body io.Reader, expected int, result interface{}) error {
+	if p.URL == "" {
+		return errors.New("orderer admin URL is required")
+	}
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimSuffix(p.URL, "/")+path, body)
+	if err != nil {
+		return errors.Wrap(err, "create request failed")
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	httpClient := p.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return errors.Wrapf(err, "%s %s failed", method, req.URL)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return errors.Wrap(err, "read response failed")
+	}
+
+	if resp.StatusCode != expected {
+		message := strings.TrimSpace(string(respBody))
+		errorResponse := &struct {
+			Error string `json:"error"`
+		}{}
+		if json.Unmarshal(respBody, errorResponse) == nil && errorResponse.Error != "" {
+			message = errorResponse.Error
+		}
+		return status.New(status.HTTPTransportStatus, int32(resp.StatusCode), message)
+	}
+
+	if result != nil {
+		if err = json.Unmarshal(respBody, result); err != nil {
+			return errors.Wrap(err, "decode response failed")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,189 @@
+package client
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/feng081212/fabric-protos-go/common"
+	"github.com/feng081212/fabric-sdk-go/fabric/errors/status"
+	"github.com/golang/protobuf/proto"
+)
+
+// channelParticipationServer is a stand-in for the Channel Participation API of an orderer, the
+// channel of a joined block is taken from the block number
+type channelParticipationServer struct {
+	mutex    sync.Mutex
+	channels map[string]*ChannelInfo
+}
+
+func (s *channelParticipationServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	writeJSON := func(code int, v interface{}) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(code)
+		_ = json.NewEncoder(w).Encode(v)
+	}
+	writeError := func(code int, msg string) {
+		writeJSON(code, map[string]string{"error": msg})
+	}
+
+	channelID := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, channelParticipationPath), "/")
+	switch {
+	case r.Method == http.MethodGet && channelID == "":
+		list := &ChannelList{Channels: []*ChannelInfoShort{}}
+		for name, info := range s.channels {
+			list.Channels = append(list.Channels, &ChannelInfoShort{Name: name, URL: info.URL})
+		}
+		writeJSON(http.StatusOK, list)
+	case r.Method == http.MethodGet:
+		info, ok := s.channels[channelID]
+		if !ok {
+			writeError(http.StatusNotFound, "channel does not exist")
+			return
+		}
+		writeJSON(http.StatusOK, info)
+	case r.Method == http.MethodPost && channelID == "":
+		file, _, err := r.FormFile("config-block")
+		if err != nil {
+			writeError(http.StatusBadRequest, "form file 'config-block' is missing")
+			return
+		}
+		bs, _ := ioutil.ReadAll(file)
+		block := &common.Block{}
+		if err = proto.Unmarshal(bs, block); err != nil || block.Header == nil {
+			writeError(http.StatusBadRequest, "invalid config block")
+			return
+		}
+		name := string(block.Header.DataHash)
+		if _, ok := s.channels[name]; ok {
+			writeError(http.StatusMethodNotAllowed, "cannot join: channel already exists")
+			return
+		}
+		info := &ChannelInfo{Name: name, URL: channelParticipationPath + "/" + name, ConsensusRelation: "consenter", Status: "active", Height: 1}
+		s.channels[name] = info
+		writeJSON(http.StatusCreated, info)
+	case r.Method == http.MethodDelete && channelID != "":
+		if _, ok := s.channels[channelID]; !ok {
+			writeError(http.StatusNotFound, "channel does not exist")
+			return
+		}
+		delete(s.channels, channelID)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(http.StatusMethodNotAllowed, "invalid request")
+	}
+}
+
+func testClientCertificate(t *testing.T) (certPEM, keyPEM string, cert *x509.Certificate) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "Admin@example.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ = x509.ParseCertificate(der)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})),
+		string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})), cert
+}
+
+// startChannelParticipationServer starts a server that requires the returned client certificate
+func startChannelParticipationServer(t *testing.T) (*httptest.Server, string, string) {
+	certPEM, keyPEM, cert := testClientCertificate(t)
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(cert)
+
+	server := httptest.NewUnstartedServer(&channelParticipationServer{channels: make(map[string]*ChannelInfo)})
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: clientCAs}
+	server.StartTLS()
+	t.Cleanup(server.Close)
+	return server, certPEM, keyPEM
+}
+
+func TestOrdererAdminClient(t *testing.T) {
+	server, certPEM, keyPEM := startChannelParticipationServer(t)
+	caPEM := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}))
+
+	client, err := NewOrdererAdminClient(server.URL, "example.com", caPEM, certPEM, keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	block := &common.Block{Header: &common.BlockHeader{DataHash: []byte("mychannel")}, Data: &common.BlockData{}}
+	info, err := client.JoinChannel(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Name != "mychannel" || info.ConsensusRelation != "consenter" || info.Status != "active" || info.Height != 1 {
+		t.Fatalf("unexpected channel info %+v", info)
+	}
+
+	if _, err = client.JoinChannel(block); err == nil {
+		t.Fatal("joining a channel twice should fail")
+	} else if s, ok := status.FromError(err); !ok || s.Group != status.HTTPTransportStatus || s.Code != http.StatusMethodNotAllowed || s.Message != "cannot join: channel already exists" {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	list, err := client.ListChannels()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if list.SystemChannel != nil || len(list.Channels) != 1 || list.Channels[0].Name != "mychannel" {
+		t.Fatalf("unexpected channel list %+v", list)
+	}
+
+	if info, err = client.GetChannelInfo("mychannel"); err != nil || info.Name != "mychannel" {
+		t.Fatalf("unexpected channel info %+v, error %v", info, err)
+	}
+
+	if err = client.RemoveChannel("mychannel"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = client.GetChannelInfo("mychannel"); err == nil {
+		t.Fatal("removed channel should not exist")
+	} else if s, ok := status.FromError(err); !ok || s.Code != http.StatusNotFound {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
+
+func TestOrdererAdminClientRequiresClientCertificate(t *testing.T) {
+	server, _, _ := startChannelParticipationServer(t)
+	otherCertPEM, otherKeyPEM, _ := testClientCertificate(t)
+	caPEM := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}))
+
+	client, err := NewOrdererAdminClient(server.URL, "example.com", caPEM, otherCertPEM, otherKeyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = client.ListChannels(); err == nil {
+		t.Fatal("a client certificate the server does not trust should be rejected")
+	}
+}
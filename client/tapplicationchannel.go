@@ -0,0 +1,104 @@
+package client
+
+import (
+	"github.com/feng081212/fabric-protos-go/common"
+	"github.com/feng081212/fabric-sdk-go/fabric/bccsp/hasher"
+	"github.com/pkg/errors"
+	"math"
+	"strconv"
+)
+
+// ApplicationChannel defines an application channel of orderers without a system channel. Its
+// genesis block holds the whole channel config, orderers join it with OrdererAdminClient.JoinChannel
+// and peers with JoinChannel.
+type ApplicationChannel struct {
+	ChannelID    string
+	Capabilities []string
+	Policies     map[string]*Policy
+	Orderer      *OrdererEndpoints
+	Application  *Application
+}
+
+func DefaultApplicationChannel(channelID string, orderer *OrdererEndpoints, application *Application) *ApplicationChannel {
+	return &ApplicationChannel{
+		ChannelID:    channelID,
+		Capabilities: []string{"V2_0"},
+		Policies:     make(map[string]*Policy),
+		Orderer:      orderer,
+		Application:  application,
+	}
+}
+
+func (p *ApplicationChannel) AddPolicy(name, rule string) {
+	if p.Policies == nil {
+		p.Policies = make(map[string]*Policy)
+	}
+	p.Policies[name] = &Policy{ImplicitMetaPolicyType, rule}
+}
+
+// GenesisBlock builds the genesis block of the channel, the config is validated first so a block
+// the orderer would refuse fails here
+func (p *ApplicationChannel) GenesisBlock() (*common.Block, error) {
+	if err := ValidateChannelID(p.ChannelID); err != nil {
+		return nil, err
+	}
+
+	configGroup, e := p.BuildConfigGroup()
+	if e != nil {
+		return nil, e
+	}
+
+	if e = ValidateChannelConfig(&common.Config{ChannelGroup: configGroup}); e != nil {
+		return nil, errors.WithMessagef(e, "invalid config of channel '%s'", p.ChannelID)
+	}
+
+	return CreateGenesisBlock(p.ChannelID, configGroup)
+}
+
+func (p *ApplicationChannel) BuildConfigGroup() (*common.ConfigGroup, error) {
+	if p.Orderer == nil {
+		return nil, errors.New("cannot define a new channel with no Orderer section")
+	}
+	if p.Application == nil {
+		return nil, errors.New("cannot define a new channel with no Application section")
+	}
+
+	configGroup := NewConfigGroup(AdminsPolicyKey)
+
+	_ = addValue(configGroup, AdminsPolicyKey, HashingAlgorithmKey, &common.HashingAlgorithm{Name: string(hasher.SHA256)})
+	_ = addValue(configGroup, AdminsPolicyKey, BlockDataHashingStructureKey, &common.BlockDataHashingStructure{Width: math.MaxUint32})
+
+	if e := AddPolicies(configGroup, p.Policies, AdminsPolicyKey); e != nil {
+		return nil, errors.Wrapf(e, "error adding policies to channel '%s'", p.ChannelID)
+	}
+
+	if len(p.Capabilities) > 0 {
+		_ = addValue(configGroup, AdminsPolicyKey, CapabilitiesKey, CapabilitiesConfigValue(p.Capabilities))
+	}
+
+	var e error
+	if configGroup.Groups[OrdererGroupKey], e = p.Orderer.BuildConfigGroup(); e != nil {
+		return nil, e
+	}
+	if configGroup.Groups[ApplicationGroupKey], e = p.Application.BuildConfigGroup(); e != nil {
+		return nil, e
+	}
+
+	// the global orderer addresses are only derived from the consenters when no orderer
+	// organization defines its endpoints
+	orgEndpoints := false
+	for _, organization := range p.Orderer.Organizations {
+		orgEndpoints = orgEndpoints || len(organization.OrdererEndpoints) > 0
+	}
+	addresses := p.Orderer.Addresses
+	if len(addresses) == 0 && !orgEndpoints {
+		for _, o := range p.Orderer.Orderers {
+			addresses = append(addresses, o.Host+":"+strconv.Itoa(int(o.Port)))
+		}
+	}
+	if len(addresses) > 0 {
+		_ = addValue(configGroup, ordererAdminsPolicyName, OrdererAddressesKey, &common.OrdererAddresses{Addresses: addresses})
+	}
+
+	return configGroup, nil
+}
@@ -0,0 +1,241 @@
+package client
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/feng081212/fabric-protos-go/common"
+	"github.com/feng081212/fabric-protos-go/msp"
+	"github.com/feng081212/fabric-protos-go/orderer"
+	"github.com/feng081212/fabric-protos-go/orderer/etcdraft"
+	"github.com/golang/protobuf/proto"
+)
+
+// testOrganization is an organization with NodeOUs whose MSP is rooted at ca
+func testOrganization(mspID string, ca *testCA) *Organization {
+	organization := DefaultOrganization(mspID)
+	caPEM := string(ca.pem())
+	organization.MspConfig = &MspConfig{
+		MspID:      mspID,
+		Cacerts:    []string{caPEM},
+		TlsCACerts: []string{caPEM},
+		NodeOUs: &NodeOUs{Enable: true, ClientOUIdentifierCert: caPEM, PeerOUIdentifierCert: caPEM,
+			AdminOUIdentifierCert: caPEM, OrdererOUIdentifierCert: caPEM},
+	}
+	return organization
+}
+
+// testApplicationChannel is a channel ordered by two Raft consenters of one orderer organization
+// with two application organizations
+func testApplicationChannel(t *testing.T) *ApplicationChannel {
+	tlsCA := newTestCA(t, "tlsca.example.com")
+
+	ordererOrg := testOrganization("OrdererMSP", newTestCA(t, "ca.example.com"))
+	ordererOrg.OrdererEndpoints = []string{"orderer0.example.com:7050", "orderer1.example.com:7050"}
+	org1 := testOrganization("Org1MSP", newTestCA(t, "ca.org1.example.com"))
+	org1.AnchorPeers = []*AnchorPeer{{Host: "peer0.org1.example.com", Port: 7051}}
+	org2 := testOrganization("Org2MSP", newTestCA(t, "ca.org2.example.com"))
+	org2.AnchorPeers = []*AnchorPeer{{Host: "peer0.org2.example.com", Port: 9051}}
+
+	ordererEndpoints := DefaultOrdererEndpoints()
+	ordererEndpoints.AddOrganization(ordererOrg)
+	for _, host := range []string{"orderer0.example.com", "orderer1.example.com"} {
+		cert := string(tlsCA.signer(t, "OrdererMSP", host).certPEM)
+		ordererEndpoints.AddOrderer(&OrdererEndpoint{Host: host, Port: 7050, ClientTlsCert: cert, ServerTlsCert: cert})
+	}
+	ordererEndpoints.AddPolicy(ReadersPolicyKey, "ANY Readers")
+	ordererEndpoints.AddPolicy(WritersPolicyKey, "ANY Writers")
+	ordererEndpoints.AddPolicy(AdminsPolicyKey, "MAJORITY Admins")
+	ordererEndpoints.AddPolicy(BlockValidationPolicyKey, "ANY Writers")
+
+	application := DefaultApplication()
+	application.Organizations = []*Organization{org1, org2}
+	application.AddPolicy(ReadersPolicyKey, "ANY Readers")
+	application.AddPolicy(WritersPolicyKey, "ANY Writers")
+	application.AddPolicy(AdminsPolicyKey, "MAJORITY Admins")
+	application.AddPolicy(EndorsementPolicyKey, "MAJORITY Endorsement")
+	application.AddPolicy("LifecycleEndorsement", "MAJORITY Endorsement")
+	application.ACLs = map[string]string{
+		"_lifecycle/CheckCommitReadiness": "/Channel/Application/Writers",
+		"qscc/GetBlockByNumber":           "Readers",
+	}
+
+	channel := DefaultApplicationChannel("mychannel", ordererEndpoints, application)
+	channel.AddPolicy(ReadersPolicyKey, "ANY Readers")
+	channel.AddPolicy(WritersPolicyKey, "ANY Writers")
+	channel.AddPolicy(AdminsPolicyKey, "MAJORITY Admins")
+	return channel
+}
+
+func TestApplicationChannelGenesisBlock(t *testing.T) {
+	channel := testApplicationChannel(t)
+	block, err := channel.GenesisBlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config, err := GetConfigFromBlock(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = ValidateChannelConfig(config); err != nil {
+		t.Fatalf("expected the config of the genesis block to be valid: %s", err)
+	}
+	if _, ok := config.ChannelGroup.Values[OrdererAddressesKey]; ok {
+		t.Fatal("expected no global orderer addresses when the orderer organization defines its endpoints")
+	}
+
+	channel.ChannelID = "MyChannel"
+	if _, err = channel.GenesisBlock(); err == nil {
+		t.Fatal("expected a channel ID with upper case letters to be refused")
+	}
+}
+
+func TestValidateChannelConfig(t *testing.T) {
+	channel := testApplicationChannel(t)
+	configGroup, err := channel.BuildConfigGroup()
+	if err != nil {
+		t.Fatal(err)
+	}
+	original := &common.Config{ChannelGroup: configGroup}
+
+	tests := []struct {
+		name   string
+		modify func(t *testing.T, config *common.Config)
+		errMsg string
+	}{
+		{"consortiums group", func(t *testing.T, c *common.Config) {
+			c.ChannelGroup.Groups[ConsortiumsGroupKey] = NewConfigGroup(AdminsPolicyKey)
+		}, "must not contain a Consortiums group"},
+		{"no hashing algorithm", func(t *testing.T, c *common.Config) {
+			delete(c.ChannelGroup.Values, HashingAlgorithmKey)
+		}, "no HashingAlgorithm value"},
+		{"unknown hashing algorithm", func(t *testing.T, c *common.Config) {
+			_ = addValue(c.ChannelGroup, AdminsPolicyKey, HashingAlgorithmKey, &common.HashingAlgorithm{Name: "MD5"})
+		}, "unknown hashing algorithm"},
+		{"hashing structure width", func(t *testing.T, c *common.Config) {
+			_ = addValue(c.ChannelGroup, AdminsPolicyKey, BlockDataHashingStructureKey, &common.BlockDataHashingStructure{Width: 2})
+		}, "width must be"},
+		{"no channel Admins policy", func(t *testing.T, c *common.Config) {
+			delete(c.ChannelGroup.Policies, AdminsPolicyKey)
+		}, "[/Channel] has no Admins policy"},
+		{"unknown channel capability", func(t *testing.T, c *common.Config) {
+			_ = addValue(c.ChannelGroup, AdminsPolicyKey, CapabilitiesKey, CapabilitiesConfigValue([]string{"V3_0"}))
+		}, "capability [V3_0] of config group [/Channel] is not supported"},
+		{"no orderer group", func(t *testing.T, c *common.Config) {
+			delete(c.ChannelGroup.Groups, OrdererGroupKey)
+		}, "[/Channel/Orderer] does not exist"},
+		{"no orderer organizations", func(t *testing.T, c *common.Config) {
+			c.ChannelGroup.Groups[OrdererGroupKey].Groups = map[string]*common.ConfigGroup{}
+		}, "orderer group has no organizations"},
+		{"no BlockValidation policy", func(t *testing.T, c *common.Config) {
+			delete(c.ChannelGroup.Groups[OrdererGroupKey].Policies, BlockValidationPolicyKey)
+		}, "has no BlockValidation policy"},
+		{"unknown orderer capability", func(t *testing.T, c *common.Config) {
+			_ = addValue(c.ChannelGroup.Groups[OrdererGroupKey], AdminsPolicyKey, CapabilitiesKey, CapabilitiesConfigValue([]string{"V2_5"}))
+		}, "capability [V2_5] of config group [/Channel/Orderer] is not supported"},
+		{"invalid batch size", func(t *testing.T, c *common.Config) {
+			_ = addValue(c.ChannelGroup.Groups[OrdererGroupKey], AdminsPolicyKey, BatchSizeKey, &orderer.BatchSize{MaxMessageCount: 10, AbsoluteMaxBytes: 1, PreferredMaxBytes: 2})
+		}, "invalid batch size"},
+		{"invalid batch timeout", func(t *testing.T, c *common.Config) {
+			_ = addValue(c.ChannelGroup.Groups[OrdererGroupKey], AdminsPolicyKey, BatchTimeoutKey, &orderer.BatchTimeout{Timeout: "2"})
+		}, "invalid batch timeout"},
+		{"solo consensus", func(t *testing.T, c *common.Config) {
+			modifyConsensusType(t, c, func(ct *orderer.ConsensusType, _ *etcdraft.ConfigMetadata) { ct.Type = "solo" })
+		}, "consensus type [solo] is not supported"},
+		{"maintenance mode", func(t *testing.T, c *common.Config) {
+			modifyConsensusType(t, c, func(ct *orderer.ConsensusType, _ *etcdraft.ConfigMetadata) {
+				ct.State = orderer.ConsensusType_STATE_MAINTENANCE
+			})
+		}, "consensus state must be"},
+		{"no consenters", func(t *testing.T, c *common.Config) {
+			modifyConsensusType(t, c, func(_ *orderer.ConsensusType, m *etcdraft.ConfigMetadata) { m.Consenters = nil })
+		}, "raft cluster has no consenters"},
+		{"invalid raft options", func(t *testing.T, c *common.Config) {
+			modifyConsensusType(t, c, func(_ *orderer.ConsensusType, m *etcdraft.ConfigMetadata) { m.Options.ElectionTick = 1 })
+		}, "ElectionTick"},
+		{"consenter defined twice", func(t *testing.T, c *common.Config) {
+			modifyConsensusType(t, c, func(_ *orderer.ConsensusType, m *etcdraft.ConfigMetadata) {
+				m.Consenters = append(m.Consenters, m.Consenters[0])
+			})
+		}, "is defined twice"},
+		{"consenter TLS certificate", func(t *testing.T, c *common.Config) {
+			modifyConsensusType(t, c, func(_ *orderer.ConsensusType, m *etcdraft.ConfigMetadata) {
+				m.Consenters[0].ServerTlsCert = []byte("not a certificate")
+			})
+		}, "server TLS certificate of consenter"},
+		{"no application organizations", func(t *testing.T, c *common.Config) {
+			c.ChannelGroup.Groups[ApplicationGroupKey].Groups = map[string]*common.ConfigGroup{}
+		}, "application group has no organizations"},
+		{"unknown application capability", func(t *testing.T, c *common.Config) {
+			_ = addValue(c.ChannelGroup.Groups[ApplicationGroupKey], AdminsPolicyKey, CapabilitiesKey, CapabilitiesConfigValue([]string{"V1_4_3"}))
+		}, "capability [V1_4_3] of config group [/Channel/Application] is not supported"},
+		{"ACL of an unknown policy", func(t *testing.T, c *common.Config) {
+			if err := NewConfigEditor(c).Application().SetACL("qscc/GetChainInfo", "Unknown"); err != nil {
+				t.Fatal(err)
+			}
+		}, "policy [/Channel/Application/Unknown] of ACL resource [qscc/GetChainInfo] does not exist"},
+		{"organization without MSP", func(t *testing.T, c *common.Config) {
+			delete(c.ChannelGroup.Groups[ApplicationGroupKey].Groups["Org1MSP"].Values, MSPKey)
+		}, "organization [Org1MSP] of the Application group has no MSP"},
+		{"MSP without root certificates", func(t *testing.T, c *common.Config) {
+			modifyMSP(t, c.ChannelGroup.Groups[ApplicationGroupKey].Groups["Org1MSP"], func(m *msp.FabricMSPConfig) { m.RootCerts = nil })
+		}, "msp [Org1MSP] has no root certificates"},
+		{"MSP defined twice", func(t *testing.T, c *common.Config) {
+			org := proto.Clone(c.ChannelGroup.Groups[ApplicationGroupKey].Groups["Org1MSP"]).(*common.ConfigGroup)
+			modifyMSP(t, org, func(m *msp.FabricMSPConfig) { m.Admins = m.RootCerts })
+			c.ChannelGroup.Groups[OrdererGroupKey].Groups["Org1MSP"] = org
+		}, "msp [Org1MSP] is defined twice"},
+		{"implicit meta policy without sub policy", func(t *testing.T, c *common.Config) {
+			if err := NewConfigEditor(c).SetPolicy("Application/Auditors", "ANY Auditors"); err != nil {
+				t.Fatal(err)
+			}
+		}, "refers to sub policy Auditors"},
+	}
+
+	if err = ValidateChannelConfig(original); err != nil {
+		t.Fatalf("expected the config to be valid: %s", err)
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := proto.Clone(original).(*common.Config)
+			test.modify(t, config)
+			err := ValidateChannelConfig(config)
+			if err == nil {
+				t.Fatal("expected the config to be invalid")
+			}
+			if !strings.Contains(err.Error(), test.errMsg) {
+				t.Fatalf("expected an error containing %q, got %s", test.errMsg, err)
+			}
+		})
+	}
+}
+
+func modifyConsensusType(t *testing.T, config *common.Config, modify func(consensusType *orderer.ConsensusType, metadata *etcdraft.ConfigMetadata)) {
+	ordererGroup := config.ChannelGroup.Groups[OrdererGroupKey]
+	consensusType := &orderer.ConsensusType{}
+	metadata := &etcdraft.ConfigMetadata{}
+	if err := proto.Unmarshal(ordererGroup.Values[ConsensusTypeKey].Value, consensusType); err != nil {
+		t.Fatal(err)
+	}
+	if err := proto.Unmarshal(consensusType.Metadata, metadata); err != nil {
+		t.Fatal(err)
+	}
+	modify(consensusType, metadata)
+	consensusType.Metadata = ProtoMarshalIgnoreError(metadata)
+	ordererGroup.Values[ConsensusTypeKey].Value = ProtoMarshalIgnoreError(consensusType)
+}
+
+func modifyMSP(t *testing.T, org *common.ConfigGroup, modify func(config *msp.FabricMSPConfig)) {
+	mspConfig := &msp.MSPConfig{}
+	fabricMSPConfig := &msp.FabricMSPConfig{}
+	if err := proto.Unmarshal(org.Values[MSPKey].Value, mspConfig); err != nil {
+		t.Fatal(err)
+	}
+	if err := proto.Unmarshal(mspConfig.Config, fabricMSPConfig); err != nil {
+		t.Fatal(err)
+	}
+	modify(fabricMSPConfig)
+	mspConfig.Config = ProtoMarshalIgnoreError(fabricMSPConfig)
+	org.Values[MSPKey].Value = ProtoMarshalIgnoreError(mspConfig)
+}
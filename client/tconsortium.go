@@ -81,7 +81,9 @@ func (p *Consortium) BuildConfigGroup() (*common.ConfigGroup, error) {
 	}
 
 	var addresses []string
-	if p.OrdererEndpoints != nil {
+	if p.OrdererEndpoints != nil && len(p.OrdererEndpoints.Addresses) > 0 {
+		addresses = p.OrdererEndpoints.Addresses
+	} else if p.OrdererEndpoints != nil {
 		for _, o := range p.OrdererEndpoints.Orderers {
 			address := o.Host + ":" + strconv.Itoa(int(o.Port))
 			addresses = append(addresses, address)
@@ -1,12 +1,17 @@
 package client
 
 import (
+	"encoding/pem"
 	"fmt"
 	"github.com/feng081212/fabric-sdk-go/fabric/bccsp/hasher"
 	"github.com/feng081212/fabric-sdk-go/fabric/bccsp/sw"
 	"github.com/feng081212/fabric-sdk-go/fabric/crypto/certs"
 	"github.com/golang/protobuf/proto"
 	"github.com/feng081212/fabric-protos-go/msp"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 )
 
 type OUIdentifier struct {
@@ -162,3 +167,140 @@ func (p *MspConfig) BuildMspConfig() (*msp.MSPConfig, error) {
 
 	return &msp.MSPConfig{Config: fabricMpsJs, Type: 0}, nil
 }
+
+// LoadMspConfig reads the MSP directory of an organization, as written by cryptogen or the Fabric
+// CA client: the PEM files of cacerts, intermediatecerts, admincerts, tlscacerts,
+// tlsintermediatecerts and crls, and the NodeOUs of config.yaml
+func LoadMspConfig(mspID, mspDir string) (*MspConfig, error) {
+	mspConfig := &MspConfig{MspID: mspID}
+
+	dirs := []struct {
+		name  string
+		certs *[]string
+	}{
+		{"cacerts", &mspConfig.Cacerts},
+		{"intermediatecerts", &mspConfig.Intermediatecerts},
+		{"admincerts", &mspConfig.AdminCerts},
+		{"tlscacerts", &mspConfig.TlsCACerts},
+		{"tlsintermediatecerts", &mspConfig.TlsIntermediateCerts},
+		{"crls", &mspConfig.Crls},
+	}
+	for _, dir := range dirs {
+		pems, e := readPemDir(filepath.Join(mspDir, dir.name))
+		if e != nil {
+			return nil, fmt.Errorf("load %s error with msp[%s] : %v", dir.name, mspID, e)
+		}
+		*dir.certs = pems
+	}
+	if len(mspConfig.Cacerts) == 0 {
+		return nil, fmt.Errorf("msp[%s] has no cacerts in %s", mspID, mspDir)
+	}
+
+	bs, e := ioutil.ReadFile(filepath.Join(mspDir, "config.yaml"))
+	if os.IsNotExist(e) {
+		return mspConfig, nil
+	}
+	if e != nil {
+		return nil, fmt.Errorf("read config.yaml error with msp[%s] : %v", mspID, e)
+	}
+
+	conf := &struct {
+		OrganizationalUnitIdentifiers []*mspOUIdentifierYAML `yaml:"OrganizationalUnitIdentifiers"`
+		NodeOUs                       *struct {
+			Enable              bool                 `yaml:"Enable"`
+			ClientOUIdentifier  *mspOUIdentifierYAML `yaml:"ClientOUIdentifier"`
+			PeerOUIdentifier    *mspOUIdentifierYAML `yaml:"PeerOUIdentifier"`
+			AdminOUIdentifier   *mspOUIdentifierYAML `yaml:"AdminOUIdentifier"`
+			OrdererOUIdentifier *mspOUIdentifierYAML `yaml:"OrdererOUIdentifier"`
+		} `yaml:"NodeOUs"`
+	}{}
+	if e = yaml.Unmarshal(bs, conf); e != nil {
+		return nil, fmt.Errorf("parse config.yaml error with msp[%s] : %v", mspID, e)
+	}
+
+	for _, oui := range conf.OrganizationalUnitIdentifiers {
+		cert, e := oui.readCertificate(mspDir)
+		if e != nil {
+			return nil, fmt.Errorf("load ouid [%s] error with msp[%s] : %v", oui.OrganizationalUnitIdentifier, mspID, e)
+		}
+		mspConfig.OUIdentifiers = append(mspConfig.OUIdentifiers, &OUIdentifier{
+			OrganizationUnitIdentifier: oui.OrganizationalUnitIdentifier,
+			Certificate:                cert,
+		})
+	}
+
+	if conf.NodeOUs != nil && conf.NodeOUs.Enable {
+		nodeOUs := &NodeOUs{Enable: true}
+		ous := []struct {
+			conf       *mspOUIdentifierYAML
+			identifier *string
+			cert       *string
+		}{
+			{conf.NodeOUs.ClientOUIdentifier, &nodeOUs.ClientOUIdentifier, &nodeOUs.ClientOUIdentifierCert},
+			{conf.NodeOUs.PeerOUIdentifier, &nodeOUs.PeerOUIdentifier, &nodeOUs.PeerOUIdentifierCert},
+			{conf.NodeOUs.AdminOUIdentifier, &nodeOUs.AdminOUIdentifier, &nodeOUs.AdminOUIdentifierCert},
+			{conf.NodeOUs.OrdererOUIdentifier, &nodeOUs.OrdererOUIdentifier, &nodeOUs.OrdererOUIdentifierCert},
+		}
+		for _, ou := range ous {
+			if ou.conf == nil {
+				continue
+			}
+			cert, e := ou.conf.readCertificate(mspDir)
+			if e != nil {
+				return nil, fmt.Errorf("load node ou [%s] error with msp[%s] : %v", ou.conf.OrganizationalUnitIdentifier, mspID, e)
+			}
+			*ou.identifier, *ou.cert = ou.conf.OrganizationalUnitIdentifier, cert
+		}
+		mspConfig.NodeOUs = nodeOUs
+	}
+
+	return mspConfig, nil
+}
+
+type mspOUIdentifierYAML struct {
+	Certificate                  string `yaml:"Certificate"`
+	OrganizationalUnitIdentifier string `yaml:"OrganizationalUnitIdentifier"`
+}
+
+// readCertificate reads the certificate, its path is relative to the MSP directory
+func (p *mspOUIdentifierYAML) readCertificate(mspDir string) (string, error) {
+	if p.Certificate == "" {
+		return "", nil
+	}
+	path := p.Certificate
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(mspDir, path)
+	}
+	bs, e := ioutil.ReadFile(path)
+	if e != nil {
+		return "", e
+	}
+	return string(bs), nil
+}
+
+// readPemDir reads the PEM files of the directory in name order, a missing directory has no files.
+// Like the msp of Fabric, files that are not PEM encoded are skipped.
+func readPemDir(dir string) ([]string, error) {
+	files, e := ioutil.ReadDir(dir)
+	if os.IsNotExist(e) {
+		return nil, nil
+	}
+	if e != nil {
+		return nil, e
+	}
+	var pems []string
+	for _, file := range files {
+		if file.IsDir() {
+			continue
+		}
+		bs, e := ioutil.ReadFile(filepath.Join(dir, file.Name()))
+		if e != nil {
+			return nil, e
+		}
+		if block, _ := pem.Decode(bs); block == nil {
+			continue
+		}
+		pems = append(pems, string(bs))
+	}
+	return pems, nil
+}
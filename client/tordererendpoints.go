@@ -45,6 +45,17 @@ func DefaultOrdererEndpoints() *OrdererEndpoints {
 		},
 		Capabilities: []string{"V2_0"},
 		Policies:     make(map[string]*Policy),
+		RaftOptions:  DefaultRaftOptions(),
+	}
+}
+
+func DefaultRaftOptions() *etcdraft.Options {
+	return &etcdraft.Options{
+		TickInterval:         "500ms",
+		ElectionTick:         10,
+		HeartbeatTick:        1,
+		MaxInflightBlocks:    5,
+		SnapshotIntervalSize: 16 * 1024 * 1024, // 16 MB
 	}
 }
 
@@ -56,6 +67,11 @@ type OrdererEndpoints struct {
 	BatchSize           *orderer.BatchSize
 	BatchTimeout        *orderer.BatchTimeout
 	ChannelRestrictions *orderer.ChannelRestrictions
+	// RaftOptions are the options of the Raft cluster, DefaultRaftOptions if nil
+	RaftOptions *etcdraft.Options
+	// Addresses are the global orderer addresses of the channel, the addresses of the Orderers
+	// are used when empty
+	Addresses []string
 }
 
 func (p *OrdererEndpoints) AddPolicy(name, rule string) {
@@ -112,15 +128,14 @@ func (p *OrdererEndpoints) BuildConfigGroup() (*common.ConfigGroup, error) {
 }
 
 func GetConsensusType(ordererEndpoints *OrdererEndpoints) (*orderer.ConsensusType, error) {
-	raftConfigMetadata := &etcdraft.ConfigMetadata{
-		Options: &etcdraft.Options{
-			TickInterval:         "500ms",
-			ElectionTick:         10,
-			HeartbeatTick:        1,
-			MaxInflightBlocks:    5,
-			SnapshotIntervalSize: 16 * 1024 * 1024, // 16 MB
-		},
+	options := ordererEndpoints.RaftOptions
+	if options == nil {
+		options = DefaultRaftOptions()
+	} else if e := ValidateRaftOptions(options); e != nil {
+		return nil, e
 	}
+
+	raftConfigMetadata := &etcdraft.ConfigMetadata{Options: options}
 	for _, o := range ordererEndpoints.Orderers {
 		consenter, e := o.GetRaftConsenter()
 		if e != nil {
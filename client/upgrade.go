@@ -0,0 +1,358 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/feng081212/fabric-protos-go/peer"
+	"github.com/feng081212/fabric-sdk-go/fabric/configtxlator"
+	"github.com/feng081212/fabric-sdk-go/fabric/errors/status"
+	"github.com/golang/protobuf/proto"
+	"github.com/pkg/errors"
+)
+
+// fields of a chaincode definition reported by DefinitionChange
+const (
+	DefinitionFieldVersion           = "Version"
+	DefinitionFieldPackage           = "Package"
+	DefinitionFieldEndorsementPlugin = "EndorsementPlugin"
+	DefinitionFieldValidationPlugin  = "ValidationPlugin"
+	DefinitionFieldPolicy            = "Policy"
+	DefinitionFieldCollections       = "Collections"
+	DefinitionFieldInitRequired      = "InitRequired"
+)
+
+// the values the peer uses for the fields left empty in a definition
+const (
+	defaultEndorsementPlugin    = "escc"
+	defaultValidationPlugin     = "vscc"
+	defaultEndorsementPolicyRef = "/Channel/Application/Endorsement"
+)
+
+// defaultUpgradeCommitTimeout bounds the wait for the approvals of Commit
+const defaultUpgradeCommitTimeout = 5 * time.Minute
+
+// notApprovedPattern matches the answer of the peer to QueryApprovedChaincodeDefinition when the
+// organization did not approve the sequence
+var notApprovedPattern = regexp.MustCompile(`could not fetch approved chaincode definition`)
+
+// DefinitionChange is a field that differs between two chaincode definitions
+type DefinitionChange struct {
+	Field    string
+	Current  string
+	Proposed string
+}
+
+// OrganizationApproval is the approval of an organization for the sequence of an upgrade plan
+type OrganizationApproval struct {
+	MspID    string
+	Approved bool
+	// PackageID is the package the organization approved, packages may differ between organizations
+	PackageID string
+	// Mismatches are the fields of the approved definition that differ from the plan
+	Mismatches []*DefinitionChange
+}
+
+// ChaincodeUpgradePlan is the next definition of a committed chaincode and how it differs from
+// the committed one. A plan for a chaincode that was never committed has sequence 1.
+type ChaincodeUpgradePlan struct {
+	ChannelID string
+	// CurrentSequence is 0 when the chaincode was never committed
+	CurrentSequence int64
+	// CurrentPackageID is the package the organization of the planning peer approved for the
+	// current sequence, it is empty when unknown
+	CurrentPackageID string
+	PackageID        string
+	// Definition is the proposed definition, its Sequence is the one following CurrentSequence
+	Definition *CommitChaincodeRequest
+	Changes    []*DefinitionChange
+	// PollInterval is the interval between two approval checks of Commit, 2s by default
+	PollInterval time.Duration
+}
+
+// chaincodeDefinitionFields are the fields of a definition the organizations must agree on, with
+// the defaults of the peer applied
+type chaincodeDefinitionFields struct {
+	version             string
+	endorsementPlugin   string
+	validationPlugin    string
+	validationParameter []byte
+	collections         *peer.CollectionConfigPackage
+	initRequired        bool
+}
+
+func (p *PeerClient) PlanChaincodeUpgrade(channelID string, definition *CommitChaincodeRequest, packageID string) (*ChaincodeUpgradePlan, error) {
+	return p.PlanChaincodeUpgradeContext(context.Background(), channelID, definition, packageID)
+}
+
+// PlanChaincodeUpgradeContext reads the committed definition of the chaincode and returns the plan
+// to replace it with definition, whose Sequence is ignored. packageID is the package the
+// organization of the peer will approve.
+func (p *PeerClient) PlanChaincodeUpgradeContext(ctx context.Context, channelID string, definition *CommitChaincodeRequest, packageID string, opts ...RequestOption) (*ChaincodeUpgradePlan, error) {
+	if definition == nil || definition.Name == "" {
+		return nil, errors.New("chaincode definition with a name is required")
+	}
+	proposed, e := newDefinitionFields(definition)
+	if e != nil {
+		return nil, e
+	}
+
+	committed, e := p.QueryCommittedOfChannelContext(ctx, channelID, opts...)
+	if e != nil {
+		return nil, errors.WithMessagef(e, "query committed chaincodes of channel %s failed", channelID)
+	}
+
+	plan := &ChaincodeUpgradePlan{ChannelID: channelID, PackageID: packageID}
+	current := &chaincodeDefinitionFields{}
+	for _, d := range committed.ChaincodeDefinitions {
+		if d.Name == definition.Name {
+			plan.CurrentSequence = d.Sequence
+			current = normalizeDefinitionFields(&chaincodeDefinitionFields{d.Version, d.EndorsementPlugin,
+				d.ValidationPlugin, d.ValidationParameter, d.Collections, d.InitRequired})
+		}
+	}
+
+	// the package of the current sequence is only known by the organizations, from their approval
+	if plan.CurrentSequence > 0 {
+		approved, e := p.QueryApprovedChaincodeDefinitionContext(ctx, channelID, definition.Name, plan.CurrentSequence, opts...)
+		switch {
+		case e == nil:
+			plan.CurrentPackageID = approved.GetSource().GetLocalPackage().GetPackageId()
+		case !isNotApproved(e):
+			return nil, errors.WithMessagef(e, "query approved definition of chaincode %s failed", definition.Name)
+		}
+	}
+
+	next := *definition
+	next.Sequence = plan.CurrentSequence + 1
+	plan.Definition = &next
+
+	if plan.CurrentPackageID != packageID {
+		plan.Changes = append(plan.Changes, &DefinitionChange{Field: DefinitionFieldPackage, Current: plan.CurrentPackageID, Proposed: packageID})
+	}
+	plan.Changes = append(plan.Changes, diffDefinitionFields(current, proposed)...)
+
+	return plan, nil
+}
+
+// String returns the report of the plan, each changed field followed by its current and proposed
+// value
+func (p *ChaincodeUpgradePlan) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "chaincode %s on channel %s: sequence %d -> %d\n", p.Definition.Name, p.ChannelID, p.CurrentSequence, p.Definition.Sequence)
+	if len(p.Changes) == 0 {
+		b.WriteString("no changes\n")
+	}
+	for _, c := range p.Changes {
+		fmt.Fprintf(&b, "%s\n\t- %s\n\t+ %s\n", c.Field, c.Current, c.Proposed)
+	}
+	return b.String()
+}
+
+// Approvals queries the approval of each organization for the sequence of the plan on the first
+// peer of the organization and compares it with the planned definition. An organization that did
+// not approve the sequence is not an error, any other failure of the query is.
+func (p *ChaincodeUpgradePlan) Approvals(ctx context.Context, organizations []*DeploymentOrganization) ([]*OrganizationApproval, error) {
+	proposed, e := newDefinitionFields(p.Definition)
+	if e != nil {
+		return nil, e
+	}
+
+	approvals := make([]*OrganizationApproval, 0, len(organizations))
+	for i, org := range organizations {
+		if org.Signer == nil || len(org.Peers) == 0 {
+			return nil, errors.Errorf("organization %d needs a signer and a peer", i)
+		}
+		approval := &OrganizationApproval{}
+		if approval.MspID, e = org.mspID(); e != nil {
+			return nil, e
+		}
+		approvals = append(approvals, approval)
+
+		peerClient := &PeerClient{Peer: org.Peers[0], Signer: org.Signer}
+		approved, e := peerClient.QueryApprovedChaincodeDefinitionContext(ctx, p.ChannelID, p.Definition.Name, p.Definition.Sequence)
+		if isNotApproved(e) {
+			continue
+		}
+		if e != nil {
+			return nil, errors.WithMessagef(e, "query approval of %s failed", approval.MspID)
+		}
+		approval.Approved = true
+		approval.PackageID = approved.GetSource().GetLocalPackage().GetPackageId()
+		approval.Mismatches = diffDefinitionFields(normalizeDefinitionFields(&chaincodeDefinitionFields{approved.Version,
+			approved.EndorsementPlugin, approved.ValidationPlugin, approved.ValidationParameter, approved.Collections,
+			approved.InitRequired}), proposed)
+	}
+	return approvals, nil
+}
+
+// Commit is CommitContext with a timeout of 5 minutes
+func (p *ChaincodeUpgradePlan) Commit(organizations []*DeploymentOrganization, orderer *OrdererClient) (*TransactionResult, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultUpgradeCommitTimeout)
+	defer cancel()
+	return p.CommitContext(ctx, organizations, orderer)
+}
+
+// CommitContext waits until every organization approved exactly the planned definition and
+// commits it, the first peer of the first organization is the committer. ctx bounds the wait, the
+// error then lists the organizations that did not converge.
+func (p *ChaincodeUpgradePlan) CommitContext(ctx context.Context, organizations []*DeploymentOrganization, orderer *OrdererClient) (*TransactionResult, error) {
+	if len(organizations) == 0 {
+		return nil, errors.New("at least one organization is required")
+	}
+	if orderer == nil {
+		return nil, errors.New("orderer client is required")
+	}
+
+	interval := p.PollInterval
+	if interval <= 0 {
+		interval = defaultDeploymentPollInterval
+	}
+
+	for {
+		approvals, e := p.Approvals(ctx, organizations)
+		if e != nil {
+			return nil, e
+		}
+		pending := pendingApprovals(approvals)
+		if len(pending) == 0 {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, errors.Wrapf(ctx.Err(), "approvals of chaincode %s sequence %d did not converge: %s",
+				p.Definition.Name, p.Definition.Sequence, strings.Join(pending, "; "))
+		case <-time.After(interval):
+		}
+	}
+
+	res, e := lifecycleEndorsers(organizations, orderer).CommitChainCodeAndWait(ctx, p.ChannelID, p.Definition, organizations[0].Peers[0])
+	if e != nil {
+		return res, errors.WithMessagef(e, "commit chaincode %s failed", p.Definition.Name)
+	}
+	return res, nil
+}
+
+// isNotApproved tells if the error is the answer of the peer for a sequence the organization did
+// not approve
+func isNotApproved(err error) bool {
+	s, ok := status.FromError(err)
+	return ok && err != nil && s.Group == status.ChaincodeStatus && notApprovedPattern.MatchString(s.Message)
+}
+
+// pendingApprovals describes the organizations that did not approve the planned definition
+func pendingApprovals(approvals []*OrganizationApproval) []string {
+	var pending []string
+	for _, a := range approvals {
+		switch {
+		case !a.Approved:
+			pending = append(pending, a.MspID+" did not approve")
+		case len(a.Mismatches) > 0:
+			fields := make([]string, 0, len(a.Mismatches))
+			for _, m := range a.Mismatches {
+				fields = append(fields, fmt.Sprintf("%s is %s instead of %s", m.Field, m.Current, m.Proposed))
+			}
+			pending = append(pending, a.MspID+" approved a different definition: "+strings.Join(fields, ", "))
+		}
+	}
+	return pending
+}
+
+func newDefinitionFields(definition *CommitChaincodeRequest) (*chaincodeDefinitionFields, error) {
+	applicationPolicy, e := CreatePolicyBytes(definition.SignaturePolicy, definition.ChannelConfigPolicy)
+	if e != nil {
+		return nil, e
+	}
+	fields := &chaincodeDefinitionFields{
+		version:           definition.Version,
+		endorsementPlugin: definition.EndorsementPlugin,
+		validationPlugin:  definition.ValidationPlugin,
+		collections:       &peer.CollectionConfigPackage{Config: definition.CollectionConfig},
+		initRequired:      definition.InitRequired,
+	}
+	if applicationPolicy != nil {
+		fields.validationParameter = ProtoMarshalIgnoreError(applicationPolicy)
+	}
+	return normalizeDefinitionFields(fields), nil
+}
+
+// normalizeDefinitionFields applies the defaults of the peer to the empty fields
+func normalizeDefinitionFields(fields *chaincodeDefinitionFields) *chaincodeDefinitionFields {
+	if fields.endorsementPlugin == "" {
+		fields.endorsementPlugin = defaultEndorsementPlugin
+	}
+	if fields.validationPlugin == "" {
+		fields.validationPlugin = defaultValidationPlugin
+	}
+	if len(fields.validationParameter) == 0 {
+		fields.validationParameter = ProtoMarshalIgnoreError(&peer.ApplicationPolicy{
+			Type: &peer.ApplicationPolicy_ChannelConfigPolicyReference{
+				ChannelConfigPolicyReference: defaultEndorsementPolicyRef,
+			},
+		})
+	}
+	if fields.collections == nil {
+		fields.collections = &peer.CollectionConfigPackage{}
+	}
+	return fields
+}
+
+func diffDefinitionFields(current, proposed *chaincodeDefinitionFields) []*DefinitionChange {
+	var changes []*DefinitionChange
+	add := func(field, current, proposed string) {
+		changes = append(changes, &DefinitionChange{Field: field, Current: current, Proposed: proposed})
+	}
+
+	if current.version != proposed.version {
+		add(DefinitionFieldVersion, current.version, proposed.version)
+	}
+	if current.endorsementPlugin != proposed.endorsementPlugin {
+		add(DefinitionFieldEndorsementPlugin, current.endorsementPlugin, proposed.endorsementPlugin)
+	}
+	if current.validationPlugin != proposed.validationPlugin {
+		add(DefinitionFieldValidationPlugin, current.validationPlugin, proposed.validationPlugin)
+	}
+	currentPolicy, proposedPolicy := &peer.ApplicationPolicy{}, &peer.ApplicationPolicy{}
+	currentErr := proto.Unmarshal(current.validationParameter, currentPolicy)
+	proposedErr := proto.Unmarshal(proposed.validationParameter, proposedPolicy)
+	if currentErr != nil || proposedErr != nil || !proto.Equal(currentPolicy, proposedPolicy) {
+		add(DefinitionFieldPolicy, describeApplicationPolicy(current.validationParameter), describeApplicationPolicy(proposed.validationParameter))
+	}
+	if !proto.Equal(current.collections, proposed.collections) {
+		add(DefinitionFieldCollections, describeCollections(current.collections), describeCollections(proposed.collections))
+	}
+	if current.initRequired != proposed.initRequired {
+		add(DefinitionFieldInitRequired, fmt.Sprint(current.initRequired), fmt.Sprint(proposed.initRequired))
+	}
+	return changes
+}
+
+func describeApplicationPolicy(validationParameter []byte) string {
+	policy := &peer.ApplicationPolicy{}
+	if e := proto.Unmarshal(validationParameter, policy); e != nil {
+		return fmt.Sprintf("invalid policy %x", validationParameter)
+	}
+	if ref := policy.GetChannelConfigPolicyReference(); ref != "" {
+		return ref
+	}
+	bs, e := configtxlator.MarshalJSON(policy.GetSignaturePolicy())
+	if e != nil {
+		return fmt.Sprintf("invalid policy %x", validationParameter)
+	}
+	return compactJSON(bs)
+}
+
+func describeCollections(collections *peer.CollectionConfigPackage) string {
+	if len(collections.Config) == 0 {
+		return "none"
+	}
+	bs, e := configtxlator.MarshalJSON(collections)
+	if e != nil {
+		return fmt.Sprintf("%d collections", len(collections.Config))
+	}
+	return compactJSON(bs)
+}
@@ -0,0 +1,61 @@
+package client
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/feng081212/fabric-protos-go/peer"
+	"github.com/feng081212/fabric-protos-go/peer/lifecycle"
+	"github.com/feng081212/fabric-sdk-go/fabric/endpoints"
+)
+
+func TestUpgradePlanApprovals(t *testing.T) {
+	plan := &ChaincodeUpgradePlan{
+		ChannelID:  "mychannel",
+		PackageID:  "cc_2:abc",
+		Definition: &CommitChaincodeRequest{Name: "cc", Version: "2", Sequence: 2},
+	}
+
+	approved := startEndorserServer(t, &peer.Response{Status: 200, Payload: ProtoMarshalIgnoreError(&lifecycle.QueryApprovedChaincodeDefinitionResult{
+		Version: "2",
+		Source: &lifecycle.ChaincodeSource{Type: &lifecycle.ChaincodeSource_LocalPackage{
+			LocalPackage: &lifecycle.ChaincodeSource_Local{PackageId: "cc_2:abc"},
+		}},
+	})})
+	otherVersion := startEndorserServer(t, &peer.Response{Status: 200, Payload: ProtoMarshalIgnoreError(&lifecycle.QueryApprovedChaincodeDefinitionResult{
+		Version: "1",
+	})})
+	notApproved := startEndorserServer(t, &peer.Response{Status: 500, Message: "failed to invoke backing implementation of " +
+		"'QueryApprovedChaincodeDefinition': could not fetch approved chaincode definition (name: 'cc', sequence: '2') on channel 'mychannel'"})
+	denied := startEndorserServer(t, &peer.Response{Status: 500, Message: "access denied for [QueryApprovedChaincodeDefinition]"})
+
+	organizations := []*DeploymentOrganization{
+		{MspID: "Org1MSP", Peers: []*endpoints.Peer{approved}, Signer: &testSigner{}},
+		{MspID: "Org2MSP", Peers: []*endpoints.Peer{otherVersion}, Signer: &testSigner{}},
+		{MspID: "Org3MSP", Peers: []*endpoints.Peer{notApproved}, Signer: &testSigner{}},
+	}
+	approvals, err := plan.Approvals(context.Background(), organizations)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !approvals[0].Approved || approvals[0].PackageID != "cc_2:abc" || len(approvals[0].Mismatches) != 0 {
+		t.Errorf("expected Org1MSP to approve the planned definition, got %+v", approvals[0])
+	}
+	if !approvals[1].Approved || len(approvals[1].Mismatches) != 1 || approvals[1].Mismatches[0].Field != DefinitionFieldVersion {
+		t.Errorf("expected Org2MSP to approve another version, got %+v", approvals[1])
+	}
+	if approvals[2].Approved {
+		t.Errorf("expected Org3MSP not to approve, got %+v", approvals[2])
+	}
+	if pending := pendingApprovals(approvals); len(pending) != 2 {
+		t.Errorf("expected 2 pending approvals, got %v", pending)
+	}
+
+	organizations = append(organizations, &DeploymentOrganization{MspID: "Org4MSP", Peers: []*endpoints.Peer{denied}, Signer: &testSigner{}})
+	_, err = plan.Approvals(context.Background(), organizations)
+	if err == nil || !strings.Contains(err.Error(), "access denied") {
+		t.Fatalf("expected the failed query of Org4MSP to be returned, got %v", err)
+	}
+}
@@ -0,0 +1,220 @@
+package grpcutils
+
+import (
+	"context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
+	"sync"
+	"time"
+)
+
+// DefaultConnIdleTimeout is how long an unused connection stays in the cache before it is closed
+const DefaultConnIdleTimeout = 2 * time.Minute
+
+// DefaultConnectionCache is the cache used by GetConn and ReleaseConn
+var DefaultConnectionCache = NewConnectionCache(DefaultConnIdleTimeout)
+
+type cachedConn struct {
+	key      string
+	conn     *grpc.ClientConn
+	refs     int
+	lastUsed time.Time
+	// evicted is set when the connection has been removed from the cache while it was still
+	// in use, it is closed as soon as the last reference is released
+	evicted bool
+}
+
+// ConnectionCache shares gRPC connections between calls to the same target so that the TLS
+// handshake is paid once per target instead of once per call. Connections are reference
+// counted, closed after being idle for the idle timeout and replaced when they are found
+// in the TRANSIENT_FAILURE or SHUTDOWN state.
+type ConnectionCache struct {
+	idleTimeout time.Duration
+	mutex       sync.Mutex
+	byKey       map[string]*cachedConn
+	byConn      map[*grpc.ClientConn]*cachedConn
+	stop        chan struct{}
+}
+
+func NewConnectionCache(idleTimeout time.Duration) *ConnectionCache {
+	if idleTimeout <= 0 {
+		idleTimeout = DefaultConnIdleTimeout
+	}
+	return &ConnectionCache{
+		idleTimeout: idleTimeout,
+		byKey:       make(map[string]*cachedConn),
+		byConn:      make(map[*grpc.ClientConn]*cachedConn),
+	}
+}
+
+// Get returns the cached connection for the key, dialing the target when there is none or the
+// cached one is unhealthy. The key must identify the target together with everything in opts
+// that affects the connection, such as the TLS configuration. Every connection returned by
+// Get must be handed back with Release.
+func (c *ConnectionCache) Get(ctx context.Context, key string, target string, opts ...grpc.DialOption) (*grpc.ClientConn, error) {
+	if conn := c.acquire(key); conn != nil {
+		return conn, nil
+	}
+
+	conn, err := DialContext(ctx, target, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	// another caller may have dialed the same target in the meantime
+	if entry, ok := c.byKey[key]; ok && healthy(entry.conn) {
+		entry.refs++
+		closeConn(conn)
+		return entry.conn, nil
+	}
+
+	c.evictLocked(key)
+	entry := &cachedConn{key: key, conn: conn, refs: 1}
+	c.byKey[key] = entry
+	c.byConn[conn] = entry
+	c.startJanitorLocked()
+
+	return conn, nil
+}
+
+// Release hands back a connection obtained from Get. Connections that are not managed by
+// the cache are closed.
+func (c *ConnectionCache) Release(conn *grpc.ClientConn) {
+	if conn == nil {
+		return
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	entry, ok := c.byConn[conn]
+	if !ok {
+		closeConn(conn)
+		return
+	}
+
+	entry.refs--
+	entry.lastUsed = time.Now()
+	if entry.refs <= 0 && (entry.evicted || !healthy(conn)) {
+		c.removeLocked(entry)
+	}
+}
+
+// Close closes all connections of the cache, including the ones that are still in use
+func (c *ConnectionCache) Close() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.stop != nil {
+		close(c.stop)
+		c.stop = nil
+	}
+	for _, entry := range c.byConn {
+		closeConn(entry.conn)
+	}
+	c.byKey = make(map[string]*cachedConn)
+	c.byConn = make(map[*grpc.ClientConn]*cachedConn)
+}
+
+func (c *ConnectionCache) acquire(key string) *grpc.ClientConn {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	entry, ok := c.byKey[key]
+	if !ok {
+		return nil
+	}
+	if !healthy(entry.conn) {
+		logger.Debugf("evicting unhealthy connection [%s] in state %s", key, entry.conn.GetState())
+		c.evictLocked(key)
+		return nil
+	}
+	entry.refs++
+	return entry.conn
+}
+
+// evictLocked removes the connection of the key from the cache, it is closed right away when
+// it is not in use
+func (c *ConnectionCache) evictLocked(key string) {
+	entry, ok := c.byKey[key]
+	if !ok {
+		return
+	}
+	delete(c.byKey, key)
+	entry.evicted = true
+	if entry.refs <= 0 {
+		c.removeLocked(entry)
+	}
+}
+
+func (c *ConnectionCache) removeLocked(entry *cachedConn) {
+	if current, ok := c.byKey[entry.key]; ok && current == entry {
+		delete(c.byKey, entry.key)
+	}
+	delete(c.byConn, entry.conn)
+	closeConn(entry.conn)
+}
+
+func (c *ConnectionCache) startJanitorLocked() {
+	if c.stop != nil {
+		return
+	}
+	c.stop = make(chan struct{})
+	go c.janitor(c.stop)
+}
+
+// janitor closes idle and unhealthy connections, it stops once the cache is empty
+func (c *ConnectionCache) janitor(stop chan struct{}) {
+	interval := c.idleTimeout / 2
+	if interval < time.Second {
+		interval = time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case now := <-ticker.C:
+			c.mutex.Lock()
+			for _, entry := range c.byConn {
+				if entry.refs > 0 {
+					continue
+				}
+				if now.Sub(entry.lastUsed) >= c.idleTimeout || !healthy(entry.conn) {
+					logger.Debugf("closing idle connection [%s]", entry.key)
+					c.removeLocked(entry)
+				}
+			}
+			if len(c.byConn) == 0 && c.stop == stop {
+				close(c.stop)
+				c.stop = nil
+			}
+			c.mutex.Unlock()
+		}
+	}
+}
+
+func healthy(conn *grpc.ClientConn) bool {
+	switch conn.GetState() {
+	case connectivity.TransientFailure, connectivity.Shutdown:
+		return false
+	default:
+		return true
+	}
+}
+
+func closeConn(conn *grpc.ClientConn) {
+	if err := conn.Close(); err != nil {
+		logger.Debugf("unable to close connection [%s]", err)
+	}
+}
+
+// GetConn returns a connection to the target from the DefaultConnectionCache
+func GetConn(ctx context.Context, key string, target string, opts ...grpc.DialOption) (*grpc.ClientConn, error) {
+	return DefaultConnectionCache.Get(ctx, key, target, opts...)
+}
@@ -0,0 +1,195 @@
+package grpcutils
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
+)
+
+func startServer(t *testing.T) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := grpc.NewServer()
+	go func() { _ = server.Serve(listener) }()
+	t.Cleanup(server.Stop)
+	return listener.Addr().String()
+}
+
+func getConn(t *testing.T, cache *ConnectionCache, key, target string) *grpc.ClientConn {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	conn, err := cache.Get(ctx, key, target, grpc.WithInsecure())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return conn
+}
+
+func (c *ConnectionCache) size() (int, int) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return len(c.byKey), len(c.byConn)
+}
+
+func (c *ConnectionCache) janitorRunning() bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.stop != nil
+}
+
+func waitFor(t *testing.T, timeout time.Duration, condition func() bool) {
+	deadline := time.Now().Add(timeout)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met in time")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestConnectionCacheSharesConnections(t *testing.T) {
+	target := startServer(t)
+	cache := NewConnectionCache(time.Minute)
+	defer cache.Close()
+
+	first := getConn(t, cache, "a", target)
+	second := getConn(t, cache, "a", target)
+	if first != second {
+		t.Fatal("expected the connection to be shared for the same key")
+	}
+	other := getConn(t, cache, "b", target)
+	if other == first {
+		t.Fatal("expected a separate connection for another key")
+	}
+
+	cache.Release(first)
+	cache.Release(second)
+	cache.Release(other)
+	if state := first.GetState(); state == connectivity.Shutdown {
+		t.Fatal("released connection must stay cached until it is idle")
+	}
+	if again := getConn(t, cache, "a", target); again != first {
+		t.Fatal("expected the released connection to be reused")
+	}
+}
+
+func TestConnectionCacheEvictsUnhealthyConnections(t *testing.T) {
+	target := startServer(t)
+	cache := NewConnectionCache(time.Minute)
+	defer cache.Close()
+
+	first := getConn(t, cache, "a", target)
+	_ = first.Close()
+
+	second := getConn(t, cache, "a", target)
+	if second == first {
+		t.Fatal("expected a new connection after the cached one was shut down")
+	}
+	cache.Release(first)
+	cache.Release(second)
+
+	if keys, conns := cache.size(); keys != 1 || conns != 1 {
+		t.Fatalf("expected 1 cached connection, got %d keys and %d connections", keys, conns)
+	}
+}
+
+func TestConnectionCacheClosesEvictedConnectionOnLastRelease(t *testing.T) {
+	target := startServer(t)
+	cache := NewConnectionCache(time.Minute)
+	defer cache.Close()
+
+	conn := getConn(t, cache, "a", target)
+
+	cache.mutex.Lock()
+	cache.evictLocked("a")
+	cache.mutex.Unlock()
+
+	if conn.GetState() == connectivity.Shutdown {
+		t.Fatal("evicted connection must stay open while it is in use")
+	}
+	cache.Release(conn)
+	if conn.GetState() != connectivity.Shutdown {
+		t.Fatal("evicted connection must be closed on the last release")
+	}
+}
+
+func TestConnectionCacheReleaseUnmanagedConnection(t *testing.T) {
+	target := startServer(t)
+	cache := NewConnectionCache(time.Minute)
+	defer cache.Close()
+
+	conn, err := DialContext(context.Background(), target, grpc.WithInsecure())
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache.Release(conn)
+	if conn.GetState() != connectivity.Shutdown {
+		t.Fatal("expected a connection not managed by the cache to be closed")
+	}
+}
+
+func TestConnectionCacheJanitorClosesIdleConnections(t *testing.T) {
+	target := startServer(t)
+	cache := NewConnectionCache(100 * time.Millisecond)
+	defer cache.Close()
+
+	idle := getConn(t, cache, "idle", target)
+	busy := getConn(t, cache, "busy", target)
+	cache.Release(idle)
+
+	waitFor(t, 5*time.Second, func() bool { return idle.GetState() == connectivity.Shutdown })
+	if busy.GetState() == connectivity.Shutdown {
+		t.Fatal("connection in use must not be closed by the janitor")
+	}
+	if !cache.janitorRunning() {
+		t.Fatal("janitor must keep running while connections are cached")
+	}
+
+	cache.Release(busy)
+	waitFor(t, 5*time.Second, func() bool { return busy.GetState() == connectivity.Shutdown })
+	waitFor(t, 5*time.Second, func() bool { return !cache.janitorRunning() })
+	if keys, conns := cache.size(); keys != 0 || conns != 0 {
+		t.Fatalf("expected an empty cache, got %d keys and %d connections", keys, conns)
+	}
+
+	// the janitor starts again with the next connection
+	conn := getConn(t, cache, "idle", target)
+	defer cache.Release(conn)
+	if !cache.janitorRunning() {
+		t.Fatal("expected the janitor to restart")
+	}
+}
+
+func TestConnectionCacheConcurrentUse(t *testing.T) {
+	target := startServer(t)
+	cache := NewConnectionCache(100 * time.Millisecond)
+	defer cache.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(key string) {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				conn, err := cache.Get(context.Background(), key, target, grpc.WithInsecure())
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				cache.Release(conn)
+			}
+		}([]string{"a", "b"}[i%2])
+	}
+	wg.Wait()
+
+	if keys, conns := cache.size(); keys > 2 || conns > 2 {
+		t.Fatalf("expected at most 2 cached connections, got %d keys and %d connections", keys, conns)
+	}
+}
@@ -14,9 +14,9 @@ func DialContext(ctx context.Context, target string, opts ...grpc.DialOption) (c
 	return grpc.DialContext(ctx, target, opts...)
 }
 
+// ReleaseConn hands a connection from GetConn back to the DefaultConnectionCache, any other
+// connection is closed
 func ReleaseConn(conn *grpc.ClientConn) {
 	logger.Debugf("ReleaseConn [%p]", conn)
-	if err := conn.Close(); err != nil {
-		logger.Debugf("unable to close connection [%s]", err)
-	}
+	DefaultConnectionCache.Release(conn)
 }
@@ -0,0 +1,444 @@
+// Package blockparser decodes blocks and transactions into typed Go structs that can be
+// inspected directly or rendered as JSON for audit tooling.
+package blockparser
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"github.com/feng081212/fabric-protos-go/common"
+	"github.com/feng081212/fabric-protos-go/ledger/rwset"
+	"github.com/feng081212/fabric-protos-go/ledger/rwset/kvrwset"
+	"github.com/feng081212/fabric-protos-go/msp"
+	"github.com/feng081212/fabric-protos-go/peer"
+	"github.com/golang/protobuf/proto"
+	"github.com/pkg/errors"
+	"time"
+)
+
+// ParseBlock decodes all transactions of the block. The validation code of each transaction
+// is taken from the TRANSACTIONS_FILTER metadata, blocks that have not been committed by a peer
+// yet report NOT_VALIDATED.
+func ParseBlock(block *common.Block) (*Block, error) {
+	if block == nil || block.Header == nil || block.Data == nil {
+		return nil, errors.New("block with header and data is required")
+	}
+
+	lastConfig, err := LastConfigIndex(block)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "read last config index of block %d failed", block.Header.Number)
+	}
+
+	result := &Block{
+		Number:          block.Header.Number,
+		PreviousHash:    block.Header.PreviousHash,
+		DataHash:        block.Header.DataHash,
+		LastConfigIndex: lastConfig,
+	}
+
+	flags := ValidationFlags(block)
+
+	for i, data := range block.Data.Data {
+		envelope := &common.Envelope{}
+		if err := proto.Unmarshal(data, envelope); err != nil {
+			return nil, errors.Wrapf(err, "unmarshal envelope %d of block %d failed", i, block.Header.Number)
+		}
+
+		code := peer.TxValidationCode_NOT_VALIDATED
+		if i < len(flags) {
+			code = flags[i]
+		}
+
+		tx, err := parseEnvelope(envelope, code)
+		if err != nil {
+			return nil, errors.WithMessagef(err, "parse transaction %d of block %d failed", i, block.Header.Number)
+		}
+		tx.Index = i
+		result.Transactions = append(result.Transactions, tx)
+	}
+
+	return result, nil
+}
+
+// ParseEnvelope decodes a transaction envelope that has not been validated
+func ParseEnvelope(envelope *common.Envelope) (*Transaction, error) {
+	return parseEnvelope(envelope, peer.TxValidationCode_NOT_VALIDATED)
+}
+
+// ParseProcessedTransaction decodes a transaction as returned by qscc GetTransactionByID
+func ParseProcessedTransaction(processedTransaction *peer.ProcessedTransaction) (*Transaction, error) {
+	if processedTransaction == nil || processedTransaction.TransactionEnvelope == nil {
+		return nil, errors.New("processed transaction with envelope is required")
+	}
+	return parseEnvelope(processedTransaction.TransactionEnvelope, peer.TxValidationCode(processedTransaction.ValidationCode))
+}
+
+// ValidationFlags returns the validation code of every transaction from the TRANSACTIONS_FILTER
+// metadata of the block
+func ValidationFlags(block *common.Block) []peer.TxValidationCode {
+	if block.Metadata == nil || len(block.Metadata.Metadata) <= int(common.BlockMetadataIndex_TRANSACTIONS_FILTER) {
+		return nil
+	}
+	filter := block.Metadata.Metadata[common.BlockMetadataIndex_TRANSACTIONS_FILTER]
+	flags := make([]peer.TxValidationCode, len(filter))
+	for i, flag := range filter {
+		flags[i] = peer.TxValidationCode(flag)
+	}
+	return flags
+}
+
+// ToJSON renders the decoded block as indented JSON
+func (b *Block) ToJSON() ([]byte, error) {
+	return json.MarshalIndent(b, "", "  ")
+}
+
+// ToJSON renders the decoded transaction as indented JSON
+func (t *Transaction) ToJSON() ([]byte, error) {
+	return json.MarshalIndent(t, "", "  ")
+}
+
+// BlockToJSON decodes the block and renders it as indented JSON
+func BlockToJSON(block *common.Block) ([]byte, error) {
+	b, err := ParseBlock(block)
+	if err != nil {
+		return nil, err
+	}
+	return b.ToJSON()
+}
+
+func parseEnvelope(envelope *common.Envelope, code peer.TxValidationCode) (*Transaction, error) {
+	payload := &common.Payload{}
+	if err := proto.Unmarshal(envelope.Payload, payload); err != nil {
+		return nil, errors.Wrap(err, "unmarshal payload failed")
+	}
+	if payload.Header == nil {
+		return nil, errors.New("payload header is missing")
+	}
+
+	channelHeader, err := parseChannelHeader(payload.Header.ChannelHeader)
+	if err != nil {
+		return nil, err
+	}
+
+	signatureHeader := &common.SignatureHeader{}
+	if err = proto.Unmarshal(payload.Header.SignatureHeader, signatureHeader); err != nil {
+		return nil, errors.Wrap(err, "unmarshal signature header failed")
+	}
+
+	creator, err := ParseIdentity(signatureHeader.Creator)
+	if err != nil {
+		return nil, err
+	}
+
+	tx := &Transaction{
+		ValidationCode: code.String(),
+		Valid:          code == peer.TxValidationCode_VALID,
+		ChannelHeader:  channelHeader,
+		Creator:        creator,
+		Signature:      envelope.Signature,
+	}
+
+	if channelHeader.Type != common.HeaderType_ENDORSER_TRANSACTION.String() {
+		return tx, nil
+	}
+
+	transaction := &peer.Transaction{}
+	if err = proto.Unmarshal(payload.Data, transaction); err != nil {
+		return nil, errors.Wrap(err, "unmarshal transaction failed")
+	}
+
+	for i, action := range transaction.Actions {
+		a, err := parseTransactionAction(action)
+		if err != nil {
+			return nil, errors.WithMessagef(err, "parse action %d of transaction [%s] failed", i, channelHeader.TxID)
+		}
+		tx.Actions = append(tx.Actions, a)
+	}
+
+	return tx, nil
+}
+
+func parseChannelHeader(bs []byte) (*ChannelHeader, error) {
+	channelHeader := &common.ChannelHeader{}
+	if err := proto.Unmarshal(bs, channelHeader); err != nil {
+		return nil, errors.Wrap(err, "unmarshal channel header failed")
+	}
+
+	result := &ChannelHeader{
+		Type:        common.HeaderType(channelHeader.Type).String(),
+		Version:     channelHeader.Version,
+		ChannelID:   channelHeader.ChannelId,
+		TxID:        channelHeader.TxId,
+		Epoch:       channelHeader.Epoch,
+		TlsCertHash: channelHeader.TlsCertHash,
+	}
+	if channelHeader.Timestamp != nil {
+		result.Timestamp = time.Unix(channelHeader.Timestamp.Seconds, int64(channelHeader.Timestamp.Nanos)).UTC()
+	}
+
+	if common.HeaderType(channelHeader.Type) == common.HeaderType_ENDORSER_TRANSACTION && len(channelHeader.Extension) > 0 {
+		extension := &peer.ChaincodeHeaderExtension{}
+		if err := proto.Unmarshal(channelHeader.Extension, extension); err != nil {
+			return nil, errors.Wrap(err, "unmarshal chaincode header extension failed")
+		}
+		result.ChaincodeID = toChaincodeID(extension.ChaincodeId)
+	}
+
+	return result, nil
+}
+
+// ParseIdentity decodes a serialized msp identity
+func ParseIdentity(serializedIdentity []byte) (*Identity, error) {
+	identity := &msp.SerializedIdentity{}
+	if err := proto.Unmarshal(serializedIdentity, identity); err != nil {
+		return nil, errors.Wrap(err, "unmarshal serialized identity failed")
+	}
+
+	result := &Identity{
+		MspID:       identity.Mspid,
+		Certificate: string(identity.IdBytes),
+	}
+
+	if block, _ := pem.Decode(identity.IdBytes); block != nil {
+		if cert, err := x509.ParseCertificate(block.Bytes); err == nil {
+			result.Subject = cert.Subject.String()
+		}
+	}
+
+	return result, nil
+}
+
+func parseTransactionAction(action *peer.TransactionAction) (*TransactionAction, error) {
+	signatureHeader := &common.SignatureHeader{}
+	if err := proto.Unmarshal(action.Header, signatureHeader); err != nil {
+		return nil, errors.Wrap(err, "unmarshal action signature header failed")
+	}
+	creator, err := ParseIdentity(signatureHeader.Creator)
+	if err != nil {
+		return nil, err
+	}
+
+	actionPayload := &peer.ChaincodeActionPayload{}
+	if err = proto.Unmarshal(action.Payload, actionPayload); err != nil {
+		return nil, errors.Wrap(err, "unmarshal chaincode action payload failed")
+	}
+
+	result := &TransactionAction{Creator: creator}
+
+	if result.Invocation, err = parseChaincodeInvocation(actionPayload.ChaincodeProposalPayload); err != nil {
+		return nil, err
+	}
+
+	if actionPayload.Action == nil {
+		return result, nil
+	}
+
+	for _, endorsement := range actionPayload.Action.Endorsements {
+		endorser, err := ParseIdentity(endorsement.Endorser)
+		if err != nil {
+			return nil, errors.WithMessage(err, "parse endorser failed")
+		}
+		result.Endorsements = append(result.Endorsements, &Endorsement{Endorser: endorser, Signature: endorsement.Signature})
+	}
+
+	responsePayload := &peer.ProposalResponsePayload{}
+	if err = proto.Unmarshal(actionPayload.Action.ProposalResponsePayload, responsePayload); err != nil {
+		return nil, errors.Wrap(err, "unmarshal proposal response payload failed")
+	}
+	result.ProposalHash = responsePayload.ProposalHash
+
+	chaincodeAction := &peer.ChaincodeAction{}
+	if err = proto.Unmarshal(responsePayload.Extension, chaincodeAction); err != nil {
+		return nil, errors.Wrap(err, "unmarshal chaincode action failed")
+	}
+
+	result.ChaincodeID = toChaincodeID(chaincodeAction.ChaincodeId)
+
+	if chaincodeAction.Response != nil {
+		result.Response = &ChaincodeResponse{
+			Status:  chaincodeAction.Response.Status,
+			Message: chaincodeAction.Response.Message,
+			Payload: chaincodeAction.Response.Payload,
+		}
+	}
+
+	if len(chaincodeAction.Events) > 0 {
+		event := &peer.ChaincodeEvent{}
+		if err = proto.Unmarshal(chaincodeAction.Events, event); err != nil {
+			return nil, errors.Wrap(err, "unmarshal chaincode event failed")
+		}
+		result.Event = &ChaincodeEvent{
+			ChaincodeID: event.ChaincodeId,
+			TxID:        event.TxId,
+			EventName:   event.EventName,
+			Payload:     event.Payload,
+		}
+	}
+
+	if result.ReadWriteSets, err = parseReadWriteSets(chaincodeAction.Results); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func parseChaincodeInvocation(bs []byte) (*ChaincodeInvocation, error) {
+	proposalPayload := &peer.ChaincodeProposalPayload{}
+	if err := proto.Unmarshal(bs, proposalPayload); err != nil {
+		return nil, errors.Wrap(err, "unmarshal chaincode proposal payload failed")
+	}
+
+	invocationSpec := &peer.ChaincodeInvocationSpec{}
+	if err := proto.Unmarshal(proposalPayload.Input, invocationSpec); err != nil {
+		return nil, errors.Wrap(err, "unmarshal chaincode invocation spec failed")
+	}
+
+	spec := invocationSpec.ChaincodeSpec
+	if spec == nil {
+		return nil, nil
+	}
+
+	return &ChaincodeInvocation{
+		Type:        spec.Type.String(),
+		ChaincodeID: toChaincodeID(spec.ChaincodeId),
+		Args:        spec.GetInput().GetArgs(),
+		IsInit:      spec.GetInput().GetIsInit(),
+	}, nil
+}
+
+func parseReadWriteSets(results []byte) ([]*NsReadWriteSet, error) {
+	if len(results) == 0 {
+		return nil, nil
+	}
+
+	txReadWriteSet := &rwset.TxReadWriteSet{}
+	if err := proto.Unmarshal(results, txReadWriteSet); err != nil {
+		return nil, errors.Wrap(err, "unmarshal read-write set failed")
+	}
+
+	var result []*NsReadWriteSet
+
+	for _, nsReadWriteSet := range txReadWriteSet.NsRwset {
+		kvReadWriteSet := &kvrwset.KVRWSet{}
+		if err := proto.Unmarshal(nsReadWriteSet.Rwset, kvReadWriteSet); err != nil {
+			return nil, errors.Wrapf(err, "unmarshal read-write set of namespace [%s] failed", nsReadWriteSet.Namespace)
+		}
+
+		ns := &NsReadWriteSet{
+			Namespace: nsReadWriteSet.Namespace,
+			Reads:     toKVReads(kvReadWriteSet.Reads),
+		}
+
+		for _, rangeQuery := range kvReadWriteSet.RangeQueriesInfo {
+			ns.RangeQueries = append(ns.RangeQueries, &RangeQuery{
+				StartKey:     rangeQuery.StartKey,
+				EndKey:       rangeQuery.EndKey,
+				ItrExhausted: rangeQuery.ItrExhausted,
+				Reads:        toKVReads(rangeQuery.GetRawReads().GetKvReads()),
+			})
+		}
+
+		for _, write := range kvReadWriteSet.Writes {
+			ns.Writes = append(ns.Writes, &KVWrite{Key: write.Key, IsDelete: write.IsDelete, Value: write.Value})
+		}
+
+		for _, metadataWrite := range kvReadWriteSet.MetadataWrites {
+			entries := make(map[string][]byte)
+			for _, entry := range metadataWrite.Entries {
+				entries[entry.Name] = entry.Value
+			}
+			ns.MetadataWrites = append(ns.MetadataWrites, &KVMetadataWrite{Key: metadataWrite.Key, Entries: entries})
+		}
+
+		for _, collection := range nsReadWriteSet.CollectionHashedRwset {
+			hashedReadWriteSet := &kvrwset.HashedRWSet{}
+			if err := proto.Unmarshal(collection.HashedRwset, hashedReadWriteSet); err != nil {
+				return nil, errors.Wrapf(err, "unmarshal hashed read-write set of collection [%s] failed", collection.CollectionName)
+			}
+
+			c := &CollectionHashedReadWriteSet{
+				CollectionName: collection.CollectionName,
+				PvtRwsetHash:   collection.PvtRwsetHash,
+			}
+			for _, read := range hashedReadWriteSet.HashedReads {
+				c.HashedReads = append(c.HashedReads, &KVReadHash{KeyHash: read.KeyHash, Version: toVersion(read.Version)})
+			}
+			for _, write := range hashedReadWriteSet.HashedWrites {
+				c.HashedWrites = append(c.HashedWrites, &KVWriteHash{KeyHash: write.KeyHash, IsDelete: write.IsDelete, ValueHash: write.ValueHash})
+			}
+			ns.Collections = append(ns.Collections, c)
+		}
+
+		result = append(result, ns)
+	}
+
+	return result, nil
+}
+
+func toKVReads(reads []*kvrwset.KVRead) []*KVRead {
+	var result []*KVRead
+	for _, read := range reads {
+		result = append(result, &KVRead{Key: read.Key, Version: toVersion(read.Version)})
+	}
+	return result
+}
+
+func toVersion(version *kvrwset.Version) *Version {
+	if version == nil {
+		return nil
+	}
+	return &Version{BlockNum: version.BlockNum, TxNum: version.TxNum}
+}
+
+func toChaincodeID(id *peer.ChaincodeID) *ChaincodeID {
+	if id == nil {
+		return nil
+	}
+	return &ChaincodeID{Name: id.Name, Version: id.Version, Path: id.Path}
+}
+
+// LastConfigIndex retrieves the index of the last config block from the block metadata. The
+// index is read from the orderer block metadata of the SIGNATURES entry, blocks of orderers
+// before v1.4.1 only carry it in the LAST_CONFIG entry.
+func LastConfigIndex(block *common.Block) (uint64, error) {
+	m, err := blockMetadata(block, common.BlockMetadataIndex_SIGNATURES)
+	if err != nil {
+		return 0, errors.WithMessage(err, "failed to retrieve metadata")
+	}
+	// TODO FAB-15864 Remove this fallback when we can stop supporting upgrade from pre-1.4.1 orderer
+	if len(m.Value) == 0 {
+		m, err := blockMetadata(block, common.BlockMetadataIndex_LAST_CONFIG)
+		if err != nil {
+			return 0, errors.WithMessage(err, "failed to retrieve metadata")
+		}
+		lc := &common.LastConfig{}
+		if err = proto.Unmarshal(m.Value, lc); err != nil {
+			return 0, errors.Wrap(err, "error unmarshalling LastConfig")
+		}
+		return lc.Index, nil
+	}
+
+	obm := &common.OrdererBlockMetadata{}
+	if err = proto.Unmarshal(m.Value, obm); err != nil {
+		return 0, errors.Wrap(err, "failed to unmarshal orderer block metadata")
+	}
+	if obm.LastConfig == nil {
+		return 0, errors.New("orderer block metadata has no last config")
+	}
+	return obm.LastConfig.Index, nil
+}
+
+func blockMetadata(block *common.Block, index common.BlockMetadataIndex) (*common.Metadata, error) {
+	if block.Metadata == nil {
+		return nil, errors.New("no metadata in block")
+	}
+	if len(block.Metadata.Metadata) <= int(index) {
+		return nil, errors.Errorf("no metadata at index [%s]", index)
+	}
+
+	md := &common.Metadata{}
+	if err := proto.Unmarshal(block.Metadata.Metadata[index], md); err != nil {
+		return nil, errors.Wrapf(err, "error unmarshalling metadata at index [%s]", index)
+	}
+	return md, nil
+}
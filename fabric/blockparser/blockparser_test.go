@@ -0,0 +1,136 @@
+package blockparser
+
+import (
+	"testing"
+
+	"github.com/feng081212/fabric-protos-go/common"
+	"github.com/feng081212/fabric-protos-go/msp"
+	"github.com/golang/protobuf/proto"
+)
+
+func marshal(t *testing.T, m proto.Message) []byte {
+	bs, err := proto.Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bs
+}
+
+// testBlock creates a block holding one config transaction with the metadata entries, in the
+// layout the orderer writes
+func testBlock(t *testing.T, number uint64, signatures, lastConfig []byte) *common.Block {
+	creator := marshal(t, &msp.SerializedIdentity{Mspid: "OrdererMSP"})
+	payload := marshal(t, &common.Payload{
+		Header: &common.Header{
+			ChannelHeader:   marshal(t, &common.ChannelHeader{Type: int32(common.HeaderType_CONFIG), ChannelId: "mychannel"}),
+			SignatureHeader: marshal(t, &common.SignatureHeader{Creator: creator}),
+		},
+	})
+
+	metadata := make([][]byte, len(common.BlockMetadataIndex_name))
+	metadata[common.BlockMetadataIndex_SIGNATURES] = signatures
+	metadata[common.BlockMetadataIndex_LAST_CONFIG] = lastConfig
+
+	return &common.Block{
+		Header:   &common.BlockHeader{Number: number},
+		Data:     &common.BlockData{Data: [][]byte{marshal(t, &common.Envelope{Payload: payload})}},
+		Metadata: &common.BlockMetadata{Metadata: metadata},
+	}
+}
+
+func TestLastConfigIndex(t *testing.T) {
+	ordererMetadata := func(lastConfig *common.LastConfig) []byte {
+		return marshal(t, &common.Metadata{
+			Value:      marshal(t, &common.OrdererBlockMetadata{LastConfig: lastConfig, ConsenterMetadata: []byte("raft")}),
+			Signatures: []*common.MetadataSignature{{Signature: []byte("signature")}},
+		})
+	}
+	legacyMetadata := func(index uint64) []byte {
+		return marshal(t, &common.Metadata{Value: marshal(t, &common.LastConfig{Index: index})})
+	}
+
+	tests := []struct {
+		name     string
+		block    *common.Block
+		expected uint64
+		err      bool
+	}{
+		{
+			name:     "genesis block",
+			block:    testBlock(t, 0, ordererMetadata(&common.LastConfig{Index: 0}), legacyMetadata(0)),
+			expected: 0,
+		},
+		{
+			name:     "orderer block metadata",
+			block:    testBlock(t, 12, ordererMetadata(&common.LastConfig{Index: 7}), nil),
+			expected: 7,
+		},
+		{
+			name:     "orderer block metadata wins over last config",
+			block:    testBlock(t, 12, ordererMetadata(&common.LastConfig{Index: 7}), legacyMetadata(3)),
+			expected: 7,
+		},
+		{
+			name:     "pre v1.4.1 orderer",
+			block:    testBlock(t, 9, marshal(t, &common.Metadata{}), legacyMetadata(4)),
+			expected: 4,
+		},
+		{
+			name:  "orderer block metadata without last config",
+			block: testBlock(t, 12, ordererMetadata(nil), nil),
+			err:   true,
+		},
+		{
+			name:  "corrupt signatures metadata",
+			block: testBlock(t, 12, []byte("corrupt"), nil),
+			err:   true,
+		},
+		{
+			name:  "corrupt last config",
+			block: testBlock(t, 9, nil, marshal(t, &common.Metadata{Value: []byte("corrupt")})),
+			err:   true,
+		},
+		{
+			name:  "no metadata",
+			block: &common.Block{Header: &common.BlockHeader{}, Data: &common.BlockData{}},
+			err:   true,
+		},
+		{
+			name:  "missing metadata entries",
+			block: &common.Block{Header: &common.BlockHeader{}, Data: &common.BlockData{}, Metadata: &common.BlockMetadata{}},
+			err:   true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			index, err := LastConfigIndex(test.block)
+			if test.err {
+				if err == nil {
+					t.Fatalf("expected an error, got index %d", index)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if index != test.expected {
+				t.Fatalf("expected last config index %d, got %d", test.expected, index)
+			}
+
+			block, err := ParseBlock(test.block)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if block.LastConfigIndex != test.expected {
+				t.Fatalf("expected parsed last config index %d, got %d", test.expected, block.LastConfigIndex)
+			}
+		})
+	}
+}
+
+func TestParseBlockLastConfigError(t *testing.T) {
+	if _, err := ParseBlock(testBlock(t, 3, []byte("corrupt"), nil)); err == nil {
+		t.Fatal("expected an error for corrupt block metadata")
+	}
+}
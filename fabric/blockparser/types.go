@@ -0,0 +1,183 @@
+package blockparser
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"time"
+)
+
+// HexBytes is rendered as a hex string in JSON, it is used for hashes and signatures
+type HexBytes []byte
+
+func (h HexBytes) MarshalJSON() ([]byte, error) {
+	return json.Marshal(hex.EncodeToString(h))
+}
+
+func (h *HexBytes) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	bs, err := hex.DecodeString(s)
+	if err != nil {
+		return err
+	}
+	*h = bs
+	return nil
+}
+
+// Block is the decoded content of a common.Block
+type Block struct {
+	Number          uint64         `json:"number"`
+	PreviousHash    HexBytes       `json:"previous_hash"`
+	DataHash        HexBytes       `json:"data_hash"`
+	LastConfigIndex uint64         `json:"last_config_index"`
+	Transactions    []*Transaction `json:"transactions"`
+}
+
+// Transaction is the decoded content of an envelope in a block
+type Transaction struct {
+	// Index is the position of the transaction in the block
+	Index int `json:"index"`
+	// ValidationCode is the peer.TxValidationCode set by the committing peer
+	ValidationCode string               `json:"validation_code"`
+	Valid          bool                 `json:"valid"`
+	ChannelHeader  *ChannelHeader       `json:"channel_header"`
+	Creator        *Identity            `json:"creator"`
+	Signature      HexBytes             `json:"signature"`
+	Actions        []*TransactionAction `json:"actions,omitempty"`
+}
+
+// ChannelHeader is the decoded common.ChannelHeader of a transaction
+type ChannelHeader struct {
+	Type        string       `json:"type"`
+	Version     int32        `json:"version"`
+	Timestamp   time.Time    `json:"timestamp"`
+	ChannelID   string       `json:"channel_id"`
+	TxID        string       `json:"tx_id"`
+	Epoch       uint64       `json:"epoch"`
+	ChaincodeID *ChaincodeID `json:"chaincode_id,omitempty"`
+	TlsCertHash HexBytes     `json:"tls_cert_hash,omitempty"`
+}
+
+// Identity is a decoded msp.SerializedIdentity
+type Identity struct {
+	MspID string `json:"msp_id"`
+	// Certificate is the PEM encoded certificate of the identity
+	Certificate string `json:"certificate"`
+	// Subject is the subject of the certificate, empty when the certificate cannot be parsed
+	Subject string `json:"subject,omitempty"`
+}
+
+// ChaincodeID identifies a chaincode
+type ChaincodeID struct {
+	Name    string `json:"name"`
+	Version string `json:"version,omitempty"`
+	Path    string `json:"path,omitempty"`
+}
+
+// TransactionAction is a decoded endorser transaction action
+type TransactionAction struct {
+	Creator      *Identity            `json:"creator"`
+	Invocation   *ChaincodeInvocation `json:"invocation,omitempty"`
+	ProposalHash HexBytes             `json:"proposal_hash"`
+	// ChaincodeID is the chaincode that was executed by the endorsers
+	ChaincodeID   *ChaincodeID       `json:"chaincode_id,omitempty"`
+	Response      *ChaincodeResponse `json:"response,omitempty"`
+	ReadWriteSets []*NsReadWriteSet  `json:"read_write_sets,omitempty"`
+	Event         *ChaincodeEvent    `json:"event,omitempty"`
+	Endorsements  []*Endorsement     `json:"endorsements"`
+}
+
+// ChaincodeInvocation is the decoded peer.ChaincodeInvocationSpec of a proposal
+type ChaincodeInvocation struct {
+	Type        string       `json:"type"`
+	ChaincodeID *ChaincodeID `json:"chaincode_id"`
+	Args        [][]byte     `json:"args"`
+	IsInit      bool         `json:"is_init,omitempty"`
+}
+
+// ChaincodeResponse is the response of the chaincode as endorsed by the peers
+type ChaincodeResponse struct {
+	Status  int32  `json:"status"`
+	Message string `json:"message,omitempty"`
+	Payload []byte `json:"payload,omitempty"`
+}
+
+// ChaincodeEvent is the event set by the chaincode
+type ChaincodeEvent struct {
+	ChaincodeID string `json:"chaincode_id"`
+	TxID        string `json:"tx_id"`
+	EventName   string `json:"event_name"`
+	Payload     []byte `json:"payload,omitempty"`
+}
+
+// Endorsement is a decoded peer.Endorsement
+type Endorsement struct {
+	Endorser  *Identity `json:"endorser"`
+	Signature HexBytes  `json:"signature"`
+}
+
+// NsReadWriteSet is the decoded read-write set of a namespace
+type NsReadWriteSet struct {
+	Namespace      string                          `json:"namespace"`
+	Reads          []*KVRead                       `json:"reads,omitempty"`
+	RangeQueries   []*RangeQuery                   `json:"range_queries,omitempty"`
+	Writes         []*KVWrite                      `json:"writes,omitempty"`
+	MetadataWrites []*KVMetadataWrite              `json:"metadata_writes,omitempty"`
+	Collections    []*CollectionHashedReadWriteSet `json:"collections,omitempty"`
+}
+
+// Version is the height of the transaction that last wrote a key
+type Version struct {
+	BlockNum uint64 `json:"block_num"`
+	TxNum    uint64 `json:"tx_num"`
+}
+
+// KVRead is a key read by the transaction, Version is nil when the key did not exist
+type KVRead struct {
+	Key     string   `json:"key"`
+	Version *Version `json:"version,omitempty"`
+}
+
+// KVWrite is a key written or deleted by the transaction
+type KVWrite struct {
+	Key      string `json:"key"`
+	IsDelete bool   `json:"is_delete,omitempty"`
+	Value    []byte `json:"value,omitempty"`
+}
+
+// KVMetadataWrite is a metadata update of a key
+type KVMetadataWrite struct {
+	Key     string            `json:"key"`
+	Entries map[string][]byte `json:"entries"`
+}
+
+// RangeQuery is a range query executed by the transaction
+type RangeQuery struct {
+	StartKey     string    `json:"start_key"`
+	EndKey       string    `json:"end_key"`
+	ItrExhausted bool      `json:"itr_exhausted"`
+	Reads        []*KVRead `json:"reads,omitempty"`
+}
+
+// CollectionHashedReadWriteSet is the hashed read-write set of a private data collection
+type CollectionHashedReadWriteSet struct {
+	CollectionName string         `json:"collection_name"`
+	PvtRwsetHash   HexBytes       `json:"pvt_rwset_hash"`
+	HashedReads    []*KVReadHash  `json:"hashed_reads,omitempty"`
+	HashedWrites   []*KVWriteHash `json:"hashed_writes,omitempty"`
+}
+
+// KVReadHash is a private key read, identified by the hash of the key
+type KVReadHash struct {
+	KeyHash HexBytes `json:"key_hash"`
+	Version *Version `json:"version,omitempty"`
+}
+
+// KVWriteHash is a private key write, identified by the hash of the key
+type KVWriteHash struct {
+	KeyHash   HexBytes `json:"key_hash"`
+	IsDelete  bool     `json:"is_delete,omitempty"`
+	ValueHash HexBytes `json:"value_hash,omitempty"`
+}
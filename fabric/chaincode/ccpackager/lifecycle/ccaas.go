@@ -0,0 +1,231 @@
+package lifecycle
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/feng081212/fabric-sdk-go/fabric/chaincode/ccmetadata"
+	"github.com/pkg/errors"
+)
+
+const (
+	// CCaaSType is the package type the builtin chaincode-as-a-service builder of the peer detects
+	CCaaSType = "ccaas"
+
+	connectionFileName   = "connection.json"
+	metadataDirName      = "META-INF"
+	defaultCCDialTimeout = 3 * time.Second
+)
+
+// CCaaSConnection is the connection.json external builders read to connect to a chaincode running
+// as a service. The keys and certificates are PEM encoded.
+type CCaaSConnection struct {
+	Address            string `json:"address"`
+	DialTimeout        string `json:"dial_timeout,omitempty"`
+	TLSRequired        bool   `json:"tls_required"`
+	ClientAuthRequired bool   `json:"client_auth_required"`
+	ClientKey          string `json:"client_key,omitempty"`
+	ClientCert         string `json:"client_cert,omitempty"`
+	RootCert           string `json:"root_cert,omitempty"`
+}
+
+// CCaaSDescriptor describes the package of a chaincode running as a service
+type CCaaSDescriptor struct {
+	Label string
+	// Type is the type of the package, CCaaSType when empty. External builders other than the
+	// builtin one may look for their own type.
+	Type    string
+	Address string
+	// DialTimeout is 3s when zero, like the peer
+	DialTimeout        time.Duration
+	TLSRequired        bool
+	ClientAuthRequired bool
+	// ClientKeyPath and ClientCertPath are the PEM files of the key pair the peer uses when client
+	// authentication is required, RootCertPath the PEM file of the CA of the chaincode server
+	ClientKeyPath  string
+	ClientCertPath string
+	RootCertPath   string
+	// MetadataPath is an optional META-INF directory holding the state database indexes of the
+	// chaincode, the builder installs them on the peer
+	MetadataPath string
+}
+
+// Validate checks the connection like the external builder of the peer does before connecting to
+// the chaincode
+func (c *CCaaSConnection) Validate() error {
+	if c.Address == "" {
+		return errors.New("chaincode address not provided")
+	}
+	if _, _, err := net.SplitHostPort(c.Address); err != nil {
+		return errors.Wrapf(err, "invalid chaincode address '%s'", c.Address)
+	}
+	if c.DialTimeout != "" {
+		if _, err := time.ParseDuration(c.DialTimeout); err != nil {
+			return errors.Wrapf(err, "invalid dial_timeout '%s'", c.DialTimeout)
+		}
+	}
+
+	if !c.TLSRequired {
+		return nil
+	}
+	if c.ClientAuthRequired {
+		if c.ClientKey == "" {
+			return errors.New("chaincode tls key not provided")
+		}
+		if c.ClientCert == "" {
+			return errors.New("chaincode tls cert not provided")
+		}
+		if block, _ := pem.Decode([]byte(c.ClientKey)); block == nil {
+			return errors.New("chaincode tls key is not PEM encoded")
+		}
+		if err := validatePEMCertificate(c.ClientCert); err != nil {
+			return errors.WithMessage(err, "invalid chaincode tls cert")
+		}
+	}
+	if c.RootCert == "" {
+		return errors.New("chaincode tls root cert not provided")
+	}
+	if err := validatePEMCertificate(c.RootCert); err != nil {
+		return errors.WithMessage(err, "invalid chaincode tls root cert")
+	}
+	return nil
+}
+
+// Connection returns the connection.json of the descriptor with the PEM files read
+func (p *CCaaSDescriptor) Connection() (*CCaaSConnection, error) {
+	dialTimeout := p.DialTimeout
+	if dialTimeout == 0 {
+		dialTimeout = defaultCCDialTimeout
+	}
+	connection := &CCaaSConnection{
+		Address:            p.Address,
+		DialTimeout:        dialTimeout.String(),
+		TLSRequired:        p.TLSRequired,
+		ClientAuthRequired: p.ClientAuthRequired,
+	}
+
+	if p.TLSRequired {
+		var err error
+		if connection.RootCert, err = readPEMFile(p.RootCertPath); err != nil {
+			return nil, errors.WithMessage(err, "read root cert failed")
+		}
+		if p.ClientAuthRequired {
+			if connection.ClientKey, err = readPEMFile(p.ClientKeyPath); err != nil {
+				return nil, errors.WithMessage(err, "read client key failed")
+			}
+			if connection.ClientCert, err = readPEMFile(p.ClientCertPath); err != nil {
+				return nil, errors.WithMessage(err, "read client cert failed")
+			}
+		}
+	}
+
+	return connection, connection.Validate()
+}
+
+// NewCCaaSPackage creates the package of a chaincode running as a service: code.tar.gz holds the
+// connection.json and the META-INF directory of the descriptor
+func NewCCaaSPackage(desc *CCaaSDescriptor) ([]byte, error) {
+	if err := ValidateLabel(desc.Label); err != nil {
+		return nil, err
+	}
+	packageType := desc.Type
+	if packageType == "" {
+		packageType = CCaaSType
+	}
+
+	connection, err := desc.Connection()
+	if err != nil {
+		return nil, err
+	}
+
+	codeBytes, err := getCCaaSCodeBytes(connection, desc.MetadataPath)
+	if err != nil {
+		return nil, err
+	}
+
+	return writeCCPackage(&PackageMetadata{Type: packageType, Label: desc.Label}, codeBytes)
+}
+
+func getCCaaSCodeBytes(connection *CCaaSConnection, metadataPath string) ([]byte, error) {
+	payload := bytes.NewBuffer(nil)
+	gw := gzip.NewWriter(payload)
+	tw := tar.NewWriter(gw)
+	defer func() { _ = gw.Close() }()
+	defer func() { _ = tw.Close() }()
+
+	connectionBytes, err := json.Marshal(connection)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to marshal connection.json")
+	}
+	if err = writePackage(tw, connectionFileName, connectionBytes); err != nil {
+		return nil, errors.Wrap(err, "error writing connection.json to tar")
+	}
+
+	if metadataPath != "" {
+		if err = writeMetadataDir(tw, metadataPath); err != nil {
+			return nil, err
+		}
+	}
+
+	_ = tw.Close()
+	_ = gw.Close()
+
+	return payload.Bytes(), nil
+}
+
+// writeMetadataDir writes the files of the META-INF directory, each file is validated like the
+// peer does when it installs the package
+func writeMetadataDir(tw *tar.Writer, metadataPath string) error {
+	return filepath.Walk(metadataPath, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(metadataPath, path)
+		if err != nil {
+			return err
+		}
+		name := metadataDirName + "/" + filepath.ToSlash(rel)
+
+		bs, err := ioutil.ReadFile(path)
+		if err != nil {
+			return errors.Wrapf(err, "read metadata file %s failed", path)
+		}
+		if err = ccmetadata.ValidateMetadataFile(name, bs); err != nil {
+			return err
+		}
+		return errors.Wrapf(writePackage(tw, name, bs), "error writing %s to tar", name)
+	})
+}
+
+func readPEMFile(path string) (string, error) {
+	if path == "" {
+		return "", errors.New("file not provided")
+	}
+	bs, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", errors.Wrapf(err, "read %s failed", path)
+	}
+	return string(bs), nil
+}
+
+func validatePEMCertificate(s string) error {
+	block, _ := pem.Decode([]byte(s))
+	if block == nil {
+		return errors.New("not PEM encoded")
+	}
+	_, err := x509.ParseCertificate(block.Bytes)
+	return errors.Wrap(err, "failed to parse certificate")
+}
@@ -0,0 +1,279 @@
+package lifecycle
+
+import (
+	"archive/tar"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// testKeyPair returns a self-signed certificate and its key, PEM encoded
+func testKeyPair(t *testing.T) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "cc.example.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})),
+		string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}))
+}
+
+// writeTestFiles writes the files under a temporary directory and returns it
+func writeTestFiles(t *testing.T, files map[string]string) string {
+	dir, err := ioutil.TempDir("", "ccaas")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err = os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err = ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestCCaaSConnectionValidate(t *testing.T) {
+	cert, key := testKeyPair(t)
+
+	tests := []struct {
+		name       string
+		connection CCaaSConnection
+		isValid    bool
+	}{
+		{"plain", CCaaSConnection{Address: "cc.example.com:9999", DialTimeout: "10s"}, true},
+		{"missing address", CCaaSConnection{}, false},
+		{"address without port", CCaaSConnection{Address: "cc.example.com"}, false},
+		{"bad dial_timeout", CCaaSConnection{Address: "cc.example.com:9999", DialTimeout: "10 seconds"}, false},
+		{"tls", CCaaSConnection{Address: "cc.example.com:9999", TLSRequired: true, RootCert: cert}, true},
+		{"tls without root cert", CCaaSConnection{Address: "cc.example.com:9999", TLSRequired: true}, false},
+		{"tls with non-PEM root cert", CCaaSConnection{Address: "cc.example.com:9999", TLSRequired: true, RootCert: "cert"}, false},
+		{"tls with a key as root cert", CCaaSConnection{Address: "cc.example.com:9999", TLSRequired: true, RootCert: key}, false},
+		{"client auth", CCaaSConnection{Address: "cc.example.com:9999", TLSRequired: true, ClientAuthRequired: true, ClientKey: key, ClientCert: cert, RootCert: cert}, true},
+		{"client auth without key", CCaaSConnection{Address: "cc.example.com:9999", TLSRequired: true, ClientAuthRequired: true, ClientCert: cert, RootCert: cert}, false},
+		{"client auth without cert", CCaaSConnection{Address: "cc.example.com:9999", TLSRequired: true, ClientAuthRequired: true, ClientKey: key, RootCert: cert}, false},
+		{"client auth with non-PEM key", CCaaSConnection{Address: "cc.example.com:9999", TLSRequired: true, ClientAuthRequired: true, ClientKey: "key", ClientCert: cert, RootCert: cert}, false},
+		{"client auth with non-PEM cert", CCaaSConnection{Address: "cc.example.com:9999", TLSRequired: true, ClientAuthRequired: true, ClientKey: key, ClientCert: "cert", RootCert: cert}, false},
+		{"client auth ignored without tls", CCaaSConnection{Address: "cc.example.com:9999", ClientAuthRequired: true}, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.connection.Validate()
+			if test.isValid && err != nil {
+				t.Fatalf("expected the connection to be valid: %s", err)
+			}
+			if !test.isValid && err == nil {
+				t.Fatal("expected the connection to be invalid")
+			}
+		})
+	}
+}
+
+func TestCCaaSDescriptorConnection(t *testing.T) {
+	cert, key := testKeyPair(t)
+	dir := writeTestFiles(t, map[string]string{"ca.pem": cert, "client.pem": cert, "client.key": key, "bad.pem": "cert"})
+
+	tests := []struct {
+		name       string
+		descriptor CCaaSDescriptor
+		expected   *CCaaSConnection
+	}{
+		{
+			name:       "default dial timeout",
+			descriptor: CCaaSDescriptor{Address: "cc.example.com:9999"},
+			expected:   &CCaaSConnection{Address: "cc.example.com:9999", DialTimeout: "3s"},
+		},
+		{
+			name:       "dial timeout",
+			descriptor: CCaaSDescriptor{Address: "cc.example.com:9999", DialTimeout: 10 * time.Second},
+			expected:   &CCaaSConnection{Address: "cc.example.com:9999", DialTimeout: "10s"},
+		},
+		{
+			name: "client auth",
+			descriptor: CCaaSDescriptor{
+				Address: "cc.example.com:9999", TLSRequired: true, ClientAuthRequired: true,
+				RootCertPath: filepath.Join(dir, "ca.pem"), ClientCertPath: filepath.Join(dir, "client.pem"), ClientKeyPath: filepath.Join(dir, "client.key"),
+			},
+			expected: &CCaaSConnection{
+				Address: "cc.example.com:9999", DialTimeout: "3s", TLSRequired: true, ClientAuthRequired: true,
+				RootCert: cert, ClientCert: cert, ClientKey: key,
+			},
+		},
+		{
+			name:       "invalid address",
+			descriptor: CCaaSDescriptor{Address: "cc.example.com"},
+		},
+		{
+			name:       "tls without root cert",
+			descriptor: CCaaSDescriptor{Address: "cc.example.com:9999", TLSRequired: true},
+		},
+		{
+			name:       "missing root cert file",
+			descriptor: CCaaSDescriptor{Address: "cc.example.com:9999", TLSRequired: true, RootCertPath: filepath.Join(dir, "missing.pem")},
+		},
+		{
+			name:       "non-PEM root cert",
+			descriptor: CCaaSDescriptor{Address: "cc.example.com:9999", TLSRequired: true, RootCertPath: filepath.Join(dir, "bad.pem")},
+		},
+		{
+			name: "client auth without key",
+			descriptor: CCaaSDescriptor{
+				Address: "cc.example.com:9999", TLSRequired: true, ClientAuthRequired: true,
+				RootCertPath: filepath.Join(dir, "ca.pem"), ClientCertPath: filepath.Join(dir, "client.pem"),
+			},
+		},
+		{
+			name: "client auth without cert",
+			descriptor: CCaaSDescriptor{
+				Address: "cc.example.com:9999", TLSRequired: true, ClientAuthRequired: true,
+				RootCertPath: filepath.Join(dir, "ca.pem"), ClientKeyPath: filepath.Join(dir, "client.key"),
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			connection, err := test.descriptor.Connection()
+			if test.expected == nil {
+				if err == nil {
+					t.Fatalf("expected the descriptor to be refused, got %+v", connection)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(connection, test.expected) {
+				t.Fatalf("expected %+v, got %+v", test.expected, connection)
+			}
+		})
+	}
+}
+
+func TestNewCCaaSPackage(t *testing.T) {
+	index := `{"index":{"fields":["owner"]},"ddoc":"indexOwnerDoc","name":"indexOwner","type":"json"}`
+	metadata := writeTestFiles(t, map[string]string{"statedb/couchdb/indexes/indexOwner.json": index})
+	badMetadata := writeTestFiles(t, map[string]string{"statedb/couchdb/indexes/indexOwner.json": "{"})
+	misplacedMetadata := writeTestFiles(t, map[string]string{"indexes/indexOwner.json": index})
+
+	tests := []struct {
+		name       string
+		descriptor CCaaSDescriptor
+		ccType     string
+		files      []string
+	}{
+		{
+			name:       "connection only",
+			descriptor: CCaaSDescriptor{Label: "cc_1", Address: "cc.example.com:9999"},
+			ccType:     CCaaSType,
+			files:      []string{"connection.json"},
+		},
+		{
+			name:       "indexes and type",
+			descriptor: CCaaSDescriptor{Label: "cc_1", Type: "external", Address: "cc.example.com:9999", MetadataPath: metadata},
+			ccType:     "external",
+			files:      []string{"connection.json", "META-INF/statedb/couchdb/indexes/indexOwner.json"},
+		},
+		{
+			name:       "invalid index",
+			descriptor: CCaaSDescriptor{Label: "cc_1", Address: "cc.example.com:9999", MetadataPath: badMetadata},
+		},
+		{
+			name:       "index outside statedb",
+			descriptor: CCaaSDescriptor{Label: "cc_1", Address: "cc.example.com:9999", MetadataPath: misplacedMetadata},
+		},
+		{
+			name:       "missing metadata directory",
+			descriptor: CCaaSDescriptor{Label: "cc_1", Address: "cc.example.com:9999", MetadataPath: filepath.Join(metadata, "missing")},
+		},
+		{
+			name:       "invalid label",
+			descriptor: CCaaSDescriptor{Label: "cc 1", Address: "cc.example.com:9999"},
+		},
+		{
+			name:       "invalid connection",
+			descriptor: CCaaSDescriptor{Label: "cc_1"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			pkgBytes, err := NewCCaaSPackage(&test.descriptor)
+			if test.files == nil {
+				if err == nil {
+					t.Fatal("expected the package to be refused")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			pkg, err := ParsePackage(pkgBytes)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if pkg.Metadata.Type != test.ccType || pkg.Metadata.Label != "cc_1" {
+				t.Fatalf("unexpected metadata %+v", pkg.Metadata)
+			}
+			var files []string
+			for _, file := range pkg.Files {
+				files = append(files, file.Name)
+			}
+			if !reflect.DeepEqual(files, test.files) {
+				t.Fatalf("expected the files %v, got %v", test.files, files)
+			}
+			if err = pkg.Validate(); err != nil {
+				t.Fatalf("expected the package to be valid: %s", err)
+			}
+
+			expected, err := test.descriptor.Connection()
+			if err != nil {
+				t.Fatal(err)
+			}
+			connection := &CCaaSConnection{}
+			err = walkTarGz(pkg.Code, func(header *tar.Header, r io.Reader) error {
+				if header.Name != connectionFileName {
+					return nil
+				}
+				return json.NewDecoder(r).Decode(connection)
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(connection, expected) {
+				t.Fatalf("expected the connection.json %+v, got %+v", expected, connection)
+			}
+		})
+	}
+}
@@ -0,0 +1,183 @@
+package lifecycle
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/feng081212/fabric-sdk-go/fabric/chaincode/ccmetadata"
+	"github.com/feng081212/fabric-sdk-go/fabric/chaincode/platforms"
+	"github.com/pkg/errors"
+)
+
+// PackageFile is an entry of the code archive of a package
+type PackageFile struct {
+	Name  string
+	Size  int64
+	Mode  int64
+	IsDir bool
+}
+
+// Package is a parsed chaincode install package, as built by NewCCPackage, NewCCaaSPackage or the
+// peer CLI
+type Package struct {
+	Metadata  *PackageMetadata
+	PackageID string
+	// Code is the code.tar.gz of the package
+	Code []byte
+	// Files are the entries of Code in archive order
+	Files []*PackageFile
+}
+
+// ParsePackageFile parses the install package stored in the file
+func ParsePackageFile(path string) (*Package, error) {
+	bs, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "read chaincode package %s failed", path)
+	}
+	return ParsePackage(bs)
+}
+
+// ParsePackage parses an install package, like the peer it requires a metadata.json with a valid
+// label and a code.tar.gz
+func ParsePackage(pkgBytes []byte) (*Package, error) {
+	pkg := &Package{}
+
+	err := walkTarGz(pkgBytes, func(header *tar.Header, r io.Reader) error {
+		switch header.Name {
+		case metadataPackageName:
+			pkg.Metadata = &PackageMetadata{}
+			if err := json.NewDecoder(r).Decode(pkg.Metadata); err != nil {
+				return errors.Wrap(err, "could not unmarshal package metadata")
+			}
+		case codePackageName:
+			code, err := ioutil.ReadAll(r)
+			if err != nil {
+				return errors.Wrap(err, "could not read code package")
+			}
+			pkg.Code = code
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.WithMessage(err, "invalid chaincode package")
+	}
+
+	if pkg.Metadata == nil {
+		return nil, errors.New("did not find any package metadata (missing metadata.json)")
+	}
+	if err = ValidateLabel(pkg.Metadata.Label); err != nil {
+		return nil, err
+	}
+	if pkg.Code == nil {
+		return nil, errors.New("did not find a code package inside the package")
+	}
+
+	err = walkTarGz(pkg.Code, func(header *tar.Header, _ io.Reader) error {
+		pkg.Files = append(pkg.Files, &PackageFile{
+			Name:  header.Name,
+			Size:  header.Size,
+			Mode:  header.Mode,
+			IsDir: header.Typeflag == tar.TypeDir,
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, errors.WithMessage(err, "invalid code package")
+	}
+
+	pkg.PackageID = ComputePackageID(pkg.Metadata.Label, pkgBytes)
+	return pkg, nil
+}
+
+// Validate validates the code with the platform of the package type and the files of META-INF
+// with ccmetadata. Types without a platform, such as the ones of external builders, only have
+// their META-INF validated. Like the peer, the type is matched case-insensitively.
+func (p *Package) Validate() error {
+	if platform := platforms.GetPlatform(strings.ToUpper(p.Metadata.Type)); platform != nil {
+		if err := platform.ValidateCodePackage(p.Code); err != nil {
+			return errors.WithMessagef(err, "invalid %s code package", p.Metadata.Type)
+		}
+	}
+
+	return walkTarGz(p.Code, func(header *tar.Header, r io.Reader) error {
+		if header.Typeflag != tar.TypeReg || !strings.HasPrefix(header.Name, metadataDirName+"/") {
+			return nil
+		}
+		bs, err := ioutil.ReadAll(r)
+		if err != nil {
+			return errors.Wrapf(err, "read %s failed", header.Name)
+		}
+		return ccmetadata.ValidateMetadataFile(header.Name, bs)
+	})
+}
+
+// Extract writes the package to dir: the metadata.json at its root and the files of the code
+// archive under src, the layout external builders get
+func (p *Package) Extract(dir string) error {
+	metadataBytes, err := json.Marshal(p.Metadata)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal chaincode package metadata into JSON")
+	}
+	if err = os.MkdirAll(dir, 0755); err != nil {
+		return errors.Wrapf(err, "create directory %s failed", dir)
+	}
+	if err = ioutil.WriteFile(filepath.Join(dir, metadataPackageName), metadataBytes, 0644); err != nil {
+		return errors.Wrap(err, "write metadata.json failed")
+	}
+
+	srcDir := filepath.Join(dir, "src")
+	return walkTarGz(p.Code, func(header *tar.Header, r io.Reader) error {
+		name := filepath.Clean(filepath.FromSlash(header.Name))
+		if filepath.IsAbs(name) || name == ".." || strings.HasPrefix(name, ".."+string(filepath.Separator)) {
+			return errors.Errorf("illegal file path '%s' in code package", header.Name)
+		}
+		target := filepath.Join(srcDir, name)
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			return errors.Wrapf(os.MkdirAll(target, 0755), "create directory %s failed", target)
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return errors.Wrapf(err, "create directory %s failed", filepath.Dir(target))
+			}
+			f, err := os.OpenFile(target, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, os.FileMode(header.Mode).Perm()|0600)
+			if err != nil {
+				return errors.Wrapf(err, "create file %s failed", target)
+			}
+			_, err = io.Copy(f, r)
+			if closeErr := f.Close(); err == nil {
+				err = closeErr
+			}
+			return errors.Wrapf(err, "write file %s failed", target)
+		default:
+			return errors.Errorf("unsupported entry '%s' of type %c in code package", header.Name, header.Typeflag)
+		}
+	})
+}
+
+func walkTarGz(bs []byte, fn func(header *tar.Header, r io.Reader) error) error {
+	gr, err := gzip.NewReader(bytes.NewReader(bs))
+	if err != nil {
+		return errors.Wrap(err, "not a gzip archive")
+	}
+	tr := tar.NewReader(gr)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return errors.Wrap(err, "read tar archive failed")
+		}
+		if err = fn(header, tr); err != nil {
+			return err
+		}
+	}
+}
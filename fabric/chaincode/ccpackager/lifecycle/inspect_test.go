@@ -0,0 +1,79 @@
+package lifecycle
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"testing"
+)
+
+type testFile struct {
+	name string
+	mode int64
+	body string
+}
+
+func testCodePackage(t *testing.T, files ...testFile) []byte {
+	buf := bytes.NewBuffer(nil)
+	gw := gzip.NewWriter(buf)
+	tw := tar.NewWriter(gw)
+	for _, file := range files {
+		err := tw.WriteHeader(&tar.Header{Name: file.name, Mode: file.mode, Size: int64(len(file.body)), Typeflag: tar.TypeReg})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = tw.Write([]byte(file.body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestPackageValidate(t *testing.T) {
+	valid := testCodePackage(t, testFile{name: "src/main.go", mode: 0100644, body: "package main"})
+	outsideSrc := testCodePackage(t, testFile{name: "main.go", mode: 0100644, body: "package main"})
+	badIndex := testCodePackage(t,
+		testFile{name: "src/main.go", mode: 0100644, body: "package main"},
+		testFile{name: "META-INF/statedb/couchdb/indexes/index.json", mode: 0100644, body: "{"},
+	)
+
+	tests := []struct {
+		name    string
+		ccType  string
+		code    []byte
+		isValid bool
+	}{
+		{"golang", "golang", valid, true},
+		{"golang code outside src", "golang", outsideSrc, false},
+		{"GOLANG code outside src", "GOLANG", outsideSrc, false},
+		{"type without platform", "external", outsideSrc, true},
+		{"invalid couchdb index", "golang", badIndex, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			pkgBytes, err := writeCCPackage(&PackageMetadata{Path: "example.com/cc", Type: test.ccType, Label: "cc_1"}, test.code)
+			if err != nil {
+				t.Fatal(err)
+			}
+			pkg, err := ParsePackage(pkgBytes)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = pkg.Validate()
+			if test.isValid && err != nil {
+				t.Fatalf("expected the package to be valid: %s", err)
+			}
+			if !test.isValid && err == nil {
+				t.Fatal("expected the package to be invalid")
+			}
+		})
+	}
+}
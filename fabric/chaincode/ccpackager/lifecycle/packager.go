@@ -21,6 +21,7 @@ import (
 	"github.com/feng081212/fabric-protos-go/peer"
 	"github.com/feng081212/fabric-sdk-go/fabric/bccsp/hasher"
 	"github.com/feng081212/fabric-sdk-go/fabric/chaincode/platforms"
+	"github.com/feng081212/fabric-sdk-go/fabric/chaincode/platforms/golang"
 	"github.com/pkg/errors"
 	"regexp"
 )
@@ -90,12 +91,6 @@ func NewCCPackage(desc *Descriptor) ([]byte, error) {
 }
 
 func getTarGzBytes(desc *Descriptor) ([]byte, error) {
-	payload := bytes.NewBuffer(nil)
-	gw := gzip.NewWriter(payload)
-	tw := tar.NewWriter(gw)
-	defer func() { _ = gw.Close() }()
-	defer func() { _ = tw.Close() }()
-
 	typeName := desc.Type.String()
 
 	platform := platforms.GetPlatform(typeName)
@@ -114,6 +109,22 @@ func getTarGzBytes(desc *Descriptor) ([]byte, error) {
 		Label: desc.Label,
 	}
 
+	codeBytes, err := platform.GetDeploymentPayload(desc.Path, desc.Value)
+	if err != nil {
+		return nil, errors.WithMessage(err, "error getting chaincode bytes")
+	}
+
+	return writeCCPackage(metadata, codeBytes)
+}
+
+// writeCCPackage writes the package holding the metadata and the code archive
+func writeCCPackage(metadata *PackageMetadata, codeBytes []byte) ([]byte, error) {
+	payload := bytes.NewBuffer(nil)
+	gw := gzip.NewWriter(payload)
+	tw := tar.NewWriter(gw)
+	defer func() { _ = gw.Close() }()
+	defer func() { _ = tw.Close() }()
+
 	metadataBytes, err := json.Marshal(metadata)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to marshal chaincode package metadata into JSON")
@@ -123,10 +134,6 @@ func getTarGzBytes(desc *Descriptor) ([]byte, error) {
 	if err != nil {
 		return nil, errors.Wrap(err, "error writing package metadata to tar")
 	}
-	codeBytes, err := platform.GetDeploymentPayload(desc.Path, desc.Value)
-	if err != nil {
-		return nil, errors.WithMessage(err, "error getting chaincode bytes")
-	}
 	err = writePackage(tw, codePackageName, codeBytes)
 	if err != nil {
 		return nil, errors.Wrap(err, "error writing package code bytes to tar")
@@ -167,3 +174,28 @@ func ValidateLabel(label string) error {
 
 	return nil
 }
+
+// NewGoModulePackage creates the package of module based Go chaincode without running the go
+// command, see golang.GetModuleDeploymentPayload. The package is reproducible: the same sources
+// and label always give the same package ID.
+func NewGoModulePackage(chaincodePath, label string) ([]byte, error) {
+	if err := ValidateLabel(label); err != nil {
+		return nil, err
+	}
+
+	cd, _, err := golang.DescribeModule(chaincodePath)
+	if err != nil {
+		return nil, err
+	}
+
+	codeBytes, err := golang.GetModuleDeploymentPayload(chaincodePath)
+	if err != nil {
+		return nil, errors.WithMessage(err, "error getting chaincode bytes")
+	}
+
+	return writeCCPackage(&PackageMetadata{
+		Path:  cd.Path,
+		Type:  peer.ChaincodeSpec_GOLANG.String(),
+		Label: label,
+	}, codeBytes)
+}
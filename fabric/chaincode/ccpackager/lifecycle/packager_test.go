@@ -0,0 +1,72 @@
+package lifecycle
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeTestModule writes a module without dependencies whose files have the given modification time
+func writeTestModule(t *testing.T, mtime time.Time) string {
+	dir, err := ioutil.TempDir("", "chaincode")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+
+	files := map[string]string{
+		"go.mod":                    "module example.com/chaincode\n\ngo 1.17\n",
+		"main.go":                   "package main\n\nfunc main() {}\n",
+		"contract/contract.go":      "package contract\n",
+		"contract/contract_test.go": "package contract\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err = os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err = ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err = os.Chtimes(path, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestNewGoModulePackageReproducible(t *testing.T) {
+	first, err := NewGoModulePackage(writeTestModule(t, time.Now()), "mycc_1.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := NewGoModulePackage(writeTestModule(t, time.Date(2001, 2, 3, 4, 5, 6, 0, time.UTC)), "mycc_1.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(first, second) {
+		t.Fatal("expected the same sources to give the same package")
+	}
+	if ComputePackageID("mycc_1.0", first) != ComputePackageID("mycc_1.0", second) {
+		t.Fatal("expected the same sources to give the same package ID")
+	}
+
+	pkg, err := ParsePackage(first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pkg.Metadata.Path != "example.com/chaincode" || pkg.Metadata.Label != "mycc_1.0" {
+		t.Fatalf("unexpected metadata %+v", pkg.Metadata)
+	}
+	if err = pkg.Validate(); err != nil {
+		t.Fatalf("expected the package to be valid: %s", err)
+	}
+
+	if _, err = NewGoModulePackage(writeTestModule(t, time.Now()), "my cc"); err == nil {
+		t.Fatal("expected an invalid label to be refused")
+	}
+}
@@ -0,0 +1,360 @@
+package golang
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"go/build"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// the platform the peer builds Go chaincode for, module packages only hold the files built there
+const (
+	moduleTargetGOOS   = "linux"
+	moduleTargetGOARCH = "amd64"
+)
+
+// defaultGoVersion is the language version the go command assumes when go.mod has no go directive
+const defaultGoVersion = "1.16"
+
+// ModuleRequirement is a require or a vendored module, Replacement is empty when not replaced
+type ModuleRequirement struct {
+	Path        string
+	Version     string
+	Replacement string
+}
+
+// GoModFile is the part of a go.mod needed to package a module
+type GoModFile struct {
+	Module    string
+	GoVersion string
+	Require   []*ModuleRequirement
+	// Replace maps "path" or "path version" to the replacement "path" or "path version"
+	Replace map[string]string
+}
+
+// ParseGoMod parses the module, go, require and replace directives of a go.mod
+func ParseGoMod(data []byte) (*GoModFile, error) {
+	mod := &GoModFile{Replace: make(map[string]string)}
+
+	var block string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := scanner.Text()
+		if i := strings.Index(line, "//"); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		if block != "" {
+			if fields[0] == ")" {
+				block = ""
+				continue
+			}
+			fields = append([]string{block}, fields...)
+		} else if len(fields) == 2 && fields[1] == "(" {
+			block = fields[0]
+			continue
+		}
+
+		for i := range fields {
+			fields[i] = unquoteModField(fields[i])
+		}
+
+		switch fields[0] {
+		case "module":
+			if len(fields) != 2 {
+				return nil, errors.Errorf("go.mod:%d: usage: module module/path", lineNumber)
+			}
+			mod.Module = fields[1]
+		case "go":
+			if len(fields) != 2 {
+				return nil, errors.Errorf("go.mod:%d: usage: go 1.23", lineNumber)
+			}
+			mod.GoVersion = fields[1]
+		case "require":
+			if len(fields) != 3 {
+				return nil, errors.Errorf("go.mod:%d: usage: require module/path v1.2.3", lineNumber)
+			}
+			mod.Require = append(mod.Require, &ModuleRequirement{Path: fields[1], Version: fields[2]})
+		case "replace":
+			arrow := indexOf(fields, "=>")
+			if arrow < 2 || arrow > 3 || len(fields)-arrow < 2 || len(fields)-arrow > 3 {
+				return nil, errors.Errorf("go.mod:%d: usage: replace module/path [v1.2.3] => other/module v1.4 | ../local/directory", lineNumber)
+			}
+			mod.Replace[strings.Join(fields[1:arrow], " ")] = strings.Join(fields[arrow+1:], " ")
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrap(err, "read go.mod failed")
+	}
+
+	if mod.Module == "" {
+		return nil, errors.New("go.mod has no module directive")
+	}
+	if mod.GoVersion == "" {
+		mod.GoVersion = defaultGoVersion
+	}
+	return mod, nil
+}
+
+// replacement returns the replacement of the module version, a replacement of the version wins
+// over a replacement of all the versions
+func (m *GoModFile) replacement(modulePath, version string) string {
+	if r, ok := m.Replace[modulePath+" "+version]; ok {
+		return r
+	}
+	return m.Replace[modulePath]
+}
+
+// VendoredModule is a module listed in vendor/modules.txt
+type VendoredModule struct {
+	ModuleRequirement
+	// Explicit is set for modules required by go.mod
+	Explicit bool
+	Packages []string
+}
+
+// ParseVendorModules parses a vendor/modules.txt as written by go mod vendor
+func ParseVendorModules(data []byte) ([]*VendoredModule, error) {
+	var modules []*VendoredModule
+	var current *VendoredModule
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "":
+		case strings.HasPrefix(line, "## "):
+			if current == nil {
+				return nil, errors.Errorf("vendor/modules.txt:%d: annotation without a module", lineNumber)
+			}
+			for _, annotation := range strings.Split(strings.TrimPrefix(line, "## "), ";") {
+				if strings.TrimSpace(annotation) == "explicit" {
+					current.Explicit = true
+				}
+			}
+		case strings.HasPrefix(line, "# "):
+			fields := strings.Fields(strings.TrimPrefix(line, "# "))
+			current = &VendoredModule{}
+			arrow := indexOf(fields, "=>")
+			if arrow >= 0 {
+				current.Replacement = strings.Join(fields[arrow+1:], " ")
+				fields = fields[:arrow]
+			}
+			if len(fields) == 0 || len(fields) > 2 {
+				return nil, errors.Errorf("vendor/modules.txt:%d: invalid module line", lineNumber)
+			}
+			current.Path = fields[0]
+			if len(fields) == 2 {
+				current.Version = fields[1]
+			}
+			modules = append(modules, current)
+		default:
+			if current == nil {
+				return nil, errors.Errorf("vendor/modules.txt:%d: package without a module", lineNumber)
+			}
+			current.Packages = append(current.Packages, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrap(err, "read vendor/modules.txt failed")
+	}
+	return modules, nil
+}
+
+// CheckVendorConsistency checks that vendor/modules.txt matches the requirements and replacements
+// of go.mod, like the go command does before building with -mod=vendor
+func CheckVendorConsistency(mod *GoModFile, vendored []*VendoredModule) error {
+	// lines without a version only record a replacement of all the versions, they are not vendored
+	vendoredByPath := make(map[string]*VendoredModule)
+	for _, v := range vendored {
+		if v.Version != "" {
+			vendoredByPath[v.Path] = v
+		}
+	}
+
+	required := make(map[string]bool)
+	var problems []string
+	for _, r := range mod.Require {
+		required[r.Path] = true
+		v, ok := vendoredByPath[r.Path]
+		switch {
+		case !ok:
+			problems = append(problems, fmt.Sprintf("%s@%s is required in go.mod but not vendored", r.Path, r.Version))
+		case v.Version != r.Version:
+			problems = append(problems, fmt.Sprintf("%s@%s is required in go.mod but %s is vendored", r.Path, r.Version, v.Version))
+		case !v.Explicit:
+			problems = append(problems, fmt.Sprintf("%s@%s is required in go.mod but not marked as explicit in vendor/modules.txt", r.Path, r.Version))
+		case v.Replacement != mod.replacement(r.Path, r.Version):
+			problems = append(problems, fmt.Sprintf("%s@%s is replaced by '%s' in go.mod but by '%s' in vendor/modules.txt", r.Path, r.Version, mod.replacement(r.Path, r.Version), v.Replacement))
+		}
+	}
+	for _, v := range vendored {
+		if v.Explicit && !required[v.Path] && v.Version != "" {
+			problems = append(problems, fmt.Sprintf("%s@%s is marked as explicit in vendor/modules.txt but not required in go.mod", v.Path, v.Version))
+		}
+	}
+
+	if len(problems) > 0 {
+		return errors.Errorf("inconsistent vendoring, run 'go mod vendor' to sync:\n\t%s", strings.Join(problems, "\n\t"))
+	}
+	return nil
+}
+
+// DescribeModule describes the module based chaincode at path without running the go command: the
+// module root is the closest directory holding a go.mod
+func DescribeModule(chaincodePath string) (*CodeDescriptor, *GoModFile, error) {
+	if chaincodePath == "" {
+		return nil, nil, errors.New("cannot collect files from empty chaincode path")
+	}
+	absPath, err := filepath.Abs(chaincodePath)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "failed to get absolute path of %s", chaincodePath)
+	}
+
+	root := absPath
+	for {
+		exists, err := regularFileExists(filepath.Join(root, "go.mod"))
+		if err != nil {
+			return nil, nil, err
+		}
+		if exists {
+			break
+		}
+		parent := filepath.Dir(root)
+		if parent == root {
+			return nil, nil, errors.Errorf("no go.mod found for %s", chaincodePath)
+		}
+		root = parent
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(root, "go.mod"))
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "read go.mod failed")
+	}
+	mod, err := ParseGoMod(data)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	rel, err := filepath.Rel(root, absPath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return &CodeDescriptor{
+		Module:       true,
+		MetadataRoot: filepath.Join(absPath, "META-INF"),
+		Path:         path.Join(mod.Module, filepath.ToSlash(rel)),
+		Source:       root,
+	}, mod, nil
+}
+
+// GetModuleDeploymentPayload creates the code archive of module based chaincode without a Go
+// toolchain. The dependencies must be vendored: vendor/modules.txt is checked against go.mod and
+// the vendor directory is packaged with the module. Go files are selected by the build constraints
+// of linux/amd64 with cgo, for the Go version of go.mod, and test files are left out. The archive
+// only depends on the content of the sources, so the same sources give the same package ID.
+func GetModuleDeploymentPayload(chaincodePath string) ([]byte, error) {
+	cd, mod, err := DescribeModule(chaincodePath)
+	if err != nil {
+		return nil, err
+	}
+
+	vendorData, err := ioutil.ReadFile(filepath.Join(cd.Source, "vendor", "modules.txt"))
+	switch {
+	case os.IsNotExist(err) && len(mod.Require) > 0:
+		return nil, errors.New("vendor/modules.txt not found, run 'go mod vendor' to vendor the dependencies")
+	case err != nil && !os.IsNotExist(err):
+		return nil, errors.Wrap(err, "read vendor/modules.txt failed")
+	case err == nil:
+		vendored, err := ParseVendorModules(vendorData)
+		if err != nil {
+			return nil, err
+		}
+		if err = CheckVendorConsistency(mod, vendored); err != nil {
+			return nil, err
+		}
+	}
+
+	fileMap, err := findSource(cd)
+	if err != nil {
+		return nil, err
+	}
+
+	ctxt, err := moduleBuildContext(mod.GoVersion)
+	if err != nil {
+		return nil, err
+	}
+	for name, sd := range fileMap {
+		if !strings.HasSuffix(name, ".go") {
+			continue
+		}
+		if strings.HasSuffix(name, "_test.go") {
+			delete(fileMap, name)
+			continue
+		}
+		match, err := ctxt.MatchFile(filepath.Dir(sd.Path), filepath.Base(sd.Path))
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to read build constraints of %s", sd.Path)
+		}
+		if !match {
+			delete(fileMap, name)
+		}
+	}
+
+	return writeSourcePayload(fileMap)
+}
+
+// moduleBuildContext returns the build context of the target platform, the release tags are the
+// ones of the Go version of go.mod so the selected files do not depend on the local toolchain
+func moduleBuildContext(goVersion string) (*build.Context, error) {
+	parts := strings.Split(goVersion, ".")
+	if len(parts) < 2 || parts[0] != "1" {
+		return nil, errors.Errorf("unsupported go version '%s' in go.mod", goVersion)
+	}
+	minor, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return nil, errors.Errorf("unsupported go version '%s' in go.mod", goVersion)
+	}
+
+	var releaseTags []string
+	for i := 1; i <= minor; i++ {
+		releaseTags = append(releaseTags, fmt.Sprintf("go1.%d", i))
+	}
+
+	return &build.Context{
+		GOOS:        moduleTargetGOOS,
+		GOARCH:      moduleTargetGOARCH,
+		CgoEnabled:  true,
+		Compiler:    "gc",
+		ReleaseTags: releaseTags,
+	}, nil
+}
+
+func unquoteModField(field string) string {
+	if s, err := strconv.Unquote(field); err == nil && strings.HasPrefix(field, "\"") {
+		return s
+	}
+	return field
+}
+
+func indexOf(fields []string, s string) int {
+	for i, f := range fields {
+		if f == s {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,343 @@
+package golang
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testGoMod = `module example.com/chaincode // the module
+
+go 1.17
+
+require (
+	github.com/hyperledger/fabric-chaincode-go v0.0.0-20210718160520-38d29fabecb9
+	"github.com/pkg/errors" v0.9.1
+)
+
+require golang.org/x/text v0.3.7 // indirect
+
+replace github.com/pkg/errors => ../errors
+
+replace golang.org/x/text v0.3.7 => golang.org/x/text v0.3.8
+`
+
+const testModulesTxt = `# github.com/hyperledger/fabric-chaincode-go v0.0.0-20210718160520-38d29fabecb9
+## explicit; go 1.12
+github.com/hyperledger/fabric-chaincode-go/shim
+# github.com/pkg/errors v0.9.1 => ../errors
+## explicit
+github.com/pkg/errors
+# golang.org/x/text v0.3.7 => golang.org/x/text v0.3.8
+## explicit; go 1.17
+golang.org/x/text/unicode/norm
+# github.com/pkg/errors => ../errors
+`
+
+// testModule is a module with vendored dependencies and files for other platforms, versions and
+// tests that must not be packaged
+var testModule = map[string]string{
+	"go.mod":                                 testGoMod,
+	"go.sum":                                 "",
+	"vendor/modules.txt":                     testModulesTxt,
+	"vendor/github.com/pkg/errors/errors.go": "package errors\n",
+	"vendor/github.com/hyperledger/fabric-chaincode-go/shim/shim.go": "package shim\n",
+	"vendor/golang.org/x/text/unicode/norm/norm.go":                  "package norm\n",
+	"vendor/golang.org/x/text/unicode/norm/norm_windows.go":          "package norm\n",
+	"main.go":                     "package main\n\nfunc main() {}\n",
+	"main_test.go":                "package main\n",
+	"linux.go":                    "//go:build linux\n\npackage main\n",
+	"windows.go":                  "//go:build windows\n\npackage main\n",
+	"process_darwin.go":           "package main\n",
+	"cgo.go":                      "//go:build cgo\n\npackage main\n",
+	"go117.go":                    "//go:build go1.17\n\npackage main\n",
+	"go118.go":                    "//go:build go1.18\n\npackage main\n",
+	"ignored.go":                  "// +build ignore\n\npackage main\n",
+	"contract/contract.go":        "package contract\n",
+	"contract/contract_arm64.go":  "package contract\n",
+	"contract/testdata/input.txt": "input",
+	".git/HEAD":                   "ref: refs/heads/main\n",
+}
+
+func writeTestModule(t *testing.T, files map[string]string) string {
+	dir, err := ioutil.TempDir("", "module")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err = os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err = ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+// payloadFiles returns the names of the regular files of a code archive, sorted
+func payloadFiles(t *testing.T, payload []byte) []string {
+	gr, err := gzip.NewReader(bytes.NewReader(payload))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := tar.NewReader(gr)
+	var names []string
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if header.Typeflag == tar.TypeReg {
+			names = append(names, header.Name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestParseGoMod(t *testing.T) {
+	mod, err := ParseGoMod([]byte(testGoMod))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mod.Module != "example.com/chaincode" || mod.GoVersion != "1.17" {
+		t.Fatalf("expected module example.com/chaincode with go 1.17, got %s %s", mod.Module, mod.GoVersion)
+	}
+	expected := []*ModuleRequirement{
+		{Path: "github.com/hyperledger/fabric-chaincode-go", Version: "v0.0.0-20210718160520-38d29fabecb9"},
+		{Path: "github.com/pkg/errors", Version: "v0.9.1"},
+		{Path: "golang.org/x/text", Version: "v0.3.7"},
+	}
+	if !reflect.DeepEqual(mod.Require, expected) {
+		t.Fatalf("unexpected requirements %v", mod.Require)
+	}
+	if r := mod.replacement("github.com/pkg/errors", "v0.9.1"); r != "../errors" {
+		t.Fatalf("expected the replacement of all versions, got %s", r)
+	}
+	if r := mod.replacement("golang.org/x/text", "v0.3.7"); r != "golang.org/x/text v0.3.8" {
+		t.Fatalf("expected the replacement of the version, got %s", r)
+	}
+	if r := mod.replacement("golang.org/x/text", "v0.3.6"); r != "" {
+		t.Fatalf("expected no replacement of another version, got %s", r)
+	}
+
+	mod, err = ParseGoMod([]byte("module example.com/chaincode\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mod.GoVersion != defaultGoVersion {
+		t.Fatalf("expected the default go version without a go directive, got %s", mod.GoVersion)
+	}
+
+	invalid := map[string]string{
+		"no module directive":    "go 1.17\n",
+		"module without path":    "module\n",
+		"require without path":   "module m\nrequire v1.0.0\n",
+		"replace without arrow":  "module m\nreplace a v1.0.0 b v1.0.1\n",
+		"replace without target": "module m\nreplace a =>\n",
+	}
+	for name, data := range invalid {
+		if _, err = ParseGoMod([]byte(data)); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestParseVendorModules(t *testing.T) {
+	modules, err := ParseVendorModules([]byte(testModulesTxt))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(modules) != 4 {
+		t.Fatalf("expected 4 modules, got %d", len(modules))
+	}
+	shim := modules[0]
+	if !shim.Explicit || shim.Replacement != "" || !reflect.DeepEqual(shim.Packages, []string{"github.com/hyperledger/fabric-chaincode-go/shim"}) {
+		t.Fatalf("unexpected module %+v", shim)
+	}
+	if text := modules[2]; text.Version != "v0.3.7" || text.Replacement != "golang.org/x/text v0.3.8" {
+		t.Fatalf("expected the replaced version, got %+v", text)
+	}
+	if errs := modules[3]; errs.Version != "" || errs.Explicit || errs.Replacement != "../errors" {
+		t.Fatalf("expected the replacement of all versions, got %+v", errs)
+	}
+
+	invalid := map[string]string{
+		"annotation without a module": "## explicit\n",
+		"package without a module":    "github.com/pkg/errors\n",
+		"module line without path":    "# => ../errors\n",
+	}
+	for name, data := range invalid {
+		if _, err = ParseVendorModules([]byte(data)); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestCheckVendorConsistency(t *testing.T) {
+	mod, err := ParseGoMod([]byte(testGoMod))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		modules string
+		errMsg  string
+	}{
+		{"consistent", testModulesTxt, ""},
+		{"not vendored", strings.Replace(testModulesTxt, "# github.com/hyperledger", "# github.com/other", 1),
+			"github.com/hyperledger/fabric-chaincode-go@v0.0.0-20210718160520-38d29fabecb9 is required in go.mod but not vendored"},
+		{"other version", strings.Replace(testModulesTxt, "errors v0.9.1", "errors v0.9.0", 1),
+			"github.com/pkg/errors@v0.9.1 is required in go.mod but v0.9.0 is vendored"},
+		{"not explicit", strings.Replace(testModulesTxt, "## explicit\n", "", 1),
+			"github.com/pkg/errors@v0.9.1 is required in go.mod but not marked as explicit"},
+		{"other replacement", strings.Replace(testModulesTxt, "v0.3.7 => golang.org/x/text v0.3.8", "v0.3.7", 1),
+			"golang.org/x/text@v0.3.7 is replaced by 'golang.org/x/text v0.3.8' in go.mod but by '' in vendor/modules.txt"},
+		{"explicit but not required", testModulesTxt + "# github.com/stretchr/testify v1.7.0\n## explicit\n",
+			"github.com/stretchr/testify@v1.7.0 is marked as explicit in vendor/modules.txt but not required in go.mod"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			vendored, err := ParseVendorModules([]byte(test.modules))
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = CheckVendorConsistency(mod, vendored)
+			if test.errMsg == "" {
+				if err != nil {
+					t.Fatalf("expected the vendoring to be consistent: %s", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), test.errMsg) {
+				t.Fatalf("expected an error containing [%s], got %v", test.errMsg, err)
+			}
+			if !strings.Contains(err.Error(), "run 'go mod vendor'") {
+				t.Fatalf("expected the error to tell how to fix the vendoring, got %s", err)
+			}
+		})
+	}
+}
+
+func TestDescribeModule(t *testing.T) {
+	dir := writeTestModule(t, testModule)
+
+	cd, mod, err := DescribeModule(filepath.Join(dir, "contract"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cd.Module || cd.Path != "example.com/chaincode/contract" || cd.Source != dir {
+		t.Fatalf("expected the module root and the package path, got %+v", cd)
+	}
+	if mod.Module != "example.com/chaincode" {
+		t.Fatalf("expected the go.mod of the module root, got %s", mod.Module)
+	}
+
+	if _, _, err = DescribeModule(""); err == nil {
+		t.Fatal("expected an empty path to be refused")
+	}
+}
+
+func TestGetModuleDeploymentPayload(t *testing.T) {
+	dir := writeTestModule(t, testModule)
+
+	payload, err := GetModuleDeploymentPayload(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// test files, files of other platforms or later Go versions and ignored files are left out
+	expected := []string{
+		"src/cgo.go",
+		"src/contract/contract.go",
+		"src/contract/testdata/input.txt",
+		"src/go.mod",
+		"src/go.sum",
+		"src/go117.go",
+		"src/linux.go",
+		"src/main.go",
+		"src/vendor/github.com/hyperledger/fabric-chaincode-go/shim/shim.go",
+		"src/vendor/github.com/pkg/errors/errors.go",
+		"src/vendor/golang.org/x/text/unicode/norm/norm.go",
+		"src/vendor/modules.txt",
+	}
+	if files := payloadFiles(t, payload); !reflect.DeepEqual(files, expected) {
+		t.Fatalf("unexpected files in the payload:\n%s", strings.Join(files, "\n"))
+	}
+}
+
+func TestGetModuleDeploymentPayloadReproducible(t *testing.T) {
+	dir := writeTestModule(t, testModule)
+
+	first, err := GetModuleDeploymentPayload(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the same sources with other modification times in another directory
+	other := writeTestModule(t, testModule)
+	mtime := time.Date(2001, 2, 3, 4, 5, 6, 0, time.UTC)
+	err = filepath.Walk(other, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		return os.Chtimes(path, mtime, mtime)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := GetModuleDeploymentPayload(other)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(first, second) {
+		t.Fatal("expected the same sources to give the same payload")
+	}
+}
+
+func TestGetModuleDeploymentPayloadVendoring(t *testing.T) {
+	files := make(map[string]string)
+	for name, content := range testModule {
+		files[name] = content
+	}
+
+	delete(files, "vendor/modules.txt")
+	if _, err := GetModuleDeploymentPayload(writeTestModule(t, files)); err == nil || !strings.Contains(err.Error(), "vendor/modules.txt not found") {
+		t.Fatalf("expected a module with requirements to need vendoring, got %v", err)
+	}
+
+	files["vendor/modules.txt"] = strings.Replace(testModulesTxt, "errors v0.9.1", "errors v0.9.0", 1)
+	if _, err := GetModuleDeploymentPayload(writeTestModule(t, files)); err == nil || !strings.Contains(err.Error(), "inconsistent vendoring") {
+		t.Fatalf("expected inconsistent vendoring to be refused, got %v", err)
+	}
+
+	files["go.mod"] = "module example.com/chaincode\n\ngo 2.0\n"
+	delete(files, "vendor/modules.txt")
+	if _, err := GetModuleDeploymentPayload(writeTestModule(t, files)); err == nil || !strings.Contains(err.Error(), "unsupported go version") {
+		t.Fatalf("expected an unsupported go version to be refused, got %v", err)
+	}
+
+	// a module without requirements does not need a vendor directory
+	files["go.mod"] = "module example.com/chaincode\n\ngo 1.17\n"
+	if _, err := GetModuleDeploymentPayload(writeTestModule(t, files)); err != nil {
+		t.Fatalf("expected a module without requirements to be packaged: %s", err)
+	}
+}
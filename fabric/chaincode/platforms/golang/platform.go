@@ -150,6 +150,12 @@ func (p *Platform) GetDeploymentPayload(codepath string, val interface{}) ([]byt
 		}
 	}
 
+	return writeSourcePayload(fileMap)
+}
+
+// writeSourcePayload writes the files of the map in name order, with the directories first, so
+// the same sources always give the same archive
+func writeSourcePayload(fileMap SourceMap) ([]byte, error) {
 	payload := bytes.NewBuffer(nil)
 	gw, err := gzip.NewWriterLevel(payload, gzipCompressionLevel)
 	if err != nil {
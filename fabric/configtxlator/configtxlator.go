@@ -0,0 +1,297 @@
+// Package configtxlator translates blocks, configs and config updates to JSON and back, like the
+// configtxlator tool of Fabric. Opaque bytes fields holding serialized messages, such as the value
+// of a ConfigValue or the config of an MSPConfig, are expanded into the JSON of the message they
+// hold, so the result can be read and edited.
+package configtxlator
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/feng081212/fabric-protos-go/common"
+	"github.com/golang/protobuf/proto"
+	"github.com/pkg/errors"
+	"google.golang.org/protobuf/encoding/protojson"
+	protov2 "google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+var (
+	marshalOptions   = protojson.MarshalOptions{UseProtoNames: true, EmitUnpopulated: true}
+	unmarshalOptions = protojson.UnmarshalOptions{}
+)
+
+// MarshalJSON returns the JSON of msg with all known nested messages expanded
+func MarshalJSON(msg proto.Message) ([]byte, error) {
+	obj, err := toJSONObject(proto.MessageV2(msg))
+	if err != nil {
+		return nil, err
+	}
+	return json.MarshalIndent(obj, "", "\t")
+}
+
+// UnmarshalJSON reads JSON written by MarshalJSON, possibly edited, into msg
+func UnmarshalJSON(data []byte, msg proto.Message) error {
+	obj, err := decodeJSONObject(data)
+	if err != nil {
+		return err
+	}
+	return fromJSONObject(obj, proto.MessageV2(msg))
+}
+
+// ConfigBlockToJSON returns the JSON of the channel config of a config block
+func ConfigBlockToJSON(block *common.Block) ([]byte, error) {
+	config, err := configFromBlock(block)
+	if err != nil {
+		return nil, err
+	}
+	return MarshalJSON(config)
+}
+
+// ConfigToJSON returns the JSON of a channel config
+func ConfigToJSON(config *common.Config) ([]byte, error) {
+	return MarshalJSON(config)
+}
+
+// ConfigFromJSON reads the JSON of a channel config
+func ConfigFromJSON(data []byte) (*common.Config, error) {
+	config := &common.Config{}
+	if err := UnmarshalJSON(data, config); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// ConfigUpdateToJSON returns the JSON of a config update
+func ConfigUpdateToJSON(configUpdate *common.ConfigUpdate) ([]byte, error) {
+	return MarshalJSON(configUpdate)
+}
+
+// ConfigUpdateFromJSON reads the JSON of a config update
+func ConfigUpdateFromJSON(data []byte) (*common.ConfigUpdate, error) {
+	configUpdate := &common.ConfigUpdate{}
+	if err := UnmarshalJSON(data, configUpdate); err != nil {
+		return nil, err
+	}
+	return configUpdate, nil
+}
+
+func configFromBlock(block *common.Block) (*common.Config, error) {
+	if block == nil || block.Data == nil || len(block.Data.Data) == 0 {
+		return nil, errors.New("block has no data")
+	}
+	envelope := &common.Envelope{}
+	if err := proto.Unmarshal(block.Data.Data[0], envelope); err != nil {
+		return nil, errors.Wrap(err, "unmarshal envelope failed")
+	}
+	payload := &common.Payload{}
+	if err := proto.Unmarshal(envelope.Payload, payload); err != nil {
+		return nil, errors.Wrap(err, "unmarshal payload failed")
+	}
+	configEnvelope := &common.ConfigEnvelope{}
+	if err := proto.Unmarshal(payload.Data, configEnvelope); err != nil {
+		return nil, errors.Wrap(err, "unmarshal config envelope failed")
+	}
+	if configEnvelope.Config == nil {
+		return nil, errors.New("block is not a config block")
+	}
+	return configEnvelope.Config, nil
+}
+
+func decodeJSONObject(data []byte) (map[string]interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	obj := make(map[string]interface{})
+	if err := decoder.Decode(&obj); err != nil {
+		return nil, errors.Wrap(err, "decode JSON failed")
+	}
+	return obj, nil
+}
+
+// toJSONObject converts msg to its protojson object and expands the nested messages
+func toJSONObject(msg protoreflect.ProtoMessage) (map[string]interface{}, error) {
+	data, err := marshalOptions.Marshal(msg)
+	if err != nil {
+		return nil, errors.Wrapf(err, "marshal %s failed", msg.ProtoReflect().Descriptor().FullName())
+	}
+	obj, err := decodeJSONObject(data)
+	if err != nil {
+		return nil, err
+	}
+	if err = expand(msg.ProtoReflect().Descriptor(), obj, ""); err != nil {
+		return nil, err
+	}
+	return obj, nil
+}
+
+// fromJSONObject collapses the nested messages of obj and reads it into msg
+func fromJSONObject(obj map[string]interface{}, msg protoreflect.ProtoMessage) error {
+	if err := collapse(msg.ProtoReflect().Descriptor(), obj, ""); err != nil {
+		return err
+	}
+	data, err := json.Marshal(obj)
+	if err != nil {
+		return errors.Wrap(err, "encode JSON failed")
+	}
+	if err = unmarshalOptions.Unmarshal(data, msg); err != nil {
+		return errors.Wrapf(err, "unmarshal %s failed", msg.ProtoReflect().Descriptor().FullName())
+	}
+	return nil
+}
+
+// expand replaces the base64 strings of the bytes fields holding known messages with the JSON of
+// these messages. Message fields are expanded first, so resolvers see the expanded siblings.
+func expand(md protoreflect.MessageDescriptor, obj map[string]interface{}, key string) error {
+	if err := walkMessageFields(md, obj, expand); err != nil {
+		return err
+	}
+
+	fields := md.Fields()
+	for i := 0; i < fields.Len(); i++ {
+		fd := fields.Get(i)
+		resolve, ok := resolvers[string(md.FullName())+"."+string(fd.Name())]
+		value, present := obj[string(fd.Name())]
+		if !ok || !present || fd.Kind() != protoreflect.BytesKind {
+			continue
+		}
+
+		expandOne := func(v interface{}) (interface{}, error) {
+			s, ok := v.(string)
+			if !ok {
+				return v, nil
+			}
+			msg := resolve(obj, key)
+			if msg == nil {
+				return v, nil
+			}
+			raw, err := base64.StdEncoding.DecodeString(s)
+			if err != nil {
+				return nil, errors.Wrapf(err, "decode field [%s] failed", fd.FullName())
+			}
+			if err = protov2.Unmarshal(raw, msg); err != nil {
+				return nil, errors.Wrapf(err, "unmarshal field [%s] as %s failed", fd.FullName(), msg.ProtoReflect().Descriptor().FullName())
+			}
+			return toJSONObject(msg)
+		}
+
+		expanded, err := mapValue(fd, value, expandOne)
+		if err != nil {
+			return err
+		}
+		obj[string(fd.Name())] = expanded
+	}
+	return nil
+}
+
+// collapse is the inverse of expand. The bytes fields are collapsed first, so resolvers see the
+// expanded siblings.
+func collapse(md protoreflect.MessageDescriptor, obj map[string]interface{}, key string) error {
+	fields := md.Fields()
+	for i := 0; i < fields.Len(); i++ {
+		fd := fields.Get(i)
+		resolve, ok := resolvers[string(md.FullName())+"."+string(fd.Name())]
+		value, present := obj[string(fd.Name())]
+		if !ok || !present || fd.Kind() != protoreflect.BytesKind {
+			continue
+		}
+
+		collapseOne := func(v interface{}) (interface{}, error) {
+			nested, ok := v.(map[string]interface{})
+			if !ok {
+				return v, nil
+			}
+			msg := resolve(obj, key)
+			if msg == nil {
+				return nil, errors.Errorf("field [%s] holds an object, but its message type is unknown", fd.FullName())
+			}
+			if err := fromJSONObject(nested, msg); err != nil {
+				return nil, err
+			}
+			raw, err := protov2.MarshalOptions{Deterministic: true}.Marshal(msg)
+			if err != nil {
+				return nil, errors.Wrapf(err, "marshal field [%s] failed", fd.FullName())
+			}
+			return base64.StdEncoding.EncodeToString(raw), nil
+		}
+
+		collapsed, err := mapValue(fd, value, collapseOne)
+		if err != nil {
+			return err
+		}
+		obj[string(fd.Name())] = collapsed
+	}
+
+	return walkMessageFields(md, obj, collapse)
+}
+
+// walkMessageFields calls fn for the object of every message field of obj, the key of map entries
+// is passed on to fn
+func walkMessageFields(md protoreflect.MessageDescriptor, obj map[string]interface{}, fn func(protoreflect.MessageDescriptor, map[string]interface{}, string) error) error {
+	fields := md.Fields()
+	for i := 0; i < fields.Len(); i++ {
+		fd := fields.Get(i)
+		value, ok := obj[string(fd.Name())]
+		if !ok || value == nil {
+			continue
+		}
+
+		switch {
+		case fd.IsMap():
+			if fd.MapValue().Kind() != protoreflect.MessageKind {
+				continue
+			}
+			entries, _ := value.(map[string]interface{})
+			for k, entry := range entries {
+				if nested, ok := entry.(map[string]interface{}); ok {
+					if err := fn(fd.MapValue().Message(), nested, k); err != nil {
+						return err
+					}
+				}
+			}
+		case fd.Kind() == protoreflect.MessageKind:
+			_, err := mapValue(fd, value, func(v interface{}) (interface{}, error) {
+				if nested, ok := v.(map[string]interface{}); ok {
+					return v, fn(fd.Message(), nested, "")
+				}
+				return v, nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// mapValue applies fn to the value of a field, or to each element of a repeated field
+func mapValue(fd protoreflect.FieldDescriptor, value interface{}, fn func(interface{}) (interface{}, error)) (interface{}, error) {
+	if !fd.IsList() {
+		return fn(value)
+	}
+	list, ok := value.([]interface{})
+	if !ok {
+		return value, nil
+	}
+	for i, v := range list {
+		mapped, err := fn(v)
+		if err != nil {
+			return nil, err
+		}
+		list[i] = mapped
+	}
+	return list, nil
+}
+
+// ConfigValueToJSON returns the JSON of the message held by the config value with the given key,
+// or a JSON string of the base64 encoded value if the key is unknown
+func ConfigValueToJSON(key string, value []byte) ([]byte, error) {
+	newMsg, ok := configValues[key]
+	if !ok {
+		return json.Marshal(value)
+	}
+	msg := newMsg()
+	if err := proto.Unmarshal(value, msg); err != nil {
+		return nil, errors.Wrapf(err, "unmarshal config value [%s] failed", key)
+	}
+	return MarshalJSON(msg)
+}
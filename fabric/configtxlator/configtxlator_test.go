@@ -0,0 +1,128 @@
+package configtxlator
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/feng081212/fabric-protos-go/common"
+	"github.com/golang/protobuf/proto"
+	protov2 "google.golang.org/protobuf/proto"
+)
+
+// testConfigBlock reads the genesis block of an application channel with a raft orderer and two
+// organizations using NodeOUs, anchor peers and ACLs
+func testConfigBlock(t *testing.T) *common.Block {
+	bs, err := ioutil.ReadFile(filepath.Join("testdata", "config_block.pb"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	block := &common.Block{}
+	if err = proto.Unmarshal(bs, block); err != nil {
+		t.Fatal(err)
+	}
+	return block
+}
+
+func deterministicMarshal(t *testing.T, msg proto.Message) []byte {
+	bs, err := protov2.MarshalOptions{Deterministic: true}.Marshal(proto.MessageV2(msg))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bs
+}
+
+func TestConfigBlockRoundTrip(t *testing.T) {
+	block := testConfigBlock(t)
+	config, err := configFromBlock(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ConfigBlockToJSON(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the nested messages are expanded, not left as base64
+	for _, expanded := range []string{`"consenters"`, `"anchor_peers"`, `"fabric_node_ous"`, `"acls"`, `"max_message_count"`} {
+		if !strings.Contains(string(data), expanded) {
+			t.Errorf("expected the JSON to contain %s", expanded)
+		}
+	}
+
+	decoded, err := ConfigFromJSON(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(deterministicMarshal(t, config), deterministicMarshal(t, decoded)) {
+		t.Fatal("expected the config read from its JSON to marshal to the bytes of the config of the block")
+	}
+
+	again, err := ConfigToJSON(decoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, again) {
+		t.Fatal("expected the JSON of the decoded config to be the JSON of the block")
+	}
+}
+
+func TestConfigUpdateRoundTrip(t *testing.T) {
+	config, err := configFromBlock(testConfigBlock(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	application := config.ChannelGroup.Groups["Application"]
+	update := &common.ConfigUpdate{
+		ChannelId: "mychannel",
+		ReadSet:   &common.ConfigGroup{Groups: map[string]*common.ConfigGroup{"Application": {Version: application.Version}}},
+		WriteSet:  &common.ConfigGroup{Groups: map[string]*common.ConfigGroup{"Application": application}},
+	}
+
+	data, err := ConfigUpdateToJSON(update)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := ConfigUpdateFromJSON(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(deterministicMarshal(t, update), deterministicMarshal(t, decoded)) {
+		t.Fatal("expected the config update read from its JSON to marshal to the bytes of the update")
+	}
+}
+
+func TestUnmarshalJSONEdited(t *testing.T) {
+	block := testConfigBlock(t)
+	data, err := ConfigBlockToJSON(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	edited := strings.Replace(string(data), `"max_message_count": 500`, `"max_message_count": 100`, 1)
+	if edited == string(data) {
+		t.Fatal("expected the JSON to hold the batch size of the block")
+	}
+	config, err := ConfigFromJSON([]byte(edited))
+	if err != nil {
+		t.Fatal(err)
+	}
+	value := config.ChannelGroup.Groups["Orderer"].Values["BatchSize"]
+	if !strings.Contains(string(mustJSON(t, "BatchSize", value.Value)), `"max_message_count": 100`) {
+		t.Fatal("expected the edited batch size to be marshaled into the config value")
+	}
+
+	if _, err = ConfigFromJSON([]byte(`{"channel_group": {"values": {"BatchSize": {"value": {"max_message_count": "x"}}}}}`)); err == nil {
+		t.Fatal("expected a value of the wrong type to fail")
+	}
+}
+
+func mustJSON(t *testing.T, key string, value []byte) []byte {
+	bs, err := ConfigValueToJSON(key, value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bs
+}
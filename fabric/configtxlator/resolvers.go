@@ -0,0 +1,156 @@
+package configtxlator
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/feng081212/fabric-protos-go/common"
+	"github.com/feng081212/fabric-protos-go/msp"
+	"github.com/feng081212/fabric-protos-go/orderer"
+	"github.com/feng081212/fabric-protos-go/orderer/etcdraft"
+	"github.com/feng081212/fabric-protos-go/peer"
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// resolver returns the message held by a bytes field, nil if it is unknown. obj is the JSON object
+// of the message holding the field, with expanded siblings, key is the map key of that message if
+// it is a map value.
+type resolver func(obj map[string]interface{}, key string) protoreflect.ProtoMessage
+
+// resolvers are the bytes fields holding messages, by full name of the field
+var resolvers = map[string]resolver{}
+
+// configValues are the messages of the config values, by key
+var configValues = map[string]func() proto.Message{
+	"HashingAlgorithm":          func() proto.Message { return &common.HashingAlgorithm{} },
+	"BlockDataHashingStructure": func() proto.Message { return &common.BlockDataHashingStructure{} },
+	"OrdererAddresses":          func() proto.Message { return &common.OrdererAddresses{} },
+	"Endpoints":                 func() proto.Message { return &common.OrdererAddresses{} },
+	"Consortium":                func() proto.Message { return &common.Consortium{} },
+	"Capabilities":              func() proto.Message { return &common.Capabilities{} },
+	"ChannelCreationPolicy":     func() proto.Message { return &common.Policy{} },
+	"ConsensusType":             func() proto.Message { return &orderer.ConsensusType{} },
+	"BatchSize":                 func() proto.Message { return &orderer.BatchSize{} },
+	"BatchTimeout":              func() proto.Message { return &orderer.BatchTimeout{} },
+	"KafkaBrokers":              func() proto.Message { return &orderer.KafkaBrokers{} },
+	"ChannelRestrictions":       func() proto.Message { return &orderer.ChannelRestrictions{} },
+	"MSP":                       func() proto.Message { return &msp.MSPConfig{} },
+	"AnchorPeers":               func() proto.Message { return &peer.AnchorPeers{} },
+	"ACLs":                      func() proto.Message { return &peer.ACLs{} },
+}
+
+func init() {
+	register(&common.ConfigValue{}, "value", func(obj map[string]interface{}, key string) proto.Message {
+		if newMsg, ok := configValues[key]; ok {
+			return newMsg()
+		}
+		return nil
+	})
+
+	register(&common.Policy{}, "value", func(obj map[string]interface{}, key string) proto.Message {
+		switch common.Policy_PolicyType(intField(obj, "type")) {
+		case common.Policy_SIGNATURE:
+			return &common.SignaturePolicyEnvelope{}
+		case common.Policy_IMPLICIT_META:
+			return &common.ImplicitMetaPolicy{}
+		}
+		return nil
+	})
+
+	register(&msp.MSPPrincipal{}, "principal", func(obj map[string]interface{}, key string) proto.Message {
+		switch enumField(obj, "principal_classification", msp.MSPPrincipal_Classification_value) {
+		case int32(msp.MSPPrincipal_ROLE):
+			return &msp.MSPRole{}
+		case int32(msp.MSPPrincipal_ORGANIZATION_UNIT):
+			return &msp.OrganizationUnit{}
+		case int32(msp.MSPPrincipal_IDENTITY):
+			return &msp.SerializedIdentity{}
+		}
+		return nil
+	})
+
+	register(&msp.MSPConfig{}, "config", func(obj map[string]interface{}, key string) proto.Message {
+		switch intField(obj, "type") {
+		case 0:
+			return &msp.FabricMSPConfig{}
+		case 1:
+			return &msp.IdemixMSPConfig{}
+		}
+		return nil
+	})
+
+	register(&orderer.ConsensusType{}, "metadata", func(obj map[string]interface{}, key string) proto.Message {
+		if obj["type"] == "etcdraft" {
+			return &etcdraft.ConfigMetadata{}
+		}
+		return nil
+	})
+
+	register(&common.BlockData{}, "data", func(obj map[string]interface{}, key string) proto.Message {
+		return &common.Envelope{}
+	})
+	register(&common.Envelope{}, "payload", func(obj map[string]interface{}, key string) proto.Message {
+		return &common.Payload{}
+	})
+	register(&common.Header{}, "channel_header", func(obj map[string]interface{}, key string) proto.Message {
+		return &common.ChannelHeader{}
+	})
+	register(&common.Header{}, "signature_header", func(obj map[string]interface{}, key string) proto.Message {
+		return &common.SignatureHeader{}
+	})
+	register(&common.SignatureHeader{}, "creator", func(obj map[string]interface{}, key string) proto.Message {
+		return &msp.SerializedIdentity{}
+	})
+	register(&common.Payload{}, "data", func(obj map[string]interface{}, key string) proto.Message {
+		header, _ := obj["header"].(map[string]interface{})
+		channelHeader, _ := header["channel_header"].(map[string]interface{})
+		switch common.HeaderType(intField(channelHeader, "type")) {
+		case common.HeaderType_CONFIG:
+			return &common.ConfigEnvelope{}
+		case common.HeaderType_CONFIG_UPDATE:
+			return &common.ConfigUpdateEnvelope{}
+		case common.HeaderType_ENDORSER_TRANSACTION:
+			return &peer.Transaction{}
+		}
+		return nil
+	})
+	register(&common.ConfigEnvelope{}, "last_update", func(obj map[string]interface{}, key string) proto.Message {
+		return &common.Envelope{}
+	})
+	register(&common.ConfigUpdateEnvelope{}, "config_update", func(obj map[string]interface{}, key string) proto.Message {
+		return &common.ConfigUpdate{}
+	})
+	register(&common.ConfigSignature{}, "signature_header", func(obj map[string]interface{}, key string) proto.Message {
+		return &common.SignatureHeader{}
+	})
+}
+
+func register(msg proto.Message, field string, resolve func(obj map[string]interface{}, key string) proto.Message) {
+	name := fmt.Sprintf("%s.%s", proto.MessageV2(msg).ProtoReflect().Descriptor().FullName(), field)
+	resolvers[name] = func(obj map[string]interface{}, key string) protoreflect.ProtoMessage {
+		if msg := resolve(obj, key); msg != nil {
+			return proto.MessageV2(msg)
+		}
+		return nil
+	}
+}
+
+// intField returns the value of an integer field of a JSON object, 0 if it is not set
+func intField(obj map[string]interface{}, name string) int64 {
+	switch v := obj[name].(type) {
+	case json.Number:
+		i, _ := v.Int64()
+		return i
+	case float64:
+		return int64(v)
+	}
+	return 0
+}
+
+// enumField returns the value of an enum field, which protojson writes by name
+func enumField(obj map[string]interface{}, name string, values map[string]int32) int32 {
+	if s, ok := obj[name].(string); ok {
+		return values[s]
+	}
+	return int32(intField(obj, name))
+}
@@ -1,8 +1,16 @@
 package endpoints
 
 import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
 	"fmt"
+	retry2 "github.com/feng081212/fabric-sdk-go/fabric/errors/retry"
 	status2 "github.com/feng081212/fabric-sdk-go/fabric/errors/status"
+	"google.golang.org/grpc/keepalive"
 )
 
 func ParseGrpcError(e error, g status2.Group, message ...string) error {
@@ -16,3 +24,69 @@ func ParseGrpcError(e error, g status2.Group, message ...string) error {
 	}
 	return status2.New(g, status2.ConnectionFailed.ToInt32(), msg)
 }
+
+// connectionKey identifies a cached connection by the target and everything that goes into
+// the dial options, so that endpoints with a different TLS configuration never share a connection.
+// tlsCaCerts are the DER certificates added to the CA pool, tlsCaPool identifies a pool set as
+// a whole, whose certificates cannot be listed.
+func connectionKey(target, serverName string, secured, failFast bool, keepaliveParams *keepalive.ClientParameters,
+	tlsCaCerts [][]byte, tlsCaPool string, tlsClientCerts []tls.Certificate) string {
+
+	h := sha256.New()
+	_, _ = fmt.Fprintf(h, "%s|%s|%t|%t|", target, serverName, secured, failFast)
+	if keepaliveParams != nil {
+		_, _ = fmt.Fprintf(h, "%d|%d|%t|", keepaliveParams.Time, keepaliveParams.Timeout, keepaliveParams.PermitWithoutStream)
+	}
+	if secured {
+		_, _ = fmt.Fprintf(h, "%s|", tlsCaPool)
+		for _, cert := range tlsCaCerts {
+			_, _ = fmt.Fprintf(h, "%d|", len(cert))
+			_, _ = h.Write(cert)
+		}
+		for _, cert := range tlsClientCerts {
+			for _, c := range cert.Certificate {
+				_, _ = fmt.Fprintf(h, "%d|", len(c))
+				_, _ = h.Write(c)
+			}
+		}
+	}
+	return target + "/" + hex.EncodeToString(h.Sum(nil))
+}
+
+// parsePemCertificates returns the certificates of the PEM blocks, blocks that are not
+// certificates are skipped like x509.CertPool.AppendCertsFromPEM does
+func parsePemCertificates(pemCerts []byte) []*x509.Certificate {
+	var result []*x509.Certificate
+	for len(pemCerts) > 0 {
+		var block *pem.Block
+		block, pemCerts = pem.Decode(pemCerts)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" || len(block.Headers) != 0 {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			continue
+		}
+		result = append(result, cert)
+	}
+	return result
+}
+
+type retryOptsKey struct{}
+
+// WithRetryOpts returns a context that overrides the retry options of the endpoints for the
+// requests made with it
+func WithRetryOpts(ctx context.Context, opts retry2.Opts) context.Context {
+	return context.WithValue(ctx, retryOptsKey{}, opts)
+}
+
+// retryOpts returns the retry options of the context, or the given defaults when it has none
+func retryOpts(ctx context.Context, defaults retry2.Opts) retry2.Opts {
+	if opts, ok := ctx.Value(retryOptsKey{}).(retry2.Opts); ok {
+		return opts
+	}
+	return defaults
+}
@@ -0,0 +1,112 @@
+package endpoints
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/feng081212/fabric-sdk-go/common/utils/grpcutils"
+	"google.golang.org/grpc"
+)
+
+// testCACert creates a self-signed CA certificate, certificates created with the same common name
+// only differ in their keys
+func testCACert(t *testing.T, commonName string) *x509.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: commonName},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+func toPem(cert *x509.Certificate) []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})
+}
+
+func TestConnectionKeyHashesCACertificates(t *testing.T) {
+	ca := testCACert(t, "tlsca.example.com")
+	sameSubject := testCACert(t, "tlsca.example.com")
+
+	peer := EmptyPeer().SetUrl("grpcs://peer0.example.com:7051").AddTlsCaCerts(ca)
+	samePem := EmptyPeer().SetUrl("grpcs://peer0.example.com:7051").AppendTlsCaCertsFromPEM(toPem(ca))
+	otherCA := EmptyPeer().SetUrl("grpcs://peer0.example.com:7051").AddTlsCaCerts(sameSubject)
+
+	if peer.connectionKey() != samePem.connectionKey() {
+		t.Fatal("expected peers with the same CA certificate to share the connection key")
+	}
+	if peer.connectionKey() == otherCA.connectionKey() {
+		t.Fatal("expected peers with different CA certificates of the same subject to have different connection keys")
+	}
+
+	pool := x509.NewCertPool()
+	pool.AddCert(ca)
+	withPool := EmptyPeer().SetUrl("grpcs://peer0.example.com:7051").SetTlsCaCerts(pool)
+	samePool := EmptyPeer().SetUrl("grpcs://peer0.example.com:7051").SetTlsCaCerts(pool)
+	if withPool.connectionKey() != samePool.connectionKey() {
+		t.Fatal("expected peers with the same pool to share the connection key")
+	}
+	if withPool.connectionKey() == peer.connectionKey() {
+		t.Fatal("expected a pool to be keyed apart from added certificates")
+	}
+
+	orderer := EmptyOrderer().SetUrl("grpcs://orderer.example.com:7050").AddTlsCaCerts(ca)
+	otherOrderer := EmptyOrderer().SetUrl("grpcs://orderer.example.com:7050").AddTlsCaCerts(sameSubject)
+	if orderer.connectionKey() == otherOrderer.connectionKey() {
+		t.Fatal("expected orderers with different CA certificates of the same subject to have different connection keys")
+	}
+}
+
+func TestGetConnCompletesKeepaliveBeforeKey(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := grpc.NewServer()
+	go func() { _ = server.Serve(listener) }()
+	defer server.Stop()
+
+	// a peer without keepalive parameters gets the defaults when its dial options are built
+	peer := &Peer{url: "grpc://" + listener.Addr().String()}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	first, err := peer.getConn(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer grpcutils.ReleaseConn(first)
+	second, err := peer.getConn(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer grpcutils.ReleaseConn(second)
+
+	if first != second {
+		t.Fatal("expected the first and second call to share the cached connection")
+	}
+}
@@ -0,0 +1,247 @@
+package endpoints
+
+import (
+	"context"
+	"fmt"
+	"github.com/feng081212/fabric-protos-go/common"
+	"github.com/feng081212/fabric-protos-go/ledger/rwset"
+	ab "github.com/feng081212/fabric-protos-go/orderer"
+	"github.com/feng081212/fabric-protos-go/peer"
+	"github.com/feng081212/fabric-sdk-go/common/utils/grpcutils"
+	retry2 "github.com/feng081212/fabric-sdk-go/fabric/errors/retry"
+	"github.com/feng081212/fabric-sdk-go/fabric/errors/status"
+	"github.com/pkg/errors"
+	"io"
+	"math"
+)
+
+// DeliverType selects the deliver service RPC used to stream blocks from a peer
+type DeliverType int
+
+const (
+	// DeliverBlock streams full blocks using the Deliver RPC
+	DeliverBlock DeliverType = iota
+	// DeliverFilteredBlock streams filtered blocks using the DeliverFiltered RPC
+	DeliverFilteredBlock
+	// DeliverBlockAndPrivateData streams full blocks together with the private data
+	// the peer is entitled to using the DeliverWithPrivateData RPC
+	DeliverBlockAndPrivateData
+)
+
+func (t DeliverType) String() string {
+	switch t {
+	case DeliverBlock:
+		return "Deliver"
+	case DeliverFilteredBlock:
+		return "DeliverFiltered"
+	case DeliverBlockAndPrivateData:
+		return "DeliverWithPrivateData"
+	default:
+		return fmt.Sprintf("DeliverType(%d)", int(t))
+	}
+}
+
+// SeekEnvelopeFunc creates the signed DELIVER_SEEK_INFO envelope for the given seek info.
+// It is called again for every reconnect because the start position moves forward.
+type SeekEnvelopeFunc func(seekInfo *ab.SeekInfo) (*SignedEnvelope, error)
+
+// DeliverRequest contains the parameters for streaming blocks from a peer
+type DeliverRequest struct {
+	Type DeliverType
+	// Start is the position of the first block, the newest block is used when it is nil. Once a
+	// block is received a broken stream starts again after it, but a stream that breaks before
+	// its first block starts again at Start, so with the newest block blocks committed in between
+	// are not delivered. Specify the block number to not miss any block.
+	Start *ab.SeekPosition
+	// Stop is the position of the last block, blocks are streamed until the context is done when it is nil
+	Stop *ab.SeekPosition
+	// Envelope creates the signed seek request
+	Envelope SeekEnvelopeFunc
+	// RetryOpts controls reconnecting a broken stream, retry.DefaultDeliverOpts is used when it is nil
+	RetryOpts *retry2.Opts
+}
+
+// BlockEvent is a block received from the deliver service of a peer. Depending on
+// the DeliverType either Block or FilteredBlock is set.
+type BlockEvent struct {
+	BlockNumber   uint64
+	Block         *common.Block
+	FilteredBlock *peer.FilteredBlock
+	// PrivateData maps the index of a transaction in the block to its private read-write set
+	PrivateData map[uint64]*rwset.TxPvtReadWriteSet
+	SourceURL   string
+}
+
+// deliverClient is implemented by the stream clients of all deliver RPCs
+type deliverClient interface {
+	Send(*common.Envelope) error
+	Recv() (*peer.DeliverResponse, error)
+	CloseSend() error
+}
+
+// DeliverBlocks opens a stream to the deliver service of the peer and sends the received
+// blocks on the events channel. When the stream breaks with a transient error it is opened
+// again, starting from the block after the last one received.
+// The events channel is closed when the stop position is reached, the context is done or
+// a permanent error occurs. The error, if any, is sent on the errs channel before both
+// channels are closed.
+func (p *Peer) DeliverBlocks(ctx context.Context, request *DeliverRequest) (<-chan *BlockEvent, <-chan error) {
+	events := make(chan *BlockEvent)
+	errs := make(chan error, 1)
+
+	go func() {
+		defer close(errs)
+		defer close(events)
+		if err := p.deliver(ctx, request, events); err != nil {
+			errs <- err
+		}
+	}()
+
+	return events, errs
+}
+
+func (p *Peer) deliver(ctx context.Context, request *DeliverRequest, events chan<- *BlockEvent) error {
+	if request == nil || request.Envelope == nil {
+		return errors.New("deliver request with seek envelope is required")
+	}
+	if request.Type < DeliverBlock || request.Type > DeliverBlockAndPrivateData {
+		return errors.Errorf("unsupported deliver type: %s", request.Type)
+	}
+
+	start := request.Start
+	if start == nil {
+		start = &ab.SeekPosition{Type: &ab.SeekPosition_Newest{Newest: &ab.SeekNewest{}}}
+	}
+	stop := request.Stop
+	if stop == nil {
+		stop = &ab.SeekPosition{Type: &ab.SeekPosition_Specified{Specified: &ab.SeekSpecified{Number: math.MaxUint64}}}
+	}
+
+	retryOpts := retry2.DefaultDeliverOpts
+	if request.RetryOpts != nil {
+		retryOpts = *request.RetryOpts
+	}
+	handler := retry2.NewContextHandler(retryOpts)
+
+	for {
+		seekInfo := &ab.SeekInfo{
+			Start:    start,
+			Stop:     stop,
+			Behavior: ab.SeekInfo_BLOCK_UNTIL_READY,
+		}
+
+		last, received, err := p.deliverStream(ctx, request.Type, seekInfo, request.Envelope, events)
+		if received {
+			// reconnect from the block after the last one received
+			handler = retry2.NewContextHandler(retryOpts)
+			start = &ab.SeekPosition{Type: &ab.SeekPosition_Specified{Specified: &ab.SeekSpecified{Number: last + 1}}}
+			if s := stop.GetSpecified(); s != nil && last >= s.Number {
+				return nil
+			}
+		}
+		if err == nil {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if !handler.RequiredContext(ctx, err) {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+		logger.Warnf("%s stream from [%s] broke, reconnecting: %s", request.Type, p.GetGrpcUrl(), err)
+	}
+}
+
+// deliverStream runs a single deliver stream. It returns the number of the last block sent on
+// the events channel and whether any block was sent at all.
+func (p *Peer) deliverStream(ctx context.Context, deliverType DeliverType, seekInfo *ab.SeekInfo, createEnvelope SeekEnvelopeFunc, events chan<- *BlockEvent) (last uint64, received bool, err error) {
+	envelope, err := createEnvelope(seekInfo)
+	if err != nil {
+		return 0, false, errors.WithMessage(err, "create seek envelope failed")
+	}
+
+	dialCtx, cancel := context.WithTimeout(ctx, p.GetTimeout())
+	conn, err := p.getConn(dialCtx)
+	cancel()
+	if err != nil {
+		return 0, false, ParseGrpcError(err, status.ClientStatus, p.GetGrpcUrl())
+	}
+	defer grpcutils.ReleaseConn(conn)
+
+	streamCtx, cancelStream := context.WithCancel(ctx)
+	defer cancelStream()
+
+	client, err := openDeliverClient(streamCtx, peer.NewDeliverClient(conn), deliverType)
+	if err != nil {
+		return 0, false, ParseGrpcError(err, status.ClientStatus, p.GetGrpcUrl())
+	}
+
+	err = client.Send(&common.Envelope{
+		Payload:   envelope.Payload,
+		Signature: envelope.Signature,
+	})
+	if err != nil {
+		return 0, false, ParseGrpcError(err, status.ClientStatus, p.GetGrpcUrl())
+	}
+	if err = client.CloseSend(); err != nil {
+		logger.Debugf("unable to close deliver client [%s]", err)
+	}
+
+	for {
+		response, err := client.Recv()
+		if err == io.EOF {
+			return last, received, status.New(status.ClientStatus, status.ConnectionFailed.ToInt32(), "deliver stream closed before the stop position was reached")
+		}
+		if err != nil {
+			return last, received, ParseGrpcError(err, status.ClientStatus, p.GetGrpcUrl())
+		}
+
+		var event *BlockEvent
+
+		switch t := response.Type.(type) {
+		case *peer.DeliverResponse_Status:
+			logger.Debugf("Received deliver response status from [%s]: %s", p.GetGrpcUrl(), t.Status)
+			if t.Status == common.Status_SUCCESS {
+				return last, received, nil
+			}
+			return last, received, status.New(status.EventServerStatus, int32(t.Status), fmt.Sprintf("error status from deliver service: %s", t.Status))
+		case *peer.DeliverResponse_Block:
+			event = &BlockEvent{BlockNumber: t.Block.GetHeader().GetNumber(), Block: t.Block}
+		case *peer.DeliverResponse_FilteredBlock:
+			event = &BlockEvent{BlockNumber: t.FilteredBlock.GetNumber(), FilteredBlock: t.FilteredBlock}
+		case *peer.DeliverResponse_BlockAndPrivateData:
+			event = &BlockEvent{
+				BlockNumber: t.BlockAndPrivateData.GetBlock().GetHeader().GetNumber(),
+				Block:       t.BlockAndPrivateData.GetBlock(),
+				PrivateData: t.BlockAndPrivateData.GetPrivateDataMap(),
+			}
+		default:
+			// ignore unknown types.
+			logger.Infof("unknown response type from deliver service %T", t)
+			continue
+		}
+
+		event.SourceURL = p.GetGrpcUrl()
+
+		select {
+		case events <- event:
+			last, received = event.BlockNumber, true
+		case <-ctx.Done():
+			return last, received, ctx.Err()
+		}
+	}
+}
+
+func openDeliverClient(ctx context.Context, client peer.DeliverClient, deliverType DeliverType) (deliverClient, error) {
+	switch deliverType {
+	case DeliverBlock:
+		return client.Deliver(ctx)
+	case DeliverFilteredBlock:
+		return client.DeliverFiltered(ctx)
+	default:
+		return client.DeliverWithPrivateData(ctx)
+	}
+}
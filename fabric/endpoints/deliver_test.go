@@ -0,0 +1,216 @@
+package endpoints
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/feng081212/fabric-protos-go/common"
+	ab "github.com/feng081212/fabric-protos-go/orderer"
+	"github.com/feng081212/fabric-protos-go/peer"
+	retry2 "github.com/feng081212/fabric-sdk-go/fabric/errors/retry"
+	"github.com/feng081212/fabric-sdk-go/fabric/errors/status"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	grpcstatus "google.golang.org/grpc/status"
+)
+
+// deliverResponse is a response of a scripted stream, a stream ends with err when it is set
+type deliverResponse struct {
+	block  uint64
+	status common.Status
+	err    error
+}
+
+// scriptedDeliverServer answers the n-th stream with the n-th script, streams beyond the scripts
+// fail as unavailable
+type scriptedDeliverServer struct {
+	mu      sync.Mutex
+	scripts [][]deliverResponse
+	streams int
+}
+
+func (s *scriptedDeliverServer) Deliver(peer.Deliver_DeliverServer) error {
+	return grpcstatus.Error(codes.Unimplemented, "use DeliverFiltered")
+}
+
+func (s *scriptedDeliverServer) DeliverWithPrivateData(peer.Deliver_DeliverWithPrivateDataServer) error {
+	return grpcstatus.Error(codes.Unimplemented, "use DeliverFiltered")
+}
+
+func (s *scriptedDeliverServer) DeliverFiltered(stream peer.Deliver_DeliverFilteredServer) error {
+	if _, err := stream.Recv(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	var script []deliverResponse
+	if s.streams < len(s.scripts) {
+		script = s.scripts[s.streams]
+	}
+	s.streams++
+	s.mu.Unlock()
+
+	if script == nil {
+		return grpcstatus.Error(codes.Unavailable, "no more scripts")
+	}
+	for _, response := range script {
+		var err error
+		switch {
+		case response.err != nil:
+			return response.err
+		case response.status != common.Status_UNKNOWN:
+			err = stream.Send(&peer.DeliverResponse{Type: &peer.DeliverResponse_Status{Status: response.status}})
+		default:
+			err = stream.Send(&peer.DeliverResponse{Type: &peer.DeliverResponse_FilteredBlock{
+				FilteredBlock: &peer.FilteredBlock{ChannelId: "mychannel", Number: response.block},
+			}})
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func startScriptedDeliverServer(t *testing.T, scripts ...[]deliverResponse) (*Peer, *scriptedDeliverServer) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := grpc.NewServer()
+	deliverServer := &scriptedDeliverServer{scripts: scripts}
+	peer.RegisterDeliverServer(server, deliverServer)
+	go func() { _ = server.Serve(listener) }()
+	t.Cleanup(server.Stop)
+	return EmptyPeer().SetUrl("grpc://" + listener.Addr().String()), deliverServer
+}
+
+// testDeliverRequest records the start of every stream
+func testDeliverRequest(start, stop *ab.SeekPosition, starts *[]*ab.SeekPosition) *DeliverRequest {
+	return &DeliverRequest{
+		Type:  DeliverFilteredBlock,
+		Start: start,
+		Stop:  stop,
+		Envelope: func(seekInfo *ab.SeekInfo) (*SignedEnvelope, error) {
+			*starts = append(*starts, seekInfo.Start)
+			return &SignedEnvelope{Payload: []byte("seek"), Signature: []byte("signature")}, nil
+		},
+		RetryOpts: &retry2.Opts{
+			Attempts:       3,
+			InitialBackoff: 10 * time.Millisecond,
+			MaxBackoff:     10 * time.Millisecond,
+			BackoffFactor:  1,
+			RetryableCodes: retry2.DeliverRetryableCodes,
+		},
+	}
+}
+
+func specified(number uint64) *ab.SeekPosition {
+	return &ab.SeekPosition{Type: &ab.SeekPosition_Specified{Specified: &ab.SeekSpecified{Number: number}}}
+}
+
+// collectBlocks returns the numbers of the delivered blocks and the error of the stream
+func collectBlocks(events <-chan *BlockEvent, errs <-chan error) ([]uint64, error) {
+	var numbers []uint64
+	for event := range events {
+		numbers = append(numbers, event.BlockNumber)
+	}
+	return numbers, <-errs
+}
+
+func TestDeliverBlocksReconnect(t *testing.T) {
+	unavailable := grpcstatus.Error(codes.Unavailable, "peer restarting")
+	p, server := startScriptedDeliverServer(t,
+		[]deliverResponse{{block: 5}, {block: 6}, {err: unavailable}},
+		// a stream that breaks before its first block starts again at the same block
+		[]deliverResponse{{err: unavailable}},
+		[]deliverResponse{{block: 7}, {block: 8}, {status: common.Status_SUCCESS}},
+	)
+
+	var starts []*ab.SeekPosition
+	events, errs := p.DeliverBlocks(context.Background(), testDeliverRequest(specified(5), specified(8), &starts))
+	numbers, err := collectBlocks(events, errs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(numbers) != 4 || numbers[0] != 5 || numbers[3] != 8 {
+		t.Fatalf("expected blocks 5 to 8 without gaps or duplicates, got %v", numbers)
+	}
+	if server.streams != 3 || len(starts) != 3 {
+		t.Fatalf("expected 3 streams, got %d", server.streams)
+	}
+	for i, expected := range []uint64{5, 7, 7} {
+		if n := starts[i].GetSpecified().GetNumber(); n != expected {
+			t.Errorf("expected stream %d to start at block %d, got %d", i, expected, n)
+		}
+	}
+}
+
+func TestDeliverBlocksStop(t *testing.T) {
+	// the stop block is reached when the stream breaks, no reconnect is needed
+	p, server := startScriptedDeliverServer(t,
+		[]deliverResponse{{block: 1}, {block: 2}, {err: grpcstatus.Error(codes.Unavailable, "peer restarting")}},
+	)
+
+	var starts []*ab.SeekPosition
+	events, errs := p.DeliverBlocks(context.Background(), testDeliverRequest(specified(1), specified(2), &starts))
+	numbers, err := collectBlocks(events, errs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(numbers) != 2 || server.streams != 1 {
+		t.Fatalf("expected blocks 1 and 2 from a single stream, got %v from %d streams", numbers, server.streams)
+	}
+}
+
+func TestDeliverBlocksErrorStatus(t *testing.T) {
+	p, server := startScriptedDeliverServer(t,
+		[]deliverResponse{{block: 3}, {status: common.Status_FORBIDDEN}},
+	)
+
+	var starts []*ab.SeekPosition
+	events, errs := p.DeliverBlocks(context.Background(), testDeliverRequest(specified(3), nil, &starts))
+	numbers, err := collectBlocks(events, errs)
+	if len(numbers) != 1 {
+		t.Fatalf("expected block 3 before the error, got %v", numbers)
+	}
+	s, ok := status.FromError(err)
+	if !ok || s.Group != status.EventServerStatus || s.Code != int32(common.Status_FORBIDDEN) {
+		t.Fatalf("expected the FORBIDDEN status of the deliver service, got %v", err)
+	}
+	if server.streams != 1 {
+		t.Fatalf("expected no reconnect after a permanent error, got %d streams", server.streams)
+	}
+}
+
+func TestDeliverBlocksCancelBackoff(t *testing.T) {
+	p, _ := startScriptedDeliverServer(t)
+
+	var starts []*ab.SeekPosition
+	request := testDeliverRequest(nil, nil, &starts)
+	request.RetryOpts.InitialBackoff, request.RetryOpts.MaxBackoff = time.Hour, time.Hour
+
+	ctx, cancel := context.WithCancel(context.Background())
+	events, errs := p.DeliverBlocks(ctx, request)
+	time.AfterFunc(100*time.Millisecond, cancel)
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := collectBlocks(events, errs)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != context.Canceled {
+			t.Fatalf("expected the context error, got %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("expected cancelling the context to end the backoff")
+	}
+	if len(starts) != 1 || starts[0].GetNewest() == nil {
+		t.Fatalf("expected a single stream from the newest block, got %v", starts)
+	}
+}
@@ -0,0 +1,68 @@
+package endpoints
+
+import (
+	"context"
+	"github.com/feng081212/fabric-protos-go/discovery"
+	"github.com/feng081212/fabric-sdk-go/common/utils"
+	"github.com/feng081212/fabric-sdk-go/common/utils/grpcutils"
+	retry2 "github.com/feng081212/fabric-sdk-go/fabric/errors/retry"
+	"github.com/feng081212/fabric-sdk-go/fabric/errors/status"
+	"github.com/pkg/errors"
+)
+
+// Discover sends the signed request to the discovery service of the peer
+func (p *Peer) Discover(ctx context.Context, request *discovery.SignedRequest) (*discovery.Response, error) {
+	logger.Debugf("Sending discovery request to: %s", p.GetGrpcUrl())
+
+	resp, err := retry2.RetryableInvokeContext(ctx, retryOpts(ctx, p.retryOpts),
+		func() (interface{}, error) {
+			return p.discover(ctx, request)
+		},
+	)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "discovery request to [%s] failed", p.GetGrpcUrl())
+	}
+	return resp.(*discovery.Response), nil
+}
+
+func (p *Peer) discover(ctx context.Context, request *discovery.SignedRequest) (*discovery.Response, error) {
+	ctx, cancel := context.WithTimeout(ctx, p.GetTimeout())
+	defer cancel()
+
+	conn, err := p.getConn(ctx)
+	if err != nil {
+		return nil, ParseGrpcError(err, status.DiscoveryServerStatus, p.GetGrpcUrl())
+	}
+	defer grpcutils.ReleaseConn(conn)
+
+	resp, err := discovery.NewDiscoveryClient(conn).Discover(ctx, request)
+	if err != nil {
+		return nil, ParseGrpcError(err, status.DiscoveryServerStatus, p.GetGrpcUrl())
+	}
+	return resp, nil
+}
+
+// DiscoveredPeer creates a peer for an endpoint returned by the discovery service. The new peer
+// uses the TLS client certificates, timeout, keepalive and retry options of p, the TLS server
+// name is taken from the endpoint and TLS is used if it is used for p. tlsRootCerts are the PEM
+// encoded TLS CA certificates of the peer.
+func (p *Peer) DiscoveredPeer(endpoint, mspID string, tlsRootCerts [][]byte) *Peer {
+	url := "grpc://" + endpoint
+	if utils.AttemptSecured(p.url, p.inSecure) {
+		url = "grpcs://" + endpoint
+	}
+	result := &Peer{
+		mspID:           mspID,
+		url:             url,
+		keepaliveParams: p.keepaliveParams,
+		failFast:        p.failFast,
+		inSecure:        p.inSecure,
+		timeout:         p.timeout,
+		tlsClientCerts:  p.tlsClientCerts,
+		retryOpts:       p.retryOpts,
+	}
+	for _, cert := range tlsRootCerts {
+		result.AppendTlsCaCertsFromPEM(cert)
+	}
+	return result
+}
@@ -10,6 +10,7 @@ import (
 	"context"
 	"crypto/tls"
 	"crypto/x509"
+	"fmt"
 	"github.com/feng081212/fabric-sdk-go/common/utils"
 	"github.com/feng081212/fabric-sdk-go/common/utils/grpcutils"
 	certs2 "github.com/feng081212/fabric-sdk-go/fabric/crypto/certs"
@@ -45,8 +46,12 @@ type Orderer struct {
 	failFast        bool
 	allowInsecure   bool
 	tlsCaCerts      *x509.CertPool
-	tlsClientCerts  []tls.Certificate
-	retryOpts       retry2.Opts
+	// tlsCaCertsRaw are the certificates added to tlsCaCerts, tlsCaPool is set when the pool was
+	// set as a whole, they identify the CA certificates in the connection key
+	tlsCaCertsRaw  [][]byte
+	tlsCaPool      string
+	tlsClientCerts []tls.Certificate
+	retryOpts      retry2.Opts
 }
 
 func (o *Orderer) GetTlsClientCerts() []tls.Certificate {
@@ -61,7 +66,7 @@ func (o *Orderer) URL() string {
 
 // SendBroadcast Send the created transaction to Orderer.
 func (o *Orderer) SendBroadcast(ctx context.Context, envelope *SignedEnvelope) (*common.Status, error) {
-	res, err := retry2.RetryableInvoke(o.retryOpts,
+	res, err := retry2.RetryableInvokeContext(ctx, retryOpts(ctx, o.retryOpts),
 		func() (interface{}, error) {
 			return o.sendBroadcast(ctx, envelope)
 		},
@@ -76,7 +81,7 @@ func (o *Orderer) SendBroadcast(ctx context.Context, envelope *SignedEnvelope) (
 func (o *Orderer) sendBroadcast(ctx context.Context, envelope *SignedEnvelope) (*common.Status, error) {
 	ctx, cancel := context.WithTimeout(ctx, o.GetTimeout())
 	defer cancel()
-	conn, err := grpcutils.DialContext(ctx, o.GetGrpcUrl(), o.GetGrpcOpts()...)
+	conn, err := o.getConn(ctx)
 	if err != nil {
 		return nil, ParseGrpcError(err, status.OrdererClientStatus, o.GetGrpcUrl())
 	}
@@ -144,7 +149,7 @@ func broadcastStream(broadcastClient ab.AtomicBroadcast_BroadcastClient, respons
 // blocks requested
 // envelope: contains the seek request for blocks
 func (o *Orderer) SendDeliver(ctx context.Context, envelope *SignedEnvelope) (*common.Block, error) {
-	res, err := retry2.RetryableInvoke(o.retryOpts,
+	res, err := retry2.RetryableInvokeContext(ctx, retryOpts(ctx, o.retryOpts),
 		func() (interface{}, error) {
 			return o.sendDeliver(ctx, envelope)
 		},
@@ -163,7 +168,7 @@ func (o *Orderer) sendDeliver(ctx context.Context, envelope *SignedEnvelope) (*c
 	ctx, cancel := context.WithTimeout(ctx, o.GetTimeout())
 	defer cancel()
 
-	conn, err := grpcutils.DialContext(ctx, o.GetGrpcUrl(), o.GetGrpcOpts()...)
+	conn, err := o.getConn(ctx)
 	if err != nil {
 		return nil, ParseGrpcError(err, status.OrdererClientStatus, o.GetGrpcUrl())
 	}
@@ -316,6 +321,17 @@ func (p *Orderer) GetGrpcOpts() []grpc.DialOption {
 	return p.grpcOpts
 }
 
+func (p *Orderer) connectionKey() string {
+	return connectionKey(p.GetGrpcUrl(), p.serverName, utils.AttemptSecured(p.url, p.allowInsecure), p.failFast, p.keepaliveParams, p.tlsCaCertsRaw, p.tlsCaPool, p.tlsClientCerts)
+}
+
+// getConn returns a connection from the connection cache. The dial options are built before the
+// connection key because building them completes the keepalive parameters the key depends on.
+func (p *Orderer) getConn(ctx context.Context) (*grpc.ClientConn, error) {
+	grpcOpts := p.GetGrpcOpts()
+	return grpcutils.GetConn(ctx, p.connectionKey(), p.GetGrpcUrl(), grpcOpts...)
+}
+
 func (p *Orderer) SetServerName(serverName string) *Orderer {
 	p.serverName = serverName
 	return p
@@ -362,8 +378,16 @@ func (p *Orderer) SetTimeout(timeout time.Duration) *Orderer {
 	return p
 }
 
+// SetTlsCaCerts sets the pool of the TLS CA certificates. The certificates of a pool cannot be
+// listed, so connections are only shared with endpoints using the same pool; the certificates
+// added with AddTlsCaCerts are shared by content.
 func (p *Orderer) SetTlsCaCerts(tlsCaCerts *x509.CertPool) *Orderer {
 	p.tlsCaCerts = tlsCaCerts
+	p.tlsCaCertsRaw = nil
+	p.tlsCaPool = ""
+	if tlsCaCerts != nil {
+		p.tlsCaPool = fmt.Sprintf("%p", tlsCaCerts)
+	}
 	return p
 }
 
@@ -372,6 +396,7 @@ func (p *Orderer) AddTlsCaCerts(cert *x509.Certificate) *Orderer {
 		p.tlsCaCerts = x509.NewCertPool()
 	}
 	p.tlsCaCerts.AddCert(cert)
+	p.tlsCaCertsRaw = append(p.tlsCaCertsRaw, cert.Raw)
 	return p
 }
 
@@ -383,7 +408,40 @@ func (p *Orderer) AddTlsCaCertsOfPem(caCert string) *Orderer {
 	return p
 }
 
+// AppendTlsCaCertsFromPEM adds the certificates of the PEM blocks, like
+// x509.CertPool.AppendCertsFromPEM it skips blocks that are not certificates
+func (p *Orderer) AppendTlsCaCertsFromPEM(pemCerts []byte) *Orderer {
+	for _, cert := range parsePemCertificates(pemCerts) {
+		p.AddTlsCaCerts(cert)
+	}
+	return p
+}
+
 func (p *Orderer) SetTlsClientCerts(tlsClientCerts []tls.Certificate) *Orderer {
 	p.tlsClientCerts = tlsClientCerts
 	return p
 }
+
+// ConfiguredOrderer creates an orderer for an endpoint taken from the channel config. The new
+// orderer uses the TLS client certificates, timeout, keepalive and retry options of o, the TLS
+// server name is taken from the endpoint and TLS is used if it is used for o. tlsRootCerts are
+// the PEM encoded TLS CA certificates of the orderer.
+func (o *Orderer) ConfiguredOrderer(endpoint string, tlsRootCerts [][]byte) *Orderer {
+	url := "grpc://" + endpoint
+	if utils.AttemptSecured(o.url, o.allowInsecure) {
+		url = "grpcs://" + endpoint
+	}
+	result := &Orderer{
+		url:             url,
+		keepaliveParams: o.keepaliveParams,
+		timeout:         o.timeout,
+		failFast:        o.failFast,
+		allowInsecure:   o.allowInsecure,
+		tlsClientCerts:  o.tlsClientCerts,
+		retryOpts:       o.retryOpts,
+	}
+	for _, cert := range tlsRootCerts {
+		result.AppendTlsCaCertsFromPEM(cert)
+	}
+	return result
+}
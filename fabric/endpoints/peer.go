@@ -23,6 +23,7 @@ import (
 	"time"
 
 	"crypto/x509"
+	"fmt"
 
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/keepalive"
@@ -44,8 +45,16 @@ type Peer struct {
 	timeout         time.Duration
 	grpcOpts        []grpc.DialOption
 	tlsCaCerts      *x509.CertPool
-	tlsClientCerts  []tls.Certificate
-	retryOpts       retry2.Opts
+	// tlsCaCertsRaw are the certificates added to tlsCaCerts, tlsCaPool is set when the pool was
+	// set as a whole, they identify the CA certificates in the connection key
+	tlsCaCertsRaw  [][]byte
+	tlsCaPool      string
+	tlsClientCerts []tls.Certificate
+	retryOpts      retry2.Opts
+}
+
+func (p *Peer) GetTlsClientCerts() []tls.Certificate {
+	return p.tlsClientCerts
 }
 
 // MSPID gets the Peer mspID.
@@ -114,11 +123,22 @@ func (p *Peer) GetGrpcOpts() []grpc.DialOption {
 	return p.grpcOpts
 }
 
+func (p *Peer) connectionKey() string {
+	return connectionKey(p.GetGrpcUrl(), p.serverName, utils.AttemptSecured(p.url, p.inSecure), p.failFast, p.keepaliveParams, p.tlsCaCertsRaw, p.tlsCaPool, p.tlsClientCerts)
+}
+
+// getConn returns a connection from the connection cache. The dial options are built before the
+// connection key because building them completes the keepalive parameters the key depends on.
+func (p *Peer) getConn(ctx context.Context) (*grpc.ClientConn, error) {
+	grpcOpts := p.GetGrpcOpts()
+	return grpcutils.GetConn(ctx, p.connectionKey(), p.GetGrpcUrl(), grpcOpts...)
+}
+
 // ProcessTransactionProposal sends the transaction proposal to a peer and returns the response.
 func (p *Peer) ProcessTransactionProposal(ctx context.Context, request *peer.SignedProposal) (*TransactionProposalResponse, error) {
 	logger.Debugf("Processing proposal using endorser: %s", p.GetGrpcUrl())
 
-	resp, err := retry2.RetryableInvoke(p.retryOpts,
+	resp, err := retry2.RetryableInvokeContext(ctx, retryOpts(ctx, p.retryOpts),
 		func() (interface{}, error) {
 			return p.sendProposal(ctx, request)
 		},
@@ -151,7 +171,7 @@ func (p *Peer) sendProposal(ctx context.Context, proposal *peer.SignedProposal)
 	ctx, cancel := context.WithTimeout(ctx, p.GetTimeout())
 	defer cancel()
 
-	conn, err := grpcutils.DialContext(ctx, p.GetGrpcUrl(), p.GetGrpcOpts()...)
+	conn, err := p.getConn(ctx)
 	if err != nil {
 		return nil, ParseGrpcError(err, status2.EndorserClientStatus, p.GetGrpcUrl())
 	}
@@ -259,8 +279,16 @@ func (p *Peer) SetTimeout(timeout time.Duration) *Peer {
 	return p
 }
 
+// SetTlsCaCerts sets the pool of the TLS CA certificates. The certificates of a pool cannot be
+// listed, so connections are only shared with endpoints using the same pool; the certificates
+// added with AddTlsCaCerts are shared by content.
 func (p *Peer) SetTlsCaCerts(tlsCaCerts *x509.CertPool) *Peer {
 	p.tlsCaCerts = tlsCaCerts
+	p.tlsCaCertsRaw = nil
+	p.tlsCaPool = ""
+	if tlsCaCerts != nil {
+		p.tlsCaPool = fmt.Sprintf("%p", tlsCaCerts)
+	}
 	return p
 }
 
@@ -269,6 +297,7 @@ func (p *Peer) AddTlsCaCerts(cert *x509.Certificate) *Peer {
 		p.tlsCaCerts = x509.NewCertPool()
 	}
 	p.tlsCaCerts.AddCert(cert)
+	p.tlsCaCertsRaw = append(p.tlsCaCertsRaw, cert.Raw)
 	return p
 }
 
@@ -280,6 +309,15 @@ func (p *Peer) AddTlsCaCertsOfPem(caCert string) *Peer {
 	return p
 }
 
+// AppendTlsCaCertsFromPEM adds the certificates of the PEM blocks, like
+// x509.CertPool.AppendCertsFromPEM it skips blocks that are not certificates
+func (p *Peer) AppendTlsCaCertsFromPEM(pemCerts []byte) *Peer {
+	for _, cert := range parsePemCertificates(pemCerts) {
+		p.AddTlsCaCerts(cert)
+	}
+	return p
+}
+
 func (p *Peer) SetTlsClientCerts(tlsClientCerts []tls.Certificate) *Peer {
 	p.tlsClientCerts = tlsClientCerts
 	return p
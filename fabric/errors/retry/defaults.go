@@ -38,6 +38,14 @@ const (
 	ResMgmtDefaultBackoffFactor = 2.5
 )
 
+// Block Event Service Suggested Defaults
+const (
+	// DeliverDefaultAttempts number of consecutive reconnect attempts made by default
+	DeliverDefaultAttempts = 10
+	// DeliverDefaultMaxBackoff default maximum backoff between reconnect attempts
+	DeliverDefaultMaxBackoff = 30 * time.Second
+)
+
 // DefaultOpts default retry options
 var DefaultOpts = Opts{
 	Attempts:       DefaultAttempts,
@@ -56,6 +64,15 @@ var DefaultChannelOpts = Opts{
 	RetryableCodes: ChannelClientRetryableCodes,
 }
 
+// DefaultDeliverOpts default reconnect options for the peer block event service
+var DefaultDeliverOpts = Opts{
+	Attempts:       DeliverDefaultAttempts,
+	InitialBackoff: DefaultInitialBackoff,
+	MaxBackoff:     DeliverDefaultMaxBackoff,
+	BackoffFactor:  DefaultBackoffFactor,
+	RetryableCodes: DeliverRetryableCodes,
+}
+
 // DefaultResMgmtOpts default retry options for the resource management client
 var DefaultResMgmtOpts = Opts{
 	Attempts:       ResMgmtDefaultAttempts,
@@ -157,6 +174,22 @@ var ChannelClientRetryableCodes = map[status2.Group][]status2.Code{
 	},
 }
 
+// DeliverRetryableCodes are the codes that cause a broken block event stream
+// to be re-established
+var DeliverRetryableCodes = map[status2.Group][]status2.Code{
+	status2.ClientStatus: {
+		status2.ConnectionFailed,
+	},
+	status2.EventServerStatus: {
+		status2.Code(common.Status_SERVICE_UNAVAILABLE),
+		status2.Code(common.Status_INTERNAL_SERVER_ERROR),
+	},
+	status2.GRPCTransportStatus: {
+		status2.Code(grpcCodes.Unavailable),
+		status2.Code(grpcCodes.Internal),
+	},
+}
+
 // ChannelConfigRetryableCodes error codes to be taken into account for query channel config retry
 var ChannelConfigRetryableCodes = map[status2.Group][]status2.Code{
 	status2.EndorserClientStatus: {status2.EndorsementMismatch},
@@ -7,6 +7,8 @@ SPDX-License-Identifier: Apache-2.0
 package retry
 
 import (
+	"context"
+
 	logging "github.com/feng081212/fabric-sdk-go/common/logger"
 	"github.com/feng081212/fabric-sdk-go/fabric/errors/multi"
 )
@@ -54,12 +56,23 @@ func NewInvoker(handler Handler, opts ...InvokerOpt) *RetryableInvoker {
 }
 
 func RetryableInvoke(retryOpts Opts, invocation Invocation) (interface{}, error) {
-	return NewInvokerWithRetryOpts(retryOpts).Invoke(invocation)
+	return RetryableInvokeContext(context.Background(), retryOpts, invocation)
+}
+
+// RetryableInvokeContext is RetryableInvoke with a context that bounds the retries
+func RetryableInvokeContext(ctx context.Context, retryOpts Opts, invocation Invocation) (interface{}, error) {
+	return NewInvokerWithRetryOpts(retryOpts).InvokeContext(ctx, invocation)
 }
 
 // Invoke invokes the given function and performs retries according
 // to the retry options.
 func (ri *RetryableInvoker) Invoke(invocation Invocation) (interface{}, error) {
+	return ri.InvokeContext(context.Background(), invocation)
+}
+
+// InvokeContext is Invoke with a context, no retry is attempted once the context is done and a
+// backoff in progress is cut short. The error of the last attempt is returned.
+func (ri *RetryableInvoker) InvokeContext(ctx context.Context, invocation Invocation) (interface{}, error) {
 	attemptNum := 0
 	var lastErr error
 
@@ -78,7 +91,7 @@ func (ri *RetryableInvoker) Invoke(invocation Invocation) (interface{}, error) {
 		}
 
 		logger.Debugf("Failed with err [%s] on attempt #%d. Checking if retry is warranted...", err, attemptNum)
-		if !ri.resolveRetry(err) {
+		if !ri.resolveRetry(ctx, err) {
 			if lastErr != nil && lastErr.Error() != err.Error() {
 				logger.Debugf("... retry for err [%s] is NOT warranted after %d attempt(s). Previous error [%s]", err, attemptNum, lastErr)
 			} else {
@@ -91,13 +104,13 @@ func (ri *RetryableInvoker) Invoke(invocation Invocation) (interface{}, error) {
 	}
 }
 
-func (ri *RetryableInvoker) resolveRetry(err error) bool {
+func (ri *RetryableInvoker) resolveRetry(ctx context.Context, err error) bool {
 	errs, ok := err.(multi.Errors)
 	if !ok {
 		errs = append(errs, err)
 	}
 	for _, e := range errs {
-		if ri.handler.Required(e) {
+		if required(ctx, ri.handler, e) {
 			logger.Debugf("Retrying on error %s", e)
 			if ri.beforeRetry != nil {
 				ri.beforeRetry(err)
@@ -107,3 +120,11 @@ func (ri *RetryableInvoker) resolveRetry(err error) bool {
 	}
 	return false
 }
+
+// required asks the handler whether a retry is required, with the context when it supports one
+func required(ctx context.Context, handler Handler, err error) bool {
+	if h, ok := handler.(ContextHandler); ok {
+		return h.RequiredContext(ctx, err)
+	}
+	return ctx.Err() == nil && handler.Required(err)
+}
@@ -0,0 +1,66 @@
+package retry
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/feng081212/fabric-sdk-go/fabric/errors/status"
+	grpcCodes "google.golang.org/grpc/codes"
+)
+
+func TestInvokeContextStopsBackoff(t *testing.T) {
+	opts := Opts{
+		Attempts:       3,
+		InitialBackoff: time.Minute,
+		MaxBackoff:     time.Minute,
+		BackoffFactor:  1,
+	}
+	transient := status.New(status.GRPCTransportStatus, int32(grpcCodes.Unavailable), "unavailable")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	attempts := 0
+	start := time.Now()
+	_, err := RetryableInvokeContext(ctx, opts, func() (interface{}, error) {
+		attempts++
+		return nil, transient
+	})
+
+	if err != transient {
+		t.Fatalf("expected the error of the last attempt, got %v", err)
+	}
+	if attempts != 1 {
+		t.Fatalf("expected 1 attempt, got %d", attempts)
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Fatalf("backoff was not cut short by the context, took %s", elapsed)
+	}
+}
+
+func TestInvokeContextRetries(t *testing.T) {
+	opts := Opts{
+		Attempts:       3,
+		InitialBackoff: time.Millisecond,
+		MaxBackoff:     time.Millisecond,
+		BackoffFactor:  1,
+	}
+	transient := status.New(status.GRPCTransportStatus, int32(grpcCodes.Unavailable), "unavailable")
+
+	attempts := 0
+	res, err := RetryableInvokeContext(context.Background(), opts, func() (interface{}, error) {
+		attempts++
+		if attempts < 3 {
+			return nil, transient
+		}
+		return "done", nil
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res != "done" || attempts != 3 {
+		t.Fatalf("expected success on attempt 3, got %v on attempt %d", res, attempts)
+	}
+}
@@ -14,6 +14,8 @@ SPDX-License-Identifier: Apache-2.0
 package retry
 
 import (
+	"context"
+
 	status2 "github.com/feng081212/fabric-sdk-go/fabric/errors/status"
 	"time"
 )
@@ -42,14 +44,26 @@ type Handler interface {
 	Required(err error) bool
 }
 
+// ContextHandler is a Handler whose backoff stops when the context is done
+type ContextHandler interface {
+	Handler
+	// RequiredContext is Required with a context, no retry is required once the context is done
+	RequiredContext(ctx context.Context, err error) bool
+}
+
 // impl retry Handler implementation
 type impl struct {
 	opts    Opts
 	retries int
 }
 
-// New retry Handler with the given opts
+// New retry Handler with the given opts, the handler is a ContextHandler
 func New(opts Opts) Handler {
+	return NewContextHandler(opts)
+}
+
+// NewContextHandler new retry ContextHandler with the given opts
+func NewContextHandler(opts Opts) ContextHandler {
 	if len(opts.RetryableCodes) == 0 {
 		opts.RetryableCodes = DefaultRetryableCodes
 	}
@@ -71,18 +85,30 @@ func WithAttempts(attempts int) Handler {
 // Required determines if retry is required for the given error
 // Note: backoffs are implemented behind this interface
 func (i *impl) Required(err error) bool {
-	if i.retries == i.opts.Attempts {
+	return i.RequiredContext(context.Background(), err)
+}
+
+// RequiredContext determines if retry is required for the given error, the backoff is cut short
+// and no retry is required when the context is done
+func (i *impl) RequiredContext(ctx context.Context, err error) bool {
+	if i.retries == i.opts.Attempts || ctx.Err() != nil {
 		return false
 	}
 
 	s, ok := status2.FromError(err)
-	if ok && i.isRetryable(s.Group, s.Code) {
-		time.Sleep(i.backoffPeriod())
-		i.retries++
-		return true
+	if !ok || !i.isRetryable(s.Group, s.Code) {
+		return false
 	}
 
-	return false
+	timer := time.NewTimer(i.backoffPeriod())
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+	}
+	i.retries++
+	return true
 }
 
 // backoffPeriod calculates the backoff duration based on the provided opts
@@ -0,0 +1,84 @@
+package policies
+
+import (
+	"github.com/feng081212/fabric-protos-go/common"
+	"github.com/pkg/errors"
+)
+
+// EvaluateSignaturePolicy checks that the identities satisfy the policy, the principals are
+// resolved with msps. Like on the peers, an identity that signed more than once is counted once
+// and every identity counts for at most one principal.
+func EvaluateSignaturePolicy(policy *common.SignaturePolicyEnvelope, identities []*Identity, msps MSPs) error {
+	if policy == nil || policy.Rule == nil {
+		return errors.New("signature policy is required")
+	}
+
+	identities = deduplicate(identities)
+	used := make([]bool, len(identities))
+	ok, err := evaluate(policy.Rule, policy, identities, msps, used)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errors.New("signature policy is not satisfied")
+	}
+	return nil
+}
+
+func evaluate(rule *common.SignaturePolicy, policy *common.SignaturePolicyEnvelope, identities []*Identity, msps MSPs, used []bool) (bool, error) {
+	switch t := rule.Type.(type) {
+	case *common.SignaturePolicy_NOutOf_:
+		verified := int32(0)
+		for _, r := range t.NOutOf.Rules {
+			tmp := make([]bool, len(used))
+			copy(tmp, used)
+			ok, err := evaluate(r, policy, identities, msps, tmp)
+			if err != nil {
+				return false, err
+			}
+			if ok {
+				verified++
+				copy(used, tmp)
+			}
+		}
+		return verified >= t.NOutOf.N, nil
+
+	case *common.SignaturePolicy_SignedBy:
+		if t.SignedBy < 0 || int(t.SignedBy) >= len(policy.Identities) {
+			return false, errors.Errorf("identity index %d out of range", t.SignedBy)
+		}
+		principal := policy.Identities[t.SignedBy]
+		for i, id := range identities {
+			if used[i] {
+				continue
+			}
+			ok, err := msps.SatisfiesPrincipal(id, principal)
+			if err != nil {
+				return false, err
+			}
+			if ok {
+				used[i] = true
+				return true, nil
+			}
+		}
+		return false, nil
+
+	default:
+		return false, errors.Errorf("unknown signature policy type %T", t)
+	}
+}
+
+// deduplicate removes the identities with the same MSP and certificate as an earlier one
+func deduplicate(identities []*Identity) []*Identity {
+	seen := make(map[string]bool)
+	result := make([]*Identity, 0, len(identities))
+	for _, id := range identities {
+		key := id.MSPID + "\x00" + string(id.Certificate.Raw)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		result = append(result, id)
+	}
+	return result
+}
@@ -0,0 +1,261 @@
+package policies
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/feng081212/fabric-protos-go/common"
+	"github.com/feng081212/fabric-protos-go/msp"
+	"github.com/golang/protobuf/proto"
+)
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func newTestCA(t *testing.T, name string) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return &testCA{cert: cert, key: key}
+}
+
+func (ca *testCA) pem() []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.cert.Raw})
+}
+
+// issue creates an identity of the msp with a certificate issued by the CA
+func (ca *testCA) issue(t *testing.T, mspID, commonName string, ous ...string) *Identity {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serial, _ := rand.Int(rand.Reader, big.NewInt(1<<62))
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: commonName, OrganizationalUnit: ous},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return &Identity{MSPID: mspID, Certificate: cert}
+}
+
+func identityPem(id *Identity) []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: id.Certificate.Raw})
+}
+
+func nodeOUs() *msp.FabricNodeOUs {
+	return &msp.FabricNodeOUs{
+		Enable:              true,
+		ClientOuIdentifier:  &msp.FabricOUIdentifier{OrganizationalUnitIdentifier: "client"},
+		PeerOuIdentifier:    &msp.FabricOUIdentifier{OrganizationalUnitIdentifier: "peer"},
+		AdminOuIdentifier:   &msp.FabricOUIdentifier{OrganizationalUnitIdentifier: "admin"},
+		OrdererOuIdentifier: &msp.FabricOUIdentifier{OrganizationalUnitIdentifier: "orderer"},
+	}
+}
+
+func newTestMSP(t *testing.T, config *msp.FabricMSPConfig) *MSP {
+	m, err := NewMSP(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func rolePrincipal(mspID string, role msp.MSPRole_MSPRoleType) *msp.MSPPrincipal {
+	bs, _ := proto.Marshal(&msp.MSPRole{MspIdentifier: mspID, Role: role})
+	return &msp.MSPPrincipal{PrincipalClassification: msp.MSPPrincipal_ROLE, Principal: bs}
+}
+
+func TestSatisfiesPrincipalRoles(t *testing.T) {
+	ca1 := newTestCA(t, "ca.org1.example.com")
+	ca2 := newTestCA(t, "ca.org2.example.com")
+
+	// Org1 uses NodeOUs, Org2 lists its admin certificate in the msp config
+	org1Admin := ca1.issue(t, "Org1MSP", "Admin@org1.example.com", "admin")
+	org1Peer := ca1.issue(t, "Org1MSP", "peer0.org1.example.com", "peer")
+	org1Client := ca1.issue(t, "Org1MSP", "User1@org1.example.com", "client")
+	org2Admin := ca2.issue(t, "Org2MSP", "Admin@org2.example.com")
+	org2Member := ca2.issue(t, "Org2MSP", "User1@org2.example.com", "admin")
+	forged := ca2.issue(t, "Org1MSP", "Admin@org1.example.com", "admin")
+
+	msps := MSPs{
+		"Org1MSP": newTestMSP(t, &msp.FabricMSPConfig{Name: "Org1MSP", RootCerts: [][]byte{ca1.pem()}, FabricNodeOus: nodeOUs()}),
+		"Org2MSP": newTestMSP(t, &msp.FabricMSPConfig{Name: "Org2MSP", RootCerts: [][]byte{ca2.pem()}, Admins: [][]byte{identityPem(org2Admin)}}),
+	}
+
+	tests := []struct {
+		name      string
+		identity  *Identity
+		principal *msp.MSPPrincipal
+		expected  bool
+	}{
+		{"member", org1Client, rolePrincipal("Org1MSP", msp.MSPRole_MEMBER), true},
+		{"member of another msp", org1Client, rolePrincipal("Org2MSP", msp.MSPRole_MEMBER), false},
+		{"admin by node OU", org1Admin, rolePrincipal("Org1MSP", msp.MSPRole_ADMIN), true},
+		{"client is not admin", org1Client, rolePrincipal("Org1MSP", msp.MSPRole_ADMIN), false},
+		{"peer by node OU", org1Peer, rolePrincipal("Org1MSP", msp.MSPRole_PEER), true},
+		{"client by node OU", org1Client, rolePrincipal("Org1MSP", msp.MSPRole_CLIENT), true},
+		{"peer is not client", org1Peer, rolePrincipal("Org1MSP", msp.MSPRole_CLIENT), false},
+		{"admin by admin certificate", org2Admin, rolePrincipal("Org2MSP", msp.MSPRole_ADMIN), true},
+		{"admin OU without node OUs", org2Member, rolePrincipal("Org2MSP", msp.MSPRole_ADMIN), false},
+		{"client without node OUs", org2Member, rolePrincipal("Org2MSP", msp.MSPRole_CLIENT), false},
+		{"certificate of another CA", forged, rolePrincipal("Org1MSP", msp.MSPRole_ADMIN), false},
+		{"certificate of another CA as member", forged, rolePrincipal("Org1MSP", msp.MSPRole_MEMBER), false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ok, err := msps.SatisfiesPrincipal(test.identity, test.principal)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ok != test.expected {
+				t.Fatalf("expected %t, got %t", test.expected, ok)
+			}
+		})
+	}
+}
+
+func TestSatisfiesPrincipalOrganizationUnitAndIdentity(t *testing.T) {
+	ca := newTestCA(t, "ca.org1.example.com")
+	other := newTestCA(t, "ca.other.example.com")
+	user := ca.issue(t, "Org1MSP", "User1@org1.example.com", "department1")
+	msps := MSPs{"Org1MSP": newTestMSP(t, &msp.FabricMSPConfig{Name: "Org1MSP", RootCerts: [][]byte{ca.pem()}})}
+
+	ouPrincipal := func(ou string, certifiers []byte) *msp.MSPPrincipal {
+		bs, _ := proto.Marshal(&msp.OrganizationUnit{MspIdentifier: "Org1MSP", OrganizationalUnitIdentifier: ou, CertifiersIdentifier: certifiers})
+		return &msp.MSPPrincipal{PrincipalClassification: msp.MSPPrincipal_ORGANIZATION_UNIT, Principal: bs}
+	}
+	identityPrincipal := func(id *Identity) *msp.MSPPrincipal {
+		bs, _ := proto.Marshal(&msp.SerializedIdentity{Mspid: id.MSPID, IdBytes: identityPem(id)})
+		return &msp.MSPPrincipal{PrincipalClassification: msp.MSPPrincipal_IDENTITY, Principal: bs}
+	}
+	certifiers := sha256.Sum256(ca.cert.Raw)
+	otherCertifiers := sha256.Sum256(other.cert.Raw)
+
+	tests := []struct {
+		name      string
+		principal *msp.MSPPrincipal
+		expected  bool
+	}{
+		{"organization unit", ouPrincipal("department1", nil), true},
+		{"other organization unit", ouPrincipal("department2", nil), false},
+		{"organization unit of the certifiers", ouPrincipal("department1", certifiers[:]), true},
+		{"organization unit of other certifiers", ouPrincipal("department1", otherCertifiers[:]), false},
+		{"same identity", identityPrincipal(user), true},
+		{"other identity", identityPrincipal(ca.issue(t, "Org1MSP", "User2@org1.example.com")), false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ok, err := msps.SatisfiesPrincipal(user, test.principal)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ok != test.expected {
+				t.Fatalf("expected %t, got %t", test.expected, ok)
+			}
+		})
+	}
+}
+
+func TestEvaluateSignaturePolicy(t *testing.T) {
+	ca1 := newTestCA(t, "ca.org1.example.com")
+	ca2 := newTestCA(t, "ca.org2.example.com")
+	ca3 := newTestCA(t, "ca.org3.example.com")
+	msps := MSPs{
+		"Org1MSP": newTestMSP(t, &msp.FabricMSPConfig{Name: "Org1MSP", RootCerts: [][]byte{ca1.pem()}, FabricNodeOus: nodeOUs()}),
+		"Org2MSP": newTestMSP(t, &msp.FabricMSPConfig{Name: "Org2MSP", RootCerts: [][]byte{ca2.pem()}, FabricNodeOus: nodeOUs()}),
+		"Org3MSP": newTestMSP(t, &msp.FabricMSPConfig{Name: "Org3MSP", RootCerts: [][]byte{ca3.pem()}, FabricNodeOus: nodeOUs()}),
+	}
+
+	org1Peer := ca1.issue(t, "Org1MSP", "peer0.org1.example.com", "peer")
+	org1Peer1 := ca1.issue(t, "Org1MSP", "peer1.org1.example.com", "peer")
+	org1Admin := ca1.issue(t, "Org1MSP", "Admin@org1.example.com", "admin")
+	org2Peer := ca2.issue(t, "Org2MSP", "peer0.org2.example.com", "peer")
+	org3Peer := ca3.issue(t, "Org3MSP", "peer0.org3.example.com", "peer")
+	untrusted := ca3.issue(t, "Org2MSP", "peer0.org2.example.com", "peer")
+	noNodeOU := ca2.issue(t, "Org2MSP", "peer1.org2.example.com")
+
+	tests := []struct {
+		name       string
+		policy     string
+		identities []*Identity
+		satisfied  bool
+	}{
+		{"and satisfied", "AND('Org1MSP.peer','Org2MSP.peer')", []*Identity{org1Peer, org2Peer}, true},
+		{"and missing an org", "AND('Org1MSP.peer','Org2MSP.peer')", []*Identity{org1Peer, org1Peer1}, false},
+		{"or satisfied", "OR('Org1MSP.member','Org2MSP.member')", []*Identity{org2Peer}, true},
+		{"majority satisfied", "OutOf(2,'Org1MSP.peer','Org2MSP.peer','Org3MSP.peer')", []*Identity{org3Peer, org1Peer}, true},
+		{"majority not satisfied", "OutOf(2,'Org1MSP.peer','Org2MSP.peer','Org3MSP.peer')", []*Identity{org3Peer}, false},
+		{"one identity for one principal", "AND('Org1MSP.member','Org1MSP.member')", []*Identity{org1Peer}, false},
+		{"two identities of one org", "AND('Org1MSP.member','Org1MSP.member')", []*Identity{org1Peer, org1Peer1}, true},
+		{"duplicate identity counts once", "AND('Org1MSP.member','Org1MSP.member')", []*Identity{org1Peer, org1Peer}, false},
+		{"admin role", "AND('Org1MSP.admin')", []*Identity{org1Peer, org1Admin}, true},
+		{"peer is not admin", "AND('Org1MSP.admin')", []*Identity{org1Peer}, false},
+		{"untrusted certificate", "AND('Org1MSP.peer','Org2MSP.peer')", []*Identity{org1Peer, untrusted}, false},
+		{"identity without node OU", "OR('Org2MSP.member')", []*Identity{noNodeOU}, false},
+		{"no identities", "OR('Org1MSP.member')", nil, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			policy, err := FromString(test.policy)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = EvaluateSignaturePolicy(policy, test.identities, msps)
+			if test.satisfied && err != nil {
+				t.Fatalf("expected the policy to be satisfied: %s", err)
+			}
+			if !test.satisfied && err == nil {
+				t.Fatal("expected the policy not to be satisfied")
+			}
+		})
+	}
+}
+
+func TestEvaluateSignaturePolicyErrors(t *testing.T) {
+	if err := EvaluateSignaturePolicy(nil, nil, MSPs{}); err == nil {
+		t.Fatal("expected an error for a missing policy")
+	}
+
+	outOfRange := &common.SignaturePolicyEnvelope{Rule: SignedBy(1), Identities: []*msp.MSPPrincipal{rolePrincipal("Org1MSP", msp.MSPRole_MEMBER)}}
+	ca := newTestCA(t, "ca.org1.example.com")
+	identity := ca.issue(t, "Org1MSP", "peer0.org1.example.com")
+	msps := MSPs{"Org1MSP": newTestMSP(t, &msp.FabricMSPConfig{Name: "Org1MSP", RootCerts: [][]byte{ca.pem()}})}
+	if err := EvaluateSignaturePolicy(outOfRange, []*Identity{identity}, msps); err == nil {
+		t.Fatal("expected an error for an identity index out of range")
+	}
+}
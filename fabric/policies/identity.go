@@ -0,0 +1,74 @@
+package policies
+
+import (
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/pem"
+	"github.com/feng081212/fabric-protos-go/msp"
+	"github.com/feng081212/fabric-sdk-go/fabric/bccsp"
+	"github.com/golang/protobuf/proto"
+	"github.com/pkg/errors"
+)
+
+// Identity is a deserialized msp identity
+type Identity struct {
+	MSPID       string
+	Certificate *x509.Certificate
+}
+
+// DeserializeIdentity parses a serialized msp identity holding a PEM encoded x509 certificate
+func DeserializeIdentity(serialized []byte) (*Identity, error) {
+	sid := &msp.SerializedIdentity{}
+	if err := proto.Unmarshal(serialized, sid); err != nil {
+		return nil, errors.Wrap(err, "unmarshal serialized identity failed")
+	}
+
+	block, _ := pem.Decode(sid.IdBytes)
+	if block == nil {
+		return nil, errors.Errorf("no PEM data found in identity of [%s]", sid.Mspid)
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, errors.Wrapf(err, "parse certificate of identity of [%s] failed", sid.Mspid)
+	}
+
+	return &Identity{MSPID: sid.Mspid, Certificate: cert}, nil
+}
+
+// Verify checks that signature is a low-S ECDSA signature of the SHA-256 digest of msg made with
+// the key of the identity, which is what the peers accept
+func (id *Identity) Verify(msg, signature []byte) error {
+	key, ok := id.Certificate.PublicKey.(*ecdsa.PublicKey)
+	if !ok {
+		return errors.Errorf("unsupported public key type %T of identity of [%s]", id.Certificate.PublicKey, id.MSPID)
+	}
+
+	r, s, err := bccsp.UnmarshalECDSASignature(signature)
+	if err != nil {
+		return err
+	}
+
+	lowS, err := bccsp.IsLowS(key, s)
+	if err != nil {
+		return err
+	}
+	if !lowS {
+		return errors.New("invalid S, must be smaller than half the order")
+	}
+
+	digest := sha256.Sum256(msg)
+	if !ecdsa.Verify(key, digest[:], r, s) {
+		return errors.Errorf("signature of identity of [%s] is not valid", id.MSPID)
+	}
+	return nil
+}
+
+func (id *Identity) hasOU(ou string) bool {
+	for _, v := range id.Certificate.Subject.OrganizationalUnit {
+		if v == ou {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,226 @@
+package policies
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/pem"
+
+	"github.com/feng081212/fabric-protos-go/msp"
+	"github.com/golang/protobuf/proto"
+	"github.com/pkg/errors"
+)
+
+// MSP validates identities against a Fabric msp config and resolves their roles like the msp of
+// the peers does. Revocation lists are not checked.
+type MSP struct {
+	ID         string
+	verifyOpts x509.VerifyOptions
+	// admins are the DER encoded admin certificates of the config
+	admins  [][]byte
+	nodeOUs *msp.FabricNodeOUs
+}
+
+// NewMSP creates the MSP of a Fabric msp config
+func NewMSP(config *msp.FabricMSPConfig) (*MSP, error) {
+	if config == nil || config.Name == "" {
+		return nil, errors.New("msp config with a name is required")
+	}
+
+	m := &MSP{
+		ID: config.Name,
+		verifyOpts: x509.VerifyOptions{
+			Roots:         x509.NewCertPool(),
+			Intermediates: x509.NewCertPool(),
+			KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+		},
+	}
+	for _, cert := range config.RootCerts {
+		m.verifyOpts.Roots.AppendCertsFromPEM(cert)
+	}
+	for _, cert := range config.IntermediateCerts {
+		m.verifyOpts.Intermediates.AppendCertsFromPEM(cert)
+	}
+	for _, cert := range config.Admins {
+		block, _ := pem.Decode(cert)
+		if block == nil {
+			return nil, errors.Errorf("admin certificate of msp [%s] is not PEM encoded", config.Name)
+		}
+		m.admins = append(m.admins, block.Bytes)
+	}
+	if config.FabricNodeOus != nil && config.FabricNodeOus.Enable {
+		m.nodeOUs = config.FabricNodeOus
+	}
+	return m, nil
+}
+
+// Validate checks that the identity belongs to the MSP: its certificate must chain to the root
+// certificates of the MSP and, with NodeOUs enabled, carry exactly one of the node OUs
+func (m *MSP) Validate(id *Identity) error {
+	if id.MSPID != m.ID {
+		return errors.Errorf("identity of msp [%s] is not an identity of msp [%s]", id.MSPID, m.ID)
+	}
+	if _, err := m.chain(id); err != nil {
+		return err
+	}
+	if m.nodeOUs == nil {
+		return nil
+	}
+
+	count := 0
+	for _, ou := range m.nodeOUIdentifiers() {
+		if ou != nil && id.hasOU(ou.OrganizationalUnitIdentifier) {
+			count++
+		}
+	}
+	if count != 1 {
+		return errors.Errorf("identity %s of msp [%s] must have exactly one of the node OUs, it has %d",
+			id.Certificate.Subject.CommonName, m.ID, count)
+	}
+	return nil
+}
+
+// HasRole tells if the identity, which must be valid for the MSP, has the role. Admins are the
+// identities listed as admin certificates or, with NodeOUs enabled, the ones with the admin OU.
+// CLIENT, PEER and ORDERER can only be told apart with NodeOUs enabled.
+func (m *MSP) HasRole(id *Identity, role msp.MSPRole_MSPRoleType) bool {
+	switch role {
+	case msp.MSPRole_MEMBER:
+		return true
+	case msp.MSPRole_ADMIN:
+		for _, admin := range m.admins {
+			if bytes.Equal(admin, id.Certificate.Raw) {
+				return true
+			}
+		}
+		return m.nodeOUs != nil && m.hasNodeOU(id, m.nodeOUs.AdminOuIdentifier)
+	case msp.MSPRole_CLIENT:
+		return m.nodeOUs != nil && m.hasNodeOU(id, m.nodeOUs.ClientOuIdentifier)
+	case msp.MSPRole_PEER:
+		return m.nodeOUs != nil && m.hasNodeOU(id, m.nodeOUs.PeerOuIdentifier)
+	case msp.MSPRole_ORDERER:
+		return m.nodeOUs != nil && m.hasNodeOU(id, m.nodeOUs.OrdererOuIdentifier)
+	default:
+		return false
+	}
+}
+
+// HasOU tells if the identity, which must be valid for the MSP, has the organizational unit.
+// When the unit names a certifiers identifier, the CA chain of the certificate must hash to it.
+func (m *MSP) HasOU(id *Identity, ou *msp.OrganizationUnit) bool {
+	if !id.hasOU(ou.OrganizationalUnitIdentifier) {
+		return false
+	}
+	if len(ou.CertifiersIdentifier) == 0 {
+		return true
+	}
+	chain, err := m.chain(id)
+	if err != nil {
+		return false
+	}
+	return bytes.Equal(certifiersIdentifier(chain), ou.CertifiersIdentifier)
+}
+
+func (m *MSP) hasNodeOU(id *Identity, ou *msp.FabricOUIdentifier) bool {
+	if ou == nil || ou.OrganizationalUnitIdentifier == "" {
+		return false
+	}
+	if !id.hasOU(ou.OrganizationalUnitIdentifier) {
+		return false
+	}
+	if len(ou.Certificate) == 0 {
+		return true
+	}
+	// the OU is restricted to the identities issued by the certificate
+	block, _ := pem.Decode(ou.Certificate)
+	if block == nil {
+		return false
+	}
+	chain, err := m.chain(id)
+	if err != nil {
+		return false
+	}
+	for _, cert := range chain[1:] {
+		if bytes.Equal(cert.Raw, block.Bytes) {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *MSP) nodeOUIdentifiers() []*msp.FabricOUIdentifier {
+	return []*msp.FabricOUIdentifier{
+		m.nodeOUs.ClientOuIdentifier,
+		m.nodeOUs.PeerOuIdentifier,
+		m.nodeOUs.AdminOuIdentifier,
+		m.nodeOUs.OrdererOuIdentifier,
+	}
+}
+
+// chain returns the certificate chain of the identity, from its certificate to a root certificate
+func (m *MSP) chain(id *Identity) ([]*x509.Certificate, error) {
+	chains, err := id.Certificate.Verify(m.verifyOpts)
+	if err != nil {
+		return nil, errors.Wrapf(err, "certificate of %s is not issued by msp [%s]", id.Certificate.Subject.CommonName, m.ID)
+	}
+	return chains[0], nil
+}
+
+// certifiersIdentifier is the SHA-256 hash of the CA certificates of the chain, the identifier
+// an msp computes for the certifiers of an organizational unit
+func certifiersIdentifier(chain []*x509.Certificate) []byte {
+	h := sha256.New()
+	for _, cert := range chain[1:] {
+		_, _ = h.Write(cert.Raw)
+	}
+	return h.Sum(nil)
+}
+
+// MSPs are the MSPs of a channel by MSP ID
+type MSPs map[string]*MSP
+
+// Validate checks that the identity is valid for its MSP
+func (m MSPs) Validate(id *Identity) error {
+	mspDef, ok := m[id.MSPID]
+	if !ok {
+		return errors.Errorf("msp [%s] of identity %s is not part of the channel", id.MSPID, id.Certificate.Subject.CommonName)
+	}
+	return mspDef.Validate(id)
+}
+
+// SatisfiesPrincipal tells if the identity matches the principal. Roles and organizational units
+// are resolved with the MSP of the identity, identities that are not valid for their MSP match
+// no principal.
+func (m MSPs) SatisfiesPrincipal(id *Identity, principal *msp.MSPPrincipal) (bool, error) {
+	switch principal.PrincipalClassification {
+	case msp.MSPPrincipal_ROLE:
+		role := &msp.MSPRole{}
+		if err := proto.Unmarshal(principal.Principal, role); err != nil {
+			return false, errors.Wrap(err, "unmarshal msp role failed")
+		}
+		if role.MspIdentifier != id.MSPID || m.Validate(id) != nil {
+			return false, nil
+		}
+		return m[id.MSPID].HasRole(id, role.Role), nil
+
+	case msp.MSPPrincipal_ORGANIZATION_UNIT:
+		ou := &msp.OrganizationUnit{}
+		if err := proto.Unmarshal(principal.Principal, ou); err != nil {
+			return false, errors.Wrap(err, "unmarshal organization unit failed")
+		}
+		if ou.MspIdentifier != id.MSPID || m.Validate(id) != nil {
+			return false, nil
+		}
+		return m[id.MSPID].HasOU(id, ou), nil
+
+	case msp.MSPPrincipal_IDENTITY:
+		other, err := DeserializeIdentity(principal.Principal)
+		if err != nil {
+			return false, err
+		}
+		return other.MSPID == id.MSPID && bytes.Equal(other.Certificate.Raw, id.Certificate.Raw), nil
+
+	default:
+		return false, errors.Errorf("unsupported principal classification %s", principal.PrincipalClassification)
+	}
+}